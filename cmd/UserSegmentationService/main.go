@@ -3,102 +3,119 @@ package main
 
 import (
 	"context"
-	"database/sql"
-	"log"
-	"net/http"
+	"encoding/json"
+	"fmt"
+	"log/slog"
 	"os"
 	"os/signal"
+	"slices"
+	"strings"
 	"syscall"
-	"time"
 
-	_ "github.com/lib/pq"
 	"github.com/pressly/goose/v3"
 
-	"github.com/go-chi/chi/v5"
-	"github.com/go-chi/chi/v5/middleware"
-	"github.com/jackc/pgx/v5/pgxpool"
-
-	"github.com/RaikyD/UserSegmentationService/internal/handler"
-	"github.com/RaikyD/UserSegmentationService/internal/service"
-	"github.com/RaikyD/UserSegmentationService/internal/storage"
+	"github.com/RaikyD/UserSegmentationService/internal/buildinfo"
+	"github.com/RaikyD/UserSegmentationService/internal/config"
+	"github.com/RaikyD/UserSegmentationService/internal/logging"
+	"github.com/RaikyD/UserSegmentationService/internal/migrate"
 )
 
+const usage = `Usage: UserSegmentationService [command]
+
+Commands:
+  serve                          run the HTTP server (default)
+  migrate up|down|status|redo    manage the database schema
+  version                        print build information
+`
+
+// fatal пишет ошибку запуска и завершает процесс.
+func fatal(logger *slog.Logger, msg string, args ...any) {
+	logger.Error(msg, args...)
+	os.Exit(1)
+}
+
+// badUsage печатает справку и завершает процесс с кодом 2.
+func badUsage(msg string) {
+	fmt.Fprintf(os.Stderr, "%s\n\n%s", msg, usage)
+	os.Exit(2)
+}
+
 func main() {
-	// 1. Конфиг из env
-	dsn := os.Getenv("DATABASE_URL")
-	if dsn == "" {
-		log.Fatal("DATABASE_URL is required")
+	// Без аргументов запускается сервер, как и до появления команд.
+	command, args := "serve", os.Args[1:]
+	if len(args) > 0 {
+		command, args = args[0], args[1:]
 	}
-	port := os.Getenv("HTTP_PORT")
-	if port == "" {
-		port = "8080"
+
+	switch command {
+	case "help", "-h", "--help":
+		fmt.Print(usage)
+		return
+	case "version":
+		if err := json.NewEncoder(os.Stdout).Encode(buildinfo.Get()); err != nil {
+			os.Exit(1)
+		}
+		return
+	case "serve":
+		if len(args) > 0 {
+			badUsage("serve takes no arguments")
+		}
+	case "migrate":
+		if len(args) != 1 || !slices.Contains(migrate.Commands, args[0]) {
+			badUsage("migrate expects one of: " + strings.Join(migrate.Commands, ", "))
+		}
+	default:
+		badUsage("unknown command " + command)
 	}
 
-	sqlDB, err := sql.Open("postgres", dsn)
+	// 0. Конфиг: умолчания, файл из CONFIG_FILE, env
+	cfg, err := config.Load()
 	if err != nil {
-		log.Fatalf("sql open: %v", err)
+		fatal(slog.Default(), "invalid config", "error", err)
 	}
-	defer sqlDB.Close()
 
-	if err := goose.SetDialect("postgres"); err != nil {
-		log.Fatalf("goose dialect: %v", err)
+	// 1. Логгер: всё остальное пишет через него
+	logger, err := logging.New(os.Stderr, cfg.Log.Level, cfg.Log.Format)
+	if err != nil {
+		fatal(slog.Default(), "logger setup failed", "error", err)
 	}
+	slog.SetDefault(logger)
+	goose.SetLogger(slogGooseLogger{logger})
+	logger.Info("effective config", "config", cfg)
 
-	if err := goose.Up(sqlDB, "migrations"); err != nil {
-		log.Fatalf("goose up: %v", err)
+	if command == "migrate" {
+		runMigrate(cfg, logger, args[0])
+		return
 	}
+	serve(cfg, logger)
+}
 
-	pool, err := pgxpool.New(context.Background(), dsn)
+// runMigrate выполняет команду migrate и завершает процесс с ошибкой, если она
+// не удалась. SIGINT/SIGTERM прерывают ожидание блокировки и текущую миграцию.
+func runMigrate(cfg config.Config, logger *slog.Logger, command string) {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	db, err := migrate.Open(cfg.Database.URL)
 	if err != nil {
-		log.Fatalf("db connect: %v", err)
+		fatal(logger, "db open failed", "error", err)
 	}
-	defer pool.Close()
-
-	segRepo := storage.NewSegmentDB(pool)
-	userSegRepo := storage.NewUserDB(pool)
-
-	segSvc := service.NewSegmentService(segRepo)
-	userSegSvc := service.NewUserSegmentService(segRepo, userSegRepo)
-
-	segHandler := handler.NewSegmentHandler(segSvc)
-	userSegHandler := handler.NewUserSegmentHandler(userSegSvc)
-
-	r := chi.NewRouter()
-	r.Use(
-		middleware.RequestID,
-		middleware.RealIP,
-		middleware.Logger,
-		middleware.Recoverer,
-		middleware.Timeout(10*time.Second),
-	)
-
-	r.Route("/segments", func(r chi.Router) {
-		segHandler.Register(r)
-	})
+	defer db.Close()
 
-	userSegHandler.Register(r)
-
-	srv := &http.Server{
-		Addr:    ":" + port,
-		Handler: r,
+	if err := migrate.Run(ctx, db, command, logger); err != nil {
+		fatal(logger, "migrate "+command+" failed", "error", err)
 	}
+}
 
-	go func() {
-		log.Printf("Server listening on :%s", port)
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("HTTP server error: %v", err)
-		}
-	}()
+// slogGooseLogger передаёт сообщения goose в общий логгер.
+type slogGooseLogger struct {
+	log *slog.Logger
+}
 
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-	<-quit
-	log.Println("Shutting down")
+func (l slogGooseLogger) Printf(format string, v ...any) {
+	l.log.Info(strings.TrimSpace(fmt.Sprintf(format, v...)), "component", "goose")
+}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-	if err := srv.Shutdown(ctx); err != nil {
-		log.Fatalf("Server forced shutdown: %v", err)
-	}
-	log.Println("Server stopped")
+func (l slogGooseLogger) Fatalf(format string, v ...any) {
+	fatal(l.log, strings.TrimSpace(fmt.Sprintf(format, v...)), "component", "goose")
 }
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"context"
+	"expvar"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/cors"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/RaikyD/UserSegmentationService/internal/auth"
+	"github.com/RaikyD/UserSegmentationService/internal/config"
+	"github.com/RaikyD/UserSegmentationService/internal/handler"
+	"github.com/RaikyD/UserSegmentationService/internal/health"
+	"github.com/RaikyD/UserSegmentationService/internal/jobs"
+	"github.com/RaikyD/UserSegmentationService/internal/logging"
+	"github.com/RaikyD/UserSegmentationService/internal/metrics"
+	"github.com/RaikyD/UserSegmentationService/internal/migrate"
+	"github.com/RaikyD/UserSegmentationService/internal/service"
+	"github.com/RaikyD/UserSegmentationService/internal/storage"
+	"github.com/RaikyD/UserSegmentationService/internal/tracing"
+	"github.com/RaikyD/UserSegmentationService/internal/worker"
+)
+
+// serve запускает HTTP-сервер и фоновые воркеры и работает до SIGINT/SIGTERM.
+func serve(cfg config.Config, logger *slog.Logger) {
+	shutdownTracing, err := tracing.Setup(context.Background())
+	if err != nil {
+		fatal(logger, "tracing setup failed", "error", err)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.HTTP.ShutdownTimeout)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			logger.Error("tracing shutdown failed", "error", err)
+		}
+	}()
+
+	poolConfig, err := pgxpool.ParseConfig(cfg.Database.URL)
+	if err != nil {
+		fatal(logger, "db config failed", "error", err)
+	}
+	poolConfig.MinConns = cfg.Database.MinConns
+	poolConfig.MaxConns = cfg.Database.MaxConns
+	poolConfig.MaxConnLifetime = cfg.Database.MaxConnLifetime
+	poolConfig.MaxConnIdleTime = cfg.Database.MaxConnIdleTime
+	poolConfig.ConnConfig.Tracer = tracing.QueryTracer{}
+	pool, err := pgxpool.NewWithConfig(context.Background(), poolConfig)
+	if err != nil {
+		fatal(logger, "db connect failed", "error", err)
+	}
+	defer pool.Close()
+	metrics.RegisterPool(pool)
+
+	if cfg.Migrations.Auto {
+		if err := migrateOnBoot(cfg, logger); err != nil {
+			fatal(logger, "migrate up failed", "error", err)
+		}
+	} else {
+		logger.Info("auto-migrate is disabled, only checking schema version")
+	}
+	latestMigration, err := migrate.Latest()
+	if err != nil {
+		fatal(logger, "collect migrations failed", "error", err)
+	}
+	checker := health.NewChecker(cfg.HTTP.HealthCheckTimeout)
+	checker.Critical("database", health.Database(pool))
+	checker.Critical("migrations", health.Migrations(pool, latestMigration))
+
+	workersCtx, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+
+	var segRepo storage.SegmentRepository = storage.NewSegmentDB(pool)
+	if cfg.SegmentCache.Size > 0 {
+		segCache := storage.NewSegmentCache(segRepo, cfg.SegmentCache.TTL, cfg.SegmentCache.Size, logger)
+		expvar.Publish("segment_cache", expvar.Func(func() any { return segCache.Stats() }))
+		metrics.RegisterSegmentCache(segCache)
+		go segCache.Listen(workersCtx, pool)
+		segRepo = segCache
+	}
+	userSegRepo := storage.NewUserDB(pool)
+	userRepo := storage.NewUserProfileDB(pool)
+
+	var authn *auth.Authenticator
+	if cfg.Auth.Disabled {
+		logger.Warn("authentication is disabled, every request gets all roles")
+	} else {
+		var jwtVerifier *auth.JWTVerifier
+		if cfg.Auth.JWKSFile != "" || cfg.Auth.JWTPublicKeyFile != "" {
+			jwtVerifier, err = auth.NewJWTVerifier(auth.JWTConfig{
+				JWKSFile:       cfg.Auth.JWKSFile,
+				PublicKeyFile:  cfg.Auth.JWTPublicKeyFile,
+				Issuer:         cfg.Auth.JWTIssuer,
+				Audience:       cfg.Auth.JWTAudience,
+				RolesClaim:     cfg.Auth.JWTRolesClaim,
+				TenantClaim:    cfg.Auth.JWTTenantClaim,
+				PlatformTenant: cfg.Auth.JWTPlatformTenant,
+			})
+			if err != nil {
+				fatal(logger, "jwt setup failed", "error", err)
+			}
+		}
+		authn = auth.NewAuthenticator(storage.NewAPIKeyDB(pool), jwtVerifier)
+	}
+
+	segSvc := service.NewTracedSegmentService(service.NewSegmentService(segRepo))
+	userSvc := service.NewUserService(userRepo)
+	tenantSvc := service.NewTenantService(storage.NewTenantDB(pool))
+	// Воркеры работают с сервисом без обёртки: их проходы не относятся ни к одному
+	// запросу и засоряли бы трассировку.
+	userSegCore := service.NewUserSegmentService(segRepo, userSegRepo, userSvc, logger)
+	userSegSvc := service.NewTracedUserSegmentService(userSegCore)
+
+	workers := cfg.Workers
+	if workers.ExpirySweeper.Enabled {
+		sweeper := worker.NewExpirySweeper(userSegRepo, workers.ExpirySweeper.Interval, workers.ExpirySweeper.Batch, logger)
+		expvar.Publish("expiry_sweeper", expvar.Func(func() any { return sweeper.Stats() }))
+		checker.Degraded("expiry_sweeper", health.Worker(sweeper))
+		go sweeper.Run(workersCtx)
+	}
+
+	if workers.SegmentScheduler.Enabled {
+		scheduler := worker.NewSegmentScheduler(segRepo, workers.SegmentScheduler.Interval, logger)
+		expvar.Publish("segment_scheduler", expvar.Func(func() any { return scheduler.Stats() }))
+		checker.Degraded("segment_scheduler", health.Worker(scheduler))
+		go scheduler.Run(workersCtx)
+	}
+
+	if workers.MemberCounter.Enabled {
+		memberCounter := worker.NewMemberCounter(segRepo, userSegCore, workers.MemberCounter.Interval, logger)
+		expvar.Publish("member_counter", expvar.Func(func() any { return memberCounter.Stats() }))
+		checker.Degraded("member_counter", health.Worker(memberCounter))
+		go memberCounter.Run(workersCtx)
+	}
+
+	// Состояние задач хранится в БД и видно всем репликам, файлы отчётов — в
+	// REPORTS_DIR, который у нескольких реплик должен быть общим томом.
+	jobManager := jobs.NewManager(workersCtx, storage.NewJobDB(pool), cfg.Files.JobRetention, logger)
+	reportSvc, err := service.NewReportService(userSegRepo, jobManager, cfg.Files.ReportsDir, cfg.Files.JobRetention)
+	if err != nil {
+		fatal(logger, "reports setup failed", "error", err)
+	}
+	importSvc, err := service.NewImportService(segRepo, userSegRepo, jobManager, cfg.Files.ImportsDir)
+	if err != nil {
+		fatal(logger, "imports setup failed", "error", err)
+	}
+
+	segHandler := handler.NewSegmentHandler(segSvc)
+	userHandler := handler.NewUserHandler(userSvc)
+	userSegHandler := handler.NewUserSegmentHandler(userSegSvc)
+	reportHandler := handler.NewReportHandler(reportSvc)
+	importHandler := handler.NewImportHandler(importSvc, segSvc)
+	tenantHandler := handler.NewTenantHandler(tenantSvc)
+	healthHandler := handler.NewHealthHandler(checker)
+
+	r := chi.NewRouter()
+	r.Use(
+		middleware.RequestID,
+		middleware.RealIP,
+		tracing.Middleware,
+		logging.Middleware(logger),
+		metrics.Middleware,
+		middleware.Recoverer,
+	)
+	if c := cfg.HTTP.CORS; c.Enabled() {
+		r.Use(cors.Handler(cors.Options{
+			AllowedOrigins:   c.AllowedOrigins,
+			AllowedMethods:   c.AllowedMethods,
+			AllowedHeaders:   c.AllowedHeaders,
+			ExposedHeaders:   []string{"Content-Disposition", "X-Request-Id"},
+			AllowCredentials: c.AllowCredentials,
+			MaxAge:           int(c.MaxAge.Seconds()),
+		}))
+	}
+
+	// Пробы и метрики доступны без аутентификации.
+	healthHandler.Register(r)
+	r.Handle("/metrics", metrics.Handler())
+
+	r.Group(func(r chi.Router) {
+		r.Use(handler.Authenticate(authn), handler.ResolveTenant)
+
+		// Потоковые выгрузки и загрузки файлов идут столько, сколько нужно клиенту,
+		// и не попадают под общий таймаут.
+		userSegHandler.RegisterExport(r)
+		importHandler.RegisterUpload(r)
+
+		r.Group(func(r chi.Router) {
+			r.Use(middleware.Timeout(cfg.HTTP.RequestTimeout))
+
+			r.Route("/segments", func(r chi.Router) {
+				segHandler.Register(r)
+			})
+			r.Route("/users", func(r chi.Router) {
+				userHandler.Register(r)
+			})
+			r.Route("/reports", func(r chi.Router) {
+				reportHandler.Register(r)
+			})
+			r.Route("/imports", func(r chi.Router) {
+				importHandler.Register(r)
+			})
+			r.Route("/tenants", func(r chi.Router) {
+				tenantHandler.Register(r)
+			})
+
+			userSegHandler.Register(r)
+			r.Handle("/debug/vars", expvar.Handler())
+		})
+	})
+
+	srv := &http.Server{
+		Addr:              ":" + cfg.HTTP.Port,
+		Handler:           r,
+		ReadHeaderTimeout: cfg.HTTP.ReadHeaderTimeout,
+		IdleTimeout:       cfg.HTTP.IdleTimeout,
+	}
+
+	go func() {
+		logger.Info("server listening", "port", cfg.HTTP.Port)
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			fatal(logger, "http server failed", "error", err)
+		}
+	}()
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	<-quit
+	logger.Info("shutting down")
+	stopWorkers()
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.HTTP.ShutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		fatal(logger, "server forced shutdown", "error", err)
+	}
+	logger.Info("server stopped")
+}
+
+// migrateOnBoot применяет миграции при запуске serve через отдельное короткое
+// подключение: блокировка занимает соединение на всё время миграций, и при
+// маленьком пуле goose остался бы без соединений.
+func migrateOnBoot(cfg config.Config, logger *slog.Logger) error {
+	db, err := migrate.Open(cfg.Database.URL)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	return migrate.Run(context.Background(), db, migrate.CommandUp, logger)
+}
@@ -0,0 +1,25 @@
+// Package audit переносит через context сведения о том, кто выполняет изменение.
+package audit
+
+import "context"
+
+// SystemActor — актор для изменений, инициированных самим сервисом.
+const SystemActor = "system"
+
+// AnonymousActor — актор запроса, который не представился.
+const AnonymousActor = "anonymous"
+
+type actorKey struct{}
+
+// WithActor возвращает контекст с заданным актором.
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFromContext возвращает актора из контекста или AnonymousActor.
+func ActorFromContext(ctx context.Context) string {
+	if actor, ok := ctx.Value(actorKey{}).(string); ok && actor != "" {
+		return actor
+	}
+	return AnonymousActor
+}
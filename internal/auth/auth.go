@@ -0,0 +1,137 @@
+// Package auth проверяет учётные данные запросов (статические ключи API и JWT)
+// и описывает роли, которыми ограничен доступ к маршрутам.
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/RaikyD/UserSegmentationService/internal/storage"
+)
+
+// Role — роль вызывающего. Роли вложены: assigner может всё, что reader,
+// segment-admin — всё, что assigner.
+type Role string
+
+const (
+	// RoleReader читает сегменты, привязки, отчёты и проверяет членство.
+	RoleReader Role = "reader"
+	// RoleAssigner вдобавок меняет привязки пользователей и профили пользователей.
+	RoleAssigner Role = "assigner"
+	// RoleSegmentAdmin вдобавок создаёт, меняет и удаляет сегменты.
+	RoleSegmentAdmin Role = "segment-admin"
+)
+
+var roleRank = map[Role]int{
+	RoleReader:       1,
+	RoleAssigner:     2,
+	RoleSegmentAdmin: 3,
+}
+
+// ParseRole проверяет название роли.
+func ParseRole(s string) (Role, error) {
+	r := Role(s)
+	if _, ok := roleRank[r]; !ok {
+		return "", fmt.Errorf("unknown role %q", s)
+	}
+	return r, nil
+}
+
+// Способы, которыми вызывающий подтвердил личность.
+const (
+	MethodAPIKey = "api_key"
+	MethodJWT    = "jwt"
+	MethodNone   = "none"
+)
+
+// Principal — аутентифицированный вызывающий. Name попадает в журналы
+// изменений как актор. Непустой Tenant привязывает вызывающего к одному
+// арендатору; с пустым он выбирает арендатора сам.
+type Principal struct {
+	Name   string
+	Method string
+	Roles  []Role
+	Tenant string
+}
+
+// Can сообщает, достаточно ли ролей вызывающего для role.
+func (p *Principal) Can(role Role) bool {
+	need := roleRank[role]
+	for _, r := range p.Roles {
+		if roleRank[r] >= need {
+			return true
+		}
+	}
+	return false
+}
+
+type principalKey struct{}
+
+// WithPrincipal возвращает контекст с вызывающим.
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// FromContext возвращает вызывающего из контекста.
+func FromContext(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(*Principal)
+	return p, ok
+}
+
+// ErrInvalidCredentials — ключ не найден или отозван, токен не прошёл проверку.
+var ErrInvalidCredentials = errors.New("invalid credentials")
+
+// APIKeyPrefix отличает ключи API от JWT в заголовке Authorization.
+const APIKeyPrefix = "usk_"
+
+// Authenticator проверяет ключи API по хэшам в БД и JWT подписью.
+type Authenticator struct {
+	keys storage.APIKeyRepository
+	jwt  *JWTVerifier
+}
+
+// NewAuthenticator создаёт проверку учётных данных. Без jwt принимаются только ключи API.
+func NewAuthenticator(keys storage.APIKeyRepository, jwt *JWTVerifier) *Authenticator {
+	return &Authenticator{keys: keys, jwt: jwt}
+}
+
+// Authenticate определяет вызывающего по ключу API (начинается с usk_) или JWT.
+// Неверные учётные данные дают ErrInvalidCredentials, прочие ошибки — сбой проверки.
+func (a *Authenticator) Authenticate(ctx context.Context, credential string) (*Principal, error) {
+	if strings.HasPrefix(credential, APIKeyPrefix) {
+		return a.authenticateKey(ctx, credential)
+	}
+	if a.jwt == nil {
+		return nil, fmt.Errorf("%w: JWT authentication is not configured", ErrInvalidCredentials)
+	}
+	return a.jwt.Verify(credential)
+}
+
+func (a *Authenticator) authenticateKey(ctx context.Context, key string) (*Principal, error) {
+	hash := HashAPIKey(key)
+	k, err := a.keys.GetByHash(ctx, hash[:])
+	if err != nil {
+		return nil, err
+	}
+	if k == nil {
+		return nil, ErrInvalidCredentials
+	}
+	p := &Principal{Name: "api-key:" + k.Name, Method: MethodAPIKey}
+	if k.Tenant != nil {
+		p.Tenant = *k.Tenant
+	}
+	for _, name := range k.Roles {
+		if r, err := ParseRole(name); err == nil {
+			p.Roles = append(p.Roles, r)
+		}
+	}
+	return p, nil
+}
+
+// HashAPIKey возвращает хэш, под которым ключ хранится в api_keys.key_hash.
+func HashAPIKey(key string) [sha256.Size]byte {
+	return sha256.Sum256([]byte(key))
+}
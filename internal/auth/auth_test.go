@@ -0,0 +1,371 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/RaikyD/UserSegmentationService/internal/models"
+)
+
+// testKeys — ключи подписи, сгенерированные для теста.
+type testKeys struct {
+	rsa *rsa.PrivateKey
+	ec  *ecdsa.PrivateKey
+	ed  ed25519.PrivateKey
+}
+
+func newTestKeys(t *testing.T) testKeys {
+	t.Helper()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return testKeys{rsa: rsaKey, ec: ecKey, ed: edKey}
+}
+
+func b64(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
+
+// writeJWKS сохраняет открытые ключи в JWKS-файл с kid rsa, ec и ed.
+func (k testKeys) writeJWKS(t *testing.T) string {
+	t.Helper()
+	set := map[string]any{"keys": []map[string]string{
+		{"kty": "RSA", "kid": "rsa", "use": "sig", "n": b64(k.rsa.N.Bytes()), "e": b64(big.NewInt(int64(k.rsa.E)).Bytes())},
+		{"kty": "EC", "kid": "ec", "crv": "P-256", "x": b64(k.ec.X.Bytes()), "y": b64(k.ec.Y.Bytes())},
+		{"kty": "OKP", "kid": "ed", "crv": "Ed25519", "x": b64(k.ed.Public().(ed25519.PublicKey))},
+		{"kty": "RSA", "kid": "enc", "use": "enc", "n": "AQAB", "e": "AQAB"},
+	}}
+	data, err := json.Marshal(set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func sign(t *testing.T, method jwt.SigningMethod, kid string, key crypto.PrivateKey, claims jwt.MapClaims) string {
+	t.Helper()
+	tok := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		tok.Header["kid"] = kid
+	}
+	s, err := tok.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func validClaims() jwt.MapClaims {
+	return jwt.MapClaims{"sub": "svc-a", "exp": time.Now().Add(time.Hour).Unix(), "roles": []string{"assigner"}, "tenant": "acme"}
+}
+
+func TestJWTVerify(t *testing.T) {
+	keys := newTestKeys(t)
+	v, err := NewJWTVerifier(JWTConfig{JWKSFile: keys.writeJWKS(t), Issuer: "idp", Audience: "segments"})
+	if err != nil {
+		t.Fatalf("NewJWTVerifier: %v", err)
+	}
+	claims := func(edit func(jwt.MapClaims)) jwt.MapClaims {
+		c := validClaims()
+		c["iss"], c["aud"] = "idp", "segments"
+		if edit != nil {
+			edit(c)
+		}
+		return c
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		ok    bool
+	}{
+		{"RS256", sign(t, jwt.SigningMethodRS256, "rsa", keys.rsa, claims(nil)), true},
+		{"PS384", sign(t, jwt.SigningMethodPS384, "rsa", keys.rsa, claims(nil)), true},
+		{"ES256", sign(t, jwt.SigningMethodES256, "ec", keys.ec, claims(nil)), true},
+		{"EdDSA", sign(t, jwt.SigningMethodEdDSA, "ed", keys.ed, claims(nil)), true},
+		{"HS256 with the public key as secret", sign(t, jwt.SigningMethodHS256, "rsa",
+			x509.MarshalPKCS1PublicKey(&keys.rsa.PublicKey), claims(nil)), false},
+		{"alg none", sign(t, jwt.SigningMethodNone, "rsa", jwt.UnsafeAllowNoneSignatureType, claims(nil)), false},
+		{"wrong kid", sign(t, jwt.SigningMethodRS256, "ec", keys.rsa, claims(nil)), false},
+		{"unknown kid", sign(t, jwt.SigningMethodRS256, "other", keys.rsa, claims(nil)), false},
+		{"no kid with several keys", sign(t, jwt.SigningMethodRS256, "", keys.rsa, claims(nil)), false},
+		{"non-signing key", sign(t, jwt.SigningMethodRS256, "enc", keys.rsa, claims(nil)), false},
+		{"no exp", sign(t, jwt.SigningMethodRS256, "rsa", keys.rsa, claims(func(c jwt.MapClaims) { delete(c, "exp") })), false},
+		{"expired", sign(t, jwt.SigningMethodRS256, "rsa", keys.rsa, claims(func(c jwt.MapClaims) {
+			c["exp"] = time.Now().Add(-time.Minute).Unix()
+		})), false},
+		{"within leeway", sign(t, jwt.SigningMethodRS256, "rsa", keys.rsa, claims(func(c jwt.MapClaims) {
+			c["exp"] = time.Now().Add(-10 * time.Second).Unix()
+		})), true},
+		{"wrong issuer", sign(t, jwt.SigningMethodRS256, "rsa", keys.rsa, claims(func(c jwt.MapClaims) { c["iss"] = "evil" })), false},
+		{"wrong audience", sign(t, jwt.SigningMethodRS256, "rsa", keys.rsa, claims(func(c jwt.MapClaims) { c["aud"] = "other" })), false},
+		{"no subject", sign(t, jwt.SigningMethodRS256, "rsa", keys.rsa, claims(func(c jwt.MapClaims) { delete(c, "sub") })), false},
+		{"garbage", "not.a.token", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := v.Verify(tt.token)
+			if !tt.ok {
+				if !errors.Is(err, ErrInvalidCredentials) {
+					t.Errorf("Verify error = %v, want ErrInvalidCredentials", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Verify: %v", err)
+			}
+			if p.Name != "svc-a" || p.Method != MethodJWT || !slices.Equal(p.Roles, []Role{RoleAssigner}) {
+				t.Errorf("principal = %+v", p)
+			}
+		})
+	}
+}
+
+func TestJWTPublicKeyFile(t *testing.T) {
+	keys := newTestKeys(t)
+	der, err := x509.MarshalPKIXPublicKey(keys.ec.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "key.pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	v, err := NewJWTVerifier(JWTConfig{PublicKeyFile: path})
+	if err != nil {
+		t.Fatalf("NewJWTVerifier: %v", err)
+	}
+	// С единственным ключом kid не важен.
+	for _, kid := range []string{"", "rotated"} {
+		if _, err := v.Verify(sign(t, jwt.SigningMethodES256, kid, keys.ec, validClaims())); err != nil {
+			t.Errorf("kid %q: %v", kid, err)
+		}
+	}
+	if _, err := v.Verify(sign(t, jwt.SigningMethodRS256, "", keys.rsa, validClaims())); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("token of another key: error = %v", err)
+	}
+
+	if _, err := NewJWTVerifier(JWTConfig{}); err == nil {
+		t.Error("NewJWTVerifier without keys: want an error")
+	}
+	if _, err := NewJWTVerifier(JWTConfig{PublicKeyFile: path, JWKSFile: path}); err == nil {
+		t.Error("NewJWTVerifier with both key sources: want an error")
+	}
+}
+
+func TestJWTRolesClaim(t *testing.T) {
+	keys := newTestKeys(t)
+	tests := []struct {
+		name  string
+		claim string
+		value any
+		want  []Role
+	}{
+		{"array", "", []string{"reader", "segment-admin"}, []Role{RoleReader, RoleSegmentAdmin}},
+		{"space separated", "", "reader  assigner", []Role{RoleReader, RoleAssigner}},
+		{"unknown roles dropped", "", []any{"root", "reader", 7}, []Role{RoleReader}},
+		{"custom claim", "scope", "segment-admin", []Role{RoleSegmentAdmin}},
+		{"wrong type", "", map[string]any{"role": "reader"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := keys.writeJWKS(t)
+			v, err := NewJWTVerifier(JWTConfig{JWKSFile: path, RolesClaim: tt.claim})
+			if err != nil {
+				t.Fatal(err)
+			}
+			claims := validClaims()
+			delete(claims, "roles")
+			name := tt.claim
+			if name == "" {
+				name = "roles"
+			}
+			claims[name] = tt.value
+			p, err := v.Verify(sign(t, jwt.SigningMethodEdDSA, "ed", keys.ed, claims))
+			if err != nil {
+				t.Fatalf("Verify: %v", err)
+			}
+			if !slices.Equal(p.Roles, tt.want) {
+				t.Errorf("roles = %v, want %v", p.Roles, tt.want)
+			}
+		})
+	}
+}
+
+func TestJWTTenantClaim(t *testing.T) {
+	keys := newTestKeys(t)
+	tests := []struct {
+		name     string
+		claim    string
+		platform string
+		set      map[string]any
+		want     string
+		wantErr  bool
+	}{
+		{"default claim", "", "", map[string]any{"tenant": "acme"}, "acme", false},
+		{"custom claim", "org", "", map[string]any{"org": "globex", "tenant": "acme"}, "globex", false},
+		{"platform value", "", "*", map[string]any{"tenant": "*"}, "", false},
+		{"no claim", "", "*", map[string]any{"tenant": nil}, "", true},
+		{"custom claim missing", "org", "", nil, "", true},
+		{"empty", "", "", map[string]any{"tenant": ""}, "", true},
+		{"not a string", "", "", map[string]any{"tenant": 42}, "", true},
+		{"list", "", "", map[string]any{"tenant": []string{"acme"}}, "", true},
+		{"invalid name", "", "", map[string]any{"tenant": "Acme Corp"}, "", true},
+		{"platform value is not configured", "", "", map[string]any{"tenant": "*"}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, err := NewJWTVerifier(JWTConfig{JWKSFile: keys.writeJWKS(t), TenantClaim: tt.claim, PlatformTenant: tt.platform})
+			if err != nil {
+				t.Fatal(err)
+			}
+			claims := validClaims()
+			for k, val := range tt.set {
+				if val == nil {
+					delete(claims, k)
+					continue
+				}
+				claims[k] = val
+			}
+			p, err := v.Verify(sign(t, jwt.SigningMethodRS256, "rsa", keys.rsa, claims))
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidCredentials) {
+					t.Errorf("Verify error = %v, want ErrInvalidCredentials", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Verify: %v", err)
+			}
+			if p.Tenant != tt.want {
+				t.Errorf("tenant = %q, want %q", p.Tenant, tt.want)
+			}
+		})
+	}
+
+	// Значение платформы, совпадающее с именем арендатора, сделало бы токены
+	// этого арендатора платформенными.
+	if _, err := NewJWTVerifier(JWTConfig{JWKSFile: keys.writeJWKS(t), PlatformTenant: "acme"}); err == nil {
+		t.Error("NewJWTVerifier with a tenant name as the platform value: want an error")
+	}
+}
+
+// memAPIKeys — таблица api_keys в памяти. Как и запрос в БД, отозванные ключи не находит.
+type memAPIKeys struct {
+	keys map[string]*models.APIKey // по хэшу
+	err  error
+}
+
+func newMemAPIKeys() *memAPIKeys {
+	return &memAPIKeys{keys: make(map[string]*models.APIKey)}
+}
+
+func (m *memAPIKeys) add(key string, k *models.APIKey) {
+	hash := HashAPIKey(key)
+	m.keys[string(hash[:])] = k
+}
+
+func (m *memAPIKeys) GetByHash(_ context.Context, hash []byte) (*models.APIKey, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	k := m.keys[string(hash)]
+	if k == nil || k.RevokedAt != nil {
+		return nil, nil
+	}
+	return k, nil
+}
+
+func TestAuthenticateAPIKey(t *testing.T) {
+	revoked := time.Now()
+	repo := newMemAPIKeys()
+	repo.add("usk_good", &models.APIKey{Name: "ci", Roles: []string{"reader", "unknown"}})
+	repo.add("usk_old", &models.APIKey{Name: "old", Roles: []string{"segment-admin"}, RevokedAt: &revoked})
+	acme := "acme"
+	repo.add("usk_acme", &models.APIKey{Name: "acme-app", Roles: []string{"reader"}, Tenant: &acme})
+	a := NewAuthenticator(repo, nil)
+
+	p, err := a.Authenticate(context.Background(), "usk_good")
+	if err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	if p.Name != "api-key:ci" || p.Method != MethodAPIKey || !slices.Equal(p.Roles, []Role{RoleReader}) || p.Tenant != "" {
+		t.Errorf("principal = %+v", p)
+	}
+	if p, err := a.Authenticate(context.Background(), "usk_acme"); err != nil || p.Tenant != "acme" {
+		t.Errorf("tenant key: principal = %+v, %v", p, err)
+	}
+
+	for _, cred := range []string{"usk_old", "usk_missing", "eyJhbGciOiJub25lIn0.e30."} {
+		if _, err := a.Authenticate(context.Background(), cred); !errors.Is(err, ErrInvalidCredentials) {
+			t.Errorf("Authenticate(%q) error = %v, want ErrInvalidCredentials", cred, err)
+		}
+	}
+
+	// Сбой хранилища — не неверные учётные данные.
+	repo.err = errors.New("db down")
+	if _, err := a.Authenticate(context.Background(), "usk_good"); err == nil || errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Authenticate with failing storage: error = %v", err)
+	}
+}
+
+func TestHashAPIKey(t *testing.T) {
+	a, b := HashAPIKey("usk_a"), HashAPIKey("usk_b")
+	if a != HashAPIKey("usk_a") || a == b || bytes.Contains(a[:], []byte("usk_a")) {
+		t.Error("HashAPIKey must be deterministic and not contain the key")
+	}
+}
+
+func TestPrincipalCan(t *testing.T) {
+	tests := []struct {
+		roles []Role
+		need  Role
+		want  bool
+	}{
+		{nil, RoleReader, false},
+		{[]Role{RoleReader}, RoleReader, true},
+		{[]Role{RoleReader}, RoleAssigner, false},
+		{[]Role{RoleAssigner}, RoleReader, true},
+		{[]Role{RoleAssigner}, RoleSegmentAdmin, false},
+		{[]Role{RoleReader, RoleSegmentAdmin}, RoleAssigner, true},
+	}
+	for _, tt := range tests {
+		p := &Principal{Roles: tt.roles}
+		if got := p.Can(tt.need); got != tt.want {
+			t.Errorf("%v.Can(%s) = %v, want %v", tt.roles, tt.need, got, tt.want)
+		}
+	}
+	if _, err := ParseRole("admin"); err == nil {
+		t.Error("ParseRole(admin): want an error")
+	}
+}
@@ -0,0 +1,298 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/RaikyD/UserSegmentationService/internal/tenant"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// JWTConfig — откуда брать ключи проверки подписи и какие утверждения требовать.
+type JWTConfig struct {
+	// JWKSFile — файл JWKS; ключ выбирается по kid из заголовка токена.
+	JWKSFile string
+	// PublicKeyFile — PEM с открытым ключом (PKIX, PKCS#1 или сертификат).
+	PublicKeyFile string
+	// Issuer и Audience, если заданы, сверяются с iss и aud.
+	Issuer   string
+	Audience string
+	// RolesClaim — утверждение со списком ролей: массив строк или строка через пробел.
+	RolesClaim string
+	// TenantClaim — утверждение с арендатором, к которому привязан вызывающий.
+	// Оно обязательно: токен без него или с некорректным именем отклоняется.
+	TenantClaim string
+	// PlatformTenant — значение TenantClaim (например "*"), которое даёт токену
+	// доступ без привязки к арендатору. Пусто — таких токенов нет.
+	PlatformTenant string
+}
+
+// JWTVerifier проверяет подпись и срок действия JWT. Принимаются только
+// асимметричные алгоритмы, поэтому подделать токен, зная открытый ключ, нельзя.
+type JWTVerifier struct {
+	keys           map[string]crypto.PublicKey
+	parser         *jwt.Parser
+	rolesClaim     string
+	tenantClaim    string
+	platformTenant string
+}
+
+var jwtMethods = []string{
+	"RS256", "RS384", "RS512",
+	"PS256", "PS384", "PS512",
+	"ES256", "ES384", "ES512",
+	"EdDSA",
+}
+
+// NewJWTVerifier загружает ключи. Должен быть задан ровно один из JWKSFile и PublicKeyFile.
+func NewJWTVerifier(cfg JWTConfig) (*JWTVerifier, error) {
+	if (cfg.JWKSFile == "") == (cfg.PublicKeyFile == "") {
+		return nil, errors.New("exactly one of JWKS file and public key file must be set")
+	}
+	if tenant.Valid(cfg.PlatformTenant) {
+		return nil, fmt.Errorf("platform tenant value %q is a valid tenant name", cfg.PlatformTenant)
+	}
+	var keys map[string]crypto.PublicKey
+	var err error
+	if cfg.JWKSFile != "" {
+		keys, err = loadJWKS(cfg.JWKSFile)
+	} else {
+		var key crypto.PublicKey
+		key, err = loadPublicKey(cfg.PublicKeyFile)
+		keys = map[string]crypto.PublicKey{"": key}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods(jwtMethods),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(30 * time.Second),
+	}
+	if cfg.Issuer != "" {
+		opts = append(opts, jwt.WithIssuer(cfg.Issuer))
+	}
+	if cfg.Audience != "" {
+		opts = append(opts, jwt.WithAudience(cfg.Audience))
+	}
+	rolesClaim := cfg.RolesClaim
+	if rolesClaim == "" {
+		rolesClaim = "roles"
+	}
+	tenantClaim := cfg.TenantClaim
+	if tenantClaim == "" {
+		tenantClaim = "tenant"
+	}
+	return &JWTVerifier{
+		keys:           keys,
+		parser:         jwt.NewParser(opts...),
+		rolesClaim:     rolesClaim,
+		tenantClaim:    tenantClaim,
+		platformTenant: cfg.PlatformTenant,
+	}, nil
+}
+
+// Verify проверяет токен и возвращает вызывающего с именем из sub
+// и арендатором из утверждения TenantClaim.
+func (v *JWTVerifier) Verify(token string) (*Principal, error) {
+	claims := jwt.MapClaims{}
+	if _, err := v.parser.ParseWithClaims(token, claims, v.keyFor); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCredentials, err)
+	}
+	sub, err := claims.GetSubject()
+	if err != nil || sub == "" {
+		return nil, fmt.Errorf("%w: token has no subject", ErrInvalidCredentials)
+	}
+	p := &Principal{Name: sub, Method: MethodJWT}
+	if p.Tenant, err = v.tenantOf(claims); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCredentials, err)
+	}
+	for _, name := range claimStrings(claims[v.rolesClaim]) {
+		if r, err := ParseRole(name); err == nil {
+			p.Roles = append(p.Roles, r)
+		}
+	}
+	return p, nil
+}
+
+// tenantOf возвращает арендатора из утверждения TenantClaim; "" — токен платформы.
+// Без утверждения или с некорректным значением токен не принимается: иначе
+// ошибка при выпуске токена открывала бы данные всех арендаторов.
+func (v *JWTVerifier) tenantOf(claims jwt.MapClaims) (string, error) {
+	raw, ok := claims[v.tenantClaim]
+	if !ok {
+		return "", fmt.Errorf("token has no %q claim", v.tenantClaim)
+	}
+	name, _ := raw.(string)
+	if v.platformTenant != "" && name == v.platformTenant {
+		return "", nil
+	}
+	if !tenant.Valid(name) {
+		return "", fmt.Errorf("claim %q is not a valid tenant name", v.tenantClaim)
+	}
+	return name, nil
+}
+
+// keyFor выбирает ключ по kid. Если ключ один, kid не важен: подпись всё равно проверяется.
+func (v *JWTVerifier) keyFor(t *jwt.Token) (any, error) {
+	kid, _ := t.Header["kid"].(string)
+	if key, ok := v.keys[kid]; ok {
+		return key, nil
+	}
+	if len(v.keys) == 1 {
+		for _, key := range v.keys {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown key id %q", kid)
+}
+
+func claimStrings(v any) []string {
+	switch v := v.(type) {
+	case string:
+		return strings.Fields(v)
+	case []any:
+		out := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+func loadPublicKey(path string) (crypto.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM block found", path)
+	}
+	switch block.Type {
+	case "PUBLIC KEY":
+		return x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	case "CERTIFICATE":
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		return cert.PublicKey, nil
+	}
+	return nil, fmt.Errorf("%s: unsupported PEM block %q", path, block.Type)
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func loadJWKS(path string) (map[string]crypto.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for i, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("%s: key %d: %w", path, i, err)
+		}
+		keys[k.Kid] = key
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("%s: no signing keys", path)
+	}
+	return keys, nil
+}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := b64Int(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := b64Int(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := b64Int(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := b64Int(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, errors.New("EC point is not on curve")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 key")
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
+
+func b64Int(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
@@ -0,0 +1,53 @@
+// Package buildinfo хранит версию и коммит, вшитые при сборке:
+//
+//	go build -ldflags "-X github.com/RaikyD/UserSegmentationService/internal/buildinfo.Version=v1.2.0 \
+//	  -X github.com/RaikyD/UserSegmentationService/internal/buildinfo.Commit=$(git rev-parse HEAD)"
+//
+// Если коммит не передан, он берётся из VCS-данных, которые go build добавляет сам.
+package buildinfo
+
+import (
+	"runtime"
+	"runtime/debug"
+)
+
+// Заполняются через -ldflags -X.
+var (
+	Version   = "dev"
+	Commit    = ""
+	BuildTime = ""
+)
+
+// Info — сведения о сборке для /version.
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildTime string `json:"build_time,omitempty"`
+	Modified  bool   `json:"modified,omitempty"`
+	GoVersion string `json:"go_version"`
+}
+
+// Get возвращает сведения о текущей сборке.
+func Get() Info {
+	info := Info{Version: Version, Commit: Commit, BuildTime: BuildTime, GoVersion: runtime.Version()}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range bi.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				if info.Commit == "" {
+					info.Commit = s.Value
+				}
+			case "vcs.time":
+				if info.BuildTime == "" {
+					info.BuildTime = s.Value
+				}
+			case "vcs.modified":
+				info.Modified = s.Value == "true"
+			}
+		}
+	}
+	if info.Commit == "" {
+		info.Commit = "unknown"
+	}
+	return info
+}
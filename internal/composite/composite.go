@@ -0,0 +1,154 @@
+// Package composite описывает сегменты типа composite — выражения над множествами
+// участников других сегментов.
+//
+// Config хранит дерево выражения. Лист ссылается на сегмент по ID, узел применяет
+// операцию к своим аргументам:
+//
+//	{"expr": {"op": "difference", "args": [
+//	    {"segment": "<PREMIUM>"},
+//	    {"segment": "<CHURN_RISK>"}
+//	]}}
+//
+// union — хотя бы в одном аргументе, intersect — во всех, difference — в первом
+// аргументе и ни в одном из остальных. Аргументом может быть другой composite-сегмент.
+package composite
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+// Op — операция узла выражения.
+type Op string
+
+const (
+	OpUnion      Op = "union"
+	OpIntersect  Op = "intersect"
+	OpDifference Op = "difference"
+)
+
+const (
+	maxDepth = 16
+	maxNodes = 256
+)
+
+// Config — формат поля config у сегмента типа composite.
+type Config struct {
+	Expr *Node `json:"expr"`
+}
+
+// Node — узел выражения: либо лист Segment, либо операция Op над Args.
+type Node struct {
+	Op      Op         `json:"op,omitempty"`
+	Args    []*Node    `json:"args,omitempty"`
+	Segment *uuid.UUID `json:"segment,omitempty"`
+}
+
+// ParseConfig разбирает и проверяет JSON-конфиг сегмента.
+func ParseConfig(raw json.RawMessage) (*Config, error) {
+	var cfg Config
+	if err := json.Unmarshal(raw, &cfg); err != nil {
+		return nil, fmt.Errorf("invalid composite config: %w", err)
+	}
+	if cfg.Expr == nil {
+		return nil, errors.New("expr is required")
+	}
+	nodes := 0
+	if err := cfg.Expr.validate(0, &nodes); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+func (n *Node) validate(depth int, nodes *int) error {
+	*nodes++
+	if *nodes > maxNodes {
+		return fmt.Errorf("expression has more than %d nodes", maxNodes)
+	}
+	if depth > maxDepth {
+		return fmt.Errorf("expression is nested deeper than %d levels", maxDepth)
+	}
+	if n.Segment != nil {
+		if n.Op != "" || len(n.Args) > 0 {
+			return errors.New("node must have either segment or op with args, not both")
+		}
+		return nil
+	}
+	switch n.Op {
+	case OpUnion, OpIntersect, OpDifference:
+	case "":
+		return errors.New("node must have either segment or op with args")
+	default:
+		return fmt.Errorf("unknown op %q, expected union, intersect or difference", n.Op)
+	}
+	if len(n.Args) < 2 {
+		return fmt.Errorf("%s needs at least 2 args", n.Op)
+	}
+	for _, arg := range n.Args {
+		if arg == nil {
+			return errors.New("arg must not be null")
+		}
+		if err := arg.validate(depth+1, nodes); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Refs возвращает ID сегментов, на которые ссылается выражение, без повторов.
+func (c *Config) Refs() []uuid.UUID {
+	var refs []uuid.UUID
+	seen := make(map[uuid.UUID]struct{})
+	var walk func(n *Node)
+	walk = func(n *Node) {
+		if n.Segment != nil {
+			if _, ok := seen[*n.Segment]; !ok {
+				seen[*n.Segment] = struct{}{}
+				refs = append(refs, *n.Segment)
+			}
+			return
+		}
+		for _, arg := range n.Args {
+			walk(arg)
+		}
+	}
+	walk(c.Expr)
+	return refs
+}
+
+// Eval вычисляет выражение, узнавая членство в листовых сегментах через member.
+func (n *Node) Eval(member func(segmentID uuid.UUID) bool) bool {
+	if n.Segment != nil {
+		return member(*n.Segment)
+	}
+	switch n.Op {
+	case OpUnion:
+		for _, arg := range n.Args {
+			if arg.Eval(member) {
+				return true
+			}
+		}
+		return false
+	case OpIntersect:
+		for _, arg := range n.Args {
+			if !arg.Eval(member) {
+				return false
+			}
+		}
+		return true
+	case OpDifference:
+		if !n.Args[0].Eval(member) {
+			return false
+		}
+		for _, arg := range n.Args[1:] {
+			if arg.Eval(member) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
@@ -0,0 +1,123 @@
+package composite
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+var (
+	segA = uuid.MustParse("00000000-0000-0000-0000-00000000000a")
+	segB = uuid.MustParse("00000000-0000-0000-0000-00000000000b")
+	segC = uuid.MustParse("00000000-0000-0000-0000-00000000000c")
+)
+
+func leaf(id uuid.UUID) string { return fmt.Sprintf(`{"segment": %q}`, id) }
+
+func op(name string, args ...string) string {
+	return fmt.Sprintf(`{"op": %q, "args": [%s]}`, name, strings.Join(args, ", "))
+}
+
+func config(expr string) json.RawMessage { return json.RawMessage(`{"expr": ` + expr + `}`) }
+
+func TestParseConfigErrors(t *testing.T) {
+	deep := leaf(segA)
+	for range maxDepth + 1 {
+		deep = op("union", deep, leaf(segB))
+	}
+	wide := make([]string, maxNodes)
+	for i := range wide {
+		wide[i] = leaf(segA)
+	}
+
+	tests := []struct {
+		name    string
+		raw     json.RawMessage
+		wantErr string
+	}{
+		{"not json", json.RawMessage(`{`), "invalid composite config"},
+		{"no expr", json.RawMessage(`{}`), "expr is required"},
+		{"empty node", config(`{}`), "either segment or op"},
+		{"segment and op", config(`{"segment": "` + segA.String() + `", "op": "union", "args": [` + leaf(segB) + `]}`), "not both"},
+		{"unknown op", config(op("xor", leaf(segA), leaf(segB))), `unknown op "xor"`},
+		{"single arg", config(op("union", leaf(segA))), "needs at least 2 args"},
+		{"null arg", config(op("intersect", leaf(segA), "null")), "must not be null"},
+		{"invalid uuid", config(`{"segment": "premium"}`), "invalid composite config"},
+		{"too deep", config(deep), "nested deeper"},
+		{"too many nodes", config(op("union", wide...)), "more than 256 nodes"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseConfig(tt.raw)
+			if err == nil {
+				t.Fatalf("ParseConfig succeeded, want error")
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ParseConfig error = %q, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRefs(t *testing.T) {
+	cfg, err := ParseConfig(config(op("difference",
+		op("union", leaf(segA), leaf(segB)),
+		op("intersect", leaf(segB), leaf(segC)),
+		leaf(segA),
+	)))
+	if err != nil {
+		t.Fatalf("ParseConfig: %v", err)
+	}
+	if got, want := cfg.Refs(), []uuid.UUID{segA, segB, segC}; !slices.Equal(got, want) {
+		t.Errorf("Refs() = %v, want %v", got, want)
+	}
+}
+
+func TestEval(t *testing.T) {
+	tests := []struct {
+		name string
+		expr string
+		// want — результат для каждого набора членства в A, B, C (биты 0, 1, 2).
+		want [8]bool
+	}{
+		{"leaf", leaf(segA), [8]bool{false, true, false, true, false, true, false, true}},
+		{"union", op("union", leaf(segA), leaf(segB)), [8]bool{false, true, true, true, false, true, true, true}},
+		{"intersect", op("intersect", leaf(segA), leaf(segB), leaf(segC)), [8]bool{7: true}},
+		{"difference", op("difference", leaf(segA), leaf(segB), leaf(segC)), [8]bool{1: true}},
+		{"nested", op("difference", op("union", leaf(segA), leaf(segB)), leaf(segC)), [8]bool{1: true, 2: true, 3: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := ParseConfig(config(tt.expr))
+			if err != nil {
+				t.Fatalf("ParseConfig: %v", err)
+			}
+			for mask := range 8 {
+				members := map[uuid.UUID]bool{segA: mask&1 != 0, segB: mask&2 != 0, segC: mask&4 != 0}
+				got := cfg.Expr.Eval(func(id uuid.UUID) bool { return members[id] })
+				if got != tt.want[mask] {
+					t.Errorf("A=%v B=%v C=%v: Eval = %v, want %v", members[segA], members[segB], members[segC], got, tt.want[mask])
+				}
+			}
+		})
+	}
+}
+
+func TestEvalShortCircuits(t *testing.T) {
+	cfg, err := ParseConfig(config(op("difference", leaf(segA), leaf(segB))))
+	if err != nil {
+		t.Fatalf("ParseConfig: %v", err)
+	}
+	var asked []uuid.UUID
+	cfg.Expr.Eval(func(id uuid.UUID) bool {
+		asked = append(asked, id)
+		return false
+	})
+	if !slices.Equal(asked, []uuid.UUID{segA}) {
+		t.Errorf("difference outside the first arg asked %v, want only A", asked)
+	}
+}
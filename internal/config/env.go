@@ -0,0 +1,81 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// applyEnv перекрывает поля с тегом env значениями переменных окружения.
+// Пустая переменная считается незаданной. Списки задаются через запятую.
+func applyEnv(cfg *Config, lookup func(string) (string, bool)) error {
+	var errs []error
+	walkEnv(reflect.ValueOf(cfg).Elem(), func(name string, v reflect.Value) {
+		raw, ok := lookup(name)
+		if !ok || raw == "" {
+			return
+		}
+		if err := setFromEnv(v, raw); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+		}
+	})
+	return errors.Join(errs...)
+}
+
+// walkEnv вызывает fn для каждого поля с тегом env, заходя во вложенные структуры.
+func walkEnv(v reflect.Value, fn func(name string, field reflect.Value)) {
+	t := v.Type()
+	for i := range t.NumField() {
+		f := t.Field(i)
+		if name := f.Tag.Get("env"); name != "" {
+			fn(name, v.Field(i))
+			continue
+		}
+		if f.Type.Kind() == reflect.Struct {
+			walkEnv(v.Field(i), fn)
+		}
+	}
+}
+
+func setFromEnv(v reflect.Value, raw string) error {
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q", raw)
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(raw)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", raw)
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(raw, 10, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", raw)
+		}
+		v.SetInt(n)
+	case reflect.Slice:
+		var items []string
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		v.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported field type %s", v.Type())
+	}
+	return nil
+}
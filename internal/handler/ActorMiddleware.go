@@ -0,0 +1,20 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/RaikyD/UserSegmentationService/internal/audit"
+)
+
+// ActorHeader — заголовок, которым клиент представляется для журнала изменений.
+const ActorHeader = "X-Actor"
+
+// ActorFromHeader кладёт в контекст запроса актора из заголовка X-Actor.
+func ActorFromHeader(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if actor := r.Header.Get(ActorHeader); actor != "" {
+			r = r.WithContext(audit.WithActor(r.Context(), actor))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
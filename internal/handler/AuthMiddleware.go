@@ -0,0 +1,87 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/RaikyD/UserSegmentationService/internal/audit"
+	"github.com/RaikyD/UserSegmentationService/internal/auth"
+)
+
+// APIKeyHeader — альтернатива Authorization: Bearer для ключей API.
+const APIKeyHeader = "X-API-Key"
+
+// Authenticate определяет вызывающего по Authorization: Bearer <ключ или JWT>
+// или X-API-Key и кладёт его в контекст; его имя становится актором журналов изменений.
+// Без учётных данных или с неверными отвечает 401.
+//
+// Если authn равен nil, проверка выключена: каждый запрос получает все роли,
+// а актор, как и раньше, берётся из X-Actor.
+func Authenticate(authn *auth.Authenticator) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if authn == nil {
+			return ActorFromHeader(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				p := &auth.Principal{
+					Name:   audit.ActorFromContext(r.Context()),
+					Method: auth.MethodNone,
+					Roles:  []auth.Role{auth.RoleSegmentAdmin},
+				}
+				next.ServeHTTP(w, r.WithContext(auth.WithPrincipal(r.Context(), p)))
+			}))
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			credential := credentialFromRequest(r)
+			if credential == "" {
+				unauthorized(w, r, "authentication required")
+				return
+			}
+			p, err := authn.Authenticate(r.Context(), credential)
+			if errors.Is(err, auth.ErrInvalidCredentials) {
+				unauthorized(w, r, "invalid credentials")
+				return
+			}
+			if err != nil {
+				writeError(w, r, err)
+				return
+			}
+			ctx := auth.WithPrincipal(r.Context(), p)
+			ctx = audit.WithActor(ctx, p.Name)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+func credentialFromRequest(r *http.Request) string {
+	if key := r.Header.Get(APIKeyHeader); key != "" {
+		return key
+	}
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+// requireRole пропускает запрос, только если у вызывающего есть role или старшая роль.
+func requireRole(role auth.Role) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			p, ok := auth.FromContext(r.Context())
+			if !ok {
+				unauthorized(w, r, "authentication required")
+				return
+			}
+			if !p.Can(role) {
+				writeErrorResponse(w, r, http.StatusForbidden, codeForbidden, "role "+string(role)+" required")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func unauthorized(w http.ResponseWriter, r *http.Request, msg string) {
+	w.Header().Set("WWW-Authenticate", `Bearer realm="segments"`)
+	writeErrorResponse(w, r, http.StatusUnauthorized, codeUnauthorized, msg)
+}
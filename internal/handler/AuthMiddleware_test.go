@@ -0,0 +1,134 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/RaikyD/UserSegmentationService/internal/audit"
+	"github.com/RaikyD/UserSegmentationService/internal/auth"
+	"github.com/RaikyD/UserSegmentationService/internal/models"
+)
+
+// memAPIKeys — ключи API в памяти по значению ключа.
+type memAPIKeys struct {
+	keys map[string]*models.APIKey
+	err  error
+}
+
+func (m *memAPIKeys) GetByHash(_ context.Context, hash []byte) (*models.APIKey, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	for key, k := range m.keys {
+		if h := auth.HashAPIKey(key); string(h[:]) == string(hash) {
+			return k, nil
+		}
+	}
+	return nil, nil
+}
+
+// authRouter — маршруты под каждой ролью, отвечающие именем актора.
+func authRouter(authn *auth.Authenticator) http.Handler {
+	r := chi.NewRouter()
+	r.Use(Authenticate(authn))
+	actor := func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(audit.ActorFromContext(r.Context())))
+	}
+	r.With(requireRole(auth.RoleReader)).Get("/read", actor)
+	r.With(requireRole(auth.RoleAssigner)).Get("/assign", actor)
+	r.With(requireRole(auth.RoleSegmentAdmin)).Get("/admin", actor)
+	return r
+}
+
+func TestAuthenticateMiddleware(t *testing.T) {
+	keys := &memAPIKeys{keys: map[string]*models.APIKey{
+		"usk_reader":   {Name: "dashboard", Roles: []string{"reader"}},
+		"usk_assigner": {Name: "crm", Roles: []string{"assigner"}},
+		"usk_admin":    {Name: "ops", Roles: []string{"segment-admin"}},
+	}}
+	r := authRouter(auth.NewAuthenticator(keys, nil))
+
+	tests := []struct {
+		name       string
+		path       string
+		header     string
+		value      string
+		wantStatus int
+		wantCode   string
+	}{
+		{"no credentials", "/read", "", "", http.StatusUnauthorized, codeUnauthorized},
+		{"unknown key", "/read", APIKeyHeader, "usk_nope", http.StatusUnauthorized, codeUnauthorized},
+		{"jwt not configured", "/read", "Authorization", "Bearer eyJ.e30.sig", http.StatusUnauthorized, codeUnauthorized},
+		{"basic scheme", "/read", "Authorization", "Basic dXNrX3JlYWRlcjo=", http.StatusUnauthorized, codeUnauthorized},
+		{"reader reads", "/read", APIKeyHeader, "usk_reader", http.StatusOK, ""},
+		{"reader cannot assign", "/assign", APIKeyHeader, "usk_reader", http.StatusForbidden, codeForbidden},
+		{"assigner reads", "/read", "Authorization", "Bearer usk_assigner", http.StatusOK, ""},
+		{"assigner assigns", "/assign", "Authorization", "bearer usk_assigner", http.StatusOK, ""},
+		{"assigner cannot administer", "/admin", APIKeyHeader, "usk_assigner", http.StatusForbidden, codeForbidden},
+		{"admin administers", "/admin", APIKeyHeader, "usk_admin", http.StatusOK, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.header != "" {
+				req.Header.Set(tt.header, tt.value)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if tt.wantCode == "" {
+				if !strings.HasPrefix(w.Body.String(), "api-key:") {
+					t.Errorf("actor = %q, want the API key name", w.Body)
+				}
+				return
+			}
+			var resp struct{ Code string }
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.Code != tt.wantCode {
+				t.Errorf("body = %s, want code %s", w.Body, tt.wantCode)
+			}
+			if tt.wantStatus == http.StatusUnauthorized && w.Header().Get("WWW-Authenticate") == "" {
+				t.Error("401 without WWW-Authenticate")
+			}
+		})
+	}
+
+	// Сбой хранилища ключей — 500, а не 401.
+	keys.err = errors.New("db down")
+	req := httptest.NewRequest(http.MethodGet, "/read", nil)
+	req.Header.Set(APIKeyHeader, "usk_reader")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("failing key storage: status = %d, want 500", w.Code)
+	}
+}
+
+func TestAuthenticateDisabled(t *testing.T) {
+	r := authRouter(nil)
+	req := httptest.NewRequest(http.MethodGet, "/admin", nil)
+	req.Header.Set(ActorHeader, "alice")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || w.Body.String() != "alice" {
+		t.Errorf("response %d %q, want 200 with the X-Actor actor", w.Code, w.Body)
+	}
+}
+
+func TestRequireRoleWithoutPrincipal(t *testing.T) {
+	r := chi.NewRouter()
+	r.With(requireRole(auth.RoleReader)).Get("/read", func(http.ResponseWriter, *http.Request) {})
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/read", nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("status = %d, want 401", w.Code)
+	}
+}
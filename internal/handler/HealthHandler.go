@@ -0,0 +1,51 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/RaikyD/UserSegmentationService/internal/buildinfo"
+	"github.com/RaikyD/UserSegmentationService/internal/health"
+)
+
+// HealthHandler отдаёт пробы для оркестратора и сведения о сборке.
+type HealthHandler struct {
+	checker *health.Checker
+}
+
+// NewHealthHandler создаёт хэндлер проб с проверками готовности checker.
+func NewHealthHandler(checker *health.Checker) *HealthHandler {
+	return &HealthHandler{checker: checker}
+}
+
+// Live обрабатывает GET /healthz: процесс жив и обслуживает HTTP. Зависимости не проверяются,
+// чтобы падение БД не приводило к перезапуску всех экземпляров.
+func (h *HealthHandler) Live(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]health.Status{"status": health.StatusOK})
+}
+
+// Ready обрабатывает GET /readyz. При недоступной БД или неприменённых миграциях
+// отвечает 503; зависший воркер даёт статус degraded, но 200 — запросы обслуживать можно.
+func (h *HealthHandler) Ready(w http.ResponseWriter, r *http.Request) {
+	rep := h.checker.Run(r.Context())
+	w.Header().Set("Content-Type", "application/json")
+	if rep.Status == health.StatusUnavailable {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(rep)
+}
+
+// Version обрабатывает GET /version.
+func (h *HealthHandler) Version(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(buildinfo.Get())
+}
+
+func (h *HealthHandler) Register(r chi.Router) {
+	r.Get("/healthz", h.Live)
+	r.Get("/readyz", h.Ready)
+	r.Get("/version", h.Version)
+}
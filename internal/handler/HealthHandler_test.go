@@ -0,0 +1,54 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/RaikyD/UserSegmentationService/internal/buildinfo"
+	"github.com/RaikyD/UserSegmentationService/internal/health"
+)
+
+func TestHealthHandler(t *testing.T) {
+	dbErr := error(nil)
+	checker := health.NewChecker(time.Second)
+	checker.Critical("database", func(context.Context) error { return dbErr })
+	checker.Degraded("worker", func(context.Context) error { return errors.New("stuck") })
+	r := chi.NewRouter()
+	NewHealthHandler(checker).Register(r)
+
+	get := func(path string, v any) int {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		return rec.Code
+	}
+
+	var live map[string]string
+	if code := get("/healthz", &live); code != http.StatusOK || live["status"] != "ok" {
+		t.Errorf("/healthz = %d %v", code, live)
+	}
+
+	var rep health.Report
+	if code := get("/readyz", &rep); code != http.StatusOK || rep.Status != health.StatusDegraded {
+		t.Errorf("/readyz with a stuck worker = %d %+v, want 200 degraded", code, rep)
+	}
+	dbErr = errors.New("connection refused")
+	if code := get("/readyz", &rep); code != http.StatusServiceUnavailable || rep.Checks["database"].Error != "connection refused" {
+		t.Errorf("/readyz without database = %d %+v, want 503", code, rep)
+	}
+
+	var info buildinfo.Info
+	if code := get("/version", &info); code != http.StatusOK || info.Version != buildinfo.Version || info.Commit == "" || info.GoVersion == "" {
+		t.Errorf("/version = %d %+v", code, info)
+	}
+}
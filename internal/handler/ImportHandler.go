@@ -0,0 +1,137 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	"github.com/RaikyD/UserSegmentationService/internal/auth"
+	"github.com/RaikyD/UserSegmentationService/internal/handler/dto"
+	"github.com/RaikyD/UserSegmentationService/internal/jobs"
+	"github.com/RaikyD/UserSegmentationService/internal/models"
+	"github.com/RaikyD/UserSegmentationService/internal/service"
+)
+
+// maxImportSize — предельный размер загружаемого файла.
+const maxImportSize = 512 << 20
+
+// ImportHandler принимает файлы со списками участников сегментов.
+type ImportHandler struct {
+	svc      service.ImportService
+	segments service.SegmentService
+}
+
+// NewImportHandler создаёт новый HTTP-хэндлер для импорта.
+func NewImportHandler(svc service.ImportService, segments service.SegmentService) *ImportHandler {
+	return &ImportHandler{svc: svc, segments: segments}
+}
+
+// Register регистрирует маршруты состояния импорта в роутере
+func (h *ImportHandler) Register(r chi.Router) {
+	r.With(requireRole(auth.RoleReader)).Get("/{importID}", h.GetImport)
+}
+
+// RegisterUpload регистрирует загрузку файла. Большой файл передаётся дольше
+// общего таймаута запроса, поэтому маршрут подключается отдельно от Register.
+func (h *ImportHandler) RegisterUpload(r chi.Router) {
+	r.With(requireRole(auth.RoleAssigner)).Post("/segments/{segmentID}/users/import", h.StartImport)
+}
+
+// StartImport обрабатывает POST /segments/{segmentID}/users/import?mode=append|replace&format=csv|ndjson.
+// Файл передаётся телом запроса или полем file в multipart/form-data.
+func (h *ImportHandler) StartImport(w http.ResponseWriter, r *http.Request) {
+	mode := models.ImportMode(r.URL.Query().Get("mode"))
+	if mode == "" {
+		mode = models.ImportAppend
+	}
+	format := models.ImportFormat(r.URL.Query().Get("format"))
+	if format == "" {
+		format = models.ImportCSV
+	}
+	segmentID, err := h.segments.ResolveSegmentID(r.Context(), chi.URLParam(r, "segmentID"))
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportSize)
+	src, err := uploadedFile(r)
+	if err != nil {
+		badRequest(w, r, err.Error())
+		return
+	}
+	job, err := h.svc.StartImport(r.Context(), segmentID, mode, format, src)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeErrorResponse(w, r, http.StatusRequestEntityTooLarge, codeTooLarge,
+				fmt.Sprintf("file must not exceed %d bytes", tooLarge.Limit))
+			return
+		}
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/imports/"+job.ID.String())
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(toImportResponse(job))
+}
+
+// GetImport обрабатывает GET /imports/{importID}
+func (h *ImportHandler) GetImport(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "importID"))
+	if err != nil {
+		badRequest(w, r, "invalid import id")
+		return
+	}
+	job, err := h.svc.GetImport(r.Context(), id)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(toImportResponse(job))
+}
+
+// uploadedFile возвращает содержимое файла: поле file из multipart/form-data
+// или всё тело запроса. Multipart читается потоком, без сохранения формы в память.
+func uploadedFile(r *http.Request) (io.Reader, error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "multipart/form-data" {
+		return r.Body, nil
+	}
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		part, err := mr.NextPart()
+		if errors.Is(err, io.EOF) {
+			return nil, errors.New("multipart form has no file field")
+		}
+		if err != nil {
+			return nil, err
+		}
+		if part.FormName() == "file" {
+			return part, nil
+		}
+	}
+}
+
+func toImportResponse(job jobs.Job) dto.ImportResponse {
+	return dto.ImportResponse{
+		ID:         job.ID,
+		Status:     string(job.Status),
+		Processed:  job.Processed,
+		Error:      job.Error,
+		Result:     job.Result,
+		CreatedAt:  job.CreatedAt,
+		FinishedAt: job.FinishedAt,
+	}
+}
@@ -0,0 +1,184 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	"github.com/RaikyD/UserSegmentationService/internal/auth"
+	"github.com/RaikyD/UserSegmentationService/internal/handler/dto"
+	"github.com/RaikyD/UserSegmentationService/internal/jobs"
+	"github.com/RaikyD/UserSegmentationService/internal/logging"
+	"github.com/RaikyD/UserSegmentationService/internal/service"
+)
+
+// ReportHandler отдаёт отчёты об изменениях привязок.
+type ReportHandler struct {
+	svc service.ReportService
+}
+
+// NewReportHandler создаёт новый HTTP-хэндлер для отчётов.
+func NewReportHandler(svc service.ReportService) *ReportHandler {
+	return &ReportHandler{svc: svc}
+}
+
+// StreamChanges обрабатывает GET /reports/segment-changes?month=YYYY-MM | from=&to=
+func (h *ReportHandler) StreamChanges(w http.ResponseWriter, r *http.Request) {
+	from, to, err := parseReportPeriod(r)
+	if err != nil {
+		badRequest(w, r, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, reportFileName(from, to)))
+	tw := &trackingWriter{ResponseWriter: w}
+	if err := h.svc.WriteChangesCSV(r.Context(), from, to, tw); err != nil {
+		if !tw.wrote {
+			w.Header().Del("Content-Disposition")
+			writeError(w, r, err)
+			return
+		}
+		// Часть отчёта уже отправлена — остаётся только оборвать ответ.
+		logging.RecordError(r.Context(), err)
+		panic(http.ErrAbortHandler)
+	}
+}
+
+// trackingWriter запоминает, начали ли мы уже писать тело ответа.
+type trackingWriter struct {
+	http.ResponseWriter
+	wrote bool
+}
+
+func (w *trackingWriter) Write(p []byte) (int, error) {
+	w.wrote = true
+	return w.ResponseWriter.Write(p)
+}
+
+// StartChanges обрабатывает POST /reports/segment-changes?month=YYYY-MM | from=&to=
+func (h *ReportHandler) StartChanges(w http.ResponseWriter, r *http.Request) {
+	from, to, err := parseReportPeriod(r)
+	if err != nil {
+		badRequest(w, r, err.Error())
+		return
+	}
+	job, err := h.svc.StartChangesReport(r.Context(), from, to)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/reports/"+job.ID.String())
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(toReportResponse(job))
+}
+
+// GetReport обрабатывает GET /reports/{reportID}
+func (h *ReportHandler) GetReport(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "reportID"))
+	if err != nil {
+		badRequest(w, r, "invalid report id")
+		return
+	}
+	job, err := h.svc.GetReport(r.Context(), id)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(toReportResponse(job))
+}
+
+// DownloadReport обрабатывает GET /reports/{reportID}/download
+func (h *ReportHandler) DownloadReport(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "reportID"))
+	if err != nil {
+		badRequest(w, r, "invalid report id")
+		return
+	}
+	f, err := h.svc.OpenReport(r.Context(), id)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	defer f.Close()
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="report-%s.csv"`, id))
+	io.Copy(w, f)
+}
+
+// Register регистрирует маршруты отчётов в роутере
+func (h *ReportHandler) Register(r chi.Router) {
+	r = r.With(requireRole(auth.RoleReader))
+	r.Get("/segment-changes", h.StreamChanges)
+	r.Post("/segment-changes", h.StartChanges)
+	r.Get("/{reportID}", h.GetReport)
+	r.Get("/{reportID}/download", h.DownloadReport)
+}
+
+// parseReportPeriod разбирает период отчёта: либо month=YYYY-MM, либо from/to
+// (RFC3339 или YYYY-MM-DD, to не включается).
+func parseReportPeriod(r *http.Request) (time.Time, time.Time, error) {
+	q := r.URL.Query()
+	if month := q.Get("month"); month != "" {
+		if q.Get("from") != "" || q.Get("to") != "" {
+			return time.Time{}, time.Time{}, errors.New("use either month or from/to")
+		}
+		start, err := time.Parse("2006-01", month)
+		if err != nil {
+			return time.Time{}, time.Time{}, errors.New("invalid month, expected YYYY-MM")
+		}
+		return start, start.AddDate(0, 1, 0), nil
+	}
+	from, err := parseReportTime(q.Get("from"))
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid from: %w", err)
+	}
+	to, err := parseReportTime(q.Get("to"))
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid to: %w", err)
+	}
+	if !from.Before(to) {
+		return time.Time{}, time.Time{}, errors.New("from must be before to")
+	}
+	return from, to, nil
+}
+
+func parseReportTime(v string) (time.Time, error) {
+	if v == "" {
+		return time.Time{}, errors.New("value is required")
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse("2006-01-02", v)
+	if err != nil {
+		return time.Time{}, errors.New("expected RFC3339 or YYYY-MM-DD")
+	}
+	return t, nil
+}
+
+func reportFileName(from, to time.Time) string {
+	return fmt.Sprintf("segment-changes_%s_%s.csv", from.Format("2006-01-02"), to.Format("2006-01-02"))
+}
+
+func toReportResponse(job jobs.Job) dto.ReportResponse {
+	resp := dto.ReportResponse{
+		ID:         job.ID,
+		Status:     string(job.Status),
+		Processed:  job.Processed,
+		Error:      job.Error,
+		CreatedAt:  job.CreatedAt,
+		FinishedAt: job.FinishedAt,
+	}
+	if job.Status == jobs.StatusDone {
+		resp.DownloadURL = "/reports/" + job.ID.String() + "/download"
+	}
+	return resp
+}
@@ -2,12 +2,16 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
 
+	"github.com/RaikyD/UserSegmentationService/internal/auth"
 	"github.com/RaikyD/UserSegmentationService/internal/handler/dto"
 	"github.com/RaikyD/UserSegmentationService/internal/models"
 	"github.com/RaikyD/UserSegmentationService/internal/service"
@@ -27,7 +31,7 @@ func NewSegmentHandler(svc service.SegmentService) *SegmentHandler {
 func (h *SegmentHandler) CreateSegment(w http.ResponseWriter, r *http.Request) {
 	var req dto.CreateSegmentRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "invalid request payload", http.StatusBadRequest)
+		badRequest(w, r, "invalid request payload")
 		return
 	}
 	seg := &models.Segment{
@@ -37,6 +41,8 @@ func (h *SegmentHandler) CreateSegment(w http.ResponseWriter, r *http.Request) {
 		Description: "",
 		IsActive:    true,
 		CreatedOn:   time.Now(),
+		ValidFrom:   req.ValidFrom,
+		ValidTo:     req.ValidTo,
 	}
 	if req.Description != nil {
 		seg.Description = *req.Description
@@ -46,97 +52,117 @@ func (h *SegmentHandler) CreateSegment(w http.ResponseWriter, r *http.Request) {
 	}
 	created, err := h.svc.CreateSegment(r.Context(), seg)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
-	resp := dto.SegmentResponse{
-		ID:          created.ID,
-		Name:        created.SegmentName,
-		Type:        string(created.Type),
-		Config:      created.Config,
-		Description: &created.Description,
-		IsActive:    created.IsActive,
-		CreatedOn:   created.CreatedOn,
-	}
+	resp := toSegmentResponse(created)
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(resp)
 }
 
-// ListSegments обрабатывает GET /segments
+// ListSegments обрабатывает GET /segments?limit=&cursor=&sort=&type=&is_active=&name_prefix=&created_from=&created_to=
 func (h *SegmentHandler) ListSegments(w http.ResponseWriter, r *http.Request) {
-	segments, err := h.svc.ListSegments(r.Context())
+	page, err := parsePage(r)
+	if err != nil {
+		badRequest(w, r, err.Error())
+		return
+	}
+	filter, err := parseSegmentFilter(r)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		badRequest(w, r, err.Error())
 		return
 	}
-	var resp []dto.SegmentResponse
+	sort := models.SegmentSort(r.URL.Query().Get("sort"))
+	if sort != "" && !sort.Valid() {
+		badRequest(w, r, "sort must be one of created_on, -created_on, name, -name")
+		return
+	}
+	segments, next, err := h.svc.ListSegments(r.Context(), filter, sort, page)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	resp := dto.SegmentListResponse{
+		Segments:   make([]dto.SegmentResponse, 0, len(segments)),
+		NextCursor: next,
+	}
 	for _, s := range segments {
-		resp = append(resp, dto.SegmentResponse{
-			ID:          s.ID,
-			Name:        s.SegmentName,
-			Type:        string(s.Type),
-			Config:      s.Config,
-			Description: &s.Description,
-			IsActive:    s.IsActive,
-			CreatedOn:   s.CreatedOn,
-		})
+		resp.Segments = append(resp.Segments, toSegmentResponse(s))
 	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(resp)
 }
 
-// GetSegment обрабатывает GET /segments/{id}
+// parseSegmentFilter читает фильтры списка сегментов из query-параметров.
+func parseSegmentFilter(r *http.Request) (models.SegmentFilter, error) {
+	var f models.SegmentFilter
+	q := r.URL.Query()
+	if v := q.Get("type"); v != "" {
+		t := models.SegmentType(v)
+		switch t {
+		case models.SegmentTypeStatic, models.SegmentTypeDynamic, models.SegmentTypeDynamicRule, models.SegmentTypeComposite:
+		default:
+			return f, fmt.Errorf("unknown segment type %q", v)
+		}
+		f.Type = &t
+	}
+	if v := q.Get("is_active"); v != "" {
+		active, err := strconv.ParseBool(v)
+		if err != nil {
+			return f, errors.New("is_active must be true or false")
+		}
+		f.IsActive = &active
+	}
+	f.NamePrefix = q.Get("name_prefix")
+	if v := q.Get("created_from"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return f, errors.New("invalid created_from, expected RFC3339 timestamp")
+		}
+		f.CreatedFrom = &t
+	}
+	if v := q.Get("created_to"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return f, errors.New("invalid created_to, expected RFC3339 timestamp")
+		}
+		f.CreatedTo = &t
+	}
+	return f, nil
+}
+
+// GetSegment обрабатывает GET /segments/{id}, где id — UUID или имя сегмента
 func (h *SegmentHandler) GetSegment(w http.ResponseWriter, r *http.Request) {
-	idParam := chi.URLParam(r, "id")
-	id, err := uuid.Parse(idParam)
-	if err != nil {
-		http.Error(w, "invalid segment id", http.StatusBadRequest)
+	id, ok := h.segmentID(w, r)
+	if !ok {
 		return
 	}
 	seg, err := h.svc.GetSegmentByID(r.Context(), id)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-	if seg == nil {
-		http.Error(w, "segment not found", http.StatusNotFound)
+		writeError(w, r, err)
 		return
 	}
-	resp := dto.SegmentResponse{
-		ID:          seg.ID,
-		Name:        seg.SegmentName,
-		Type:        string(seg.Type),
-		Config:      seg.Config,
-		Description: &seg.Description,
-		IsActive:    seg.IsActive,
-		CreatedOn:   seg.CreatedOn,
-	}
+	resp := toSegmentResponse(seg)
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(resp)
 }
 
 // UpdateSegment обрабатывает PUT /segments/{id}
 func (h *SegmentHandler) UpdateSegment(w http.ResponseWriter, r *http.Request) {
-	idParam := chi.URLParam(r, "id")
-	id, err := uuid.Parse(idParam)
-	if err != nil {
-		http.Error(w, "invalid segment id", http.StatusBadRequest)
+	id, ok := h.segmentID(w, r)
+	if !ok {
 		return
 	}
 	var req dto.UpdateSegmentRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "invalid request payload", http.StatusBadRequest)
+		badRequest(w, r, "invalid request payload")
 		return
 	}
 	// Fetch existing
 	existing, err := h.svc.GetSegmentByID(r.Context(), id)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-	if existing == nil {
-		http.Error(w, "segment not found", http.StatusNotFound)
+		writeError(w, r, err)
 		return
 	}
 	if req.Name != nil {
@@ -154,44 +180,70 @@ func (h *SegmentHandler) UpdateSegment(w http.ResponseWriter, r *http.Request) {
 	if req.IsActive != nil {
 		existing.IsActive = *req.IsActive
 	}
+	if req.ValidFrom.Set {
+		existing.ValidFrom = req.ValidFrom.Value
+	}
+	if req.ValidTo.Set {
+		existing.ValidTo = req.ValidTo.Value
+	}
 	updated, err := h.svc.UpdateSegment(r.Context(), existing)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
-	resp := dto.SegmentResponse{
-		ID:          updated.ID,
-		Name:        updated.SegmentName,
-		Type:        string(updated.Type),
-		Config:      updated.Config,
-		Description: &updated.Description,
-		IsActive:    updated.IsActive,
-		CreatedOn:   updated.CreatedOn,
-	}
+	resp := toSegmentResponse(updated)
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(resp)
 }
 
 // DeleteSegment обрабатывает DELETE /segments/{id}
 func (h *SegmentHandler) DeleteSegment(w http.ResponseWriter, r *http.Request) {
-	idParam := chi.URLParam(r, "id")
-	id, err := uuid.Parse(idParam)
-	if err != nil {
-		http.Error(w, "invalid segment id", http.StatusBadRequest)
+	id, ok := h.segmentID(w, r)
+	if !ok {
 		return
 	}
 	if err := h.svc.DeleteSegment(r.Context(), id); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// segmentID достаёт из пути ссылку на сегмент (UUID или имя) и превращает её в ID.
+// При ошибке сам пишет ответ и возвращает false.
+func (h *SegmentHandler) segmentID(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	id, err := h.svc.ResolveSegmentID(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, r, err)
+		return uuid.Nil, false
+	}
+	return id, true
+}
+
 // Register регистрирует маршруты сегментов в роутере
 func (h *SegmentHandler) Register(r chi.Router) {
-	r.Post("/", h.CreateSegment)
-	r.Get("/", h.ListSegments)
-	r.Get("/{id}", h.GetSegment)
-	r.Put("/{id}", h.UpdateSegment)
-	r.Delete("/{id}", h.DeleteSegment)
+	read := r.With(requireRole(auth.RoleReader))
+	admin := r.With(requireRole(auth.RoleSegmentAdmin))
+	admin.Post("/", h.CreateSegment)
+	read.Get("/", h.ListSegments)
+	read.Get("/{id}", h.GetSegment)
+	admin.Put("/{id}", h.UpdateSegment)
+	admin.Delete("/{id}", h.DeleteSegment)
+}
+
+// toSegmentResponse собирает ответ по сегменту. is_active отражает фактическую
+// активность с учётом окна valid_from/valid_to.
+func toSegmentResponse(s *models.Segment) dto.SegmentResponse {
+	return dto.SegmentResponse{
+		ID:          s.ID,
+		Tenant:      s.Tenant,
+		Name:        s.SegmentName,
+		Type:        string(s.Type),
+		Config:      s.Config,
+		Description: &s.Description,
+		IsActive:    s.ActiveAt(time.Now()),
+		CreatedOn:   s.CreatedOn,
+		ValidFrom:   s.ValidFrom,
+		ValidTo:     s.ValidTo,
+	}
 }
@@ -0,0 +1,90 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	"github.com/RaikyD/UserSegmentationService/internal/models"
+	"github.com/RaikyD/UserSegmentationService/internal/service"
+)
+
+// fakeSegmentService хранит один сегмент и запоминает, что ушло в UpdateSegment.
+type fakeSegmentService struct {
+	service.SegmentService
+	seg     models.Segment
+	updated *models.Segment
+}
+
+func (f *fakeSegmentService) ResolveSegmentID(_ context.Context, ref string) (uuid.UUID, error) {
+	return uuid.Parse(ref)
+}
+
+func (f *fakeSegmentService) GetSegmentByID(context.Context, uuid.UUID) (*models.Segment, error) {
+	seg := f.seg
+	return &seg, nil
+}
+
+func (f *fakeSegmentService) UpdateSegment(_ context.Context, seg *models.Segment) (*models.Segment, error) {
+	f.updated = seg
+	return seg, nil
+}
+
+func TestUpdateSegmentValidity(t *testing.T) {
+	from := time.Date(2025, 8, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2025, 9, 1, 0, 0, 0, 0, time.UTC)
+	moved := time.Date(2025, 10, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		body     string
+		wantFrom *time.Time
+		wantTo   *time.Time
+	}{
+		{"absent keeps both", `{"description": "x"}`, &from, &to},
+		{"null clears", `{"valid_to": null}`, &from, nil},
+		{"null clears both", `{"valid_from": null, "valid_to": null}`, nil, nil},
+		{"value replaces", `{"valid_to": "2025-10-01T00:00:00Z"}`, &from, &moved},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := &fakeSegmentService{seg: models.Segment{ID: uuid.New(), SegmentName: "beta", ValidFrom: &from, ValidTo: &to}}
+			r := chi.NewRouter()
+			r.Use(Authenticate(nil))
+			r.Route("/segments", NewSegmentHandler(svc).Register)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/segments/"+svc.seg.ID.String(), strings.NewReader(tt.body)))
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d: %s", w.Code, w.Body)
+			}
+			if !sameTime(svc.updated.ValidFrom, tt.wantFrom) || !sameTime(svc.updated.ValidTo, tt.wantTo) {
+				t.Errorf("window = [%v, %v), want [%v, %v)", svc.updated.ValidFrom, svc.updated.ValidTo, tt.wantFrom, tt.wantTo)
+			}
+		})
+	}
+
+	t.Run("invalid date", func(t *testing.T) {
+		svc := &fakeSegmentService{seg: models.Segment{ID: uuid.New()}}
+		r := chi.NewRouter()
+		r.Use(Authenticate(nil))
+		r.Route("/segments", NewSegmentHandler(svc).Register)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/segments/"+svc.seg.ID.String(), strings.NewReader(`{"valid_to": "soon"}`)))
+		if w.Code != http.StatusBadRequest || svc.updated != nil {
+			t.Errorf("status = %d, updated = %v, want 400 without an update", w.Code, svc.updated)
+		}
+	})
+}
+
+func sameTime(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
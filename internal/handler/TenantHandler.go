@@ -0,0 +1,49 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/RaikyD/UserSegmentationService/internal/auth"
+	"github.com/RaikyD/UserSegmentationService/internal/handler/dto"
+	"github.com/RaikyD/UserSegmentationService/internal/service"
+)
+
+// TenantHandler отдаёт администраторам платформы сводку по арендаторам.
+type TenantHandler struct {
+	svc service.TenantService
+}
+
+// NewTenantHandler создаёт новый HTTP-хэндлер для арендаторов.
+func NewTenantHandler(svc service.TenantService) *TenantHandler {
+	return &TenantHandler{svc: svc}
+}
+
+// ListTenants обрабатывает GET /tenants
+func (h *TenantHandler) ListTenants(w http.ResponseWriter, r *http.Request) {
+	usage, err := h.svc.ListTenants(r.Context())
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	resp := dto.TenantListResponse{Tenants: make([]dto.TenantResponse, 0, len(usage))}
+	for _, u := range usage {
+		resp.Tenants = append(resp.Tenants, dto.TenantResponse{
+			Name:           u.Tenant,
+			Segments:       u.Segments,
+			ActiveSegments: u.ActiveSegments,
+			Assignments:    u.Assignments,
+			Users:          u.Users,
+		})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// Register регистрирует маршруты арендаторов в роутере
+func (h *TenantHandler) Register(r chi.Router) {
+	r = r.With(requireRole(auth.RoleSegmentAdmin), requirePlatform)
+	r.Get("/", h.ListTenants)
+}
@@ -0,0 +1,54 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/RaikyD/UserSegmentationService/internal/auth"
+	"github.com/RaikyD/UserSegmentationService/internal/tenant"
+)
+
+// TenantHeader — заголовок, которым вызывающий выбирает арендатора.
+const TenantHeader = "X-Tenant"
+
+// ResolveTenant кладёт в контекст арендатора запроса. Вызывающий, привязанный
+// к арендатору, работает только с ним, и другой X-Tenant получает 403. Остальные
+// выбирают арендатора заголовком X-Tenant, без него — tenant.Default.
+// Ставится после Authenticate.
+func ResolveTenant(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := r.Header.Get(TenantHeader)
+		if p, ok := auth.FromContext(r.Context()); ok && p.Tenant != "" {
+			if name != "" && name != p.Tenant {
+				writeErrorResponse(w, r, http.StatusForbidden, codeForbidden, "access to tenant "+name+" denied")
+				return
+			}
+			name = p.Tenant
+		}
+		if name == "" {
+			name = tenant.Default
+		}
+		if !tenant.Valid(name) {
+			writeErrorResponse(w, r, http.StatusBadRequest, codeValidation, "invalid tenant name")
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(tenant.With(r.Context(), name)))
+	})
+}
+
+// requirePlatform пропускает только вызывающих, не привязанных к арендатору:
+// сводка по всем арендаторам не должна быть видна одному из них, а изменение
+// общих профилей пользователей не должно задевать чужие данные.
+func requirePlatform(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, ok := auth.FromContext(r.Context())
+		if !ok {
+			unauthorized(w, r, "authentication required")
+			return
+		}
+		if p.Tenant != "" {
+			writeErrorResponse(w, r, http.StatusForbidden, codeForbidden, "platform-wide credentials required")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
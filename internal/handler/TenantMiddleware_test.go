@@ -0,0 +1,85 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/RaikyD/UserSegmentationService/internal/auth"
+	"github.com/RaikyD/UserSegmentationService/internal/tenant"
+)
+
+// tenantRequest проводит запрос вызывающего p через ResolveTenant и возвращает
+// статус и выбранного арендатора.
+func tenantRequest(p *auth.Principal, header string) (int, string) {
+	var got string
+	h := ResolveTenant(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = tenant.FromContext(r.Context())
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/segments", nil)
+	if p != nil {
+		req = req.WithContext(auth.WithPrincipal(req.Context(), p))
+	}
+	if header != "" {
+		req.Header.Set(TenantHeader, header)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return w.Code, got
+}
+
+func TestResolveTenant(t *testing.T) {
+	bound := &auth.Principal{Name: "acme-app", Tenant: "acme"}
+	platform := &auth.Principal{Name: "ops"}
+
+	tests := []struct {
+		name       string
+		principal  *auth.Principal
+		header     string
+		wantStatus int
+		wantTenant string
+	}{
+		{"platform default", platform, "", http.StatusOK, tenant.Default},
+		{"platform picks tenant", platform, "globex", http.StatusOK, "globex"},
+		{"platform invalid tenant", platform, "Not Valid", http.StatusBadRequest, ""},
+		{"bound tenant", bound, "", http.StatusOK, "acme"},
+		{"bound same header", bound, "acme", http.StatusOK, "acme"},
+		{"bound other tenant", bound, "globex", http.StatusForbidden, ""},
+		{"no principal", nil, "globex", http.StatusOK, "globex"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, got := tenantRequest(tt.principal, tt.header)
+			if status != tt.wantStatus || got != tt.wantTenant {
+				t.Errorf("got %d %q, want %d %q", status, got, tt.wantStatus, tt.wantTenant)
+			}
+		})
+	}
+}
+
+func TestRequirePlatform(t *testing.T) {
+	r := chi.NewRouter()
+	r.With(requirePlatform).Get("/tenants", func(http.ResponseWriter, *http.Request) {})
+	tests := []struct {
+		name       string
+		principal  *auth.Principal
+		wantStatus int
+	}{
+		{"platform", &auth.Principal{Name: "ops"}, http.StatusOK},
+		{"bound to tenant", &auth.Principal{Name: "acme-app", Tenant: "acme"}, http.StatusForbidden},
+		{"anonymous", nil, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/tenants", nil)
+		if tt.principal != nil {
+			req = req.WithContext(auth.WithPrincipal(req.Context(), tt.principal))
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != tt.wantStatus {
+			t.Errorf("%s: status = %d, want %d", tt.name, w.Code, tt.wantStatus)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	"github.com/RaikyD/UserSegmentationService/internal/auth"
+	"github.com/RaikyD/UserSegmentationService/internal/handler/dto"
+	"github.com/RaikyD/UserSegmentationService/internal/models"
+	"github.com/RaikyD/UserSegmentationService/internal/service"
+)
+
+const (
+	defaultUsersLimit = 100
+	maxUsersLimit     = 1000
+)
+
+// UserHandler обрабатывает HTTP-запросы, связанные с пользователями.
+type UserHandler struct {
+	svc service.UserService
+}
+
+// NewUserHandler создаёт новый HTTP-хэндлер для пользователей.
+func NewUserHandler(svc service.UserService) *UserHandler {
+	return &UserHandler{svc: svc}
+}
+
+// CreateUser обрабатывает POST /users
+func (h *UserHandler) CreateUser(w http.ResponseWriter, r *http.Request) {
+	var req dto.CreateUserRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		badRequest(w, r, "invalid request payload")
+		return
+	}
+	user := &models.User{Attributes: req.Attributes}
+	if req.ID != nil {
+		user.ID = *req.ID
+	}
+	created, err := h.svc.CreateUser(r.Context(), user)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(toUserResponse(created))
+}
+
+// ListUsers обрабатывает GET /users?limit=&offset=
+func (h *UserHandler) ListUsers(w http.ResponseWriter, r *http.Request) {
+	limit := defaultUsersLimit
+	offset := 0
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxUsersLimit {
+			badRequest(w, r, "limit must be between 1 and 1000")
+			return
+		}
+		limit = n
+	}
+	if v := r.URL.Query().Get("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			badRequest(w, r, "invalid offset")
+			return
+		}
+		offset = n
+	}
+	users, err := h.svc.ListUsers(r.Context(), limit, offset)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	resp := make([]dto.UserResponse, 0, len(users))
+	for _, u := range users {
+		resp = append(resp, toUserResponse(u))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// GetUser обрабатывает GET /users/{userID}
+func (h *UserHandler) GetUser(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "userID"))
+	if err != nil {
+		badRequest(w, r, "invalid user id")
+		return
+	}
+	user, err := h.svc.GetUser(r.Context(), id)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(toUserResponse(user))
+}
+
+// UpdateUser обрабатывает PUT /users/{userID}
+func (h *UserHandler) UpdateUser(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "userID"))
+	if err != nil {
+		badRequest(w, r, "invalid user id")
+		return
+	}
+	var req dto.UpdateUserRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		badRequest(w, r, "invalid request payload")
+		return
+	}
+	updated, err := h.svc.UpdateUser(r.Context(), &models.User{ID: id, Attributes: req.Attributes})
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(toUserResponse(updated))
+}
+
+// DeleteUser обрабатывает DELETE /users/{userID}
+func (h *UserHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "userID"))
+	if err != nil {
+		badRequest(w, r, "invalid user id")
+		return
+	}
+	if err := h.svc.DeleteUser(r.Context(), id); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Register регистрирует маршруты пользователей в роутере
+func (h *UserHandler) Register(r chi.Router) {
+	read := r.With(requireRole(auth.RoleReader))
+	write := r.With(requireRole(auth.RoleAssigner))
+	// Профили общие для всех арендаторов: удаление снимает привязки пользователя
+	// у каждого из них, а атрибуты влияют на их dynamic_rule-сегменты.
+	platform := write.With(requirePlatform)
+	write.Post("/", h.CreateUser)
+	read.Get("/", h.ListUsers)
+	read.Get("/{userID}", h.GetUser)
+	platform.Put("/{userID}", h.UpdateUser)
+	platform.Delete("/{userID}", h.DeleteUser)
+}
+
+func toUserResponse(u *models.User) dto.UserResponse {
+	return dto.UserResponse{
+		ID:         u.ID,
+		Attributes: u.Attributes,
+		CreatedAt:  u.CreatedAt,
+		UpdatedAt:  u.UpdatedAt,
+	}
+}
@@ -0,0 +1,64 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	"github.com/RaikyD/UserSegmentationService/internal/auth"
+	"github.com/RaikyD/UserSegmentationService/internal/models"
+	"github.com/RaikyD/UserSegmentationService/internal/service"
+)
+
+// fakeUsers принимает любые изменения профилей.
+type fakeUsers struct {
+	service.UserService
+}
+
+func (fakeUsers) GetUser(_ context.Context, id uuid.UUID) (*models.User, error) {
+	return &models.User{ID: id}, nil
+}
+
+func (fakeUsers) UpdateUser(_ context.Context, user *models.User) (*models.User, error) {
+	return user, nil
+}
+
+func (fakeUsers) DeleteUser(context.Context, uuid.UUID) error { return nil }
+
+func TestUserProfilesArePlatformOnly(t *testing.T) {
+	acme := "acme"
+	keys := &memAPIKeys{keys: map[string]*models.APIKey{
+		"usk_platform": {Name: "ops", Roles: []string{"assigner"}},
+		"usk_acme":     {Name: "acme-app", Roles: []string{"assigner"}, Tenant: &acme},
+	}}
+	r := chi.NewRouter()
+	r.Use(Authenticate(auth.NewAuthenticator(keys, nil)))
+	r.Route("/users", NewUserHandler(fakeUsers{}).Register)
+
+	path := "/users/" + uuid.NewString()
+	tests := []struct {
+		method     string
+		key        string
+		wantStatus int
+	}{
+		{http.MethodGet, "usk_acme", http.StatusOK},
+		{http.MethodPut, "usk_acme", http.StatusForbidden},
+		{http.MethodDelete, "usk_acme", http.StatusForbidden},
+		{http.MethodPut, "usk_platform", http.StatusOK},
+		{http.MethodDelete, "usk_platform", http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, path, strings.NewReader(`{"attributes": {"country": "KZ"}}`))
+		req.Header.Set(APIKeyHeader, tt.key)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != tt.wantStatus {
+			t.Errorf("%s as %s: status = %d, want %d", tt.method, tt.key, w.Code, tt.wantStatus)
+		}
+	}
+}
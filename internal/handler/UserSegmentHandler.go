@@ -1,15 +1,21 @@
 package handler
 
 import (
+	"encoding/csv"
 	"encoding/json"
-	"log"
+	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/RaikyD/UserSegmentationService/internal/auth"
 	"github.com/RaikyD/UserSegmentationService/internal/handler/dto"
+	"github.com/RaikyD/UserSegmentationService/internal/logging"
+	"github.com/RaikyD/UserSegmentationService/internal/models"
 	"github.com/RaikyD/UserSegmentationService/internal/service"
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
-	"github.com/jackc/pgx/v5"
 )
 
 type UserSegmentHandler struct {
@@ -21,51 +27,69 @@ func NewUserSegmentHandler(svc service.UserSegmentService) *UserSegmentHandler {
 }
 
 func (h *UserSegmentHandler) Register(r chi.Router) {
-	r.Post("/segments/{segmentID}/users", h.AssignUser)
-	r.Delete("/segments/{segmentID}/users/{userID}", h.UnassignUser)
-	r.Get("/users/{userID}/segments", h.ListUserSegments)
-	r.Get("/segments/{segmentID}/users", h.ListSegmentUsers)
-	r.Post("/segments/mass-assign", h.MassAssignSegment)
+	read := r.With(requireRole(auth.RoleReader))
+	assign := r.With(requireRole(auth.RoleAssigner))
+	assign.Post("/segments/{segmentID}/users", h.AssignUser)
+	assign.Delete("/segments/{segmentID}/users/{userID}", h.UnassignUser)
+	read.Get("/users/{userID}/segments", h.ListUserSegments)
+	assign.Post("/users/{userID}/segments", h.UpdateUserSegments)
+	read.Get("/users/{userID}/segments/history", h.ListUserHistory)
+	read.Get("/users/{userID}/segments/check", h.CheckUserSegments)
+	read.Post("/membership/check", h.CheckMembership)
+	read.Get("/segments/{segmentID}/users", h.ListSegmentUsers)
+	assign.Post("/segments/mass-assign", h.MassAssignSegment)
+}
+
+// RegisterExport регистрирует потоковые выгрузки. Они могут идти дольше общего
+// таймаута запроса, поэтому подключаются отдельно от Register.
+func (h *UserSegmentHandler) RegisterExport(r chi.Router) {
+	r.With(requireRole(auth.RoleReader)).Get("/segments/{segmentID}/users/export", h.ExportSegmentUsers)
 }
 
 func (h *UserSegmentHandler) AssignUser(w http.ResponseWriter, r *http.Request) {
-	segmentID, err := uuid.Parse(chi.URLParam(r, "segmentID"))
-	if err != nil {
-		http.Error(w, "invalid segment id", http.StatusBadRequest)
+	segmentID, ok := h.segmentID(w, r, chi.URLParam(r, "segmentID"))
+	if !ok {
 		return
 	}
 	var req dto.AssignUserRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "invalid request body", http.StatusBadRequest)
+		badRequest(w, r, "invalid request body")
 		return
 	}
 
-	log.Printf("AssignUser: req.UserID = %s", req.UserID)
-
-	if err := h.svc.AssignUser(r.Context(), segmentID, req.UserID); err != nil {
-		if err == pgx.ErrNoRows {
-			http.Error(w, "segment not found", http.StatusNotFound)
-		} else {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+	expiresAt := req.ExpiresAt
+	if req.TTLSeconds != nil {
+		if expiresAt != nil {
+			validationError(w, r, "expires_at and ttl_seconds are mutually exclusive")
+			return
 		}
+		if *req.TTLSeconds <= 0 {
+			validationError(w, r, "ttl_seconds must be positive")
+			return
+		}
+		t := time.Now().Add(time.Duration(*req.TTLSeconds) * time.Second)
+		expiresAt = &t
+	}
+
+	if err := h.svc.AssignUser(r.Context(), segmentID, req.UserID, expiresAt); err != nil {
+		writeError(w, r, err)
 		return
 	}
 	w.WriteHeader(http.StatusNoContent)
 }
 
 func (h *UserSegmentHandler) UnassignUser(w http.ResponseWriter, r *http.Request) {
-	segmentID, err := uuid.Parse(chi.URLParam(r, "segmentID"))
-	if err != nil {
-		http.Error(w, "invalid segment id", http.StatusBadRequest)
+	segmentID, ok := h.segmentID(w, r, chi.URLParam(r, "segmentID"))
+	if !ok {
 		return
 	}
 	userID, err := uuid.Parse(chi.URLParam(r, "userID"))
 	if err != nil {
-		http.Error(w, "invalid user id", http.StatusBadRequest)
+		badRequest(w, r, "invalid user id")
 		return
 	}
 	if err := h.svc.UnassignUser(r.Context(), segmentID, userID); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 	w.WriteHeader(http.StatusNoContent)
@@ -74,66 +98,362 @@ func (h *UserSegmentHandler) UnassignUser(w http.ResponseWriter, r *http.Request
 func (h *UserSegmentHandler) ListUserSegments(w http.ResponseWriter, r *http.Request) {
 	userID, err := uuid.Parse(chi.URLParam(r, "userID"))
 	if err != nil {
-		http.Error(w, "invalid user id", http.StatusBadRequest)
+		badRequest(w, r, "invalid user id")
+		return
+	}
+	var (
+		segs []*models.UserSegment
+		next string
+	)
+	// Срез на момент at строится по журналу и не разбивается на страницы.
+	if atParam := r.URL.Query().Get("at"); atParam != "" {
+		at, parseErr := time.Parse(time.RFC3339, atParam)
+		if parseErr != nil {
+			badRequest(w, r, "invalid at, expected RFC3339 timestamp")
+			return
+		}
+		segs, err = h.svc.ListUserSegmentsAt(r.Context(), userID, at)
+	} else {
+		page, parseErr := parsePage(r)
+		if parseErr != nil {
+			badRequest(w, r, parseErr.Error())
+			return
+		}
+		var includeInactive bool
+		if v := r.URL.Query().Get("include_inactive"); v != "" {
+			if includeInactive, parseErr = strconv.ParseBool(v); parseErr != nil {
+				badRequest(w, r, "include_inactive must be true or false")
+				return
+			}
+		}
+		segs, next, err = h.svc.ListUserSegments(r.Context(), userID, includeInactive, page)
+	}
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	resp := dto.UserSegmentsResponse{
+		UserID:     userID,
+		Segments:   make([]dto.UserSegmentResponse, 0, len(segs)),
+		NextCursor: next,
+	}
+	for _, us := range segs {
+		resp.Segments = append(resp.Segments, dto.UserSegmentResponse{
+			SegmentResponse: toSegmentResponse(us.Segment),
+			AssignmentType:  string(us.AssignmentType),
+			AssignedAt:      us.AssignedAt,
+			ExpiresAt:       us.ExpiresAt,
+		})
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+// UpdateUserSegments обрабатывает POST /users/{userID}/segments
+func (h *UserSegmentHandler) UpdateUserSegments(w http.ResponseWriter, r *http.Request) {
+	userID, err := uuid.Parse(chi.URLParam(r, "userID"))
+	if err != nil {
+		badRequest(w, r, "invalid user id")
+		return
+	}
+	var req dto.UpdateUserSegmentsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		badRequest(w, r, "invalid request body")
+		return
+	}
+	if len(req.Add) == 0 && len(req.Remove) == 0 {
+		validationError(w, r, "add or remove must not be empty")
+		return
+	}
+	if err := h.svc.UpdateUserSegments(r.Context(), userID, req.Add, req.Remove); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListUserHistory обрабатывает GET /users/{userID}/segments/history
+func (h *UserSegmentHandler) ListUserHistory(w http.ResponseWriter, r *http.Request) {
+	userID, err := uuid.Parse(chi.URLParam(r, "userID"))
+	if err != nil {
+		badRequest(w, r, "invalid user id")
 		return
 	}
-	segs, err := h.svc.ListUserSegments(r.Context(), userID)
+	events, err := h.svc.ListUserHistory(r.Context(), userID)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-	var resp dto.UserSegmentsResponse
-	resp.UserID = userID
-	for _, s := range segs {
-		resp.Segments = append(resp.Segments, dto.SegmentResponse{
-			ID:          s.ID,
-			Name:        s.SegmentName,
-			Type:        string(s.Type),
-			Config:      s.Config,
-			Description: &s.Description,
-			IsActive:    s.IsActive,
-			CreatedOn:   s.CreatedOn,
+		writeError(w, r, err)
+		return
+	}
+	resp := dto.UserSegmentHistoryResponse{
+		UserID: userID,
+		Events: make([]dto.AssignmentEventResponse, 0, len(events)),
+	}
+	for _, ev := range events {
+		resp.Events = append(resp.Events, dto.AssignmentEventResponse{
+			SegmentID:  ev.SegmentID,
+			Operation:  string(ev.Operation),
+			Source:     string(ev.Source),
+			Actor:      ev.Actor,
+			ExpiresAt:  ev.ExpiresAt,
+			OccurredAt: ev.OccurredAt,
 		})
 	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// Ограничения на размер запросов проверки членства.
+const (
+	maxCheckSegments = 100
+	maxCheckPairs    = 1000
+)
+
+// CheckUserSegments обрабатывает GET /users/{userID}/segments/check?segments=a,b,c
+func (h *UserSegmentHandler) CheckUserSegments(w http.ResponseWriter, r *http.Request) {
+	userID, err := uuid.Parse(chi.URLParam(r, "userID"))
+	if err != nil {
+		badRequest(w, r, "invalid user id")
+		return
+	}
+	var refs []string
+	for _, ref := range strings.Split(r.URL.Query().Get("segments"), ",") {
+		if ref = strings.TrimSpace(ref); ref != "" {
+			refs = append(refs, ref)
+		}
+	}
+	if len(refs) == 0 {
+		validationError(w, r, "segments must not be empty")
+		return
+	}
+	if len(refs) > maxCheckSegments {
+		validationError(w, r, fmt.Sprintf("at most %d segments per request", maxCheckSegments))
+		return
+	}
+	results, err := h.svc.CheckUserSegments(r.Context(), userID, refs)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	resp := dto.UserSegmentsCheckResponse{
+		UserID:   userID,
+		Segments: make([]dto.SegmentMembership, len(results)),
+	}
+	for i, res := range results {
+		resp.Segments[i] = toSegmentMembership(refs[i], res)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// CheckMembership обрабатывает POST /membership/check
+func (h *UserSegmentHandler) CheckMembership(w http.ResponseWriter, r *http.Request) {
+	var req dto.MembershipCheckRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		badRequest(w, r, "invalid request body")
+		return
+	}
+	if len(req.Checks) == 0 {
+		validationError(w, r, "checks must not be empty")
+		return
+	}
+	if len(req.Checks) > maxCheckPairs {
+		validationError(w, r, fmt.Sprintf("at most %d checks per request", maxCheckPairs))
+		return
+	}
+	checks := make([]models.MembershipCheck, len(req.Checks))
+	for i, c := range req.Checks {
+		if c.UserID == uuid.Nil || c.Segment == "" {
+			validationError(w, r, fmt.Sprintf("checks[%d]: user_id and segment are required", i))
+			return
+		}
+		checks[i] = models.MembershipCheck{UserID: c.UserID, Segment: c.Segment}
+	}
+	results, err := h.svc.CheckMembership(r.Context(), checks)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	resp := dto.MembershipCheckResponse{Results: make([]dto.MembershipCheckResult, len(results))}
+	for i, res := range results {
+		resp.Results[i] = dto.MembershipCheckResult{
+			UserID:            res.UserID,
+			SegmentMembership: toSegmentMembership(checks[i].Segment, res),
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(resp)
 }
 
+func toSegmentMembership(ref string, m *models.Membership) dto.SegmentMembership {
+	return dto.SegmentMembership{
+		Segment:        ref,
+		SegmentID:      m.Segment.ID,
+		Member:         m.Member,
+		AssignmentType: string(m.AssignmentType),
+	}
+}
+
 func (h *UserSegmentHandler) ListSegmentUsers(w http.ResponseWriter, r *http.Request) {
-	segmentID, err := uuid.Parse(chi.URLParam(r, "segmentID"))
+	segmentID, ok := h.segmentID(w, r, chi.URLParam(r, "segmentID"))
+	if !ok {
+		return
+	}
+	page, err := parsePage(r)
 	if err != nil {
-		http.Error(w, "invalid segment id", http.StatusBadRequest)
+		badRequest(w, r, err.Error())
 		return
 	}
-	users, err := h.svc.ListSegmentUsers(r.Context(), segmentID)
+	users, next, err := h.svc.ListSegmentUsers(r.Context(), segmentID, page)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 	resp := dto.SegmentUsersResponse{
-		SegmentID: segmentID,
-		UserIDs:   users,
+		SegmentID:  segmentID,
+		UserIDs:    users,
+		NextCursor: next,
 	}
 	json.NewEncoder(w).Encode(resp)
 }
 
+// exportFlushEvery — через сколько строк выгрузки сбрасывать буфер клиенту.
+const exportFlushEvery = 1000
+
+// ExportSegmentUsers обрабатывает GET /segments/{segmentID}/users/export?format=csv|ndjson.
+// Строки пишутся в ответ по мере чтения из БД, без накопления в памяти.
+func (h *UserSegmentHandler) ExportSegmentUsers(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "csv"
+	}
+	if format != "csv" && format != "ndjson" {
+		badRequest(w, r, "format must be csv or ndjson")
+		return
+	}
+	segmentID, ok := h.segmentID(w, r, chi.URLParam(r, "segmentID"))
+	if !ok {
+		return
+	}
+
+	tw := &trackingWriter{ResponseWriter: w}
+	flusher, _ := w.(http.Flusher)
+	var (
+		writeRow func(*models.UserSegmentAssignment) error
+		flush    func() error
+	)
+	switch format {
+	case "csv":
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="segment-%s-users.csv"`, segmentID))
+		// Заголовок остаётся в буфере csv.Writer до первого сброса, поэтому ошибку
+		// запроса к БД ещё можно отдать обычным ответом.
+		cw := csv.NewWriter(tw)
+		cw.Write([]string{"user_id", "assignment_type", "assigned_at", "expires_at"})
+		writeRow = func(asg *models.UserSegmentAssignment) error {
+			return cw.Write([]string{
+				asg.UserID.String(),
+				string(asg.AssignmentType),
+				formatExportTime(exportAssignedAt(asg)),
+				formatExportTime(asg.ExpiresAt),
+			})
+		}
+		flush = func() error {
+			cw.Flush()
+			return cw.Error()
+		}
+	case "ndjson":
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		enc := json.NewEncoder(tw)
+		writeRow = func(asg *models.UserSegmentAssignment) error {
+			return enc.Encode(dto.SegmentMemberExport{
+				UserID:         asg.UserID,
+				AssignmentType: string(asg.AssignmentType),
+				AssignedAt:     exportAssignedAt(asg),
+				ExpiresAt:      asg.ExpiresAt,
+			})
+		}
+		flush = func() error { return nil }
+	}
+
+	var rows int
+	err := h.svc.ExportSegmentUsers(r.Context(), segmentID, func(asg *models.UserSegmentAssignment) error {
+		if err := writeRow(asg); err != nil {
+			return err
+		}
+		rows++
+		if rows%exportFlushEvery == 0 {
+			if err := flush(); err != nil {
+				return err
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+		return nil
+	})
+	if err == nil {
+		err = flush()
+	}
+	if err != nil {
+		if !tw.wrote {
+			w.Header().Del("Content-Disposition")
+			writeError(w, r, err)
+			return
+		}
+		// Часть выгрузки уже отправлена — остаётся только оборвать ответ.
+		logging.RecordError(r.Context(), err)
+		panic(http.ErrAbortHandler)
+	}
+}
+
+// exportAssignedAt возвращает момент назначения или nil для вычисляемого членства.
+func exportAssignedAt(asg *models.UserSegmentAssignment) *time.Time {
+	if asg.AssignedAt.IsZero() {
+		return nil
+	}
+	return &asg.AssignedAt
+}
+
+func formatExportTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
 func (h *UserSegmentHandler) MassAssignSegment(w http.ResponseWriter, r *http.Request) {
 	var req dto.MassAssignRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "invalid request body", http.StatusBadRequest)
+		badRequest(w, r, "invalid request body")
 		return
 	}
 
 	if req.Percent < 1 || req.Percent > 100 {
-		http.Error(w, "percent must be between 1 and 100", http.StatusBadRequest)
+		validationError(w, r, "percent must be between 1 and 100")
 		return
 	}
 
-	result, err := h.svc.MassAssignSegment(r.Context(), req.SegmentID, req.Percent)
+	segmentID, ok := h.segmentID(w, r, req.SegmentID)
+	if !ok {
+		return
+	}
+
+	result, err := h.svc.MassAssignSegment(r.Context(), segmentID, req.Percent)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(result)
 }
+
+// segmentID превращает ссылку на сегмент (UUID или имя) в ID.
+// При ошибке сам пишет ответ и возвращает false.
+func (h *UserSegmentHandler) segmentID(w http.ResponseWriter, r *http.Request, ref string) (uuid.UUID, bool) {
+	id, err := h.svc.ResolveSegmentID(r.Context(), ref)
+	if err != nil {
+		writeError(w, r, err)
+		return uuid.Nil, false
+	}
+	return id, true
+}
@@ -0,0 +1,136 @@
+package handler
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	"github.com/RaikyD/UserSegmentationService/internal/handler/dto"
+	"github.com/RaikyD/UserSegmentationService/internal/models"
+	"github.com/RaikyD/UserSegmentationService/internal/service"
+)
+
+// fakeUserSegments отдаёт выгрузку из заранее заданных строк и затем ошибку err.
+type fakeUserSegments struct {
+	service.UserSegmentService
+	rows []*models.UserSegmentAssignment
+	err  error
+}
+
+func (f *fakeUserSegments) ResolveSegmentID(_ context.Context, ref string) (uuid.UUID, error) {
+	if id, err := uuid.Parse(ref); err == nil {
+		return id, nil
+	}
+	return uuid.Nil, service.ErrSegmentNotFound.Withf("%s", ref)
+}
+
+func (f *fakeUserSegments) ExportSegmentUsers(_ context.Context, _ uuid.UUID, fn func(*models.UserSegmentAssignment) error) error {
+	for _, row := range f.rows {
+		if err := fn(row); err != nil {
+			return err
+		}
+	}
+	return f.err
+}
+
+func exportRequest(t *testing.T, svc service.UserSegmentService, target string) *httptest.ResponseRecorder {
+	t.Helper()
+	r := chi.NewRouter()
+	r.Use(Authenticate(nil))
+	NewUserSegmentHandler(svc).RegisterExport(r)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+	return w
+}
+
+func TestExportSegmentUsers(t *testing.T) {
+	segID := uuid.MustParse("33333333-3333-3333-3333-333333333333")
+	manual := uuid.MustParse("11111111-1111-1111-1111-111111111111")
+	computed := uuid.MustParse("22222222-2222-2222-2222-222222222222")
+	assigned := time.Date(2025, 8, 1, 10, 0, 0, 0, time.FixedZone("MSK", 3*3600))
+	expires := time.Date(2025, 9, 1, 0, 0, 0, 0, time.UTC)
+	svc := &fakeUserSegments{rows: []*models.UserSegmentAssignment{
+		{UserID: manual, AssignmentType: models.AssignmentManual, AssignedAt: assigned, ExpiresAt: &expires},
+		{UserID: computed, AssignmentType: models.AssignmentAuto},
+	}}
+	base := "/segments/" + segID.String() + "/users/export"
+
+	t.Run("csv", func(t *testing.T) {
+		w := exportRequest(t, svc, base)
+		want := "user_id,assignment_type,assigned_at,expires_at\n" +
+			"11111111-1111-1111-1111-111111111111,manual,2025-08-01T07:00:00Z,2025-09-01T00:00:00Z\n" +
+			"22222222-2222-2222-2222-222222222222,auto,,\n"
+		if w.Code != http.StatusOK || w.Body.String() != want {
+			t.Errorf("response %d:\n%s\nwant\n%s", w.Code, w.Body, want)
+		}
+		if cd := w.Header().Get("Content-Disposition"); !strings.Contains(cd, segID.String()) {
+			t.Errorf("Content-Disposition = %q", cd)
+		}
+	})
+
+	t.Run("ndjson", func(t *testing.T) {
+		w := exportRequest(t, svc, base+"?format=ndjson")
+		if ct := w.Header().Get("Content-Type"); ct != "application/x-ndjson" {
+			t.Errorf("Content-Type = %q", ct)
+		}
+		var got []dto.SegmentMemberExport
+		sc := bufio.NewScanner(w.Body)
+		for sc.Scan() {
+			var row dto.SegmentMemberExport
+			if err := json.Unmarshal(sc.Bytes(), &row); err != nil {
+				t.Fatalf("line %q: %v", sc.Text(), err)
+			}
+			got = append(got, row)
+		}
+		if len(got) != 2 || got[0].UserID != manual || !got[0].AssignedAt.Equal(assigned) || got[1].AssignedAt != nil {
+			t.Errorf("rows = %+v", got)
+		}
+	})
+
+	t.Run("errors before the body", func(t *testing.T) {
+		tests := []struct {
+			name       string
+			target     string
+			svc        *fakeUserSegments
+			wantStatus int
+		}{
+			{"bad format", base + "?format=xml", svc, http.StatusBadRequest},
+			{"unknown segment", "/segments/ghost/users/export", svc, http.StatusNotFound},
+			{"query fails", base, &fakeUserSegments{err: errors.New("db down")}, http.StatusInternalServerError},
+			{"query fails after buffered rows", base, &fakeUserSegments{rows: svc.rows, err: errors.New("db down")}, http.StatusInternalServerError},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				w := exportRequest(t, tt.svc, tt.target)
+				if w.Code != tt.wantStatus || w.Header().Get("Content-Type") != "application/json" {
+					t.Errorf("response %d %q, want %d JSON", w.Code, w.Header().Get("Content-Type"), tt.wantStatus)
+				}
+				if w.Header().Get("Content-Disposition") != "" {
+					t.Error("error response is still marked as an attachment")
+				}
+			})
+		}
+	})
+
+	t.Run("error after the body started aborts", func(t *testing.T) {
+		rows := make([]*models.UserSegmentAssignment, exportFlushEvery)
+		for i := range rows {
+			rows[i] = &models.UserSegmentAssignment{UserID: uuid.New(), AssignmentType: models.AssignmentAuto}
+		}
+		defer func() {
+			if r := recover(); r != http.ErrAbortHandler {
+				t.Errorf("recovered %v, want http.ErrAbortHandler", r)
+			}
+		}()
+		exportRequest(t, &fakeUserSegments{rows: rows, err: errors.New("db down")}, base)
+	})
+}
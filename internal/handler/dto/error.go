@@ -0,0 +1,8 @@
+package dto
+
+// ErrorResponse — тело ответа при любой ошибке
+type ErrorResponse struct {
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	RequestID string `json:"request_id,omitempty"`
+}
@@ -1,11 +1,9 @@
 package dto
 
-import "github.com/google/uuid"
-
 // MassAssignRequest запрос на массовое назначение сегмента
 type MassAssignRequest struct {
-	SegmentID uuid.UUID `json:"segmentID"`
-	Percent   int       `json:"percent"` // от 1 до 100
+	SegmentID string `json:"segmentID"` // UUID или имя сегмента
+	Percent   int    `json:"percent"`   // от 1 до 100
 }
 
 // MassAssignResult результат массового назначения сегмента
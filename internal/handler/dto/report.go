@@ -0,0 +1,29 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ReportResponse — состояние фонового отчёта для POST /reports/segment-changes и GET /reports/{id}
+type ReportResponse struct {
+	ID          uuid.UUID  `json:"id"`
+	Status      string     `json:"status"`
+	Processed   int64      `json:"processed"`
+	Error       string     `json:"error,omitempty"`
+	DownloadURL string     `json:"download_url,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	FinishedAt  *time.Time `json:"finished_at,omitempty"`
+}
+
+// ImportResponse — состояние фонового импорта для POST /segments/{id}/users/import и GET /imports/{id}
+type ImportResponse struct {
+	ID         uuid.UUID      `json:"id"`
+	Status     string         `json:"status"`
+	Processed  int64          `json:"processed"` // прочитано строк файла
+	Error      string         `json:"error,omitempty"`
+	Result     map[string]any `json:"result,omitempty"`
+	CreatedAt  time.Time      `json:"created_at"`
+	FinishedAt *time.Time     `json:"finished_at,omitempty"`
+}
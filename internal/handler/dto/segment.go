@@ -10,7 +10,7 @@ import (
 // CreateSegmentRequest — payload для POST /segments
 type CreateSegmentRequest struct {
 	Name        string          `json:"name"        validate:"required"`
-	Type        string          `json:"type"        validate:"required,oneof=static dynamic dynamic_rule"`
+	Type        string          `json:"type"        validate:"required,oneof=static dynamic dynamic_rule composite"`
 	Config      json.RawMessage `json:"config"      validate:"required,json"`
 	Description *string         `json:"description"` // опционально
 	IsActive    *bool           `json:"is_active"`   // опционально, default=true
@@ -21,17 +21,38 @@ type CreateSegmentRequest struct {
 // UpdateSegmentRequest — payload для PUT /segments/{id}
 type UpdateSegmentRequest struct {
 	Name        *string          `json:"name"` // опционально
-	Type        *string          `json:"type"        validate:"omitempty,oneof=static dynamic dynamic_rule"`
+	Type        *string          `json:"type"        validate:"omitempty,oneof=static dynamic dynamic_rule composite"`
 	Config      *json.RawMessage `json:"config"      validate:"omitempty,json"`
 	Description *string          `json:"description"`
 	IsActive    *bool            `json:"is_active"`
-	ValidFrom   *time.Time       `json:"valid_from"`
-	ValidTo     *time.Time       `json:"valid_to"`
+	ValidFrom   NullableTime     `json:"valid_from"` // null снимает границу
+	ValidTo     NullableTime     `json:"valid_to"`   // null снимает границу
+}
+
+// NullableTime отличает отсутствующее в запросе поле от явного null.
+type NullableTime struct {
+	Set   bool       // поле есть в запросе
+	Value *time.Time // nil, если передан null
+}
+
+func (t *NullableTime) UnmarshalJSON(data []byte) error {
+	t.Set = true
+	if string(data) == "null" {
+		t.Value = nil
+		return nil
+	}
+	var v time.Time
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	t.Value = &v
+	return nil
 }
 
 // SegmentResponse — то, что возвращаем клиенту по GET /segments[/{id}]
 type SegmentResponse struct {
 	ID          uuid.UUID       `json:"id"`
+	Tenant      string          `json:"tenant"`
 	Name        string          `json:"name"`
 	Type        string          `json:"type"`
 	Config      json.RawMessage `json:"config"`
@@ -41,3 +62,9 @@ type SegmentResponse struct {
 	ValidFrom   *time.Time      `json:"valid_from,omitempty"`
 	ValidTo     *time.Time      `json:"valid_to,omitempty"`
 }
+
+// SegmentListResponse — ответ на GET /segments
+type SegmentListResponse struct {
+	Segments   []SegmentResponse `json:"segments"`
+	NextCursor string            `json:"next_cursor,omitempty"`
+}
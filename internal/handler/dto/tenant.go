@@ -0,0 +1,15 @@
+package dto
+
+// TenantResponse — арендатор и объём его данных
+type TenantResponse struct {
+	Name           string `json:"name"`
+	Segments       int64  `json:"segments"`
+	ActiveSegments int64  `json:"active_segments"`
+	Assignments    int64  `json:"assignments"`
+	Users          int64  `json:"users"`
+}
+
+// TenantListResponse — ответ на GET /tenants
+type TenantListResponse struct {
+	Tenants []TenantResponse `json:"tenants"`
+}
@@ -0,0 +1,27 @@
+package dto
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// CreateUserRequest — payload для POST /users
+type CreateUserRequest struct {
+	ID         *uuid.UUID      `json:"id"`         // опционально, иначе генерируется
+	Attributes json.RawMessage `json:"attributes"` // опционально, JSON-объект
+}
+
+// UpdateUserRequest — payload для PUT /users/{userID}
+type UpdateUserRequest struct {
+	Attributes json.RawMessage `json:"attributes" validate:"required"`
+}
+
+// UserResponse — то, что возвращаем клиенту по GET /users[/{userID}]
+type UserResponse struct {
+	ID         uuid.UUID       `json:"id"`
+	Attributes json.RawMessage `json:"attributes"`
+	CreatedAt  time.Time       `json:"created_at"`
+	UpdatedAt  time.Time       `json:"updated_at"`
+}
@@ -1,22 +1,106 @@
 package dto
 
 import (
+	"time"
+
 	"github.com/google/uuid"
 )
 
 // AssignUserRequest — payload для POST /segments/{id}/users
 type AssignUserRequest struct {
-	UserID uuid.UUID `json:"user_id" validate:"required,uuid"`
+	UserID     uuid.UUID  `json:"user_id" validate:"required,uuid"`
+	ExpiresAt  *time.Time `json:"expires_at"`  // опционально, абсолютный срок действия
+	TTLSeconds *int64     `json:"ttl_seconds"` // опционально, срок действия от момента назначения
+}
+
+// UpdateUserSegmentsRequest — payload для POST /users/{user_id}/segments.
+// Сегменты указываются по ID или по имени.
+type UpdateUserSegmentsRequest struct {
+	Add    []string `json:"add"`
+	Remove []string `json:"remove"`
+}
+
+// UserSegmentResponse — сегмент пользователя вместе с данными о привязке.
+// У вычисляемого членства (rollout, rule, composite) нет assigned_at и expires_at.
+type UserSegmentResponse struct {
+	SegmentResponse
+	AssignmentType string     `json:"assignment_type"`
+	AssignedAt     *time.Time `json:"assigned_at,omitempty"`
+	ExpiresAt      *time.Time `json:"expires_at,omitempty"`
 }
 
 // UserSegmentsResponse — ответ на GET /users/{user_id}/segments
 type UserSegmentsResponse struct {
-	UserID   uuid.UUID         `json:"user_id"`
-	Segments []SegmentResponse `json:"segments"`
+	UserID     uuid.UUID             `json:"user_id"`
+	Segments   []UserSegmentResponse `json:"segments"`
+	NextCursor string                `json:"next_cursor,omitempty"`
 }
 
 // SegmentUsersResponse — ответ на GET /segments/{id}/users
 type SegmentUsersResponse struct {
-	SegmentID uuid.UUID   `json:"segment_id"`
-	UserIDs   []uuid.UUID `json:"user_ids"`
+	SegmentID  uuid.UUID   `json:"segment_id"`
+	UserIDs    []uuid.UUID `json:"user_ids"`
+	NextCursor string      `json:"next_cursor,omitempty"`
+}
+
+// AssignmentEventResponse — одно событие журнала привязок
+type AssignmentEventResponse struct {
+	SegmentID  uuid.UUID  `json:"segment_id"`
+	Operation  string     `json:"operation"`
+	Source     string     `json:"source"`
+	Actor      string     `json:"actor"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	OccurredAt time.Time  `json:"occurred_at"`
+}
+
+// UserSegmentHistoryResponse — ответ на GET /users/{user_id}/segments/history
+type UserSegmentHistoryResponse struct {
+	UserID uuid.UUID                 `json:"user_id"`
+	Events []AssignmentEventResponse `json:"events"`
+}
+
+// SegmentMemberExport — строка выгрузки GET /segments/{id}/users/export?format=ndjson
+type SegmentMemberExport struct {
+	UserID         uuid.UUID  `json:"user_id"`
+	AssignmentType string     `json:"assignment_type"`
+	AssignedAt     *time.Time `json:"assigned_at,omitempty"` // нет у вычисляемого членства
+	ExpiresAt      *time.Time `json:"expires_at,omitempty"`
+}
+
+// SegmentMembership — результат проверки членства в одном сегменте.
+// AssignmentType заполнен, только если пользователь в сегменте: manual/auto —
+// явная привязка, rollout, rule, composite — вычисленное членство.
+type SegmentMembership struct {
+	Segment        string    `json:"segment"` // ссылка в том виде, в каком пришла в запросе
+	SegmentID      uuid.UUID `json:"segment_id"`
+	Member         bool      `json:"member"`
+	AssignmentType string    `json:"assignment_type,omitempty"`
+}
+
+// UserSegmentsCheckResponse — ответ на GET /users/{user_id}/segments/check
+type UserSegmentsCheckResponse struct {
+	UserID   uuid.UUID           `json:"user_id"`
+	Segments []SegmentMembership `json:"segments"`
+}
+
+// MembershipCheckItem — одна пара «пользователь — сегмент» в POST /membership/check
+type MembershipCheckItem struct {
+	UserID  uuid.UUID `json:"user_id"`
+	Segment string    `json:"segment"` // ID или имя
+}
+
+// MembershipCheckRequest — payload для POST /membership/check
+type MembershipCheckRequest struct {
+	Checks []MembershipCheckItem `json:"checks"`
+}
+
+// MembershipCheckResult — результат проверки одной пары
+type MembershipCheckResult struct {
+	UserID uuid.UUID `json:"user_id"`
+	SegmentMembership
+}
+
+// MembershipCheckResponse — ответ на POST /membership/check, результаты в порядке запроса
+type MembershipCheckResponse struct {
+	Results []MembershipCheckResult `json:"results"`
 }
@@ -0,0 +1,70 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5/middleware"
+
+	"github.com/RaikyD/UserSegmentationService/internal/handler/dto"
+	"github.com/RaikyD/UserSegmentationService/internal/logging"
+	"github.com/RaikyD/UserSegmentationService/internal/service"
+)
+
+// Коды ошибок в теле ответа.
+const (
+	codeBadRequest    = "bad_request"
+	codeValidation    = "validation_error"
+	codeNotFound      = "not_found"
+	codeAlreadyExists = "already_exists"
+	codeConflict      = "conflict"
+	codeInactive      = "inactive"
+	codeInternal      = "internal_error"
+	codeTooLarge      = "payload_too_large"
+	codeUnauthorized  = "unauthorized"
+	codeForbidden     = "forbidden"
+)
+
+// writeError — единственное место, где ошибки сервиса превращаются в HTTP-статус.
+// Неизвестные ошибки отдаются как 500 без подробностей, сами подробности попадают
+// в журнал запросов (см. logging.Middleware).
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	status, code, msg := http.StatusInternalServerError, codeInternal, "internal server error"
+	switch {
+	case errors.Is(err, service.ErrNotFound):
+		status, code, msg = http.StatusNotFound, codeNotFound, err.Error()
+	case errors.Is(err, service.ErrAlreadyExists):
+		status, code, msg = http.StatusConflict, codeAlreadyExists, err.Error()
+	case errors.Is(err, service.ErrConflict):
+		status, code, msg = http.StatusConflict, codeConflict, err.Error()
+	case errors.Is(err, service.ErrInactive):
+		status, code, msg = http.StatusConflict, codeInactive, err.Error()
+	case errors.Is(err, service.ErrValidation):
+		status, code, msg = http.StatusUnprocessableEntity, codeValidation, err.Error()
+	default:
+		logging.RecordError(r.Context(), err)
+	}
+	writeErrorResponse(w, r, status, code, msg)
+}
+
+// badRequest отвечает 400 на запрос, который не удалось разобрать.
+func badRequest(w http.ResponseWriter, r *http.Request, msg string) {
+	writeErrorResponse(w, r, http.StatusBadRequest, codeBadRequest, msg)
+}
+
+// validationError отвечает 422 на корректно разобранный, но недопустимый запрос.
+func validationError(w http.ResponseWriter, r *http.Request, msg string) {
+	writeErrorResponse(w, r, http.StatusUnprocessableEntity, codeValidation, msg)
+}
+
+func writeErrorResponse(w http.ResponseWriter, r *http.Request, status int, code, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(dto.ErrorResponse{
+		Code:      code,
+		Message:   msg,
+		RequestID: middleware.GetReqID(r.Context()),
+	})
+}
@@ -0,0 +1,59 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5/middleware"
+
+	"github.com/RaikyD/UserSegmentationService/internal/handler/dto"
+	"github.com/RaikyD/UserSegmentationService/internal/service"
+)
+
+func TestWriteError(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+		wantCode   string
+		wantMsg    string
+	}{
+		{"not found", service.ErrSegmentNotFound.Withf("beta"), http.StatusNotFound, codeNotFound, "segment not found: beta"},
+		{"already exists", service.ErrSegmentExists, http.StatusConflict, codeAlreadyExists, service.ErrSegmentExists.Error()},
+		{"conflict", service.ErrReportNotReady, http.StatusConflict, codeConflict, "report is not ready"},
+		{"inactive", service.ErrSegmentInactive, http.StatusConflict, codeInactive, "segment is inactive"},
+		{"validation", service.ErrInvalidExpiry, http.StatusUnprocessableEntity, codeValidation, "expires_at must be in the future"},
+		{"wrapped", fmt.Errorf("batch: %w", service.ErrUserNotFound), http.StatusNotFound, codeNotFound, "batch: user not found"},
+		{"internal details are hidden", errors.New("pq: connection refused"), http.StatusInternalServerError, codeInternal, "internal server error"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var r *http.Request
+			middleware.RequestID(http.HandlerFunc(func(_ http.ResponseWriter, req *http.Request) { r = req })).
+				ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/segments/beta", nil))
+			w := httptest.NewRecorder()
+			writeError(w, r, tt.err)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+				t.Errorf("Content-Type = %q", ct)
+			}
+			var body dto.ErrorResponse
+			if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+				t.Fatalf("decode body: %v", err)
+			}
+			if body.Code != tt.wantCode || body.Message != tt.wantMsg {
+				t.Errorf("body = %+v, want code %q and message %q", body, tt.wantCode, tt.wantMsg)
+			}
+			if body.RequestID == "" || body.RequestID != middleware.GetReqID(r.Context()) {
+				t.Errorf("request_id = %q, want the request's id", body.RequestID)
+			}
+		})
+	}
+}
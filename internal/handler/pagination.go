@@ -0,0 +1,27 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/RaikyD/UserSegmentationService/internal/service"
+)
+
+const (
+	defaultPageLimit = 100
+	maxPageLimit     = 1000
+)
+
+// parsePage читает параметры limit и cursor постраничной выдачи.
+func parsePage(r *http.Request) (service.Page, error) {
+	page := service.Page{Limit: defaultPageLimit, Cursor: r.URL.Query().Get("cursor")}
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxPageLimit {
+			return page, errors.New("limit must be between 1 and 1000")
+		}
+		page.Limit = n
+	}
+	return page, nil
+}
@@ -0,0 +1,57 @@
+package handler
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/RaikyD/UserSegmentationService/internal/models"
+)
+
+func TestParsePage(t *testing.T) {
+	tests := []struct {
+		query     string
+		wantLimit int
+		wantErr   bool
+	}{
+		{"", defaultPageLimit, false},
+		{"?limit=1&cursor=abc", 1, false},
+		{"?limit=1000", 1000, false},
+		{"?limit=0", 0, true},
+		{"?limit=1001", 0, true},
+		{"?limit=ten", 0, true},
+	}
+	for _, tt := range tests {
+		page, err := parsePage(httptest.NewRequest("GET", "/segments"+tt.query, nil))
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parsePage(%q) error = %v, want error %v", tt.query, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && page.Limit != tt.wantLimit {
+			t.Errorf("parsePage(%q).Limit = %d, want %d", tt.query, page.Limit, tt.wantLimit)
+		}
+	}
+	if page, _ := parsePage(httptest.NewRequest("GET", "/segments?cursor=abc", nil)); page.Cursor != "abc" {
+		t.Errorf("Cursor = %q, want abc", page.Cursor)
+	}
+}
+
+func TestParseSegmentFilter(t *testing.T) {
+	f, err := parseSegmentFilter(httptest.NewRequest("GET",
+		"/segments?type=dynamic&is_active=false&name_prefix=promo_&created_from=2025-01-01T00:00:00Z&created_to=2025-02-01T00:00:00%2B03:00", nil))
+	if err != nil {
+		t.Fatalf("parseSegmentFilter: %v", err)
+	}
+	from := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2025, 1, 31, 21, 0, 0, 0, time.UTC)
+	if f.Type == nil || *f.Type != models.SegmentTypeDynamic || f.IsActive == nil || *f.IsActive ||
+		f.NamePrefix != "promo_" || !f.CreatedFrom.Equal(from) || !f.CreatedTo.Equal(to) {
+		t.Errorf("parseSegmentFilter = %+v", f)
+	}
+
+	for _, query := range []string{"?type=weird", "?is_active=maybe", "?created_from=yesterday", "?created_to=2025-01-01"} {
+		if _, err := parseSegmentFilter(httptest.NewRequest("GET", "/segments"+query, nil)); err == nil {
+			t.Errorf("parseSegmentFilter(%q) succeeded, want error", query)
+		}
+	}
+}
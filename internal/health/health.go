@@ -0,0 +1,162 @@
+// Package health собирает проверки готовности сервиса для /readyz.
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/RaikyD/UserSegmentationService/internal/worker"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Status — итог проверки.
+type Status string
+
+const (
+	StatusOK Status = "ok"
+	// StatusDegraded — сервис обслуживает запросы, но часть фоновой работы не идёт.
+	StatusDegraded Status = "degraded"
+	// StatusUnavailable — сервис не может обслуживать запросы.
+	StatusUnavailable Status = "unavailable"
+)
+
+// CheckFunc возвращает ошибку, если проверяемая часть не в порядке.
+type CheckFunc func(ctx context.Context) error
+
+type check struct {
+	name     string
+	critical bool
+	fn       CheckFunc
+}
+
+// Result — результат одной проверки.
+type Result struct {
+	Status Status `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Report — результат всех проверок.
+type Report struct {
+	Status Status            `json:"status"`
+	Checks map[string]Result `json:"checks"`
+}
+
+// Checker выполняет зарегистрированные проверки параллельно с общим таймаутом.
+type Checker struct {
+	timeout time.Duration
+	checks  []check
+}
+
+// NewChecker создаёт набор проверок. Каждая проверка ограничена timeout.
+func NewChecker(timeout time.Duration) *Checker {
+	return &Checker{timeout: timeout}
+}
+
+// Critical добавляет проверку, без которой сервис не готов принимать запросы.
+func (c *Checker) Critical(name string, fn CheckFunc) {
+	c.checks = append(c.checks, check{name: name, critical: true, fn: fn})
+}
+
+// Degraded добавляет проверку, провал которой только понижает статус до degraded.
+func (c *Checker) Degraded(name string, fn CheckFunc) {
+	c.checks = append(c.checks, check{name: name, fn: fn})
+}
+
+// Run выполняет все проверки.
+func (c *Checker) Run(ctx context.Context) Report {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	results := make([]error, len(c.checks))
+	var wg sync.WaitGroup
+	for i, ch := range c.checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = ch.fn(ctx)
+		}()
+	}
+	wg.Wait()
+
+	rep := Report{Status: StatusOK, Checks: make(map[string]Result, len(c.checks))}
+	for i, ch := range c.checks {
+		err := results[i]
+		if err == nil {
+			rep.Checks[ch.name] = Result{Status: StatusOK}
+			continue
+		}
+		status := StatusDegraded
+		if ch.critical {
+			status = StatusUnavailable
+		}
+		rep.Checks[ch.name] = Result{Status: status, Error: err.Error()}
+		if status == StatusUnavailable || rep.Status == StatusOK {
+			rep.Status = status
+		}
+	}
+	return rep
+}
+
+// Database проверяет, что пул отвечает на ping.
+func Database(pool *pgxpool.Pool) CheckFunc {
+	return func(ctx context.Context) error {
+		return pool.Ping(ctx)
+	}
+}
+
+// RowQuerier выполняет запрос, возвращающий одну строку; *pgxpool.Pool ему удовлетворяет.
+type RowQuerier interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// undefinedTable — SQLSTATE обращения к несуществующей таблице.
+const undefinedTable = "42P01"
+
+// Migrations проверяет, что к БД применены миграции до версии want — последней,
+// с которой собран сервис. Версия только читается из таблицы goose: проба не
+// создаёт таблицу, как goose.GetDBVersion, и работает на read-only копии.
+// Без таблицы схема считается ненакатанной.
+func Migrations(db RowQuerier, want int64) CheckFunc {
+	const query = `SELECT COALESCE(max(version_id), 0) FROM goose_db_version WHERE is_applied;`
+	return func(ctx context.Context) error {
+		var got int64
+		if err := db.QueryRow(ctx, query).Scan(&got); err != nil {
+			var pgErr *pgconn.PgError
+			if !errors.As(err, &pgErr) || pgErr.Code != undefinedTable {
+				return err
+			}
+		}
+		if got < want {
+			return fmt.Errorf("schema version %d, expected %d", got, want)
+		}
+		return nil
+	}
+}
+
+// Heartbeater — воркер, который сообщает о своих проходах.
+type Heartbeater interface {
+	Heartbeat() worker.Heartbeat
+}
+
+// staleAfter — сколько интервалов воркер может не завершать проход.
+const staleAfter = 3
+
+// Worker проверяет, что воркер w не завис.
+func Worker(w Heartbeater) CheckFunc {
+	return func(context.Context) error {
+		hb := w.Heartbeat()
+		if hb.Stale(time.Now(), staleAfter) {
+			last := "never"
+			if !hb.LastRunAt.IsZero() {
+				last = hb.LastRunAt.Format(time.RFC3339)
+			}
+			return fmt.Errorf("no completed run for %d intervals of %s, last run %s", staleAfter, hb.Interval, last)
+		}
+		return nil
+	}
+}
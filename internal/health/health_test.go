@@ -0,0 +1,122 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"github.com/RaikyD/UserSegmentationService/internal/worker"
+)
+
+func TestCheckerRun(t *testing.T) {
+	ok := func(context.Context) error { return nil }
+	fail := func(context.Context) error { return errors.New("down") }
+	slow := func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	tests := []struct {
+		name       string
+		critical   []CheckFunc
+		degraded   []CheckFunc
+		wantStatus Status
+	}{
+		{"all ok", []CheckFunc{ok}, []CheckFunc{ok}, StatusOK},
+		{"degraded", []CheckFunc{ok}, []CheckFunc{fail}, StatusDegraded},
+		{"critical wins", []CheckFunc{fail}, []CheckFunc{fail}, StatusUnavailable},
+		{"critical after degraded", []CheckFunc{ok, fail}, []CheckFunc{fail, ok}, StatusUnavailable},
+		{"timeout", []CheckFunc{slow}, nil, StatusUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewChecker(10 * time.Millisecond)
+			for i, fn := range tt.critical {
+				c.Critical("critical"+string(rune('a'+i)), fn)
+			}
+			for i, fn := range tt.degraded {
+				c.Degraded("degraded"+string(rune('a'+i)), fn)
+			}
+			rep := c.Run(context.Background())
+			if rep.Status != tt.wantStatus || len(rep.Checks) != len(tt.critical)+len(tt.degraded) {
+				t.Errorf("report = %+v, want status %s", rep, tt.wantStatus)
+			}
+			for name, res := range rep.Checks {
+				if (res.Status == StatusOK) != (res.Error == "") {
+					t.Errorf("check %s = %+v", name, res)
+				}
+			}
+		})
+	}
+}
+
+type fakeHeartbeater worker.Heartbeat
+
+func (f fakeHeartbeater) Heartbeat() worker.Heartbeat { return worker.Heartbeat(f) }
+
+func TestWorker(t *testing.T) {
+	now := time.Now()
+	fresh := fakeHeartbeater{Interval: time.Minute, StartedAt: now.Add(-time.Hour), LastRunAt: now.Add(-time.Minute)}
+	stuck := fakeHeartbeater{Interval: time.Minute, StartedAt: now.Add(-time.Hour), LastRunAt: now.Add(-10 * time.Minute)}
+	if err := Worker(fresh)(context.Background()); err != nil {
+		t.Errorf("fresh worker: %v", err)
+	}
+	if err := Worker(stuck)(context.Background()); err == nil {
+		t.Error("stuck worker: want an error")
+	}
+}
+
+// versionRow отдаёт версию схемы или ошибку запроса; запрос сохраняется в sql.
+type versionRow struct {
+	version int64
+	err     error
+	sql     *string
+}
+
+func (r versionRow) QueryRow(_ context.Context, sql string, _ ...any) pgx.Row {
+	*r.sql = sql
+	return r
+}
+
+func (r versionRow) Scan(dest ...any) error {
+	if r.err != nil {
+		return r.err
+	}
+	*dest[0].(*int64) = r.version
+	return nil
+}
+
+func TestMigrations(t *testing.T) {
+	queryErr := errors.New("connection reset")
+	tests := []struct {
+		name    string
+		row     versionRow
+		wantErr string
+	}{
+		{"up to date", versionRow{version: 20250820100000}, ""},
+		{"newer schema", versionRow{version: 20250901100000}, ""},
+		{"behind", versionRow{version: 20250815100000}, "schema version 20250815100000, expected 20250820100000"},
+		{"no goose table", versionRow{err: &pgconn.PgError{Code: "42P01"}}, "schema version 0, expected 20250820100000"},
+		{"query failed", versionRow{err: queryErr}, queryErr.Error()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sql string
+			tt.row.sql = &sql
+			err := Migrations(tt.row, 20250820100000)(context.Background())
+			if got := fmt.Sprint(err); (tt.wantErr == "" && err != nil) || (tt.wantErr != "" && got != tt.wantErr) {
+				t.Errorf("Migrations() = %v, want %q", err, tt.wantErr)
+			}
+			// Проба только читает версию и ничего не создаёт.
+			if !strings.HasPrefix(sql, "SELECT") {
+				t.Errorf("query = %q, want a plain SELECT", sql)
+			}
+		})
+	}
+}
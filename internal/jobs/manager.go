@@ -0,0 +1,246 @@
+// Package jobs отслеживает фоновые задачи (отчёты, импорты), которые не укладываются
+// во время жизни HTTP-запроса. Задача выполняется на реплике, которая её запустила,
+// а её состояние сохраняется в Store, поэтому прочитать его можно с любой реплики.
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/RaikyD/UserSegmentationService/internal/tenant"
+	"github.com/google/uuid"
+)
+
+type Status string
+
+const (
+	StatusPending Status = "pending"
+	StatusRunning Status = "running"
+	StatusDone    Status = "done"
+	StatusFailed  Status = "failed"
+)
+
+// Job — снимок состояния задачи.
+type Job struct {
+	ID         uuid.UUID      `json:"id"`
+	Kind       string         `json:"kind"`
+	Tenant     string         `json:"tenant"`
+	Status     Status         `json:"status"`
+	Processed  int64          `json:"processed"`
+	Total      int64          `json:"total,omitempty"`
+	Error      string         `json:"error,omitempty"`
+	Result     map[string]any `json:"result,omitempty"`
+	CreatedAt  time.Time      `json:"created_at"`
+	UpdatedAt  time.Time      `json:"updated_at"`
+	FinishedAt *time.Time     `json:"finished_at,omitempty"`
+}
+
+// Store хранит состояние задач, общее для всех реплик.
+type Store interface {
+	// Save создаёт или перезаписывает задачу
+	Save(ctx context.Context, job *Job) error
+	// Get возвращает задачу по ID; nil, nil — если задачи нет
+	Get(ctx context.Context, id uuid.UUID) (*Job, error)
+	// DeleteUpdatedBefore удаляет задачи, не обновлявшиеся с cutoff
+	DeleteUpdatedBefore(ctx context.Context, cutoff time.Time) error
+}
+
+// Func — тело задачи. Через Progress задача сообщает о ходе выполнения.
+type Func func(ctx context.Context, p *Progress) (result map[string]any, err error)
+
+const (
+	// heartbeatInterval — как часто выполняющаяся задача сохраняет прогресс.
+	heartbeatInterval = 5 * time.Second
+	// abandonedAfter — сколько незавершённая задача может не обновляться, прежде
+	// чем считается брошенной: реплика, которая её выполняла, остановилась.
+	abandonedAfter = 6 * heartbeatInterval
+	// saveTimeout ограничивает запись состояния задачи.
+	saveTimeout = 5 * time.Second
+)
+
+// Manager запускает задачи и сохраняет их состояние в Store. Задачи, не
+// обновлявшиеся дольше retention, удаляются.
+type Manager struct {
+	ctx       context.Context
+	store     Store
+	retention time.Duration
+	log       *slog.Logger
+	// heartbeat и abandoned меняются в тестах.
+	heartbeat time.Duration
+	abandoned time.Duration
+
+	mu      sync.Mutex
+	running map[uuid.UUID]*Job // задачи этой реплики
+}
+
+// NewManager создаёт менеджер. Отмена ctx отменяет все выполняющиеся задачи.
+func NewManager(ctx context.Context, store Store, retention time.Duration, logger *slog.Logger) *Manager {
+	return &Manager{
+		ctx:       ctx,
+		store:     store,
+		retention: retention,
+		log:       logger,
+		heartbeat: heartbeatInterval,
+		abandoned: abandonedAfter,
+		running:   make(map[uuid.UUID]*Job),
+	}
+}
+
+// Start сохраняет задачу и запускает её в отдельной горутине. Задача
+// выполняется от имени арендатора из ctx, сам ctx задача не наследует.
+func (m *Manager) Start(ctx context.Context, kind string, fn Func) (Job, error) {
+	now := time.Now()
+	job := &Job{
+		ID:        uuid.New(),
+		Kind:      kind,
+		Tenant:    tenant.FromContext(ctx),
+		Status:    StatusPending,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := m.store.DeleteUpdatedBefore(ctx, now.Add(-m.retention)); err != nil {
+		m.log.WarnContext(ctx, "prune jobs failed", "error", err)
+	}
+	if err := m.store.Save(ctx, job); err != nil {
+		return Job{}, fmt.Errorf("save job: %w", err)
+	}
+
+	m.mu.Lock()
+	m.running[job.ID] = job
+	snapshot := *job
+	m.mu.Unlock()
+
+	go m.run(job.ID, kind, job.Tenant, fn)
+	return snapshot, nil
+}
+
+// Get возвращает снимок задачи; nil — если задачи нет. Задачи этой реплики
+// читаются из памяти, остальные — из Store. Незавершённая задача, которую её
+// реплика давно не обновляла, возвращается как failed.
+func (m *Manager) Get(ctx context.Context, id uuid.UUID) (*Job, error) {
+	m.mu.Lock()
+	if job, ok := m.running[id]; ok {
+		snapshot := *job
+		m.mu.Unlock()
+		return &snapshot, nil
+	}
+	m.mu.Unlock()
+
+	job, err := m.store.Get(ctx, id)
+	if err != nil || job == nil {
+		return nil, err
+	}
+	if job.FinishedAt == nil && time.Since(job.UpdatedAt) > m.abandoned {
+		job.Status = StatusFailed
+		job.Error = "job was abandoned: the instance running it stopped"
+		job.FinishedAt = &job.UpdatedAt
+	}
+	return job, nil
+}
+
+func (m *Manager) run(id uuid.UUID, kind, tenantName string, fn Func) {
+	m.update(id, func(j *Job) { j.Status = StatusRunning })
+	m.save(id)
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go m.heartbeatLoop(id, stop)
+
+	var (
+		result map[string]any
+		err    error
+	)
+	func() {
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("job panicked: %v", r)
+			}
+		}()
+		result, err = fn(tenant.With(m.ctx, tenantName), &Progress{m: m, id: id})
+	}()
+
+	now := time.Now()
+	m.update(id, func(j *Job) {
+		j.FinishedAt = &now
+		j.Result = result
+		if err != nil {
+			j.Status = StatusFailed
+			j.Error = err.Error()
+			return
+		}
+		j.Status = StatusDone
+	})
+	m.save(id)
+	m.mu.Lock()
+	delete(m.running, id)
+	m.mu.Unlock()
+	if err != nil {
+		m.log.Error("job failed", "job_id", id, "kind", kind, "tenant", tenantName, "error", err)
+	}
+}
+
+// heartbeatLoop сохраняет прогресс задачи, пока не закрыт stop. По времени
+// последнего сохранения другие реплики отличают выполняющуюся задачу от брошенной.
+func (m *Manager) heartbeatLoop(id uuid.UUID, stop <-chan struct{}) {
+	t := time.NewTicker(m.heartbeat)
+	defer t.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-t.C:
+			m.save(id)
+		}
+	}
+}
+
+// save записывает текущее состояние задачи этой реплики в Store. Ошибка только
+// логируется: задача продолжает выполняться, а следующее сохранение её исправит.
+func (m *Manager) save(id uuid.UUID) {
+	m.mu.Lock()
+	job, ok := m.running[id]
+	if !ok {
+		m.mu.Unlock()
+		return
+	}
+	job.UpdatedAt = time.Now()
+	snapshot := *job
+	m.mu.Unlock()
+
+	// Финальное состояние сохраняется и после отмены m.ctx при остановке.
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(m.ctx), saveTimeout)
+	defer cancel()
+	if err := m.store.Save(ctx, &snapshot); err != nil {
+		m.log.Warn("save job failed", "job_id", id, "error", err)
+	}
+}
+
+func (m *Manager) update(id uuid.UUID, fn func(j *Job)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if job, ok := m.running[id]; ok {
+		fn(job)
+	}
+}
+
+// Progress позволяет задаче сообщать о ходе выполнения.
+type Progress struct {
+	m  *Manager
+	id uuid.UUID
+}
+
+// JobID возвращает идентификатор задачи.
+func (p *Progress) JobID() uuid.UUID { return p.id }
+
+// SetTotal задаёт ожидаемый объём работы, если он известен.
+func (p *Progress) SetTotal(total int64) {
+	p.m.update(p.id, func(j *Job) { j.Total = total })
+}
+
+// Add увеличивает число обработанных элементов.
+func (p *Progress) Add(n int64) {
+	p.m.update(p.id, func(j *Job) { j.Processed += n })
+}
@@ -0,0 +1,174 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/RaikyD/UserSegmentationService/internal/logging"
+	"github.com/RaikyD/UserSegmentationService/internal/tenant"
+)
+
+// wait опрашивает задачу, пока она не завершится.
+func wait(t *testing.T, m *Manager, id uuid.UUID) Job {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		job, err := m.Get(context.Background(), id)
+		if err != nil || job == nil {
+			t.Fatalf("job %s: %v, %v", id, job, err)
+		}
+		if job.FinishedAt != nil {
+			return *job
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("job %s did not finish", id)
+	return Job{}
+}
+
+func start(t *testing.T, m *Manager, ctx context.Context, fn Func) Job {
+	t.Helper()
+	job, err := m.Start(ctx, "test", fn)
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	return job
+}
+
+func TestManagerRun(t *testing.T) {
+	tests := []struct {
+		name       string
+		fn         Func
+		wantStatus Status
+		wantError  string
+	}{
+		{"done", func(_ context.Context, p *Progress) (map[string]any, error) {
+			p.SetTotal(3)
+			p.Add(2)
+			p.Add(1)
+			return map[string]any{"rows": 3}, nil
+		}, StatusDone, ""},
+		{"failed", func(context.Context, *Progress) (map[string]any, error) {
+			return nil, errors.New("disk full")
+		}, StatusFailed, "disk full"},
+		{"panicked", func(context.Context, *Progress) (map[string]any, error) {
+			panic("oops")
+		}, StatusFailed, "job panicked: oops"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewManager(context.Background(), NewMemoryStore(), time.Hour, logging.Discard())
+			started := start(t, m, context.Background(), tt.fn)
+			if started.Status != StatusPending || started.Kind != "test" {
+				t.Errorf("Start = %+v, want a pending test job", started)
+			}
+			job := wait(t, m, started.ID)
+			if job.Status != tt.wantStatus || job.Error != tt.wantError {
+				t.Errorf("job = %s %q, want %s %q", job.Status, job.Error, tt.wantStatus, tt.wantError)
+			}
+			// Результат прошёл через хранилище в JSON, числа в нём — float64.
+			if tt.wantStatus == StatusDone && (job.Processed != 3 || job.Total != 3 || job.Result["rows"] != float64(3)) {
+				t.Errorf("job = %+v, want 3 of 3 processed and the result", job)
+			}
+		})
+	}
+}
+
+func TestManagerCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	m := NewManager(ctx, NewMemoryStore(), time.Hour, logging.Discard())
+	job := start(t, m, ctx, func(ctx context.Context, _ *Progress) (map[string]any, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	cancel()
+	if got := wait(t, m, job.ID); got.Status != StatusFailed {
+		t.Errorf("status after cancel = %s, want failed", got.Status)
+	}
+}
+
+func TestManagerPrunesOldJobs(t *testing.T) {
+	m := NewManager(context.Background(), NewMemoryStore(), time.Millisecond, logging.Discard())
+	noop := func(context.Context, *Progress) (map[string]any, error) { return nil, nil }
+	old := start(t, m, context.Background(), noop)
+	wait(t, m, old.ID)
+	time.Sleep(5 * time.Millisecond)
+
+	start(t, m, context.Background(), noop)
+	if job, err := m.Get(context.Background(), old.ID); job != nil || err != nil {
+		t.Errorf("finished job outlived its retention: %v, %v", job, err)
+	}
+	if job, err := m.Get(context.Background(), uuid.New()); job != nil || err != nil {
+		t.Errorf("Get found an unknown job: %v, %v", job, err)
+	}
+}
+
+func TestManagerRunsAsTenant(t *testing.T) {
+	m := NewManager(context.Background(), NewMemoryStore(), time.Hour, logging.Discard())
+	job := start(t, m, tenant.With(context.Background(), "acme"), func(ctx context.Context, _ *Progress) (map[string]any, error) {
+		return map[string]any{"tenant": tenant.FromContext(ctx)}, nil
+	})
+	if job.Tenant != "acme" {
+		t.Errorf("job tenant = %q, want acme", job.Tenant)
+	}
+	if done := wait(t, m, job.ID); done.Result["tenant"] != "acme" {
+		t.Errorf("job ran as tenant %v, want acme", done.Result["tenant"])
+	}
+}
+
+// Две реплики с общим хранилищем: вторая видит прогресс и итог задачи первой.
+func TestManagerSharesStateThroughStore(t *testing.T) {
+	store := NewMemoryStore()
+	owner := NewManager(context.Background(), store, time.Hour, logging.Discard())
+	owner.heartbeat = time.Millisecond
+	other := NewManager(context.Background(), store, time.Hour, logging.Discard())
+
+	release := make(chan struct{})
+	job := start(t, owner, context.Background(), func(_ context.Context, p *Progress) (map[string]any, error) {
+		p.Add(7)
+		<-release
+		return map[string]any{"rows": 7}, nil
+	})
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		got, err := other.Get(context.Background(), job.ID)
+		if err != nil {
+			t.Fatalf("Get: %v", err)
+		}
+		if got != nil && got.Status == StatusRunning && got.Processed == 7 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("other replica sees %+v, want running with 7 processed", got)
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	close(release)
+	if done := wait(t, other, job.ID); done.Status != StatusDone || done.Result["rows"] != float64(7) {
+		t.Errorf("other replica sees %+v, want done with 7 rows", done)
+	}
+}
+
+func TestManagerReportsAbandonedJobs(t *testing.T) {
+	store := NewMemoryStore()
+	stale := time.Now().Add(-time.Hour)
+	abandoned := &Job{ID: uuid.New(), Kind: "test", Status: StatusRunning, Processed: 5, CreatedAt: stale, UpdatedAt: stale}
+	if err := store.Save(context.Background(), abandoned); err != nil {
+		t.Fatal(err)
+	}
+	m := NewManager(context.Background(), store, 24*time.Hour, logging.Discard())
+
+	job, err := m.Get(context.Background(), abandoned.ID)
+	if err != nil || job == nil {
+		t.Fatalf("Get = %v, %v", job, err)
+	}
+	if job.Status != StatusFailed || job.FinishedAt == nil || job.Processed != 5 {
+		t.Errorf("abandoned job = %+v, want failed with its last progress", job)
+	}
+}
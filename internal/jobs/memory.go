@@ -0,0 +1,60 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// MemoryStore хранит задачи в памяти процесса. Подходит для тестов и для
+// единственной реплики: после перезапуска задачи теряются.
+type MemoryStore struct {
+	mu   sync.Mutex
+	jobs map[uuid.UUID][]byte
+}
+
+// NewMemoryStore создаёт пустое хранилище задач.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{jobs: make(map[uuid.UUID][]byte)}
+}
+
+// Save хранит задачу в JSON, как и в БД: результат читается с теми же типами.
+func (s *MemoryStore) Save(_ context.Context, job *Job) error {
+	raw, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jobs[job.ID] = raw
+	return nil
+}
+
+func (s *MemoryStore) Get(_ context.Context, id uuid.UUID) (*Job, error) {
+	s.mu.Lock()
+	raw, ok := s.jobs[id]
+	s.mu.Unlock()
+	if !ok {
+		return nil, nil
+	}
+	var job Job
+	if err := json.Unmarshal(raw, &job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+func (s *MemoryStore) DeleteUpdatedBefore(_ context.Context, cutoff time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, raw := range s.jobs {
+		var job Job
+		if err := json.Unmarshal(raw, &job); err == nil && job.UpdatedAt.Before(cutoff) {
+			delete(s.jobs, id)
+		}
+	}
+	return nil
+}
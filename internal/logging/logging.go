@@ -0,0 +1,108 @@
+// Package logging настраивает структурированный лог сервиса на log/slog.
+//
+// Логгер создаётся один раз в main и передаётся компонентам через конструкторы.
+// Записи, сделанные через методы *Context, получают request_id запроса, если
+// контекст пришёл из HTTP-обработчика, и trace_id, если запрос трассируется.
+package logging
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"sync/atomic"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// New создаёт логгер. level — debug, info, warn или error; format — json
+// (по умолчанию, для продакшена) или text (удобнее читать локально).
+func New(w io.Writer, level, format string) (*slog.Logger, error) {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("invalid log level %q", level)
+	}
+	opts := &slog.HandlerOptions{Level: lvl}
+
+	var h slog.Handler
+	switch strings.ToLower(format) {
+	case "", "json":
+		h = slog.NewJSONHandler(w, opts)
+	case "text":
+		h = slog.NewTextHandler(w, opts)
+	default:
+		return nil, fmt.Errorf("invalid log format %q, expected json or text", format)
+	}
+	return slog.New(contextHandler{h}), nil
+}
+
+// Discard возвращает логгер, который ничего не пишет. Подходит, когда логгер не передан.
+func Discard() *slog.Logger {
+	return slog.New(slog.DiscardHandler)
+}
+
+// contextHandler добавляет к записи request_id и trace_id из контекста.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if id := middleware.GetReqID(ctx); id != "" {
+		r.AddAttrs(slog.String("request_id", id))
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		r.AddAttrs(slog.String("trace_id", sc.TraceID().String()))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
+
+// UserID — атрибут с обезличенным ID пользователя: префикс sha256 от UUID.
+// По нему можно связать записи об одном пользователе, но не узнать сам ID.
+func UserID(id uuid.UUID) slog.Attr {
+	sum := sha256.Sum256(id[:])
+	return slog.String("user", hex.EncodeToString(sum[:6]))
+}
+
+// Sampled возвращает логгер, который пропускает только каждую every-ю запись
+// ниже уровня warn. Предупреждения и ошибки пишутся всегда. Нужен на горячих
+// путях, где подробная запись на каждый запрос забила бы лог.
+func Sampled(logger *slog.Logger, every uint64) *slog.Logger {
+	if every <= 1 {
+		return logger
+	}
+	return slog.New(&samplingHandler{Handler: logger.Handler(), every: every, n: new(atomic.Uint64)})
+}
+
+type samplingHandler struct {
+	slog.Handler
+	every uint64
+	n     *atomic.Uint64
+}
+
+func (h *samplingHandler) Handle(ctx context.Context, r slog.Record) error {
+	if r.Level < slog.LevelWarn && h.n.Add(1)%h.every != 1 {
+		return nil
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h *samplingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &samplingHandler{Handler: h.Handler.WithAttrs(attrs), every: h.every, n: h.n}
+}
+
+func (h *samplingHandler) WithGroup(name string) slog.Handler {
+	return &samplingHandler{Handler: h.Handler.WithGroup(name), every: h.every, n: h.n}
+}
@@ -0,0 +1,146 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// records разбирает JSON-строки лога.
+func records(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	t.Helper()
+	var out []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var rec map[string]any
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			t.Fatalf("log line %q: %v", line, err)
+		}
+		out = append(out, rec)
+	}
+	return out
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		level, format string
+		wantErr       bool
+	}{
+		{"info", "", false},
+		{"debug", "json", false},
+		{"WARN", "text", false},
+		{"verbose", "json", true},
+		{"info", "xml", true},
+	}
+	for _, tt := range tests {
+		_, err := New(&bytes.Buffer{}, tt.level, tt.format)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("New(%q, %q) error = %v, want error %v", tt.level, tt.format, err, tt.wantErr)
+		}
+	}
+
+	var buf bytes.Buffer
+	logger, err := New(&buf, "warn", "json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.WithValue(context.Background(), middleware.RequestIDKey, "req-1")
+	ctx = trace.ContextWithSpanContext(ctx, trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID: trace.TraceID{1},
+		SpanID:  trace.SpanID{2},
+	}))
+	logger.InfoContext(ctx, "skipped")
+	logger.With("component", "test").WarnContext(ctx, "kept")
+	recs := records(t, &buf)
+	if len(recs) != 1 || recs[0]["msg"] != "kept" || recs[0]["request_id"] != "req-1" || recs[0]["component"] != "test" ||
+		recs[0]["trace_id"] != (trace.TraceID{1}).String() {
+		t.Errorf("records = %v, want one warn with request_id, trace_id and component", recs)
+	}
+}
+
+func TestUserID(t *testing.T) {
+	id := uuid.New()
+	attr := UserID(id)
+	if attr.Key != "user" || len(attr.Value.String()) != 12 || strings.Contains(id.String(), attr.Value.String()) {
+		t.Errorf("UserID = %v", attr)
+	}
+	if UserID(id).Value.String() != attr.Value.String() || UserID(uuid.New()).Value.String() == attr.Value.String() {
+		t.Error("UserID must be stable per user and differ between users")
+	}
+}
+
+func TestSampled(t *testing.T) {
+	var buf bytes.Buffer
+	logger := Sampled(slog.New(slog.NewJSONHandler(&buf, nil)), 10).With("k", "v")
+	for range 25 {
+		logger.Info("hot")
+	}
+	logger.Warn("always")
+	recs := records(t, &buf)
+	if len(recs) != 4 || recs[3]["msg"] != "always" || recs[0]["k"] != "v" {
+		t.Errorf("got %d records %v, want 3 sampled infos and the warning", len(recs), recs)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := New(&buf, "info", "json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := chi.NewRouter()
+	r.Use(middleware.RequestID, Middleware(logger))
+	r.Get("/segments/{segmentID}", func(w http.ResponseWriter, r *http.Request) {
+		switch chi.URLParam(r, "segmentID") {
+		case "broken":
+			RecordError(r.Context(), errors.New("db down"))
+			http.Error(w, "internal", http.StatusInternalServerError)
+		case "gone":
+			w.WriteHeader(http.StatusNotFound)
+		default:
+			_, _ = w.Write([]byte("ok"))
+		}
+	})
+
+	tests := []struct {
+		path      string
+		wantLevel string
+		wantCode  float64
+		wantError string
+	}{
+		{"/segments/a", "INFO", 200, ""},
+		{"/segments/gone", "INFO", 404, ""},
+		{"/segments/broken", "ERROR", 500, "db down"},
+	}
+	for _, tt := range tests {
+		buf.Reset()
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, tt.path, nil))
+		recs := records(t, &buf)
+		if len(recs) != 1 {
+			t.Fatalf("%s: %d records, want 1", tt.path, len(recs))
+		}
+		rec := recs[0]
+		if rec["level"] != tt.wantLevel || rec["status"] != tt.wantCode || rec["route"] != "/segments/{segmentID}" {
+			t.Errorf("%s: record = %v", tt.path, rec)
+		}
+		if gotErr, _ := rec["error"].(string); rec["request_id"] == nil || gotErr != tt.wantError {
+			t.Errorf("%s: record = %v, want request_id and error %q", tt.path, rec, tt.wantError)
+		}
+	}
+
+	// Вне Middleware RecordError ничего не делает.
+	RecordError(context.Background(), errors.New("ignored"))
+}
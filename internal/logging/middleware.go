@@ -0,0 +1,68 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+type errorKey struct{}
+
+// requestError — ячейка, в которую обработчик кладёт внутреннюю ошибку запроса,
+// чтобы она попала в строку журнала запросов.
+type requestError struct {
+	err error
+}
+
+// RecordError прикрепляет err к строке журнала текущего запроса. Вне Middleware ничего не делает.
+func RecordError(ctx context.Context, err error) {
+	if cell, ok := ctx.Value(errorKey{}).(*requestError); ok {
+		cell.err = err
+	}
+}
+
+// Middleware пишет по строке на запрос: метод, шаблон маршрута, статус, размер
+// ответа и длительность. Запросы с 5xx или ошибкой из RecordError пишутся с уровнем
+// error, остальные — info. Строка пишется и для оборванных запросов.
+func Middleware(logger *slog.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			cell := &requestError{}
+			ctx := context.WithValue(r.Context(), errorKey{}, cell)
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+
+			defer func() {
+				status := ww.Status()
+				if status == 0 {
+					status = http.StatusOK
+				}
+				route := r.URL.Path
+				if rctx := chi.RouteContext(ctx); rctx != nil && rctx.RoutePattern() != "" {
+					route = rctx.RoutePattern()
+				}
+				attrs := []slog.Attr{
+					slog.String("method", r.Method),
+					slog.String("route", route),
+					slog.Int("status", status),
+					slog.Int("bytes", ww.BytesWritten()),
+					slog.Duration("duration", time.Since(start)),
+					slog.String("remote_addr", r.RemoteAddr),
+				}
+				level := slog.LevelInfo
+				if cell.err != nil {
+					attrs = append(attrs, slog.String("error", cell.err.Error()))
+					level = slog.LevelError
+				} else if status >= http.StatusInternalServerError {
+					level = slog.LevelError
+				}
+				logger.LogAttrs(ctx, level, "http request", attrs...)
+			}()
+			next.ServeHTTP(ww, r.WithContext(ctx))
+		})
+	}
+}
@@ -0,0 +1,181 @@
+// Package metrics собирает метрики сервиса для Prometheus. Метрики регистрируются
+// в реестре по умолчанию и отдаются через Handler.
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/RaikyD/UserSegmentationService/internal/storage"
+)
+
+const namespace = "segmentation"
+
+var (
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by route pattern, method and status code.",
+	}, []string{"route", "method", "status"})
+
+	httpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by route pattern and method.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method"})
+
+	// Assignments считает новые привязки пользователей к сегментам по типу привязки.
+	Assignments = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "assignments_total",
+		Help:      "User-to-segment assignments by assignment type.",
+	}, []string{"assignment_type"})
+
+	// MassAssignDuration — длительность массового назначения сегмента.
+	MassAssignDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "mass_assign_duration_seconds",
+		Help:      "Duration of mass segment assignment.",
+		Buckets:   prometheus.ExponentialBuckets(0.01, 4, 8),
+	})
+
+	// MassAssignSize — сколько пользователей получили сегмент за одно массовое назначение.
+	MassAssignSize = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "mass_assign_users",
+		Help:      "Users newly assigned by one mass segment assignment.",
+		Buckets:   prometheus.ExponentialBuckets(1, 10, 7),
+	})
+
+	// SegmentMembers — число участников каждого действующего сегмента.
+	SegmentMembers = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "segment_members",
+		Help:      "Current member count of each active segment, refreshed periodically.",
+	}, []string{"tenant", "segment", "type"})
+)
+
+// Handler отдаёт метрики в формате Prometheus.
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// Middleware считает запросы и их длительность. Маршрут берётся из шаблона chi
+// (например /segments/{segmentID}), чтобы ID не раздували число рядов.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r)
+
+		route := "unmatched"
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			route = rctx.RoutePattern()
+		}
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		httpRequests.WithLabelValues(route, r.Method, strconv.Itoa(status)).Inc()
+		httpDuration.WithLabelValues(route, r.Method).Observe(time.Since(start).Seconds())
+	})
+}
+
+// RegisterPool регистрирует метрики пула соединений с БД.
+func RegisterPool(pool *pgxpool.Pool) {
+	prometheus.MustRegister(&poolCollector{pool: pool})
+}
+
+var (
+	poolAcquiredDesc    = poolDesc("acquired_conns", "Connections currently in use.")
+	poolIdleDesc        = poolDesc("idle_conns", "Idle connections in the pool.")
+	poolTotalDesc       = poolDesc("total_conns", "All connections in the pool.")
+	poolMaxDesc         = poolDesc("max_conns", "Maximum pool size.")
+	poolAcquiresDesc    = poolDesc("acquires_total", "Successful connection acquires.")
+	poolWaitsDesc       = poolDesc("acquire_waits_total", "Acquires that had to wait for a free connection.")
+	poolWaitSecondsDesc = poolDesc("acquire_wait_seconds_total", "Time spent waiting for a free connection.")
+	poolCanceledDesc    = poolDesc("canceled_acquires_total", "Acquires canceled by context.")
+)
+
+func poolDesc(name, help string) *prometheus.Desc {
+	return prometheus.NewDesc(prometheus.BuildFQName(namespace, "db_pool", name), help, nil, nil)
+}
+
+// poolCollector читает pgxpool.Stat в момент сбора метрик.
+type poolCollector struct {
+	pool *pgxpool.Pool
+}
+
+func (c *poolCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- poolAcquiredDesc
+	ch <- poolIdleDesc
+	ch <- poolTotalDesc
+	ch <- poolMaxDesc
+	ch <- poolAcquiresDesc
+	ch <- poolWaitsDesc
+	ch <- poolWaitSecondsDesc
+	ch <- poolCanceledDesc
+}
+
+func (c *poolCollector) Collect(ch chan<- prometheus.Metric) {
+	s := c.pool.Stat()
+	ch <- prometheus.MustNewConstMetric(poolAcquiredDesc, prometheus.GaugeValue, float64(s.AcquiredConns()))
+	ch <- prometheus.MustNewConstMetric(poolIdleDesc, prometheus.GaugeValue, float64(s.IdleConns()))
+	ch <- prometheus.MustNewConstMetric(poolTotalDesc, prometheus.GaugeValue, float64(s.TotalConns()))
+	ch <- prometheus.MustNewConstMetric(poolMaxDesc, prometheus.GaugeValue, float64(s.MaxConns()))
+	ch <- prometheus.MustNewConstMetric(poolAcquiresDesc, prometheus.CounterValue, float64(s.AcquireCount()))
+	ch <- prometheus.MustNewConstMetric(poolWaitsDesc, prometheus.CounterValue, float64(s.EmptyAcquireCount()))
+	ch <- prometheus.MustNewConstMetric(poolWaitSecondsDesc, prometheus.CounterValue, s.EmptyAcquireWaitTime().Seconds())
+	ch <- prometheus.MustNewConstMetric(poolCanceledDesc, prometheus.CounterValue, float64(s.CanceledAcquireCount()))
+}
+
+// RegisterSegmentCache регистрирует метрики кэша сегментов.
+func RegisterSegmentCache(cache *storage.SegmentCache) {
+	prometheus.MustRegister(&cacheCollector{cache: cache})
+}
+
+var (
+	cacheSizeDesc          = cacheDesc("size", "Segments currently cached.")
+	cacheCapacityDesc      = cacheDesc("capacity", "Maximum number of cached segments.")
+	cacheHitsDesc          = cacheDesc("hits_total", "Segment lookups served from the cache.")
+	cacheMissesDesc        = cacheDesc("misses_total", "Segment lookups that went to the database.")
+	cacheEvictionsDesc     = cacheDesc("evictions_total", "Segments evicted to stay within capacity.")
+	cacheInvalidationsDesc = cacheDesc("invalidations_total", "Segments dropped after a change notification.")
+)
+
+func cacheDesc(name, help string) *prometheus.Desc {
+	return prometheus.NewDesc(prometheus.BuildFQName(namespace, "segment_cache", name), help, nil, nil)
+}
+
+// cacheCollector читает storage.CacheStats в момент сбора метрик.
+type cacheCollector struct {
+	cache *storage.SegmentCache
+}
+
+func (c *cacheCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- cacheSizeDesc
+	ch <- cacheCapacityDesc
+	ch <- cacheHitsDesc
+	ch <- cacheMissesDesc
+	ch <- cacheEvictionsDesc
+	ch <- cacheInvalidationsDesc
+}
+
+func (c *cacheCollector) Collect(ch chan<- prometheus.Metric) {
+	s := c.cache.Stats()
+	ch <- prometheus.MustNewConstMetric(cacheSizeDesc, prometheus.GaugeValue, float64(s.Size))
+	ch <- prometheus.MustNewConstMetric(cacheCapacityDesc, prometheus.GaugeValue, float64(s.Capacity))
+	ch <- prometheus.MustNewConstMetric(cacheHitsDesc, prometheus.CounterValue, float64(s.Hits))
+	ch <- prometheus.MustNewConstMetric(cacheMissesDesc, prometheus.CounterValue, float64(s.Misses))
+	ch <- prometheus.MustNewConstMetric(cacheEvictionsDesc, prometheus.CounterValue, float64(s.Evictions))
+	ch <- prometheus.MustNewConstMetric(cacheInvalidationsDesc, prometheus.CounterValue, float64(s.Invalidations))
+}
@@ -0,0 +1,73 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/RaikyD/UserSegmentationService/internal/logging"
+	"github.com/RaikyD/UserSegmentationService/internal/storage"
+)
+
+func TestMiddlewareLabelsByRoutePattern(t *testing.T) {
+	r := chi.NewRouter()
+	r.Use(Middleware)
+	r.Get("/segments/{segmentID}", func(w http.ResponseWriter, r *http.Request) {
+		if chi.URLParam(r, "segmentID") == "missing" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+
+	for _, path := range []string{"/segments/a", "/segments/b", "/segments/missing", "/nowhere"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	tests := []struct {
+		route, status string
+		want          float64
+	}{
+		{"/segments/{segmentID}", "200", 2},
+		{"/segments/{segmentID}", "404", 1},
+		{"unmatched", "404", 1},
+	}
+	for _, tt := range tests {
+		if got := testutil.ToFloat64(httpRequests.WithLabelValues(tt.route, http.MethodGet, tt.status)); got != tt.want {
+			t.Errorf("http_requests_total{route=%q,status=%s} = %v, want %v", tt.route, tt.status, got, tt.want)
+		}
+	}
+	if n := testutil.CollectAndCount(httpDuration); n != 2 {
+		t.Errorf("duration series = %d, want 2 (one per route)", n)
+	}
+}
+
+func TestCacheCollector(t *testing.T) {
+	cache := storage.NewSegmentCache(nil, time.Minute, 64, logging.Discard())
+	cache.Invalidate(uuid.New())
+	cache.Purge()
+
+	want := `
+# HELP segmentation_segment_cache_capacity Maximum number of cached segments.
+# TYPE segmentation_segment_cache_capacity gauge
+segmentation_segment_cache_capacity 64
+# HELP segmentation_segment_cache_invalidations_total Segments dropped after a change notification.
+# TYPE segmentation_segment_cache_invalidations_total counter
+segmentation_segment_cache_invalidations_total 2
+# HELP segmentation_segment_cache_size Segments currently cached.
+# TYPE segmentation_segment_cache_size gauge
+segmentation_segment_cache_size 0
+`
+	err := testutil.CollectAndCompare(&cacheCollector{cache: cache}, strings.NewReader(want),
+		"segmentation_segment_cache_capacity", "segmentation_segment_cache_invalidations_total", "segmentation_segment_cache_size")
+	if err != nil {
+		t.Error(err)
+	}
+	if n := testutil.CollectAndCount(&cacheCollector{cache: cache}); n != 6 {
+		t.Errorf("collected %d metrics, want 6", n)
+	}
+}
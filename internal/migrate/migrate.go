@@ -0,0 +1,122 @@
+// Package migrate применяет встроенные миграции схемы. Изменяющие схему команды
+// выполняются под advisory-блокировкой Postgres, поэтому несколько реплик или
+// запусков migrate не применяют миграции одновременно.
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"log/slog"
+	"time"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/pressly/goose/v3"
+
+	"github.com/RaikyD/UserSegmentationService/migrations"
+)
+
+// Команды migrate.
+const (
+	CommandUp     = "up"
+	CommandDown   = "down"
+	CommandStatus = "status"
+	CommandRedo   = "redo"
+)
+
+// Commands перечисляет поддерживаемые команды в порядке для справки.
+var Commands = []string{CommandUp, CommandDown, CommandStatus, CommandRedo}
+
+// lockKey — ключ advisory-блокировки миграций (байты строки "segments").
+const lockKey int64 = 0x7365676d656e7473
+
+// dir — каталог миграций внутри migrations.FS.
+const dir = "."
+
+func init() {
+	goose.SetBaseFS(migrations.FS)
+	if err := goose.SetDialect("postgres"); err != nil {
+		panic(err)
+	}
+}
+
+// Open открывает подключение для миграций через драйвер pgx.
+func Open(databaseURL string) (*sql.DB, error) {
+	return sql.Open("pgx", databaseURL)
+}
+
+// Latest возвращает версию последней встроенной миграции — ту, до которой
+// должна быть обновлена схема.
+func Latest() (int64, error) {
+	all, err := goose.CollectMigrations(dir, 0, goose.MaxVersion)
+	if err != nil {
+		return 0, err
+	}
+	last, err := all.Last()
+	if err != nil {
+		return 0, err
+	}
+	return last.Version, nil
+}
+
+// Run выполняет команду migrate. up, down и redo ждут advisory-блокировку,
+// status выполняется без неё.
+func Run(ctx context.Context, db *sql.DB, command string, logger *slog.Logger) error {
+	var apply func(context.Context, *sql.DB, string, ...goose.OptionsFunc) error
+	switch command {
+	case CommandUp:
+		apply = goose.UpContext
+	case CommandDown:
+		apply = goose.DownContext
+	case CommandRedo:
+		apply = goose.RedoContext
+	case CommandStatus:
+		return goose.StatusContext(ctx, db, dir)
+	default:
+		return fmt.Errorf("unknown migrate command %q", command)
+	}
+
+	unlock, err := lock(ctx, db, logger)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	return apply(ctx, db, dir)
+}
+
+// lock берёт сессионную advisory-блокировку на отдельном соединении и держит
+// его до вызова unlock. goose работает через другие соединения db.
+func lock(ctx context.Context, db *sql.DB, logger *slog.Logger) (unlock func(), err error) {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("migration lock: %w", err)
+	}
+
+	var locked bool
+	if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", lockKey).Scan(&locked); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("migration lock: %w", err)
+	}
+	if !locked {
+		logger.Info("waiting for migration lock held by another instance")
+		started := time.Now()
+		if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", lockKey); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("migration lock: %w", err)
+		}
+		logger.Info("migration lock acquired", "waited", time.Since(started))
+	}
+
+	return func() {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+		defer cancel()
+		if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", lockKey); err != nil {
+			logger.Warn("migration unlock failed, dropping connection", "error", err)
+			// Блокировка снимается вместе с сессией: соединение не должно
+			// вернуться в пул db.
+			_ = conn.Raw(func(any) error { return driver.ErrBadConn })
+		}
+		conn.Close()
+	}, nil
+}
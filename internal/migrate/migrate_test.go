@@ -0,0 +1,36 @@
+package migrate
+
+import (
+	"context"
+	"io/fs"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/RaikyD/UserSegmentationService/internal/logging"
+	"github.com/RaikyD/UserSegmentationService/migrations"
+)
+
+func TestLatest(t *testing.T) {
+	files, err := fs.Glob(migrations.FS, "*.sql")
+	if err != nil || len(files) == 0 {
+		t.Fatalf("embedded migrations = %v, %v", files, err)
+	}
+	latest, err := Latest()
+	if err != nil {
+		t.Fatalf("Latest: %v", err)
+	}
+	// Файлы называются <версия>_<описание>.sql, последний по имени — самый новый.
+	want := strings.SplitN(files[len(files)-1], "_", 2)[0]
+	if got := strconv.FormatInt(latest, 10); got != want {
+		t.Errorf("Latest = %s, want %s", got, want)
+	}
+}
+
+func TestRunUnknownCommand(t *testing.T) {
+	// Неизвестная команда отвергается до обращения к БД.
+	err := Run(context.Background(), nil, "sideways", logging.Discard())
+	if err == nil || !strings.Contains(err.Error(), "sideways") {
+		t.Errorf("Run(sideways) error = %v", err)
+	}
+}
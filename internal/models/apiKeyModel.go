@@ -0,0 +1,18 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// APIKey — статический ключ доступа к API. Сам ключ не хранится, только его sha256.
+// Ключ с Tenant привязан к одному арендатору, без него действует для всех.
+type APIKey struct {
+	ID        uuid.UUID  `db:"id" json:"id"`
+	Name      string     `db:"name" json:"name"`
+	Roles     []string   `db:"roles" json:"roles"`
+	Tenant    *string    `db:"tenant" json:"tenant,omitempty"`
+	CreatedAt time.Time  `db:"created_at" json:"created_at"`
+	RevokedAt *time.Time `db:"revoked_at" json:"revoked_at,omitempty"`
+}
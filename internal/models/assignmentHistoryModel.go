@@ -0,0 +1,44 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ChangeSource — откуда пришло изменение привязки.
+type ChangeSource string
+
+const (
+	SourceManual ChangeSource = "manual"
+	SourceAuto   ChangeSource = "auto"
+	SourceRule   ChangeSource = "rule"
+	SourceImport ChangeSource = "import"
+)
+
+type ChangeOperation string
+
+const (
+	OperationAssign   ChangeOperation = "assign"
+	OperationUnassign ChangeOperation = "unassign"
+)
+
+// ChangeMeta — кто и каким способом меняет привязки; попадает в журнал истории.
+type ChangeMeta struct {
+	Actor  string
+	Source ChangeSource
+}
+
+// AssignmentEvent — одна запись журнала user_segment_history.
+type AssignmentEvent struct {
+	ID        int64     `db:"id" json:"id"`
+	SegmentID uuid.UUID `db:"segment_id" json:"segment_id"`
+	// SegmentName заполняется только в отчётах; пусто, если сегмент уже удалён.
+	SegmentName string          `db:"segment_name" json:"segment_name,omitempty"`
+	UserID      uuid.UUID       `db:"user_id" json:"user_id"`
+	Operation   ChangeOperation `db:"operation" json:"operation"`
+	Source      ChangeSource    `db:"source" json:"source"`
+	Actor       string          `db:"actor" json:"actor"`
+	ExpiresAt   *time.Time      `db:"expires_at" json:"expires_at,omitempty"`
+	OccurredAt  time.Time       `db:"occurred_at" json:"occurred_at"`
+}
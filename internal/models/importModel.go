@@ -0,0 +1,28 @@
+package models
+
+// ImportMode — как загруженный список участников применяется к сегменту.
+type ImportMode string
+
+const (
+	// ImportAppend добавляет пользователей из файла к уже привязанным.
+	ImportAppend ImportMode = "append"
+	// ImportReplace делает явных участников сегмента ровно теми, что перечислены в файле.
+	ImportReplace ImportMode = "replace"
+)
+
+// ImportResult — итог применения импорта к сегменту.
+type ImportResult struct {
+	Staged  int64 `json:"staged"`  // уникальных пользователей в файле
+	Added   int64 `json:"added"`   // новых привязок
+	Removed int64 `json:"removed"` // снятых привязок (только для replace)
+}
+
+// ImportFormat — формат загружаемого файла.
+type ImportFormat string
+
+const (
+	// ImportCSV — по одному user_id в первой колонке строки, заголовок user_id необязателен.
+	ImportCSV ImportFormat = "csv"
+	// ImportNDJSON — по одному JSON-объекту {"user_id": "..."} в строке.
+	ImportNDJSON ImportFormat = "ndjson"
+)
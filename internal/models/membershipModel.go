@@ -0,0 +1,26 @@
+package models
+
+import "github.com/google/uuid"
+
+// MembershipCheck — пара «пользователь — сегмент» для проверки членства.
+// Segment — ID или имя сегмента.
+type MembershipCheck struct {
+	UserID  uuid.UUID
+	Segment string
+}
+
+// MembershipRow — то, что БД знает о паре: сам сегмент (nil, если его нет)
+// и тип действующей явной привязки (пусто, если привязки нет).
+type MembershipRow struct {
+	Segment        *Segment
+	AssignmentType AssignmentType
+}
+
+// Membership — результат проверки одной пары. AssignmentType заполнен,
+// только если пользователь состоит в сегменте.
+type Membership struct {
+	UserID         uuid.UUID
+	Segment        *Segment
+	Member         bool
+	AssignmentType AssignmentType
+}
@@ -0,0 +1,53 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// SegmentSort — порядок выдачи списка сегментов. Минус — по убыванию.
+type SegmentSort string
+
+const (
+	SortCreatedOnDesc SegmentSort = "-created_on"
+	SortCreatedOnAsc  SegmentSort = "created_on"
+	SortNameAsc       SegmentSort = "name"
+	SortNameDesc      SegmentSort = "-name"
+)
+
+// Valid сообщает, известен ли порядок сортировки.
+func (s SegmentSort) Valid() bool {
+	switch s {
+	case SortCreatedOnDesc, SortCreatedOnAsc, SortNameAsc, SortNameDesc:
+		return true
+	}
+	return false
+}
+
+// SegmentFilter — условия отбора сегментов. Незаданные поля не фильтруют.
+type SegmentFilter struct {
+	Type *SegmentType
+	// IsActive отбирает сегменты, которые действуют (или не действуют) сейчас,
+	// с учётом флага и окна valid_from/valid_to — как в ActiveAt.
+	IsActive    *bool
+	NamePrefix  string
+	CreatedFrom *time.Time // включительно
+	CreatedTo   *time.Time // не включительно
+}
+
+// SegmentKey — позиция сегмента в выдаче: значения полей сортировки последнего
+// сегмента страницы. Следующая страница начинается строго после неё.
+type SegmentKey struct {
+	CreatedOn time.Time
+	Name      string
+	ID        uuid.UUID
+}
+
+// SegmentQuery — запрос страницы списка сегментов.
+type SegmentQuery struct {
+	Filter SegmentFilter
+	Sort   SegmentSort
+	After  *SegmentKey // nil — с начала
+	Limit  int         // 0 — без ограничения
+}
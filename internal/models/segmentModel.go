@@ -12,14 +12,34 @@ const (
 	SegmentTypeStatic      SegmentType = "static"
 	SegmentTypeDynamic     SegmentType = "dynamic"
 	SegmentTypeDynamicRule SegmentType = "dynamic_rule"
+	// SegmentTypeComposite — членство вычисляется по выражению над другими сегментами (см. пакет composite).
+	SegmentTypeComposite SegmentType = "composite"
 )
 
 type Segment struct {
 	ID          uuid.UUID       `db:"id" json:"id"`
+	Tenant      string          `db:"tenant" json:"tenant"`
 	SegmentName string          `db:"segmentName" json:"segmentName"`
 	Type        SegmentType     `db:"segmentType" json:"segmentType"`
 	Config      json.RawMessage `db:"config" json:"config"`
 	Description string          `db:"description" json:"description"`
 	IsActive    bool            `db:"isActive" json:"isActive"`
 	CreatedOn   time.Time       `db:"createdOn" json:"createdOn"`
+	ValidFrom   *time.Time      `db:"validFrom" json:"validFrom,omitempty"`
+	ValidTo     *time.Time      `db:"validTo" json:"validTo,omitempty"`
+}
+
+// ActiveAt сообщает, действует ли сегмент в момент t: он должен быть включён
+// и t должно попадать в окно [ValidFrom, ValidTo).
+func (s *Segment) ActiveAt(t time.Time) bool {
+	if !s.IsActive {
+		return false
+	}
+	if s.ValidFrom != nil && t.Before(*s.ValidFrom) {
+		return false
+	}
+	if s.ValidTo != nil && !t.Before(*s.ValidTo) {
+		return false
+	}
+	return true
 }
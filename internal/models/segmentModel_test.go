@@ -0,0 +1,35 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestActiveAt(t *testing.T) {
+	now := time.Date(2025, 7, 28, 12, 0, 0, 0, time.UTC)
+	before, after := now.Add(-time.Hour), now.Add(time.Hour)
+
+	tests := []struct {
+		name     string
+		active   bool
+		from, to *time.Time
+		want     bool
+	}{
+		{"no window", true, nil, nil, true},
+		{"disabled", false, nil, nil, false},
+		{"disabled inside window", false, &before, &after, false},
+		{"inside window", true, &before, &after, true},
+		{"not started", true, &after, nil, false},
+		{"starts now", true, &now, nil, true},
+		{"ended", true, nil, &before, false},
+		{"ends now", true, nil, &now, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			seg := &Segment{IsActive: tt.active, ValidFrom: tt.from, ValidTo: tt.to}
+			if got := seg.ActiveAt(now); got != tt.want {
+				t.Errorf("ActiveAt = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,11 @@
+package models
+
+// TenantUsage — объём данных арендатора. Assignments и Users учитывают только
+// действующие явные привязки; пользователи из корзин раскатки не считаются.
+type TenantUsage struct {
+	Tenant         string
+	Segments       int64
+	ActiveSegments int64
+	Assignments    int64
+	Users          int64
+}
@@ -0,0 +1,17 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// User — пользователь сервиса с произвольными атрибутами,
+// по которым вычисляются правила dynamic_rule.
+type User struct {
+	ID         uuid.UUID       `db:"id" json:"id"`
+	Attributes json.RawMessage `db:"attributes" json:"attributes"`
+	CreatedAt  time.Time       `db:"created_at" json:"created_at"`
+	UpdatedAt  time.Time       `db:"updated_at" json:"updated_at"`
+}
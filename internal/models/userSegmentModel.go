@@ -11,6 +11,12 @@ type AssignmentType string
 const (
 	AssignmentManual AssignmentType = "manual"
 	AssignmentAuto   AssignmentType = "auto"
+	// AssignmentRollout — членство вычислено по корзине dynamic-сегмента и в БД не хранится.
+	AssignmentRollout AssignmentType = "rollout"
+	// AssignmentComposite — членство вычислено по выражению composite-сегмента.
+	AssignmentComposite AssignmentType = "composite"
+	// AssignmentRule — пользователь подходит под правило dynamic_rule-сегмента.
+	AssignmentRule AssignmentType = "rule"
 )
 
 // UserSegmentAssignment хранит одну запись о том,
@@ -22,6 +28,17 @@ type UserSegmentAssignment struct {
 	AssignmentType AssignmentType `db:"assignment_type" json:"assignment_type"` // Необходимо для понимания,
 	// был ли пользователь добавлен "руками" или при случайной выборке (Полезно может быть для условной категории Стримеров/VIP и тд)
 	AssignedAt time.Time `db:"assigned_at" json:"assigned_at"`
+	// ExpiresAt — момент, после которого привязка считается недействительной; nil — бессрочно.
+	ExpiresAt *time.Time `db:"expires_at" json:"expires_at,omitempty"`
+}
+
+// UserSegment — сегмент пользователя вместе с тем, как пользователь в него попал.
+// У вычисляемого членства (rollout, rule, composite) AssignedAt и ExpiresAt пусты.
+type UserSegment struct {
+	Segment        *Segment
+	AssignmentType AssignmentType
+	AssignedAt     *time.Time
+	ExpiresAt      *time.Time
 }
 
 // MassAssignResult результат массового назначения сегмента
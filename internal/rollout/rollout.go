@@ -0,0 +1,65 @@
+// Package rollout реализует детерминированное процентное разбиение пользователей
+// для сегментов типа dynamic.
+//
+// Каждый пользователь попадает в одну из 10000 корзин: hash(salt, userID) mod 10000.
+// Пользователь входит в сегмент, если номер его корзины меньше percent*100.
+// Поэтому ответ для пользователя стабилен между вызовами, не требует хранимых
+// строк, а увеличение процента сохраняет всех, кто уже был в сегменте.
+package rollout
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+
+	"github.com/google/uuid"
+)
+
+// Buckets — количество корзин, шаг процента — 0.01%.
+const Buckets = 10000
+
+// Config — формат поля config у сегмента типа dynamic.
+type Config struct {
+	Percent float64 `json:"percent"`
+	Salt    string  `json:"salt"`
+}
+
+// ParseConfig разбирает и проверяет JSON-конфиг сегмента.
+func ParseConfig(raw json.RawMessage) (*Config, error) {
+	var cfg Config
+	if err := json.Unmarshal(raw, &cfg); err != nil {
+		return nil, fmt.Errorf("invalid rollout config: %w", err)
+	}
+	if math.IsNaN(cfg.Percent) || cfg.Percent < 0 || cfg.Percent > 100 {
+		return nil, fmt.Errorf("percent must be between 0 and 100, got %v", cfg.Percent)
+	}
+	return &cfg, nil
+}
+
+// Marshal сериализует конфиг обратно в JSON для сохранения в сегменте.
+func (c *Config) Marshal() json.RawMessage {
+	raw, _ := json.Marshal(c)
+	return raw
+}
+
+// Threshold возвращает число корзин, входящих в сегмент.
+func (c *Config) Threshold() int {
+	return int(math.Round(c.Percent * Buckets / 100))
+}
+
+// Contains сообщает, входит ли пользователь в раскатку.
+func (c *Config) Contains(userID uuid.UUID) bool {
+	return Bucket(c.Salt, userID) < c.Threshold()
+}
+
+// Bucket возвращает номер корзины пользователя в диапазоне [0, Buckets).
+func Bucket(salt string, userID uuid.UUID) int {
+	h := sha256.New()
+	h.Write([]byte(salt))
+	h.Write([]byte{':'})
+	h.Write(userID[:])
+	sum := h.Sum(nil)
+	return int(binary.BigEndian.Uint64(sum[:8]) % Buckets)
+}
@@ -0,0 +1,118 @@
+package rollout
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+// Значения посчитаны независимо: sha256(salt ":" uuid), первые 8 байт big-endian
+// по модулю 10000. Их же должна давать SQL-функция rollout_bucket.
+func TestBucketGolden(t *testing.T) {
+	tests := []struct {
+		salt string
+		user string
+		want int
+	}{
+		{"salt", "00000000-0000-0000-0000-000000000000", 1277},
+		{"salt", "550e8400-e29b-41d4-a716-446655440000", 9171},
+		{"a1b2", "550e8400-e29b-41d4-a716-446655440000", 1305},
+		{"", "6ba7b810-9dad-11d1-80b4-00c04fd430c8", 4915},
+	}
+	for _, tt := range tests {
+		if got := Bucket(tt.salt, uuid.MustParse(tt.user)); got != tt.want {
+			t.Errorf("Bucket(%q, %s) = %d, want %d", tt.salt, tt.user, got, tt.want)
+		}
+	}
+}
+
+func TestBucketDistribution(t *testing.T) {
+	const users = 100000
+	counts := make([]int, 10)
+	for range users {
+		b := Bucket("distribution", uuid.New())
+		if b < 0 || b >= Buckets {
+			t.Fatalf("bucket %d out of range", b)
+		}
+		counts[b*len(counts)/Buckets]++
+	}
+	// Каждая десятая часть корзин должна получить около 10% пользователей.
+	for i, n := range counts {
+		if n < users/10*9/10 || n > users/10*11/10 {
+			t.Errorf("decile %d got %d users, want about %d", i, n, users/10)
+		}
+	}
+}
+
+func TestContainsKeepsMembersWhenPercentGrows(t *testing.T) {
+	small := &Config{Percent: 10, Salt: "grow"}
+	large := &Config{Percent: 25.5, Salt: "grow"}
+	other := &Config{Percent: 10, Salt: "other"}
+	inSmall, differs := 0, 0
+	for range 10000 {
+		id := uuid.New()
+		if small.Contains(id) {
+			inSmall++
+			if !large.Contains(id) {
+				t.Fatalf("user %s left the rollout when percent grew", id)
+			}
+		}
+		if small.Contains(id) != other.Contains(id) {
+			differs++
+		}
+	}
+	if inSmall == 0 {
+		t.Fatal("nobody got into a 10% rollout")
+	}
+	if differs == 0 {
+		t.Error("different salts produced the same split")
+	}
+}
+
+func TestThreshold(t *testing.T) {
+	tests := []struct {
+		percent float64
+		want    int
+	}{
+		{0, 0},
+		{0.01, 1},
+		{0.005, 1},
+		{12.345, 1235},
+		{50, 5000},
+		{100, Buckets},
+	}
+	for _, tt := range tests {
+		if got := (&Config{Percent: tt.percent}).Threshold(); got != tt.want {
+			t.Errorf("Threshold(%v) = %d, want %d", tt.percent, got, tt.want)
+		}
+	}
+
+	id := uuid.New()
+	if (&Config{Percent: 0, Salt: "s"}).Contains(id) {
+		t.Error("0% rollout contains a user")
+	}
+	if !(&Config{Percent: 100, Salt: "s"}).Contains(id) {
+		t.Error("100% rollout does not contain a user")
+	}
+}
+
+func TestParseConfig(t *testing.T) {
+	cfg, err := ParseConfig(json.RawMessage(`{"percent": 12.5, "salt": "abc"}`))
+	if err != nil {
+		t.Fatalf("ParseConfig: %v", err)
+	}
+	if cfg.Percent != 12.5 || cfg.Salt != "abc" {
+		t.Errorf("ParseConfig = %+v", cfg)
+	}
+	back, err := ParseConfig(cfg.Marshal())
+	if err != nil || *back != *cfg {
+		t.Errorf("Marshal round trip = %+v, %v", back, err)
+	}
+
+	for _, raw := range []string{`{"percent": -1}`, `{"percent": 100.01}`, `{"percent": "10"}`, `[]`} {
+		if _, err := ParseConfig(json.RawMessage(raw)); err == nil {
+			t.Errorf("ParseConfig(%s) succeeded, want error", raw)
+		}
+	}
+}
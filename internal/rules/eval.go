@@ -0,0 +1,345 @@
+package rules
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+)
+
+func (n *literalNode) eval(map[string]any) (any, error) { return n.value, nil }
+
+func (n *attrNode) eval(attrs map[string]any) (any, error) {
+	var cur any = attrs
+	for _, key := range n.path {
+		m, ok := cur.(map[string]any)
+		if !ok {
+			return nil, nil
+		}
+		if cur, ok = m[key]; !ok {
+			return nil, nil
+		}
+	}
+	return normalize(cur), nil
+}
+
+func (n *listNode) eval(attrs map[string]any) (any, error) {
+	out := make([]any, 0, len(n.items))
+	for _, item := range n.items {
+		v, err := item.eval(attrs)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+	}
+	return out, nil
+}
+
+func (n *callNode) eval(attrs map[string]any) (any, error) {
+	args := make([]any, 0, len(n.args))
+	for _, a := range n.args {
+		v, err := a.eval(attrs)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, v)
+	}
+	switch n.name {
+	case "now":
+		return time.Now(), nil
+	case "date":
+		if t, ok := toTime(args[0]); ok {
+			return t, nil
+		}
+		return nil, nil
+	case "days_ago":
+		d, ok := toFloat(args[0])
+		if !ok {
+			return nil, fmt.Errorf("days_ago expects a number")
+		}
+		return time.Now().Add(-time.Duration(d * float64(24*time.Hour))), nil
+	case "lower":
+		if s, ok := args[0].(string); ok {
+			return strings.ToLower(s), nil
+		}
+		return nil, nil
+	case "upper":
+		if s, ok := args[0].(string); ok {
+			return strings.ToUpper(s), nil
+		}
+		return nil, nil
+	case "len":
+		switch v := args[0].(type) {
+		case string:
+			return float64(len([]rune(v))), nil
+		case []any:
+			return float64(len(v)), nil
+		case map[string]any:
+			return float64(len(v)), nil
+		}
+		return float64(0), nil
+	}
+	return nil, fmt.Errorf("unknown function %s", n.name)
+}
+
+func (n *notNode) eval(attrs map[string]any) (any, error) {
+	v, err := n.operand.eval(attrs)
+	if err != nil {
+		return nil, err
+	}
+	return !truthy(v), nil
+}
+
+func (n *logicalNode) eval(attrs map[string]any) (any, error) {
+	l, err := n.left.eval(attrs)
+	if err != nil {
+		return nil, err
+	}
+	if n.op == "and" && !truthy(l) {
+		return false, nil
+	}
+	if n.op == "or" && truthy(l) {
+		return true, nil
+	}
+	r, err := n.right.eval(attrs)
+	if err != nil {
+		return nil, err
+	}
+	return truthy(r), nil
+}
+
+func (n *inNode) eval(attrs map[string]any) (any, error) {
+	item, err := n.item.eval(attrs)
+	if err != nil {
+		return nil, err
+	}
+	list, err := n.list.eval(attrs)
+	if err != nil {
+		return nil, err
+	}
+	found := false
+	switch l := list.(type) {
+	case []any:
+		for _, candidate := range l {
+			if equal(item, candidate) {
+				found = true
+				break
+			}
+		}
+	case string:
+		if s, ok := item.(string); ok {
+			found = strings.Contains(l, s)
+		}
+	case nil:
+	default:
+		return nil, fmt.Errorf("in expects a list, got %T", list)
+	}
+	return found != n.negate, nil
+}
+
+func (n *compareNode) eval(attrs map[string]any) (any, error) {
+	l, err := n.left.eval(attrs)
+	if err != nil {
+		return nil, err
+	}
+	r, err := n.right.eval(attrs)
+	if err != nil {
+		return nil, err
+	}
+	switch n.op {
+	case "==":
+		return equal(l, r), nil
+	case "!=":
+		return !equal(l, r), nil
+	case ">", ">=", "<", "<=", "before", "after":
+		c, ok := compare(l, r)
+		if n.op == "before" || n.op == "after" {
+			c, ok = compareTime(l, r)
+		}
+		if !ok {
+			return false, nil
+		}
+		switch n.op {
+		case ">", "after":
+			return c > 0, nil
+		case ">=":
+			return c >= 0, nil
+		case "<", "before":
+			return c < 0, nil
+		default:
+			return c <= 0, nil
+		}
+	case "contains":
+		switch lv := l.(type) {
+		case string:
+			rs, ok := r.(string)
+			return ok && strings.Contains(lv, rs), nil
+		case []any:
+			for _, item := range lv {
+				if equal(item, r) {
+					return true, nil
+				}
+			}
+		}
+		return false, nil
+	case "starts_with", "ends_with":
+		ls, lok := l.(string)
+		rs, rok := r.(string)
+		if !lok || !rok {
+			return false, nil
+		}
+		if n.op == "starts_with" {
+			return strings.HasPrefix(ls, rs), nil
+		}
+		return strings.HasSuffix(ls, rs), nil
+	case "matches":
+		ls, ok := l.(string)
+		if !ok {
+			return false, nil
+		}
+		re := n.re
+		if re == nil {
+			pattern, ok := r.(string)
+			if !ok {
+				return false, nil
+			}
+			if re, err = regexp.Compile(pattern); err != nil {
+				return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+			}
+		}
+		return re.MatchString(ls), nil
+	}
+	return nil, fmt.Errorf("unknown operator %s", n.op)
+}
+
+// normalize приводит значения атрибутов к типам, с которыми работает интерпретатор:
+// все числа — float64, срезы — []any.
+func normalize(v any) any {
+	if f, ok := toFloat(v); ok {
+		return f
+	}
+	switch x := v.(type) {
+	case []string:
+		out := make([]any, len(x))
+		for i, s := range x {
+			out[i] = s
+		}
+		return out
+	case []any:
+		out := make([]any, len(x))
+		for i, item := range x {
+			out[i] = normalize(item)
+		}
+		return out
+	}
+	return v
+}
+
+func truthy(v any) bool {
+	switch x := v.(type) {
+	case nil:
+		return false
+	case bool:
+		return x
+	case float64:
+		return x != 0
+	case string:
+		return x != ""
+	case []any:
+		return len(x) > 0
+	}
+	return true
+}
+
+func equal(a, b any) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	if c, ok := compare(a, b); ok {
+		return c == 0
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// compare сравнивает числа, строки и даты. Строка сравнивается с датой,
+// если её удаётся разобрать как дату.
+func compare(a, b any) (int, bool) {
+	if af, ok := toFloat(a); ok {
+		if bf, ok := toFloat(b); ok {
+			switch {
+			case af < bf:
+				return -1, true
+			case af > bf:
+				return 1, true
+			}
+			return 0, true
+		}
+		return 0, false
+	}
+	_, aIsTime := a.(time.Time)
+	_, bIsTime := b.(time.Time)
+	if aIsTime || bIsTime {
+		at, aok := toTime(a)
+		bt, bok := toTime(b)
+		if !aok || !bok {
+			return 0, false
+		}
+		return at.Compare(bt), true
+	}
+	as, aok := a.(string)
+	bs, bok := b.(string)
+	if aok && bok {
+		return strings.Compare(as, bs), true
+	}
+	return 0, false
+}
+
+// compareTime сравнивает операнды before/after как даты: обе строки разбираются
+// через toTime, иначе "2023-12-31T23:00:00-05:00" оказалась бы раньше
+// "2024-01-01" по строковому порядку. Если хотя бы один операнд не дата,
+// сравнение не выполняется.
+func compareTime(a, b any) (int, bool) {
+	at, aok := toTime(a)
+	bt, bok := toTime(b)
+	if !aok || !bok {
+		return 0, false
+	}
+	return at.Compare(bt), true
+}
+
+func toFloat(v any) (float64, bool) {
+	switch x := v.(type) {
+	case float64:
+		return x, true
+	case float32:
+		return float64(x), true
+	case int:
+		return float64(x), true
+	case int32:
+		return float64(x), true
+	case int64:
+		return float64(x), true
+	}
+	return 0, false
+}
+
+func toTime(v any) (time.Time, bool) {
+	switch x := v.(type) {
+	case time.Time:
+		return x, true
+	case string:
+		t, err := parseTime(x)
+		return t, err == nil
+	}
+	return time.Time{}, false
+}
+
+func parseTime(s string) (time.Time, error) {
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05", "2006-01-02"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date %q, expected RFC3339 or YYYY-MM-DD", s)
+}
@@ -0,0 +1,294 @@
+package rules
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// keywords — слова, которые не могут быть именами атрибутов.
+var keywords = map[string]struct{}{
+	"and": {}, "or": {}, "not": {}, "in": {},
+	"true": {}, "false": {}, "null": {},
+	"contains": {}, "starts_with": {}, "ends_with": {}, "matches": {},
+	"before": {}, "after": {},
+}
+
+// functions — встроенные функции и их арность.
+var functions = map[string]int{
+	"now":      0,
+	"date":     1,
+	"days_ago": 1,
+	"lower":    1,
+	"upper":    1,
+	"len":      1,
+}
+
+type node interface {
+	eval(attrs map[string]any) (any, error)
+}
+
+type literalNode struct{ value any }
+
+type attrNode struct{ path []string }
+
+type listNode struct{ items []node }
+
+type callNode struct {
+	name string
+	args []node
+}
+
+type notNode struct{ operand node }
+
+type logicalNode struct {
+	op          string // "and" | "or"
+	left, right node
+}
+
+type compareNode struct {
+	op          string
+	left, right node
+	re          *regexp.Regexp // заранее скомпилированный шаблон для matches
+}
+
+type inNode struct {
+	item, list node
+	negate     bool
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func parse(src string) (node, error) {
+	tokens, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	n, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, fmt.Errorf("unexpected %s", t)
+	}
+	return n, nil
+}
+
+func (p *parser) peek() token { return p.tokens[p.pos] }
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+// word возвращает ключевое слово или оператор текущего токена в нижнем регистре.
+func (p *parser) word() string {
+	t := p.peek()
+	if t.kind == tokIdent || t.kind == tokOp {
+		return strings.ToLower(t.text)
+	}
+	return ""
+}
+
+func (p *parser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for w := p.word(); w == "or" || w == "||"; w = p.word() {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &logicalNode{op: "or", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for w := p.word(); w == "and" || w == "&&"; w = p.word() {
+		p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &logicalNode{op: "and", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseUnary() (node, error) {
+	if w := p.word(); w == "not" || w == "!" {
+		p.next()
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &notNode{operand: operand}, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *parser) parseComparison() (node, error) {
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	switch w := p.word(); w {
+	case "==", "=", "!=", ">", ">=", "<", "<=",
+		"contains", "starts_with", "ends_with", "matches", "before", "after":
+		p.next()
+		right, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		if w == "=" {
+			w = "=="
+		}
+		cmp := &compareNode{op: w, left: left, right: right}
+		if w == "matches" {
+			if lit, ok := right.(*literalNode); ok {
+				pattern, ok := lit.value.(string)
+				if !ok {
+					return nil, fmt.Errorf("matches expects a string pattern")
+				}
+				if cmp.re, err = regexp.Compile(pattern); err != nil {
+					return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+				}
+			}
+		}
+		return cmp, nil
+	case "in":
+		p.next()
+		list, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		return &inNode{item: left, list: list}, nil
+	case "not":
+		if next := p.tokens[p.pos+1]; next.kind == tokIdent && strings.ToLower(next.text) == "in" {
+			p.next()
+			p.next()
+			list, err := p.parseOperand()
+			if err != nil {
+				return nil, err
+			}
+			return &inNode{item: left, list: list, negate: true}, nil
+		}
+	}
+	return left, nil
+}
+
+func (p *parser) parseOperand() (node, error) {
+	t := p.next()
+	switch t.kind {
+	case tokNumber:
+		f, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %s", t)
+		}
+		return &literalNode{value: f}, nil
+	case tokString:
+		return &literalNode{value: t.text}, nil
+	case tokLParen:
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if c := p.next(); c.kind != tokRParen {
+			return nil, fmt.Errorf("expected ')' but got %s", c)
+		}
+		return inner, nil
+	case tokLBracket:
+		var items []node
+		if p.peek().kind != tokRBracket {
+			for {
+				item, err := p.parseOperand()
+				if err != nil {
+					return nil, err
+				}
+				items = append(items, item)
+				if p.peek().kind != tokComma {
+					break
+				}
+				p.next()
+			}
+		}
+		if c := p.next(); c.kind != tokRBracket {
+			return nil, fmt.Errorf("expected ']' but got %s", c)
+		}
+		return &listNode{items: items}, nil
+	case tokIdent:
+		name := strings.ToLower(t.text)
+		switch name {
+		case "true":
+			return &literalNode{value: true}, nil
+		case "false":
+			return &literalNode{value: false}, nil
+		case "null":
+			return &literalNode{value: nil}, nil
+		}
+		if _, ok := keywords[name]; ok {
+			return nil, fmt.Errorf("unexpected keyword %s", t)
+		}
+		if p.peek().kind == tokLParen {
+			return p.parseCall(t)
+		}
+		return &attrNode{path: strings.Split(t.text, ".")}, nil
+	}
+	return nil, fmt.Errorf("unexpected %s", t)
+}
+
+func (p *parser) parseCall(name token) (node, error) {
+	fn := strings.ToLower(name.text)
+	arity, ok := functions[fn]
+	if !ok {
+		return nil, fmt.Errorf("unknown function %s", name)
+	}
+	p.next() // (
+	var args []node
+	if p.peek().kind != tokRParen {
+		for {
+			arg, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, arg)
+			if p.peek().kind != tokComma {
+				break
+			}
+			p.next()
+		}
+	}
+	if c := p.next(); c.kind != tokRParen {
+		return nil, fmt.Errorf("expected ')' but got %s", c)
+	}
+	if len(args) != arity {
+		return nil, fmt.Errorf("function %s expects %d argument(s), got %d", fn, arity, len(args))
+	}
+	if fn == "date" {
+		if lit, ok := args[0].(*literalNode); ok {
+			s, ok := lit.value.(string)
+			if !ok {
+				return nil, fmt.Errorf("date expects a string argument")
+			}
+			if _, err := parseTime(s); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return &callNode{name: fn, args: args}, nil
+}
@@ -0,0 +1,70 @@
+// Package rules реализует язык правил для сегментов типа dynamic_rule.
+//
+// Правило — это выражение над атрибутами пользователя, например:
+//
+//	purchase_count > 10 and country in ["RU", "KZ"]
+//	not (email ends_with "@example.com") or tags contains "vip"
+//	registered_at after days_ago(30)
+//
+// Поддерживаются сравнения (==, !=, >, >=, <, <=), логические and/or/not
+// (а также &&, ||, !), in / not in, строковые contains, starts_with,
+// ends_with, matches (регулярное выражение), сравнения дат before/after и
+// функции now(), date(s), days_ago(n), lower(s), upper(s), len(x).
+// Вложенные атрибуты адресуются через точку: profile.city.
+package rules
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Config — формат поля config у сегмента типа dynamic_rule.
+type Config struct {
+	Rule string `json:"rule"`
+}
+
+// Rule — разобранное и готовое к вычислению правило.
+type Rule struct {
+	src  string
+	root node
+}
+
+// Parse разбирает текст правила.
+func Parse(src string) (*Rule, error) {
+	if strings.TrimSpace(src) == "" {
+		return nil, errors.New("rule is empty")
+	}
+	root, err := parse(src)
+	if err != nil {
+		return nil, err
+	}
+	return &Rule{src: src, root: root}, nil
+}
+
+// ParseConfig достаёт правило из JSON-конфига сегмента и разбирает его.
+func ParseConfig(raw json.RawMessage) (*Rule, error) {
+	var cfg Config
+	if err := json.Unmarshal(raw, &cfg); err != nil {
+		return nil, fmt.Errorf("invalid rule config: %w", err)
+	}
+	return Parse(cfg.Rule)
+}
+
+// String возвращает исходный текст правила.
+func (r *Rule) String() string { return r.src }
+
+// Match вычисляет правило для набора атрибутов пользователя.
+// Отсутствующие атрибуты считаются null.
+func (r *Rule) Match(attrs map[string]any) (bool, error) {
+	v, err := r.root.eval(attrs)
+	if err != nil {
+		return false, err
+	}
+	b, ok := v.(bool)
+	if !ok {
+		return truthy(v), nil
+	}
+	return b, nil
+}
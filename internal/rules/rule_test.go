@@ -0,0 +1,190 @@
+package rules
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMatch(t *testing.T) {
+	day := 24 * time.Hour
+	attrs := map[string]any{
+		"country":        "RU",
+		"purchase_count": 12,
+		"email":          "alice@example.com",
+		"tags":           []any{"vip", "beta"},
+		"plan":           "Premium",
+		"registered_at":  time.Now().Add(-10 * day).Format(time.RFC3339),
+		"last_seen":      time.Now().Add(-40 * day).Format("2006-01-02"),
+		"verified":       true,
+		"profile":        map[string]any{"city": "Almaty", "age": 31.0},
+	}
+
+	tests := []struct {
+		name string
+		rule string
+		want bool
+	}{
+		// Приоритет: not сильнее and, and сильнее or.
+		{"and binds tighter than or", `country == "KZ" and purchase_count > 100 or verified`, true},
+		{"and binds tighter than or, false", `verified and country == "KZ" or purchase_count > 100`, false},
+		{"parentheses override precedence", `country == "KZ" and (purchase_count > 100 or verified)`, false},
+		{"not binds tighter than and", `not country == "KZ" and verified`, true},
+		{"not over parentheses", `not (country == "RU" and verified)`, false},
+		{"symbolic operators", `!(country == "KZ") && (purchase_count < 5 || verified)`, true},
+		{"keywords are case-insensitive", `country == "RU" AND NOT verified == false`, true},
+
+		{"number comparison", `purchase_count >= 12`, true},
+		{"number equality with single =", `purchase_count = 12`, true},
+		{"int attribute equals float literal", `purchase_count == 12.0`, true},
+		{"string comparison is lexicographic", `country < "US"`, true},
+		{"number and string are not ordered", `purchase_count > "10"`, false},
+		{"number and string are not equal", `purchase_count == "12"`, false},
+
+		{"in list", `country in ["RU", "KZ"]`, true},
+		{"in list, absent", `country in ["US", "DE"]`, false},
+		{"not in list", `country not in ["US", "DE"]`, true},
+		{"not in list, present", `country not in ["RU"]`, false},
+		{"in empty list", `country in []`, false},
+		{"number in list", `purchase_count in [10, 12]`, true},
+		{"in attribute list", `"vip" in tags`, true},
+		{"in string is substring", `"example" in email`, true},
+		{"not in keeps precedence with and", `country not in ["US"] and verified`, true},
+
+		{"contains on list", `tags contains "vip"`, true},
+		{"contains on string", `email contains "@example"`, true},
+		{"starts_with", `email starts_with "alice"`, true},
+		{"ends_with", `email ends_with "@example.org"`, false},
+		{"matches", `email matches "^[a-z]+@example\\.com$"`, true},
+		{"matches is case-sensitive", `plan matches "^premium$"`, false},
+		{"lower", `lower(plan) == "premium"`, true},
+		{"upper", `upper(country) == "RU"`, true},
+		{"len of list", `len(tags) == 2`, true},
+		{"len of string counts runes", `len("привет") == 6`, true},
+		{"nested attribute", `profile.city == "Almaty" and profile.age > 30`, true},
+
+		{"after days_ago", `registered_at after days_ago(30)`, true},
+		{"before days_ago", `registered_at before days_ago(30)`, false},
+		{"date-only string against days_ago", `last_seen before days_ago(30)`, true},
+		{"before now", `registered_at before now()`, true},
+		{"comparison operators on dates", `registered_at < now() and registered_at > days_ago(11)`, true},
+		{"date literal", `registered_at after date("2000-01-01")`, true},
+		{"date string against date", `"2024-05-01" before date("2024-06-01T00:00:00Z")`, true},
+		{"non-date string against date", `country before now()`, false},
+		// Две строки сравниваются как даты, а не лексикографически.
+		{"date strings with offset", `"2023-12-31T23:00:00-05:00" before "2024-01-01"`, false},
+		{"date strings with offset, after", `"2023-12-31T23:00:00-05:00" after "2024-01-01"`, true},
+		{"non-date strings are not dates", `"b" before "c"`, false},
+		{"date string against non-date string", `"2024-01-01" after country`, false},
+		{"date string against number", `"2024-01-01" before 5`, false},
+
+		// Отсутствующий атрибут — null.
+		{"missing equals null", `missing == null`, true},
+		{"missing is not equal to value", `missing == "RU"`, false},
+		{"missing not equal to value", `missing != "RU"`, true},
+		{"missing is not ordered", `missing > 0 or missing < 0`, false},
+		{"missing in list", `missing in ["a"]`, false},
+		{"missing not in list", `missing not in ["a"]`, true},
+		{"in missing list", `country in missing`, false},
+		{"missing nested path", `profile.street.name == null`, true},
+		{"path through scalar", `country.code == null`, true},
+		{"missing after date", `missing after days_ago(30)`, false},
+		{"missing is falsy", `not missing`, true},
+		{"len of missing", `len(missing) == 0`, true},
+
+		{"bare attribute is truthy", `verified`, true},
+		{"bare empty list is falsy", `tags and len(tags) > 5`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule, err := Parse(tt.rule)
+			if err != nil {
+				t.Fatalf("Parse(%q): %v", tt.rule, err)
+			}
+			got, err := rule.Match(attrs)
+			if err != nil {
+				t.Fatalf("Match(%q): %v", tt.rule, err)
+			}
+			if got != tt.want {
+				t.Errorf("Match(%q) = %v, want %v", tt.rule, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchErrors(t *testing.T) {
+	attrs := map[string]any{"n": "ten", "pattern": "(", "email": "a@b.c"}
+	tests := []struct {
+		name string
+		rule string
+	}{
+		{"in scalar", `1 in 5`},
+		{"days_ago of string", `now() after days_ago(n)`},
+		{"dynamic invalid pattern", `email matches pattern`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule, err := Parse(tt.rule)
+			if err != nil {
+				t.Fatalf("Parse(%q): %v", tt.rule, err)
+			}
+			if _, err := rule.Match(attrs); err == nil {
+				t.Errorf("Match(%q) succeeded, want error", tt.rule)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		rule    string
+		wantErr string
+	}{
+		{"empty", "   ", "rule is empty"},
+		{"unbalanced paren", `(a == 1`, "expected ')'"},
+		{"unbalanced bracket", `a in [1, 2`, "expected ']'"},
+		{"trailing tokens", `a == 1 b`, "unexpected"},
+		{"dangling operator", `a ==`, "unexpected end of expression"},
+		{"dangling and", `a == 1 and`, "unexpected end of expression"},
+		{"unterminated string", `a == "x`, "unterminated string"},
+		{"unknown character", `a == 1 # comment`, "unexpected character"},
+		{"keyword as attribute", `contains == 1`, "unexpected keyword"},
+		{"unknown function", `foo(a) == 1`, "unknown function"},
+		{"wrong arity", `lower(a, b) == "x"`, "expects 1 argument"},
+		{"now with argument", `a after now(1)`, "expects 0 argument"},
+		{"invalid date literal", `a after date("yesterday")`, "invalid date"},
+		{"date of number", `a after date(5)`, "date expects a string"},
+		{"invalid regexp", `a matches "("`, "invalid pattern"},
+		{"matches number", `a matches 5`, "matches expects a string"},
+		{"not in without list", `a not in`, "unexpected end of expression"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(tt.rule)
+			if err == nil {
+				t.Fatalf("Parse(%q) succeeded, want error", tt.rule)
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Parse(%q) error = %q, want it to contain %q", tt.rule, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseConfig(t *testing.T) {
+	rule, err := ParseConfig(json.RawMessage(`{"rule": "country == \"RU\""}`))
+	if err != nil {
+		t.Fatalf("ParseConfig: %v", err)
+	}
+	if rule.String() != `country == "RU"` {
+		t.Errorf("String() = %q", rule.String())
+	}
+
+	for _, raw := range []string{`{"rule": ""}`, `{}`, `[]`, `{"rule": 5}`} {
+		if _, err := ParseConfig(json.RawMessage(raw)); err == nil {
+			t.Errorf("ParseConfig(%s) succeeded, want error", raw)
+		}
+	}
+}
@@ -0,0 +1,263 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/RaikyD/UserSegmentationService/internal/jobs"
+	"github.com/RaikyD/UserSegmentationService/internal/metrics"
+	"github.com/RaikyD/UserSegmentationService/internal/models"
+	"github.com/RaikyD/UserSegmentationService/internal/storage"
+	"github.com/RaikyD/UserSegmentationService/internal/tenant"
+	"github.com/google/uuid"
+)
+
+const (
+	importKind = "segment_users_import"
+	// maxReportedLineErrors — сколько ошибочных строк попадает в отчёт импорта;
+	// остальные только учитываются в счётчике invalid.
+	maxReportedLineErrors = 100
+	importProgressEvery   = 1000
+)
+
+// ImportService загружает списки участников сегментов из файлов.
+type ImportService interface {
+	// StartImport сохраняет src во временный файл и запускает импорт в фоне.
+	StartImport(ctx context.Context, segmentID uuid.UUID, mode models.ImportMode, format models.ImportFormat, src io.Reader) (jobs.Job, error)
+	// GetImport возвращает состояние фоновой задачи импорта арендатора из ctx.
+	GetImport(ctx context.Context, id uuid.UUID) (jobs.Job, error)
+}
+
+// ImportLineError — строка файла, которую не удалось разобрать.
+type ImportLineError struct {
+	Line  int    `json:"line"`
+	Value string `json:"value"`
+	Error string `json:"error"`
+}
+
+type importService struct {
+	segRepo storage.SegmentRepository
+	usRepo  storage.UserRepository
+	jobs    *jobs.Manager
+	dir     string
+}
+
+// NewImportService создаёт сервис импорта. Загруженные файлы временно хранятся в dir.
+func NewImportService(segRepo storage.SegmentRepository, usRepo storage.UserRepository, jobManager *jobs.Manager, dir string) (ImportService, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create imports dir: %w", err)
+	}
+	return &importService{segRepo: segRepo, usRepo: usRepo, jobs: jobManager, dir: dir}, nil
+}
+
+func (s *importService) StartImport(ctx context.Context, segmentID uuid.UUID, mode models.ImportMode, format models.ImportFormat, src io.Reader) (jobs.Job, error) {
+	if mode != models.ImportAppend && mode != models.ImportReplace {
+		return jobs.Job{}, ErrInvalidImportMode
+	}
+	if format != models.ImportCSV && format != models.ImportNDJSON {
+		return jobs.Job{}, ErrInvalidImportFormat
+	}
+	seg, err := s.segRepo.GetByID(ctx, segmentID)
+	if err != nil {
+		return jobs.Job{}, err
+	}
+	if seg == nil {
+		return jobs.Job{}, ErrSegmentNotFound
+	}
+	if !seg.ActiveAt(time.Now()) {
+		return jobs.Job{}, ErrSegmentInactive
+	}
+	if seg.Type == models.SegmentTypeComposite {
+		return jobs.Job{}, ErrCompositeAssignment
+	}
+	// В dynamic- и dynamic_rule-сегментах хранятся и привязки массового назначения:
+	// replace снял бы их вместе со всеми, кого нет в файле.
+	if seg.Type != models.SegmentTypeStatic {
+		return jobs.Job{}, ErrImportSegmentType.Withf("%s is %s", seg.SegmentName, seg.Type)
+	}
+
+	// Загрузку сохраняем целиком до ответа: тело запроса нельзя читать после того,
+	// как обработчик вернул управление.
+	tmp, err := os.CreateTemp(s.dir, "import-*.tmp")
+	if err != nil {
+		return jobs.Job{}, err
+	}
+	_, err = io.Copy(tmp, src)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return jobs.Job{}, err
+	}
+
+	meta := changeMeta(ctx, models.SourceImport)
+	job, err := s.jobs.Start(ctx, importKind, func(ctx context.Context, p *jobs.Progress) (map[string]any, error) {
+		defer os.Remove(tmp.Name())
+		f, err := os.Open(tmp.Name())
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+
+		parser := newImportParser(f, format, p)
+		res, err := s.usRepo.ImportSegmentUsers(ctx, segmentID, mode, func() (uuid.UUID, bool, error) {
+			id, ok, err := parser.next()
+			// Частичный файл не должен снимать сегмент с тех, кто просто не попал в него
+			// из-за ошибки, поэтому replace применяется только к файлу без ошибок.
+			if err == nil && !ok && mode == models.ImportReplace && parser.invalid > 0 {
+				err = fmt.Errorf("%d invalid lines, nothing was replaced", parser.invalid)
+			}
+			return id, ok, err
+		}, meta)
+		result := map[string]any{
+			"mode":    mode,
+			"lines":   parser.line,
+			"invalid": parser.invalid,
+			"errors":  parser.errors,
+		}
+		if err == nil && res != nil {
+			metrics.Assignments.WithLabelValues(string(models.AssignmentManual)).Add(float64(res.Added))
+		}
+		if res != nil {
+			result["staged"] = res.Staged
+			result["added"] = res.Added
+			result["removed"] = res.Removed
+		}
+		return result, err
+	})
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return job, err
+}
+
+func (s *importService) GetImport(ctx context.Context, id uuid.UUID) (jobs.Job, error) {
+	job, err := s.jobs.Get(ctx, id)
+	if err != nil {
+		return jobs.Job{}, err
+	}
+	if job == nil || job.Kind != importKind || job.Tenant != tenant.FromContext(ctx) {
+		return jobs.Job{}, ErrImportNotFound
+	}
+	return *job, nil
+}
+
+// importParser построчно читает файл импорта и отдаёт корректные user_id,
+// запоминая ошибочные строки.
+type importParser struct {
+	format   models.ImportFormat
+	csv      *csv.Reader
+	scanner  *bufio.Scanner
+	progress *jobs.Progress
+
+	line     int
+	reported int // строк, уже учтённых в progress
+	invalid  int64
+	errors   []ImportLineError
+}
+
+func newImportParser(r io.Reader, format models.ImportFormat, progress *jobs.Progress) *importParser {
+	p := &importParser{format: format, progress: progress, errors: []ImportLineError{}}
+	if format == models.ImportCSV {
+		p.csv = csv.NewReader(r)
+		p.csv.FieldsPerRecord = -1
+		p.csv.ReuseRecord = true
+	} else {
+		p.scanner = bufio.NewScanner(r)
+		p.scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	}
+	return p
+}
+
+// next возвращает следующий корректный user_id; ok=false — файл закончился.
+func (p *importParser) next() (uuid.UUID, bool, error) {
+	for {
+		value, done, err := p.readValue()
+		if err != nil || done {
+			p.reportProgress(0)
+			return uuid.Nil, false, err
+		}
+		p.reportProgress(importProgressEvery)
+		if value == "" {
+			continue
+		}
+		id, err := uuid.Parse(value)
+		if err != nil {
+			p.fail(value, "invalid UUID")
+			continue
+		}
+		return id, true, nil
+	}
+}
+
+// readValue читает следующую строку и достаёт из неё user_id. Пустая строка,
+// заголовок CSV и пустой value означают строку без пользователя.
+func (p *importParser) readValue() (value string, done bool, err error) {
+	if p.format == models.ImportCSV {
+		record, err := p.csv.Read()
+		if errors.Is(err, io.EOF) {
+			return "", true, nil
+		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			p.line = parseErr.Line
+			p.fail("", parseErr.Err.Error())
+			return "", false, nil
+		}
+		if err != nil {
+			return "", false, err
+		}
+		p.line, _ = p.csv.FieldPos(0)
+		value = strings.TrimSpace(record[0])
+		if p.line == 1 && strings.EqualFold(value, "user_id") {
+			return "", false, nil
+		}
+		return value, false, nil
+	}
+
+	if !p.scanner.Scan() {
+		return "", true, p.scanner.Err()
+	}
+	p.line++
+	raw := strings.TrimSpace(p.scanner.Text())
+	if raw == "" {
+		return "", false, nil
+	}
+	var row struct {
+		UserID string `json:"user_id"`
+	}
+	if err := json.Unmarshal([]byte(raw), &row); err != nil {
+		p.fail(raw, "invalid JSON")
+		return "", false, nil
+	}
+	if row.UserID == "" {
+		p.fail(raw, "user_id is required")
+		return "", false, nil
+	}
+	return row.UserID, false, nil
+}
+
+// reportProgress передаёт в задачу число прочитанных строк, если их набралось не меньше every.
+func (p *importParser) reportProgress(every int) {
+	if p.progress == nil || p.line-p.reported < every || p.line == p.reported {
+		return
+	}
+	p.progress.Add(int64(p.line - p.reported))
+	p.reported = p.line
+}
+
+func (p *importParser) fail(value, reason string) {
+	p.invalid++
+	if len(p.errors) < maxReportedLineErrors {
+		p.errors = append(p.errors, ImportLineError{Line: p.line, Value: value, Error: reason})
+	}
+}
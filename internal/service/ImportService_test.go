@@ -0,0 +1,221 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/RaikyD/UserSegmentationService/internal/jobs"
+	"github.com/RaikyD/UserSegmentationService/internal/logging"
+	"github.com/RaikyD/UserSegmentationService/internal/models"
+	"github.com/RaikyD/UserSegmentationService/internal/tenant"
+)
+
+var (
+	importUser1 = uuid.MustParse("11111111-1111-1111-1111-111111111111")
+	importUser2 = uuid.MustParse("22222222-2222-2222-2222-222222222222")
+)
+
+func TestImportParser(t *testing.T) {
+	tests := []struct {
+		name        string
+		format      models.ImportFormat
+		input       string
+		wantIDs     []uuid.UUID
+		wantErrLine []int
+	}{
+		{"csv with header", models.ImportCSV,
+			"user_id,comment\n11111111-1111-1111-1111-111111111111,first\n\n 22222222-2222-2222-2222-222222222222 \n",
+			[]uuid.UUID{importUser1, importUser2}, nil},
+		{"csv without header", models.ImportCSV,
+			"11111111-1111-1111-1111-111111111111\nnot-a-uuid\n22222222-2222-2222-2222-222222222222",
+			[]uuid.UUID{importUser1, importUser2}, []int{2}},
+		{"csv header only on the first line", models.ImportCSV,
+			"11111111-1111-1111-1111-111111111111\nuser_id\n",
+			[]uuid.UUID{importUser1}, []int{2}},
+		{"csv syntax error", models.ImportCSV,
+			"11111111-1111-1111-1111-111111111111\n\"broken\n",
+			[]uuid.UUID{importUser1}, []int{2}},
+		{"ndjson", models.ImportNDJSON,
+			"{\"user_id\": \"11111111-1111-1111-1111-111111111111\"}\n\n{\"user_id\": \"22222222-2222-2222-2222-222222222222\", \"extra\": 1}\n",
+			[]uuid.UUID{importUser1, importUser2}, nil},
+		{"ndjson errors", models.ImportNDJSON,
+			"{\"user_id\": \"11111111-1111-1111-1111-111111111111\"}\n{oops\n{\"id\": \"x\"}\n{\"user_id\": \"x\"}\n",
+			[]uuid.UUID{importUser1}, []int{2, 3, 4}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newImportParser(strings.NewReader(tt.input), tt.format, nil)
+			var ids []uuid.UUID
+			for {
+				id, ok, err := p.next()
+				if err != nil {
+					t.Fatalf("next: %v", err)
+				}
+				if !ok {
+					break
+				}
+				ids = append(ids, id)
+			}
+			if !slices.Equal(ids, tt.wantIDs) {
+				t.Errorf("ids = %v, want %v", ids, tt.wantIDs)
+			}
+			var lines []int
+			for _, e := range p.errors {
+				lines = append(lines, e.Line)
+			}
+			if !slices.Equal(lines, tt.wantErrLine) || p.invalid != int64(len(tt.wantErrLine)) {
+				t.Errorf("errors = %+v (invalid %d), want lines %v", p.errors, p.invalid, tt.wantErrLine)
+			}
+		})
+	}
+}
+
+func TestImportParserCapsReportedErrors(t *testing.T) {
+	p := newImportParser(strings.NewReader(strings.Repeat("bad\n", maxReportedLineErrors+5)), models.ImportCSV, nil)
+	if _, ok, err := p.next(); ok || err != nil {
+		t.Fatalf("next = %v, %v, want the end of file", ok, err)
+	}
+	if p.invalid != maxReportedLineErrors+5 || len(p.errors) != maxReportedLineErrors {
+		t.Errorf("invalid = %d, reported %d", p.invalid, len(p.errors))
+	}
+}
+
+// ImportSegmentUsers вычитывает всех пользователей из next, как COPY в репозитории.
+func (f *fakeAssignments) ImportSegmentUsers(_ context.Context, _ uuid.UUID, _ models.ImportMode, next func() (uuid.UUID, bool, error), _ models.ChangeMeta) (*models.ImportResult, error) {
+	var staged int64
+	for {
+		id, ok, err := next()
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return &models.ImportResult{Staged: staged, Added: staged}, nil
+		}
+		f.added = append(f.added, &models.UserSegmentAssignment{UserID: id})
+		staged++
+	}
+}
+
+func waitJob(t *testing.T, get func(context.Context, uuid.UUID) (jobs.Job, error), id uuid.UUID) jobs.Job {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		job, err := get(context.Background(), id)
+		if err != nil {
+			t.Fatalf("get job: %v", err)
+		}
+		if job.FinishedAt != nil {
+			return job
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("job %s did not finish", id)
+	return jobs.Job{}
+}
+
+func TestStartImport(t *testing.T) {
+	active := testSegment("beta", models.SegmentTypeStatic, `{}`)
+	inactive := testSegment("off", models.SegmentTypeStatic, `{}`)
+	inactive.IsActive = false
+	dynamic := testSegment("rollout", models.SegmentTypeDynamic, `{"percent": 10, "salt": "s"}`)
+	rule := testSegment("adults", models.SegmentTypeDynamicRule, `{"rule": "age >= 18"}`)
+	ctx := context.Background()
+	newService := func(repo *fakeAssignments) ImportService {
+		svc, err := NewImportService(newFakeSegments(active, inactive, dynamic, rule), repo, jobs.NewManager(ctx, jobs.NewMemoryStore(), time.Hour, logging.Discard()), t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return svc
+	}
+	const file = "11111111-1111-1111-1111-111111111111\nbad\n22222222-2222-2222-2222-222222222222\n"
+
+	rejected := []struct {
+		name    string
+		segment uuid.UUID
+		mode    models.ImportMode
+		format  models.ImportFormat
+		wantErr error
+	}{
+		{"mode", active.ID, "merge", models.ImportCSV, ErrInvalidImportMode},
+		{"format", active.ID, models.ImportAppend, "xlsx", ErrInvalidImportFormat},
+		{"unknown segment", uuid.New(), models.ImportAppend, models.ImportCSV, ErrSegmentNotFound},
+		{"inactive segment", inactive.ID, models.ImportAppend, models.ImportCSV, ErrSegmentInactive},
+		{"dynamic segment", dynamic.ID, models.ImportReplace, models.ImportCSV, ErrImportSegmentType},
+		{"dynamic_rule segment", rule.ID, models.ImportAppend, models.ImportCSV, ErrImportSegmentType},
+	}
+	for _, tt := range rejected {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newService(&fakeAssignments{}).StartImport(ctx, tt.segment, tt.mode, tt.format, strings.NewReader(file))
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("StartImport error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	t.Run("append skips invalid lines", func(t *testing.T) {
+		repo := &fakeAssignments{}
+		svc := newService(repo)
+		job, err := svc.StartImport(ctx, active.ID, models.ImportAppend, models.ImportCSV, strings.NewReader(file))
+		if err != nil {
+			t.Fatalf("StartImport: %v", err)
+		}
+		job = waitJob(t, svc.GetImport, job.ID)
+		if job.Status != jobs.StatusDone || job.Result["added"] != float64(2) || job.Result["invalid"] != float64(1) || job.Processed != 3 {
+			t.Errorf("job = %+v, want 2 added and 1 invalid of 3 lines", job)
+		}
+		if len(repo.added) != 2 {
+			t.Errorf("imported %d users, want 2", len(repo.added))
+		}
+	})
+
+	t.Run("replace refuses a file with errors", func(t *testing.T) {
+		svc := newService(&fakeAssignments{})
+		job, err := svc.StartImport(ctx, active.ID, models.ImportReplace, models.ImportCSV, strings.NewReader(file))
+		if err != nil {
+			t.Fatalf("StartImport: %v", err)
+		}
+		job = waitJob(t, svc.GetImport, job.ID)
+		if job.Status != jobs.StatusFailed || !strings.Contains(job.Error, "nothing was replaced") {
+			t.Errorf("job = %s %q, want failed with nothing replaced", job.Status, job.Error)
+		}
+		if _, err := svc.GetImport(ctx, uuid.New()); !errors.Is(err, ErrImportNotFound) {
+			t.Errorf("GetImport(unknown) error = %v, want ErrImportNotFound", err)
+		}
+		// Задача другого арендатора не видна.
+		if _, err := svc.GetImport(tenant.With(ctx, "acme"), job.ID); !errors.Is(err, ErrImportNotFound) {
+			t.Errorf("GetImport(other tenant) error = %v, want ErrImportNotFound", err)
+		}
+	})
+}
+
+// Состояние импорта читается через другую реплику с общим хранилищем задач.
+func TestGetImportAcrossReplicas(t *testing.T) {
+	ctx := context.Background()
+	seg := testSegment("beta", models.SegmentTypeStatic, `{}`)
+	segs, store := newFakeSegments(seg), jobs.NewMemoryStore()
+	newReplica := func() ImportService {
+		svc, err := NewImportService(segs, &fakeAssignments{}, jobs.NewManager(ctx, store, time.Hour, logging.Discard()), t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return svc
+	}
+	a, b := newReplica(), newReplica()
+
+	job, err := a.StartImport(ctx, seg.ID, models.ImportAppend, models.ImportCSV, strings.NewReader(importUser1.String()+"\n"))
+	if err != nil {
+		t.Fatalf("StartImport: %v", err)
+	}
+	if job = waitJob(t, b.GetImport, job.ID); job.Status != jobs.StatusDone || job.Result["added"] != float64(1) {
+		t.Errorf("job on the other replica = %+v, want done with 1 added", job)
+	}
+	if _, err := b.GetImport(tenant.With(ctx, "acme"), job.ID); !errors.Is(err, ErrImportNotFound) {
+		t.Errorf("GetImport(other tenant) error = %v, want ErrImportNotFound", err)
+	}
+}
@@ -0,0 +1,169 @@
+package service
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/RaikyD/UserSegmentationService/internal/jobs"
+	"github.com/RaikyD/UserSegmentationService/internal/models"
+	"github.com/RaikyD/UserSegmentationService/internal/storage"
+	"github.com/RaikyD/UserSegmentationService/internal/tenant"
+	"github.com/google/uuid"
+)
+
+const changesReportKind = "segment_changes_report"
+
+// ReportService строит CSV-отчёты об изменениях привязок по журналу истории.
+type ReportService interface {
+	// WriteChangesCSV пишет отчёт за период [from, to) прямо в w.
+	WriteChangesCSV(ctx context.Context, from, to time.Time, w io.Writer) error
+	// StartChangesReport строит тот же отчёт в фоне и сохраняет его в файл.
+	StartChangesReport(ctx context.Context, from, to time.Time) (jobs.Job, error)
+	// GetReport возвращает состояние фоновой задачи отчёта арендатора из ctx.
+	GetReport(ctx context.Context, id uuid.UUID) (jobs.Job, error)
+	// OpenReport открывает готовый файл отчёта.
+	OpenReport(ctx context.Context, id uuid.UUID) (*os.File, error)
+}
+
+type reportService struct {
+	usRepo    storage.UserRepository
+	jobs      *jobs.Manager
+	dir       string
+	retention time.Duration
+}
+
+// NewReportService создаёт сервис отчётов. Готовые файлы складываются в dir
+// и удаляются спустя retention.
+func NewReportService(usRepo storage.UserRepository, jobManager *jobs.Manager, dir string, retention time.Duration) (ReportService, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create reports dir: %w", err)
+	}
+	return &reportService{usRepo: usRepo, jobs: jobManager, dir: dir, retention: retention}, nil
+}
+
+func (s *reportService) WriteChangesCSV(ctx context.Context, from, to time.Time, w io.Writer) error {
+	_, err := s.writeChangesCSV(ctx, from, to, w, nil)
+	return err
+}
+
+func (s *reportService) writeChangesCSV(ctx context.Context, from, to time.Time, w io.Writer, progress *jobs.Progress) (int64, error) {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"user_id", "segment", "operation", "timestamp"}); err != nil {
+		return 0, err
+	}
+	var rows int64
+	err := s.usRepo.StreamHistory(ctx, from, to, func(ev *models.AssignmentEvent) error {
+		segment := ev.SegmentName
+		if segment == "" {
+			segment = ev.SegmentID.String()
+		}
+		operation := "added"
+		if ev.Operation == models.OperationUnassign {
+			operation = "removed"
+		}
+		if err := cw.Write([]string{
+			ev.UserID.String(),
+			segment,
+			operation,
+			ev.OccurredAt.UTC().Format(time.RFC3339),
+		}); err != nil {
+			return err
+		}
+		rows++
+		// Сбрасываем буфер пачками, чтобы клиент получал данные по мере чтения из БД.
+		if rows%1000 == 0 {
+			cw.Flush()
+			if progress != nil {
+				progress.Add(1000)
+			}
+			return cw.Error()
+		}
+		return nil
+	})
+	if err != nil {
+		return rows, err
+	}
+	cw.Flush()
+	if progress != nil {
+		progress.Add(rows % 1000)
+	}
+	return rows, cw.Error()
+}
+
+func (s *reportService) StartChangesReport(ctx context.Context, from, to time.Time) (jobs.Job, error) {
+	s.pruneFiles()
+	return s.jobs.Start(ctx, changesReportKind, func(ctx context.Context, p *jobs.Progress) (map[string]any, error) {
+		tmp, err := os.CreateTemp(s.dir, "report-*.csv.tmp")
+		if err != nil {
+			return nil, err
+		}
+		defer os.Remove(tmp.Name())
+
+		rows, err := s.writeChangesCSV(ctx, from, to, tmp, p)
+		if closeErr := tmp.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return nil, err
+		}
+		// Файл появляется под итоговым именем только целиком.
+		if err := os.Rename(tmp.Name(), s.reportPath(p.JobID())); err != nil {
+			return nil, err
+		}
+		return map[string]any{"rows": rows}, nil
+	})
+}
+
+// pruneFiles удаляет файлы отчётов старше retention.
+func (s *reportService) pruneFiles() {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return
+	}
+	cutoff := time.Now().Add(-s.retention)
+	for _, e := range entries {
+		info, err := e.Info()
+		if err == nil && !e.IsDir() && info.ModTime().Before(cutoff) {
+			os.Remove(filepath.Join(s.dir, e.Name()))
+		}
+	}
+}
+
+func (s *reportService) GetReport(ctx context.Context, id uuid.UUID) (jobs.Job, error) {
+	job, err := s.jobs.Get(ctx, id)
+	if err != nil {
+		return jobs.Job{}, err
+	}
+	if job == nil || job.Kind != changesReportKind || job.Tenant != tenant.FromContext(ctx) {
+		return jobs.Job{}, ErrReportNotFound
+	}
+	return *job, nil
+}
+
+func (s *reportService) OpenReport(ctx context.Context, id uuid.UUID) (*os.File, error) {
+	job, err := s.GetReport(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if job.Status != jobs.StatusDone {
+		return nil, ErrReportNotReady
+	}
+	f, err := os.Open(s.reportPath(id))
+	if errors.Is(err, fs.ErrNotExist) {
+		// Файл удалён по сроку хранения или лежит на другой реплике, если
+		// каталог отчётов у реплик не общий.
+		return nil, ErrReportFileMissing
+	}
+	return f, err
+}
+
+func (s *reportService) reportPath(id uuid.UUID) string {
+	return filepath.Join(s.dir, id.String()+".csv")
+}
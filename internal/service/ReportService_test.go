@@ -0,0 +1,160 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/RaikyD/UserSegmentationService/internal/jobs"
+	"github.com/RaikyD/UserSegmentationService/internal/logging"
+	"github.com/RaikyD/UserSegmentationService/internal/models"
+	"github.com/RaikyD/UserSegmentationService/internal/storage"
+	"github.com/RaikyD/UserSegmentationService/internal/tenant"
+)
+
+// fakeHistory отдаёт журнал изменений из памяти.
+type fakeHistory struct {
+	storage.UserRepository
+	events []*models.AssignmentEvent
+}
+
+func (f *fakeHistory) StreamHistory(_ context.Context, from, to time.Time, fn func(*models.AssignmentEvent) error) error {
+	for _, ev := range f.events {
+		if ev.OccurredAt.Before(from) || !ev.OccurredAt.Before(to) {
+			continue
+		}
+		if err := fn(ev); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestWriteChangesCSV(t *testing.T) {
+	user := uuid.MustParse("11111111-1111-1111-1111-111111111111")
+	deleted := uuid.MustParse("22222222-2222-2222-2222-222222222222")
+	day := time.Date(2025, 8, 1, 0, 0, 0, 0, time.UTC)
+	repo := &fakeHistory{events: []*models.AssignmentEvent{
+		{UserID: user, SegmentName: "beta", Operation: models.OperationAssign, OccurredAt: day.Add(time.Hour)},
+		{UserID: user, SegmentID: deleted, Operation: models.OperationUnassign, OccurredAt: day.Add(2 * time.Hour).In(time.FixedZone("MSK", 3*3600))},
+		{UserID: user, SegmentName: "late", Operation: models.OperationAssign, OccurredAt: day.Add(24 * time.Hour)},
+	}}
+	svc, err := NewReportService(repo, jobs.NewManager(context.Background(), jobs.NewMemoryStore(), time.Hour, logging.Discard()), t.TempDir(), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var b strings.Builder
+	if err := svc.WriteChangesCSV(context.Background(), day, day.Add(24*time.Hour), &b); err != nil {
+		t.Fatalf("WriteChangesCSV: %v", err)
+	}
+	want := "user_id,segment,operation,timestamp\n" +
+		"11111111-1111-1111-1111-111111111111,beta,added,2025-08-01T01:00:00Z\n" +
+		"11111111-1111-1111-1111-111111111111,22222222-2222-2222-2222-222222222222,removed,2025-08-01T02:00:00Z\n"
+	if b.String() != want {
+		t.Errorf("WriteChangesCSV =\n%s\nwant\n%s", b.String(), want)
+	}
+}
+
+func TestChangesReportJob(t *testing.T) {
+	events := make([]*models.AssignmentEvent, 2500)
+	start := time.Date(2025, 8, 1, 0, 0, 0, 0, time.UTC)
+	for i := range events {
+		events[i] = &models.AssignmentEvent{UserID: uuid.New(), SegmentName: "beta", Operation: models.OperationAssign, OccurredAt: start}
+	}
+	ctx := context.Background()
+	manager := jobs.NewManager(ctx, jobs.NewMemoryStore(), time.Hour, logging.Discard())
+	svc, err := NewReportService(&fakeHistory{events: events}, manager, t.TempDir(), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	job, err := svc.StartChangesReport(ctx, start, start.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("StartChangesReport: %v", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for job.Status != jobs.StatusDone && job.Status != jobs.StatusFailed && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+		if job, err = svc.GetReport(ctx, job.ID); err != nil {
+			t.Fatalf("GetReport: %v", err)
+		}
+	}
+	if job.Status != jobs.StatusDone || job.Processed != 2500 || job.Result["rows"] != float64(2500) {
+		t.Fatalf("job = %+v, want done with 2500 rows", job)
+	}
+
+	f, err := svc.OpenReport(ctx, job.ID)
+	if err != nil {
+		t.Fatalf("OpenReport: %v", err)
+	}
+	defer f.Close()
+	data, err := io.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Count(string(data), "\n"); lines != 2501 {
+		t.Errorf("report has %d lines, want header and 2500 rows", lines)
+	}
+
+	// Задачи другого вида через сервис отчётов не видны.
+	other, err := manager.Start(ctx, "other", func(context.Context, *jobs.Progress) (map[string]any, error) { return nil, nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.GetReport(ctx, other.ID); !errors.Is(err, ErrReportNotFound) {
+		t.Errorf("GetReport(other kind) error = %v, want ErrReportNotFound", err)
+	}
+	if _, err := svc.OpenReport(ctx, uuid.New()); !errors.Is(err, ErrReportNotFound) {
+		t.Errorf("OpenReport(unknown) error = %v, want ErrReportNotFound", err)
+	}
+	if _, err := svc.OpenReport(tenant.With(ctx, "acme"), job.ID); !errors.Is(err, ErrReportNotFound) {
+		t.Errorf("OpenReport(other tenant) error = %v, want ErrReportNotFound", err)
+	}
+}
+
+// Отчёт, построенный одной репликой, читается и скачивается с другой, если у них
+// общие хранилище задач и каталог отчётов.
+func TestChangesReportAcrossReplicas(t *testing.T) {
+	ctx := context.Background()
+	start := time.Date(2025, 8, 1, 0, 0, 0, 0, time.UTC)
+	repo := &fakeHistory{events: []*models.AssignmentEvent{
+		{UserID: uuid.New(), SegmentName: "beta", Operation: models.OperationAssign, OccurredAt: start},
+	}}
+	store, dir := jobs.NewMemoryStore(), t.TempDir()
+	newReplica := func() ReportService {
+		svc, err := NewReportService(repo, jobs.NewManager(ctx, store, time.Hour, logging.Discard()), dir, time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return svc
+	}
+	a, b := newReplica(), newReplica()
+
+	job, err := a.StartChangesReport(ctx, start, start.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("StartChangesReport: %v", err)
+	}
+	if job = waitJob(t, b.GetReport, job.ID); job.Status != jobs.StatusDone {
+		t.Fatalf("job = %+v, want done", job)
+	}
+	f, err := b.OpenReport(ctx, job.ID)
+	if err != nil {
+		t.Fatalf("OpenReport on the other replica: %v", err)
+	}
+	f.Close()
+
+	// Без общего каталога файла на другой реплике нет.
+	c, err := NewReportService(repo, jobs.NewManager(ctx, store, time.Hour, logging.Discard()), t.TempDir(), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.OpenReport(ctx, job.ID); !errors.Is(err, ErrReportFileMissing) || !errors.Is(err, ErrNotFound) {
+		t.Errorf("OpenReport without the file: error = %v, want ErrReportFileMissing", err)
+	}
+}
@@ -2,20 +2,43 @@ package service
 
 import (
 	"context"
-	"fmt"
+	"errors"
+	"regexp"
+	"strings"
 	"time"
 
+	"github.com/RaikyD/UserSegmentationService/internal/composite"
 	"github.com/RaikyD/UserSegmentationService/internal/models"
+	"github.com/RaikyD/UserSegmentationService/internal/rollout"
+	"github.com/RaikyD/UserSegmentationService/internal/rules"
 	"github.com/RaikyD/UserSegmentationService/internal/storage"
 	"github.com/google/uuid"
 )
 
+// segmentNamePattern — формат имени сегмента. Дефис не допускается, поэтому имя
+// не пересечётся со служебными путями вроде /segments/mass-assign.
+var segmentNamePattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_]{0,127}$`)
+
+// validSegmentName проверяет формат имени. Кроме того, имя не должно разбираться
+// как UUID: uuid.Parse принимает и 32 шестнадцатеричные цифры без дефисов, а
+// ссылка на сегмент сначала разбирается как UUID, и такое имя было бы недоступно.
+func validSegmentName(name string) bool {
+	if !segmentNamePattern.MatchString(name) {
+		return false
+	}
+	_, err := uuid.Parse(name)
+	return err != nil
+}
+
 type SegmentService interface {
 	CreateSegment(ctx context.Context, seg *models.Segment) (*models.Segment, error)
 	GetSegmentByID(ctx context.Context, id uuid.UUID) (*models.Segment, error)
-	ListSegments(ctx context.Context) ([]*models.Segment, error)
+	// ListSegments возвращает страницу сегментов и курсор следующей страницы ("" — это последняя)
+	ListSegments(ctx context.Context, filter models.SegmentFilter, sort models.SegmentSort, page Page) ([]*models.Segment, string, error)
 	UpdateSegment(ctx context.Context, seg *models.Segment) (*models.Segment, error)
 	DeleteSegment(ctx context.Context, id uuid.UUID) error
+	// ResolveSegmentID превращает ссылку на сегмент (UUID или имя) в его ID
+	ResolveSegmentID(ctx context.Context, ref string) (uuid.UUID, error)
 }
 
 type segmentService struct {
@@ -27,26 +50,86 @@ func NewSegmentService(repo storage.SegmentRepository) SegmentService {
 }
 
 func (s *segmentService) CreateSegment(ctx context.Context, seg *models.Segment) (*models.Segment, error) {
+	if !validSegmentName(seg.SegmentName) {
+		return nil, ErrInvalidSegmentName
+	}
+	if err := prepareConfig(seg, nil); err != nil {
+		return nil, err
+	}
+	if seg.Type == models.SegmentTypeComposite {
+		if err := checkCompositeRefs(ctx, s.repo, seg); err != nil {
+			return nil, err
+		}
+	}
 	seg.CreatedOn = time.Now()
 	if err := s.repo.Create(ctx, seg); err != nil {
-		return nil, err
+		return nil, writeError(err, seg)
 	}
 	return seg, nil
 }
 
+// writeError переводит ошибки записи сегмента в ошибки сервиса. Ссылки выражения
+// сервис проверяет заранее, чтобы назвать сегменты в ответе, а ошибки ссылок от
+// репозитория означают, что их изменили параллельно с проверкой.
+func writeError(err error, seg *models.Segment) error {
+	switch {
+	case errors.Is(err, storage.ErrAlreadyExists):
+		return ErrSegmentExists
+	case errors.Is(err, storage.ErrMissingReference):
+		return ErrInvalidSegmentConfig.Withf("a referenced segment was deleted")
+	case errors.Is(err, storage.ErrReferenceCycle):
+		return ErrCompositeCycle.Withf("%s", seg.SegmentName)
+	case errors.Is(err, storage.ErrRuleReference):
+		return ErrCompositeRuleRef.Withf("%s", seg.SegmentName)
+	}
+	return err
+}
+
 func (s *segmentService) GetSegmentByID(ctx context.Context, id uuid.UUID) (*models.Segment, error) {
 	seg, err := s.repo.GetByID(ctx, id)
 	if err != nil {
 		return nil, err
 	}
 	if seg == nil {
-		return nil, fmt.Errorf("segment %s not found", id)
+		return nil, ErrSegmentNotFound
 	}
 	return seg, nil
 }
 
-func (s *segmentService) ListSegments(ctx context.Context) ([]*models.Segment, error) {
-	return s.repo.List(ctx)
+// segmentCursor — содержимое курсора списка сегментов. Порядок сортировки
+// сохраняется в курсоре, чтобы курсор нельзя было применить к другой сортировке.
+type segmentCursor struct {
+	Sort      models.SegmentSort `json:"s"`
+	CreatedOn time.Time          `json:"c"`
+	Name      string             `json:"n,omitempty"`
+	ID        uuid.UUID          `json:"id"`
+}
+
+func (s *segmentService) ListSegments(ctx context.Context, filter models.SegmentFilter, sort models.SegmentSort, page Page) ([]*models.Segment, string, error) {
+	if sort == "" {
+		sort = models.SortCreatedOnDesc
+	}
+	q := models.SegmentQuery{Filter: filter, Sort: sort, Limit: page.Limit + 1}
+	if page.Cursor != "" {
+		var c segmentCursor
+		if err := decodeCursor(page.Cursor, &c); err != nil {
+			return nil, "", err
+		}
+		if c.Sort != sort {
+			return nil, "", ErrInvalidCursor.Withf("cursor was issued for sort %q", c.Sort)
+		}
+		q.After = &models.SegmentKey{CreatedOn: c.CreatedOn, Name: c.Name, ID: c.ID}
+	}
+	segs, err := s.repo.List(ctx, q)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(segs) <= page.Limit {
+		return segs, "", nil
+	}
+	segs = segs[:page.Limit]
+	last := segs[len(segs)-1]
+	return segs, encodeCursor(segmentCursor{Sort: sort, CreatedOn: last.CreatedOn, Name: last.SegmentName, ID: last.ID}), nil
 }
 
 func (s *segmentService) UpdateSegment(ctx context.Context, seg *models.Segment) (*models.Segment, error) {
@@ -55,21 +138,126 @@ func (s *segmentService) UpdateSegment(ctx context.Context, seg *models.Segment)
 		return nil, err
 	}
 	if existing == nil {
-		return nil, fmt.Errorf("segment %s not found", seg.ID)
+		return nil, ErrSegmentNotFound
 	}
-	if err := s.repo.Update(ctx, seg); err != nil {
+	seg.Tenant = existing.Tenant
+	// Старые сегменты могли быть созданы до появления формата — проверяем имя, только если оно меняется.
+	if seg.SegmentName != existing.SegmentName && !validSegmentName(seg.SegmentName) {
+		return nil, ErrInvalidSegmentName
+	}
+	if err := prepareConfig(seg, existing); err != nil {
 		return nil, err
 	}
+	if seg.Type == models.SegmentTypeComposite {
+		if err := checkCompositeRefs(ctx, s.repo, seg); err != nil {
+			return nil, err
+		}
+	}
+	// Сегмент из выражения composite не может стать dynamic_rule — см. checkCompositeRefs.
+	if seg.Type == models.SegmentTypeDynamicRule && existing.Type != models.SegmentTypeDynamicRule {
+		referencing, err := s.repo.ListReferencing(ctx, seg.ID)
+		if err != nil {
+			return nil, err
+		}
+		if len(referencing) > 0 {
+			return nil, ErrCompositeRuleRef.Withf("%s is used by %s", seg.SegmentName, segmentNames(referencing))
+		}
+	}
+	if err := s.repo.Update(ctx, seg); err != nil {
+		return nil, writeError(err, seg)
+	}
 	return seg, nil
 }
 
+// DeleteSegment удаляет сегмент. Сегмент, на который ссылаются composite-сегменты,
+// удалить нельзя — сначала нужно поменять их выражения.
 func (s *segmentService) DeleteSegment(ctx context.Context, id uuid.UUID) error {
 	existing, err := s.repo.GetByID(ctx, id)
 	if err != nil {
 		return err
 	}
 	if existing == nil {
-		return fmt.Errorf("segment %s not found", id)
+		return ErrSegmentNotFound
+	}
+	referencing, err := s.repo.ListReferencing(ctx, id)
+	if err != nil {
+		return err
+	}
+	if len(referencing) > 0 {
+		return ErrSegmentReferenced.Withf("used by %s", segmentNames(referencing))
+	}
+	// Ссылку могли добавить после проверки — её поймает внешний ключ.
+	if err := s.repo.Delete(ctx, id); err != nil {
+		if errors.Is(err, storage.ErrReferenced) {
+			return ErrSegmentReferenced
+		}
+		return err
+	}
+	return nil
+}
+
+// segmentNames перечисляет имена сегментов через запятую.
+func segmentNames(segs []*models.Segment) string {
+	names := make([]string, len(segs))
+	for i, seg := range segs {
+		names[i] = seg.SegmentName
+	}
+	return strings.Join(names, ", ")
+}
+
+func (s *segmentService) ResolveSegmentID(ctx context.Context, ref string) (uuid.UUID, error) {
+	return resolveSegmentID(ctx, s.repo, ref)
+}
+
+// resolveSegmentID возвращает ID сегмента по ссылке: UUID возвращается как есть,
+// иначе сегмент ищется по имени.
+func resolveSegmentID(ctx context.Context, repo storage.SegmentRepository, ref string) (uuid.UUID, error) {
+	if id, err := uuid.Parse(ref); err == nil {
+		return id, nil
+	}
+	seg, err := repo.GetByName(ctx, ref)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	if seg == nil {
+		return uuid.Nil, ErrSegmentNotFound.Withf("%s", ref)
+	}
+	return seg.ID, nil
+}
+
+// prepareConfig проверяет окно действия и то, что config сегмента корректен для его типа.
+// Для dynamic-сегмента без соли подставляет соль из прежней версии сегмента
+// (existing может быть nil) или генерирует новую, чтобы разбиение не менялось
+// при последующих обновлениях.
+func prepareConfig(seg, existing *models.Segment) error {
+	if seg.ValidFrom != nil && seg.ValidTo != nil && !seg.ValidFrom.Before(*seg.ValidTo) {
+		return ErrInvalidValidityWindow
+	}
+	switch seg.Type {
+	case models.SegmentTypeDynamicRule:
+		if _, err := rules.ParseConfig(seg.Config); err != nil {
+			return ErrInvalidSegmentConfig.Withf("%v", err)
+		}
+	case models.SegmentTypeDynamic:
+		cfg, err := rollout.ParseConfig(seg.Config)
+		if err != nil {
+			return ErrInvalidSegmentConfig.Withf("%v", err)
+		}
+		if cfg.Salt == "" {
+			if existing != nil && existing.Type == models.SegmentTypeDynamic {
+				if prev, err := rollout.ParseConfig(existing.Config); err == nil {
+					cfg.Salt = prev.Salt
+				}
+			}
+			if cfg.Salt == "" {
+				cfg.Salt = uuid.NewString()
+			}
+			seg.Config = cfg.Marshal()
+		}
+	case models.SegmentTypeComposite:
+		if _, err := composite.ParseConfig(seg.Config); err != nil {
+			return ErrInvalidSegmentConfig.Withf("%v", err)
+		}
 	}
-	return s.repo.Delete(ctx, id)
+	return nil
 }
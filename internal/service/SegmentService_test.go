@@ -0,0 +1,348 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/RaikyD/UserSegmentationService/internal/models"
+	"github.com/RaikyD/UserSegmentationService/internal/rollout"
+	"github.com/RaikyD/UserSegmentationService/internal/storage"
+)
+
+// fakeSegments — таблица сегментов в памяти.
+type fakeSegments struct {
+	storage.SegmentRepository
+	segs map[uuid.UUID]*models.Segment
+	// referencedCalls считает вызовы ListReferenced.
+	referencedCalls int
+}
+
+func newFakeSegments(segs ...*models.Segment) *fakeSegments {
+	f := &fakeSegments{segs: make(map[uuid.UUID]*models.Segment)}
+	for _, seg := range segs {
+		f.segs[seg.ID] = seg
+	}
+	return f
+}
+
+func (f *fakeSegments) GetByID(_ context.Context, id uuid.UUID) (*models.Segment, error) {
+	return f.segs[id], nil
+}
+
+func (f *fakeSegments) GetByName(_ context.Context, name string) (*models.Segment, error) {
+	for _, seg := range f.segs {
+		if seg.SegmentName == name {
+			return seg, nil
+		}
+	}
+	return nil, nil
+}
+
+func (f *fakeSegments) Create(ctx context.Context, seg *models.Segment) error {
+	if dup, _ := f.GetByName(ctx, seg.SegmentName); dup != nil {
+		return storage.ErrAlreadyExists
+	}
+	seg.ID = uuid.New()
+	f.segs[seg.ID] = seg
+	return nil
+}
+
+// List повторяет порядок и keyset-условие SegmentDB.List; из фильтров
+// поддерживается только NamePrefix.
+func (f *fakeSegments) List(_ context.Context, q models.SegmentQuery) ([]*models.Segment, error) {
+	byName := q.Sort == models.SortNameAsc || q.Sort == models.SortNameDesc
+	desc := q.Sort == models.SortCreatedOnDesc || q.Sort == models.SortNameDesc
+	compare := func(name string, created time.Time, id uuid.UUID, seg *models.Segment) int {
+		c := seg.CreatedOn.Compare(created)
+		if byName {
+			c = strings.Compare(seg.SegmentName, name)
+		}
+		if c == 0 {
+			c = bytes.Compare(seg.ID[:], id[:])
+		}
+		if desc {
+			c = -c
+		}
+		return c
+	}
+	var out []*models.Segment
+	for _, seg := range f.segs {
+		if !strings.HasPrefix(seg.SegmentName, q.Filter.NamePrefix) {
+			continue
+		}
+		if q.After != nil && compare(q.After.Name, q.After.CreatedOn, q.After.ID, seg) <= 0 {
+			continue
+		}
+		out = append(out, seg)
+	}
+	slices.SortFunc(out, func(a, b *models.Segment) int { return compare(b.SegmentName, b.CreatedOn, b.ID, a) })
+	if q.Limit > 0 && len(out) > q.Limit {
+		out = out[:q.Limit]
+	}
+	return out, nil
+}
+
+func (f *fakeSegments) ListActiveByType(_ context.Context, typ models.SegmentType) ([]*models.Segment, error) {
+	var out []*models.Segment
+	for _, seg := range f.segs {
+		if seg.Type == typ && seg.ActiveAt(time.Now()) {
+			out = append(out, seg)
+		}
+	}
+	return out, nil
+}
+
+func testSegment(name string, typ models.SegmentType, config string) *models.Segment {
+	return &models.Segment{ID: uuid.New(), SegmentName: name, Type: typ, IsActive: true, Config: json.RawMessage(config)}
+}
+
+func TestPrepareConfigRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  string
+		wantErr bool
+	}{
+		{"valid rule", `{"rule": "country in [\"RU\", \"KZ\"] and registered_at after days_ago(30)"}`, false},
+		{"not in", `{"rule": "country not in [\"US\"]"}`, false},
+		{"empty rule", `{"rule": ""}`, true},
+		{"missing rule", `{}`, true},
+		{"not an object", `"country == 1"`, true},
+		{"syntax error", `{"rule": "country == "}`, true},
+		{"unbalanced parentheses", `{"rule": "(a == 1 or b == 2"}`, true},
+		{"unknown function", `{"rule": "yesterday() before now()"}`, true},
+		{"invalid regexp", `{"rule": "email matches \"[\""}`, true},
+		{"invalid date literal", `{"rule": "registered_at after date(\"31.12.2024\")"}`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			seg := &models.Segment{Type: models.SegmentTypeDynamicRule, Config: json.RawMessage(tt.config)}
+			err := prepareConfig(seg, nil)
+			if !tt.wantErr {
+				if err != nil {
+					t.Fatalf("prepareConfig: %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrInvalidSegmentConfig) {
+				t.Errorf("prepareConfig error = %v, want ErrInvalidSegmentConfig", err)
+			}
+		})
+	}
+}
+
+func TestPrepareConfigSalt(t *testing.T) {
+	dynamic := func(config string) *models.Segment {
+		return &models.Segment{Type: models.SegmentTypeDynamic, Config: json.RawMessage(config)}
+	}
+	salt := func(t *testing.T, seg *models.Segment) string {
+		t.Helper()
+		cfg, err := rollout.ParseConfig(seg.Config)
+		if err != nil {
+			t.Fatalf("ParseConfig(%s): %v", seg.Config, err)
+		}
+		return cfg.Salt
+	}
+
+	a, b := dynamic(`{"percent": 10}`), dynamic(`{"percent": 10}`)
+	for _, seg := range []*models.Segment{a, b} {
+		if err := prepareConfig(seg, nil); err != nil {
+			t.Fatalf("prepareConfig: %v", err)
+		}
+	}
+	if salt(t, a) == "" || salt(t, a) == salt(t, b) {
+		t.Errorf("generated salts %q and %q, want distinct non-empty salts", salt(t, a), salt(t, b))
+	}
+
+	// Изменение процента не должно менять соль, иначе выборка перетасуется.
+	grown := dynamic(`{"percent": 20}`)
+	if err := prepareConfig(grown, a); err != nil {
+		t.Fatalf("prepareConfig: %v", err)
+	}
+	if salt(t, grown) != salt(t, a) {
+		t.Errorf("salt after update = %q, want the existing %q", salt(t, grown), salt(t, a))
+	}
+
+	explicit := dynamic(`{"percent": 10, "salt": "mine"}`)
+	if err := prepareConfig(explicit, a); err != nil || salt(t, explicit) != "mine" {
+		t.Errorf("explicit salt = %q, %v, want mine", salt(t, explicit), err)
+	}
+
+	for _, raw := range []string{`{"percent": 101}`, `{"percent": "5"}`} {
+		if err := prepareConfig(dynamic(raw), nil); !errors.Is(err, ErrInvalidSegmentConfig) {
+			t.Errorf("prepareConfig(%s) error = %v, want ErrInvalidSegmentConfig", raw, err)
+		}
+	}
+}
+
+func TestPrepareConfigValidityWindow(t *testing.T) {
+	now := time.Now()
+	later := now.Add(time.Hour)
+	tests := []struct {
+		name     string
+		from, to *time.Time
+		wantErr  bool
+	}{
+		{"open", nil, nil, false},
+		{"only from", &now, nil, false},
+		{"only to", nil, &now, false},
+		{"ordered", &now, &later, false},
+		{"empty", &now, &now, true},
+		{"reversed", &later, &now, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			seg := &models.Segment{Type: models.SegmentTypeStatic, ValidFrom: tt.from, ValidTo: tt.to}
+			err := prepareConfig(seg, nil)
+			if got := errors.Is(err, ErrInvalidValidityWindow); got != tt.wantErr {
+				t.Errorf("prepareConfig error = %v, want ErrInvalidValidityWindow %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSegmentNames(t *testing.T) {
+	tests := []struct {
+		name  string
+		valid bool
+	}{
+		{"beta", true},
+		{"Premium_users_2025", true},
+		{"a", true},
+		{"a" + strings.Repeat("b", 127), true},
+		{"a" + strings.Repeat("b", 128), false},
+		{"", false},
+		{"2025_promo", false},
+		{"_hidden", false},
+		{"mass-assign", false},
+		{"with space", false},
+		{"кириллица", false},
+		{"550e8400-e29b-41d4-a716-446655440000", false},
+		// uuid.Parse принимает 32 шестнадцатеричные цифры без дефисов.
+		{"ae8400e29b41d4a716446655440000ff", false},
+		{"ABCDEF0123456789abcdef0123456789", false},
+		{"ae8400e29b41d4a716446655440000f", true},
+		{"ae8400e29b41d4a716446655440000fff", true},
+		{"ge8400e29b41d4a716446655440000ff", true},
+	}
+	svc := NewSegmentService(newFakeSegments())
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := svc.CreateSegment(context.Background(), &models.Segment{SegmentName: tt.name, Type: models.SegmentTypeStatic})
+			if tt.valid && err != nil {
+				t.Errorf("CreateSegment(%q): %v", tt.name, err)
+			}
+			if !tt.valid && !errors.Is(err, ErrInvalidSegmentName) {
+				t.Errorf("CreateSegment(%q) error = %v, want ErrInvalidSegmentName", tt.name, err)
+			}
+		})
+	}
+
+	// Переименование проверяет имя так же.
+	beta := testSegment("beta", models.SegmentTypeStatic, `{}`)
+	svc = NewSegmentService(newFakeSegments(beta))
+	renamed := *beta
+	renamed.SegmentName = "ae8400e29b41d4a716446655440000ff"
+	if _, err := svc.UpdateSegment(context.Background(), &renamed); !errors.Is(err, ErrInvalidSegmentName) {
+		t.Errorf("rename to a UUID: error = %v, want ErrInvalidSegmentName", err)
+	}
+}
+
+func TestResolveSegmentID(t *testing.T) {
+	beta := testSegment("beta", models.SegmentTypeStatic, `{}`)
+	svc := NewSegmentService(newFakeSegments(beta))
+	ctx := context.Background()
+
+	if id, err := svc.ResolveSegmentID(ctx, "beta"); err != nil || id != beta.ID {
+		t.Errorf("ResolveSegmentID(name) = %s, %v, want %s", id, err, beta.ID)
+	}
+	// UUID не проверяется по базе: отсутствие сегмента обнаружит сам запрос.
+	other := uuid.New()
+	if id, err := svc.ResolveSegmentID(ctx, other.String()); err != nil || id != other {
+		t.Errorf("ResolveSegmentID(uuid) = %s, %v, want %s", id, err, other)
+	}
+	if _, err := svc.ResolveSegmentID(ctx, "ghost"); !errors.Is(err, ErrSegmentNotFound) {
+		t.Errorf("ResolveSegmentID(unknown) error = %v, want ErrSegmentNotFound", err)
+	}
+}
+
+func TestCreateSegmentDuplicateName(t *testing.T) {
+	svc := NewSegmentService(newFakeSegments(testSegment("beta", models.SegmentTypeStatic, `{}`)))
+	_, err := svc.CreateSegment(context.Background(), &models.Segment{SegmentName: "beta", Type: models.SegmentTypeStatic})
+	if !errors.Is(err, ErrSegmentExists) || !errors.Is(err, ErrAlreadyExists) {
+		t.Errorf("CreateSegment(duplicate) error = %v, want ErrSegmentExists", err)
+	}
+	if _, err := svc.GetSegmentByID(context.Background(), uuid.New()); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetSegmentByID(unknown) error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestListSegmentsPages(t *testing.T) {
+	repo := newFakeSegments()
+	base := time.Date(2025, 8, 5, 0, 0, 0, 0, time.UTC)
+	for i, name := range []string{"delta", "alpha", "echo", "bravo", "charlie"} {
+		seg := testSegment(name, models.SegmentTypeStatic, `{}`)
+		// У двух сегментов одинаковое время создания: порядок решает id.
+		seg.CreatedOn = base.Add(time.Duration(min(i, 3)) * time.Hour)
+		repo.segs[seg.ID] = seg
+	}
+	svc := NewSegmentService(repo)
+	ctx := context.Background()
+
+	for _, sort := range []models.SegmentSort{"", models.SortCreatedOnAsc, models.SortNameAsc, models.SortNameDesc} {
+		t.Run(string(sort), func(t *testing.T) {
+			all, next, err := svc.ListSegments(ctx, models.SegmentFilter{}, sort, Page{Limit: 100})
+			if err != nil || next != "" || len(all) != 5 {
+				t.Fatalf("ListSegments(all) = %d segments, %q, %v", len(all), next, err)
+			}
+			var paged []*models.Segment
+			page := Page{Limit: 2}
+			for range 5 {
+				segs, next, err := svc.ListSegments(ctx, models.SegmentFilter{}, sort, page)
+				if err != nil {
+					t.Fatalf("ListSegments: %v", err)
+				}
+				paged = append(paged, segs...)
+				if next == "" {
+					break
+				}
+				page.Cursor = next
+			}
+			if !slices.Equal(paged, all) {
+				t.Errorf("pages = %v, want %v", namesOf(paged), namesOf(all))
+			}
+		})
+	}
+
+	_, next, err := svc.ListSegments(ctx, models.SegmentFilter{}, models.SortNameAsc, Page{Limit: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, bad := range []struct {
+		sort   models.SegmentSort
+		cursor string
+	}{
+		{models.SortNameDesc, next},
+		{models.SortNameAsc, "not a cursor"},
+		{models.SortNameAsc, "e30"},
+	} {
+		if _, _, err := svc.ListSegments(ctx, models.SegmentFilter{}, bad.sort, Page{Limit: 1, Cursor: bad.cursor}); !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("ListSegments(%s, %q) error = %v, want ErrInvalidCursor", bad.sort, bad.cursor, err)
+		}
+	}
+}
+
+func namesOf(segs []*models.Segment) []string {
+	names := make([]string, len(segs))
+	for i, seg := range segs {
+		names[i] = seg.SegmentName
+	}
+	return names
+}
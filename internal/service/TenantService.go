@@ -0,0 +1,27 @@
+package service
+
+import (
+	"context"
+
+	"github.com/RaikyD/UserSegmentationService/internal/models"
+	"github.com/RaikyD/UserSegmentationService/internal/storage"
+)
+
+// TenantService отдаёт сводки по арендаторам для администраторов платформы.
+type TenantService interface {
+	// ListTenants возвращает арендаторов с объёмом их данных.
+	ListTenants(ctx context.Context) ([]*models.TenantUsage, error)
+}
+
+type tenantService struct {
+	repo storage.TenantRepository
+}
+
+// NewTenantService создаёт сервис сводок по арендаторам.
+func NewTenantService(repo storage.TenantRepository) TenantService {
+	return &tenantService{repo: repo}
+}
+
+func (s *tenantService) ListTenants(ctx context.Context) ([]*models.TenantUsage, error) {
+	return s.repo.ListUsage(ctx)
+}
@@ -1,105 +1,523 @@
 package service
 
 import (
+	"bytes"
 	"context"
-	"fmt"
-	"log"
+	"log/slog"
 	"math/rand"
+	"sort"
 	"strings"
 	"time"
 
+	"github.com/RaikyD/UserSegmentationService/internal/audit"
+	"github.com/RaikyD/UserSegmentationService/internal/logging"
+	"github.com/RaikyD/UserSegmentationService/internal/metrics"
 	"github.com/RaikyD/UserSegmentationService/internal/models"
+	"github.com/RaikyD/UserSegmentationService/internal/rollout"
+	"github.com/RaikyD/UserSegmentationService/internal/rules"
 	"github.com/RaikyD/UserSegmentationService/internal/storage"
 	"github.com/google/uuid"
 )
 
 // UserSegmentService описывает логику работы с привязками пользователей к сегментам.
 type UserSegmentService interface {
-	AssignUser(ctx context.Context, segmentID, userID uuid.UUID) error
+	AssignUser(ctx context.Context, segmentID, userID uuid.UUID, expiresAt *time.Time) error
 	UnassignUser(ctx context.Context, segmentID, userID uuid.UUID) error
-	ListUserSegments(ctx context.Context, userID uuid.UUID) ([]*models.Segment, error)
-	ListSegmentUsers(ctx context.Context, segmentID uuid.UUID) ([]uuid.UUID, error)
+	// ListUserSegments возвращает страницу сегментов пользователя с данными о привязках
+	// и курсор следующей страницы. includeInactive добавляет явные привязки к недействующим сегментам
+	ListUserSegments(ctx context.Context, userID uuid.UUID, includeInactive bool, page Page) ([]*models.UserSegment, string, error)
+	// ListSegmentUsers возвращает страницу участников сегмента и курсор следующей страницы
+	ListSegmentUsers(ctx context.Context, segmentID uuid.UUID, page Page) ([]uuid.UUID, string, error)
+	// ExportSegmentUsers построчно передаёт в fn всех участников сегмента
+	ExportSegmentUsers(ctx context.Context, segmentID uuid.UUID, fn func(*models.UserSegmentAssignment) error) error
+	// CountSegmentMembers считает участников сегмента так же, как ListSegmentUsers
+	CountSegmentMembers(ctx context.Context, seg *models.Segment) (int64, error)
+	ListUserSegmentsAt(ctx context.Context, userID uuid.UUID, at time.Time) ([]*models.UserSegment, error)
+	ListUserHistory(ctx context.Context, userID uuid.UUID) ([]*models.AssignmentEvent, error)
 	MassAssignSegment(ctx context.Context, segmentID uuid.UUID, percent int) (*models.MassAssignResult, error)
+	ResolveSegmentID(ctx context.Context, ref string) (uuid.UUID, error)
+	UpdateUserSegments(ctx context.Context, userID uuid.UUID, add, remove []string) error
+	// CheckUserSegments проверяет, в каких из сегментов refs (ID или имена) состоит пользователь
+	CheckUserSegments(ctx context.Context, userID uuid.UUID, refs []string) ([]*models.Membership, error)
+	// CheckMembership проверяет членство для набора пар «пользователь — сегмент»
+	CheckMembership(ctx context.Context, checks []models.MembershipCheck) ([]*models.Membership, error)
 }
 
+// AttributeProvider отдаёт атрибуты пользователя, по которым вычисляются правила dynamic_rule.
+type AttributeProvider interface {
+	GetAttributes(ctx context.Context, userID uuid.UUID) (map[string]any, error)
+	// GetManyAttributes загружает атрибуты сразу нескольких пользователей
+	GetManyAttributes(ctx context.Context, userIDs []uuid.UUID) (map[uuid.UUID]map[string]any, error)
+}
+
+// hotLogSampleEvery — на горячих путях (назначение, проверки) в лог попадает
+// только каждая такая запись уровня debug/info.
+const hotLogSampleEvery = 100
+
 type userSegmentService struct {
 	segRepo storage.SegmentRepository
 	usRepo  storage.UserRepository
+	attrs   AttributeProvider
+	log     *slog.Logger
+	hotLog  *slog.Logger
 }
 
-func NewUserSegmentService(segRepo storage.SegmentRepository, usRepo storage.UserRepository) UserSegmentService {
-	return &userSegmentService{segRepo: segRepo, usRepo: usRepo}
+// NewUserSegmentService создаёт сервис привязок. attrs может быть nil —
+// тогда правила видят только встроенный атрибут user_id.
+func NewUserSegmentService(segRepo storage.SegmentRepository, usRepo storage.UserRepository, attrs AttributeProvider, logger *slog.Logger) UserSegmentService {
+	return &userSegmentService{
+		segRepo: segRepo,
+		usRepo:  usRepo,
+		attrs:   attrs,
+		log:     logger,
+		hotLog:  logging.Sampled(logger, hotLogSampleEvery),
+	}
 }
 
-func (u *userSegmentService) AssignUser(ctx context.Context, segmentID, userID uuid.UUID) error {
-	log.Printf("Service.AssignUser: userID = %s", userID)
+func (u *userSegmentService) AssignUser(ctx context.Context, segmentID, userID uuid.UUID, expiresAt *time.Time) error {
+	now := time.Now()
+	if expiresAt != nil && !expiresAt.After(now) {
+		return ErrInvalidExpiry
+	}
 
 	seg, err := u.segRepo.GetByID(ctx, segmentID)
 	if err != nil {
 		return err
 	}
 	if seg == nil {
-		return fmt.Errorf("segment %s not found", segmentID)
+		return ErrSegmentNotFound
+	}
+	if seg.Type == models.SegmentTypeComposite {
+		return ErrCompositeAssignment
 	}
 	asg := &models.UserSegmentAssignment{
 		SegmentID:      segmentID,
 		UserID:         userID,
 		AssignmentType: models.AssignmentManual,
-		AssignedAt:     time.Now(),
+		AssignedAt:     now,
+		ExpiresAt:      expiresAt,
 	}
-	return u.usRepo.Add(ctx, asg)
+	if err := u.usRepo.Add(ctx, asg, changeMeta(ctx, models.SourceManual)); err != nil {
+		return err
+	}
+	metrics.Assignments.WithLabelValues(string(models.AssignmentManual)).Inc()
+	u.hotLog.DebugContext(ctx, "user assigned to segment", slog.String("segment_id", segmentID.String()), logging.UserID(userID))
+	return nil
 }
 
 func (u *userSegmentService) UnassignUser(ctx context.Context, segmentID, userID uuid.UUID) error {
-	return u.usRepo.Delete(ctx, segmentID, userID)
+	return u.usRepo.Delete(ctx, segmentID, userID, changeMeta(ctx, models.SourceManual))
+}
+
+// UpdateUserSegments атомарно добавляет пользователю сегменты add и снимает сегменты remove.
+// Сегменты указываются по ID или имени. Если хоть один сегмент не найден или
+// неактивен, не применяется ничего.
+func (u *userSegmentService) UpdateUserSegments(ctx context.Context, userID uuid.UUID, add, remove []string) error {
+	now := time.Now()
+	addIDs := make(map[uuid.UUID]struct{}, len(add))
+	var toAdd []*models.UserSegmentAssignment
+	for _, ref := range add {
+		seg, err := u.resolveSegment(ctx, ref)
+		if err != nil {
+			return err
+		}
+		if !seg.ActiveAt(now) {
+			return ErrSegmentInactive.Withf("%s", ref)
+		}
+		if seg.Type == models.SegmentTypeComposite {
+			return ErrCompositeAssignment.Withf("%s", ref)
+		}
+		if _, dup := addIDs[seg.ID]; dup {
+			continue
+		}
+		addIDs[seg.ID] = struct{}{}
+		toAdd = append(toAdd, &models.UserSegmentAssignment{
+			SegmentID:      seg.ID,
+			UserID:         userID,
+			AssignmentType: models.AssignmentManual,
+			AssignedAt:     now,
+		})
+	}
+
+	var toRemove []uuid.UUID
+	for _, ref := range remove {
+		seg, err := u.resolveSegment(ctx, ref)
+		if err != nil {
+			return err
+		}
+		if !seg.ActiveAt(now) {
+			return ErrSegmentInactive.Withf("%s", ref)
+		}
+		if seg.Type == models.SegmentTypeComposite {
+			return ErrCompositeAssignment.Withf("%s", ref)
+		}
+		if _, ok := addIDs[seg.ID]; ok {
+			return ErrConflictingChange.Withf("%s", ref)
+		}
+		toRemove = append(toRemove, seg.ID)
+	}
+
+	if err := u.usRepo.ApplyBatch(ctx, userID, toAdd, toRemove, changeMeta(ctx, models.SourceManual)); err != nil {
+		return err
+	}
+	metrics.Assignments.WithLabelValues(string(models.AssignmentManual)).Add(float64(len(toAdd)))
+	return nil
 }
 
-func (u *userSegmentService) ListUserSegments(ctx context.Context, userID uuid.UUID) ([]*models.Segment, error) {
-	assignments, err := u.usRepo.ListByUser(ctx, userID)
+func (u *userSegmentService) ResolveSegmentID(ctx context.Context, ref string) (uuid.UUID, error) {
+	return resolveSegmentID(ctx, u.segRepo, ref)
+}
+
+// resolveSegment находит сегмент по UUID или по имени.
+func (u *userSegmentService) resolveSegment(ctx context.Context, ref string) (*models.Segment, error) {
+	var (
+		seg *models.Segment
+		err error
+	)
+	if id, parseErr := uuid.Parse(ref); parseErr == nil {
+		seg, err = u.segRepo.GetByID(ctx, id)
+	} else {
+		seg, err = u.segRepo.GetByName(ctx, ref)
+	}
 	if err != nil {
 		return nil, err
 	}
-	var segments []*models.Segment
+	if seg == nil {
+		return nil, ErrSegmentNotFound.Withf("%s", ref)
+	}
+	return seg, nil
+}
+
+// ListUserSegmentsAt восстанавливает по журналу сегменты пользователя на момент at.
+// Учитываются только явные привязки; удалённые с тех пор сегменты пропускаются.
+func (u *userSegmentService) ListUserSegmentsAt(ctx context.Context, userID uuid.UUID, at time.Time) ([]*models.UserSegment, error) {
+	assignments, err := u.usRepo.ListByUserAt(ctx, userID, at)
+	if err != nil {
+		return nil, err
+	}
+	var segments []*models.UserSegment
 	for _, asg := range assignments {
 		seg, err := u.segRepo.GetByID(ctx, asg.SegmentID)
 		if err != nil {
 			return nil, err
 		}
-		if seg != nil {
-			segments = append(segments, seg)
+		if seg == nil {
+			continue
 		}
+		segments = append(segments, &models.UserSegment{
+			Segment:        seg,
+			AssignmentType: asg.AssignmentType,
+			AssignedAt:     &asg.AssignedAt,
+			ExpiresAt:      asg.ExpiresAt,
+		})
 	}
 	return segments, nil
 }
 
-func (u *userSegmentService) ListSegmentUsers(ctx context.Context, segmentID uuid.UUID) ([]uuid.UUID, error) {
-	assignments, err := u.usRepo.ListBySegment(ctx, segmentID)
+func (u *userSegmentService) ListUserHistory(ctx context.Context, userID uuid.UUID) ([]*models.AssignmentEvent, error) {
+	return u.usRepo.ListHistoryByUser(ctx, userID)
+}
+
+// changeMeta собирает сведения об изменении для журнала истории.
+func changeMeta(ctx context.Context, source models.ChangeSource) models.ChangeMeta {
+	return models.ChangeMeta{Actor: audit.ActorFromContext(ctx), Source: source}
+}
+
+// idCursor — содержимое курсора списков, упорядоченных по UUID.
+type idCursor struct {
+	ID uuid.UUID `json:"id"`
+}
+
+// decodeIDCursor возвращает UUID, после которого начинается страница; uuid.Nil — с начала.
+func decodeIDCursor(cursor string) (uuid.UUID, error) {
+	if cursor == "" {
+		return uuid.Nil, nil
+	}
+	var c idCursor
+	if err := decodeCursor(cursor, &c); err != nil {
+		return uuid.Nil, err
+	}
+	return c.ID, nil
+}
+
+// ListUserSegments отдаёт сегменты пользователя в порядке ID. Явные привязки
+// выбираются страницей из БД одним запросом вместе с сегментами, вычисляемые
+// сегменты вливаются в неё по тому же порядку. includeInactive касается только
+// явных привязок: вычисляемое членство бывает лишь у действующих сегментов.
+func (u *userSegmentService) ListUserSegments(ctx context.Context, userID uuid.UUID, includeInactive bool, page Page) ([]*models.UserSegment, string, error) {
+	after, err := decodeIDCursor(page.Cursor)
+	if err != nil {
+		return nil, "", err
+	}
+	segments, err := u.usRepo.ListSegmentsByUser(ctx, userID, after, page.Limit+1, includeInactive)
+	if err != nil {
+		return nil, "", err
+	}
+	seen := make(map[uuid.UUID]struct{}, len(segments))
+	for _, us := range segments {
+		seen[us.Segment.ID] = struct{}{}
+	}
+
+	matched, err := u.matchComputedSegments(ctx, userID)
+	if err != nil {
+		return nil, "", err
+	}
+	for _, seg := range matched {
+		if _, ok := seen[seg.ID]; !ok && compareIDs(seg.ID, after) > 0 {
+			segments = append(segments, &models.UserSegment{Segment: seg, AssignmentType: computedAssignmentType(seg.Type)})
+			seen[seg.ID] = struct{}{}
+		}
+	}
+	sort.Slice(segments, func(i, j int) bool { return compareIDs(segments[i].Segment.ID, segments[j].Segment.ID) < 0 })
+
+	// Явных привязок запрошено на одну больше страницы, поэтому всё, что попало
+	// в страницу, лежит внутри выбранного из БД диапазона.
+	if len(segments) <= page.Limit {
+		return segments, "", nil
+	}
+	segments = segments[:page.Limit]
+	return segments, encodeCursor(idCursor{ID: segments[len(segments)-1].Segment.ID}), nil
+}
+
+// computedAssignmentType — тип членства в сегменте, которое вычисляется, а не хранится.
+func computedAssignmentType(t models.SegmentType) models.AssignmentType {
+	switch t {
+	case models.SegmentTypeDynamic:
+		return models.AssignmentRollout
+	case models.SegmentTypeDynamicRule:
+		return models.AssignmentRule
+	case models.SegmentTypeComposite:
+		return models.AssignmentComposite
+	}
+	return ""
+}
+
+// compareIDs сравнивает UUID побайтно — в том же порядке, что и Postgres.
+func compareIDs(a, b uuid.UUID) int {
+	return bytes.Compare(a[:], b[:])
+}
+
+// matchComputedSegments возвращает активные сегменты, членство в которых вычисляется,
+// а не хранится: dynamic — по корзине пользователя, dynamic_rule — по правилу,
+// composite — по выражению над остальными сегментами.
+// Сегмент с некорректным конфигом пропускается.
+func (u *userSegmentService) matchComputedSegments(ctx context.Context, userID uuid.UUID) ([]*models.Segment, error) {
+	var matched []*models.Segment
+
+	dynamic, err := u.segRepo.ListActiveByType(ctx, models.SegmentTypeDynamic)
 	if err != nil {
 		return nil, err
 	}
-	var userIDs []uuid.UUID
-	for _, asg := range assignments {
-		userIDs = append(userIDs, asg.UserID)
+	for _, seg := range dynamic {
+		cfg, err := rollout.ParseConfig(seg.Config)
+		if err != nil {
+			u.log.WarnContext(ctx, "skip segment with invalid rollout config", "segment_id", seg.ID, "error", err)
+			continue
+		}
+		if cfg.Contains(userID) {
+			matched = append(matched, seg)
+		}
+	}
+
+	matched, err = u.matchRules(ctx, userID, matched)
+	if err != nil {
+		return nil, err
 	}
-	return userIDs, nil
+
+	composites, err := u.matchComposites(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return append(matched, composites...), nil
 }
 
-// Стоит отметить, что ,наверное, для наиболее правдоподобной работы стоило делать 3 таблицу,
-// в которой хранились бы пользователи с их данными, но так как это мне показалось нерационально, то решил
-// брать просто пользователей, которые сами добавляем в ходе работы.
-func (u *userSegmentService) MassAssignSegment(ctx context.Context, segmentID uuid.UUID, percent int) (*models.MassAssignResult, error) {
+// matchRules добавляет к matched сегменты dynamic_rule, правилам которых удовлетворяет пользователь.
+func (u *userSegmentService) matchRules(ctx context.Context, userID uuid.UUID, matched []*models.Segment) ([]*models.Segment, error) {
+	candidates, err := u.segRepo.ListActiveByType(ctx, models.SegmentTypeDynamicRule)
+	if err != nil {
+		return nil, err
+	}
+	if len(candidates) == 0 {
+		return matched, nil
+	}
+
+	attrs, err := u.userAttributes(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, seg := range candidates {
+		if u.matchRule(ctx, seg, attrs) {
+			matched = append(matched, seg)
+		}
+	}
+	return matched, nil
+}
+
+// userAttributes возвращает атрибуты пользователя для правил вместе со встроенным user_id.
+func (u *userSegmentService) userAttributes(ctx context.Context, userID uuid.UUID) (map[string]any, error) {
+	attrs := map[string]any{}
+	if u.attrs != nil {
+		var err error
+		if attrs, err = u.attrs.GetAttributes(ctx, userID); err != nil {
+			return nil, err
+		}
+		if attrs == nil {
+			attrs = map[string]any{}
+		}
+	}
+	attrs["user_id"] = userID.String()
+	return attrs, nil
+}
+
+// usersAttributes возвращает атрибуты пользователей для правил, как userAttributes,
+// но загружает их одним обращением к провайдеру.
+func (u *userSegmentService) usersAttributes(ctx context.Context, userIDs []uuid.UUID) (map[uuid.UUID]map[string]any, error) {
+	out := make(map[uuid.UUID]map[string]any, len(userIDs))
+	if u.attrs != nil {
+		loaded, err := u.attrs.GetManyAttributes(ctx, userIDs)
+		if err != nil {
+			return nil, err
+		}
+		for id, attrs := range loaded {
+			out[id] = attrs
+		}
+	}
+	for _, id := range userIDs {
+		if out[id] == nil {
+			out[id] = map[string]any{}
+		}
+		out[id]["user_id"] = id.String()
+	}
+	return out, nil
+}
+
+// matchRule проверяет правило dynamic_rule-сегмента. Некорректное правило ни под кого не подходит.
+func (u *userSegmentService) matchRule(ctx context.Context, seg *models.Segment, attrs map[string]any) bool {
+	rule, err := rules.ParseConfig(seg.Config)
+	if err != nil {
+		u.log.WarnContext(ctx, "skip segment with invalid rule", "segment_id", seg.ID, "error", err)
+		return false
+	}
+	ok, err := rule.Match(attrs)
+	if err != nil {
+		u.log.WarnContext(ctx, "rule evaluation failed", "segment_id", seg.ID, "error", err)
+		return false
+	}
+	return ok
+}
+
+// ListSegmentUsers отдаёт участников сегмента в порядке user_id. Для действующего
+// dynamic-сегмента к явным привязкам добавляются пользователи из его корзин,
+// участники composite-сегмента вычисляются по его выражению.
+func (u *userSegmentService) ListSegmentUsers(ctx context.Context, segmentID uuid.UUID, page Page) ([]uuid.UUID, string, error) {
+	after, err := decodeIDCursor(page.Cursor)
+	if err != nil {
+		return nil, "", err
+	}
 	seg, err := u.segRepo.GetByID(ctx, segmentID)
+	if err != nil {
+		return nil, "", err
+	}
+	if seg == nil {
+		return nil, "", ErrSegmentNotFound
+	}
+	expr, err := u.memberExpr(ctx, seg, time.Now(), map[uuid.UUID]bool{})
+	if err != nil {
+		return nil, "", err
+	}
+	userIDs, err := u.usRepo.ListMemberIDs(ctx, expr, after, page.Limit+1)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(userIDs) <= page.Limit {
+		return userIDs, "", nil
+	}
+	userIDs = userIDs[:page.Limit]
+	return userIDs, encodeCursor(idCursor{ID: userIDs[len(userIDs)-1]}), nil
+}
+
+func (u *userSegmentService) CountSegmentMembers(ctx context.Context, seg *models.Segment) (int64, error) {
+	expr, err := u.memberExpr(ctx, seg, time.Now(), map[uuid.UUID]bool{})
+	if err != nil {
+		return 0, err
+	}
+	return u.usRepo.CountMembers(ctx, expr)
+}
+
+// ExportSegmentUsers отдаёт тех же участников, что и ListSegmentUsers, но потоком и целиком.
+// У участников composite-сегмента нет своих привязок, они выгружаются с типом composite.
+func (u *userSegmentService) ExportSegmentUsers(ctx context.Context, segmentID uuid.UUID, fn func(*models.UserSegmentAssignment) error) error {
+	seg, err := u.segRepo.GetByID(ctx, segmentID)
+	if err != nil {
+		return err
+	}
+	if seg == nil {
+		return ErrSegmentNotFound
+	}
+	now := time.Now()
+	if seg.Type == models.SegmentTypeComposite {
+		expr, err := u.memberExpr(ctx, seg, now, map[uuid.UUID]bool{})
+		if err != nil {
+			return err
+		}
+		return u.usRepo.StreamMemberIDs(ctx, expr, func(userID uuid.UUID) error {
+			return fn(&models.UserSegmentAssignment{
+				SegmentID:      segmentID,
+				UserID:         userID,
+				AssignmentType: models.AssignmentComposite,
+			})
+		})
+	}
+
+	var bucket *rollout.Config
+	if seg.Type == models.SegmentTypeDynamic && seg.ActiveAt(now) {
+		if bucket, err = rollout.ParseConfig(seg.Config); err != nil {
+			return err
+		}
+	}
+	return u.usRepo.StreamBySegment(ctx, segmentID, bucket, fn)
+}
+
+// MassAssignSegment назначает сегмент случайному проценту пользователей из таблицы users.
+// Для dynamic-сегмента строки не пишутся: процент сохраняется в config сегмента,
+// а членство вычисляется по корзинам (см. пакет rollout).
+func (u *userSegmentService) MassAssignSegment(ctx context.Context, segmentID uuid.UUID, percent int) (*models.MassAssignResult, error) {
+	start := time.Now()
+	result, assignmentType, err := u.massAssign(ctx, segmentID, percent)
 	if err != nil {
 		return nil, err
 	}
+	metrics.MassAssignDuration.Observe(time.Since(start).Seconds())
+	metrics.MassAssignSize.Observe(float64(result.Assigned))
+	metrics.Assignments.WithLabelValues(string(assignmentType)).Add(float64(result.Assigned))
+	return result, nil
+}
+
+// massAssign выполняет MassAssignSegment и сообщает, каким типом назначены пользователи.
+func (u *userSegmentService) massAssign(ctx context.Context, segmentID uuid.UUID, percent int) (*models.MassAssignResult, models.AssignmentType, error) {
+	seg, err := u.segRepo.GetByID(ctx, segmentID)
+	if err != nil {
+		return nil, "", err
+	}
 	if seg == nil {
-		return nil, fmt.Errorf("segment %s not found", segmentID)
+		return nil, "", ErrSegmentNotFound
+	}
+	if !seg.ActiveAt(time.Now()) {
+		return nil, "", ErrSegmentInactive
+	}
+	if seg.Type == models.SegmentTypeComposite {
+		return nil, "", ErrCompositeAssignment
 	}
 
-	// Собираем все уникаильные ключи юзеров
+	// Собираем всех пользователей
 	userIDs, err := u.usRepo.GetAllUserIDs(ctx)
 	if err != nil {
-		return nil, err
+		return nil, "", err
+	}
+
+	if seg.Type == models.SegmentTypeDynamic {
+		result, err := u.setRolloutPercent(ctx, seg, userIDs, percent)
+		return result, models.AssignmentRollout, err
 	}
 
 	if len(userIDs) == 0 {
@@ -107,7 +525,7 @@ func (u *userSegmentService) MassAssignSegment(ctx context.Context, segmentID uu
 			TotalUsers: 0,
 			Assigned:   0,
 			Skipped:    0,
-		}, nil
+		}, models.AssignmentAuto, nil
 	}
 
 	// Берём наш процент
@@ -126,13 +544,19 @@ func (u *userSegmentService) MassAssignSegment(ctx context.Context, segmentID uu
 	assigned := 0
 	skipped := 0
 
+	meta := changeMeta(ctx, models.SourceAuto)
 	for _, userID := range selected {
-		err := u.AssignUser(ctx, segmentID, userID)
+		err := u.usRepo.Add(ctx, &models.UserSegmentAssignment{
+			SegmentID:      segmentID,
+			UserID:         userID,
+			AssignmentType: models.AssignmentAuto,
+			AssignedAt:     time.Now(),
+		}, meta)
 		if err != nil {
 			if strings.Contains(err.Error(), "duplicate") || strings.Contains(err.Error(), "already exists") {
 				skipped++
 			} else {
-				return nil, err
+				return nil, "", err
 			}
 		} else {
 			assigned++
@@ -143,5 +567,38 @@ func (u *userSegmentService) MassAssignSegment(ctx context.Context, segmentID uu
 		TotalUsers: len(userIDs),
 		Assigned:   assigned,
 		Skipped:    skipped,
-	}, nil
+	}, models.AssignmentAuto, nil
+}
+
+// setRolloutPercent меняет процент раскатки dynamic-сегмента. В результате Assigned —
+// пользователи, попавшие в сегмент впервые, Skipped — уже входившие в него.
+func (u *userSegmentService) setRolloutPercent(ctx context.Context, seg *models.Segment, userIDs []uuid.UUID, percent int) (*models.MassAssignResult, error) {
+	cfg, err := rollout.ParseConfig(seg.Config)
+	if err != nil {
+		return nil, err
+	}
+	prev := *cfg
+	cfg.Percent = float64(percent)
+	// Сегменты, созданные до появления соли, получают её здесь, как и в
+	// prepareConfig: с пустой солью все такие сегменты делили бы одни корзины.
+	if cfg.Salt == "" {
+		cfg.Salt = uuid.NewString()
+	}
+	seg.Config = cfg.Marshal()
+	if err := u.segRepo.Update(ctx, seg); err != nil {
+		return nil, err
+	}
+
+	result := &models.MassAssignResult{TotalUsers: len(userIDs)}
+	for _, id := range userIDs {
+		if !cfg.Contains(id) {
+			continue
+		}
+		if prev.Contains(id) {
+			result.Skipped++
+		} else {
+			result.Assigned++
+		}
+	}
+	return result, nil
 }
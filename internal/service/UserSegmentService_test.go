@@ -0,0 +1,297 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/RaikyD/UserSegmentationService/internal/audit"
+	"github.com/RaikyD/UserSegmentationService/internal/logging"
+	"github.com/RaikyD/UserSegmentationService/internal/models"
+	"github.com/RaikyD/UserSegmentationService/internal/rollout"
+	"github.com/RaikyD/UserSegmentationService/internal/storage"
+)
+
+// fakeAssignments — таблица привязок в памяти. segs нужен запросам,
+// которые соединяют привязки с сегментами.
+type fakeAssignments struct {
+	storage.UserRepository
+	segs    *fakeSegments
+	added   []*models.UserSegmentAssignment
+	removed []uuid.UUID
+	metas   []models.ChangeMeta
+	batches int
+	// pairsCalls считает вызовы AssignedPairs.
+	pairsCalls int
+}
+
+func (f *fakeAssignments) Add(_ context.Context, asg *models.UserSegmentAssignment, meta models.ChangeMeta) error {
+	f.added = append(f.added, asg)
+	f.metas = append(f.metas, meta)
+	return nil
+}
+
+func (f *fakeAssignments) Delete(_ context.Context, _, _ uuid.UUID, meta models.ChangeMeta) error {
+	f.metas = append(f.metas, meta)
+	return nil
+}
+
+func (f *fakeAssignments) ApplyBatch(_ context.Context, _ uuid.UUID, add []*models.UserSegmentAssignment, remove []uuid.UUID, meta models.ChangeMeta) error {
+	f.batches++
+	f.added = append(f.added, add...)
+	f.removed = append(f.removed, remove...)
+	f.metas = append(f.metas, meta)
+	return nil
+}
+
+// ListSegmentsByUser отдаёт сегменты привязок из added по возрастанию segment_id, как SQL-запрос.
+func (f *fakeAssignments) ListSegmentsByUser(_ context.Context, userID, after uuid.UUID, limit int, includeInactive bool) ([]*models.UserSegment, error) {
+	var out []*models.UserSegment
+	for _, asg := range f.added {
+		seg := f.segs.segs[asg.SegmentID]
+		if asg.UserID != userID || compareIDs(asg.SegmentID, after) <= 0 || seg == nil {
+			continue
+		}
+		if includeInactive || seg.ActiveAt(time.Now()) {
+			out = append(out, &models.UserSegment{Segment: seg, AssignmentType: models.AssignmentManual, AssignedAt: &asg.AssignedAt})
+		}
+	}
+	slices.SortFunc(out, func(a, b *models.UserSegment) int { return compareIDs(a.Segment.ID, b.Segment.ID) })
+	return out[:min(limit, len(out))], nil
+}
+
+func TestAssignUserExpiry(t *testing.T) {
+	seg := testSegment("beta", models.SegmentTypeStatic, `{}`)
+	past := time.Now().Add(-time.Minute)
+	future := time.Now().Add(time.Hour)
+
+	tests := []struct {
+		name      string
+		expiresAt *time.Time
+		wantErr   error
+	}{
+		{"no expiry", nil, nil},
+		{"future", &future, nil},
+		{"past", &past, ErrInvalidExpiry},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &fakeAssignments{}
+			svc := NewUserSegmentService(newFakeSegments(seg), repo, nil, logging.Discard())
+			err := svc.AssignUser(context.Background(), seg.ID, uuid.New(), tt.expiresAt)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("AssignUser error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				if len(repo.added) != 0 {
+					t.Error("assignment stored despite the error")
+				}
+				return
+			}
+			if len(repo.added) != 1 || repo.added[0].ExpiresAt != tt.expiresAt {
+				t.Errorf("stored %+v, want one assignment expiring at %v", repo.added, tt.expiresAt)
+			}
+		})
+	}
+}
+
+func TestChangeMetaRecordsActor(t *testing.T) {
+	seg := testSegment("beta", models.SegmentTypeStatic, `{}`)
+	repo := &fakeAssignments{}
+	svc := NewUserSegmentService(newFakeSegments(seg), repo, nil, logging.Discard())
+	userID := uuid.New()
+
+	if err := svc.AssignUser(audit.WithActor(context.Background(), "alice"), seg.ID, userID, nil); err != nil {
+		t.Fatalf("AssignUser: %v", err)
+	}
+	if err := svc.UnassignUser(context.Background(), seg.ID, userID); err != nil {
+		t.Fatalf("UnassignUser: %v", err)
+	}
+	want := []models.ChangeMeta{
+		{Actor: "alice", Source: models.SourceManual},
+		{Actor: audit.AnonymousActor, Source: models.SourceManual},
+	}
+	if !slices.Equal(repo.metas, want) {
+		t.Errorf("history meta = %+v, want %+v", repo.metas, want)
+	}
+}
+
+func TestUpdateUserSegments(t *testing.T) {
+	beta := testSegment("beta", models.SegmentTypeStatic, `{}`)
+	promo := testSegment("promo", models.SegmentTypeStatic, `{}`)
+	off := testSegment("off", models.SegmentTypeStatic, `{}`)
+	off.IsActive = false
+	segs := newFakeSegments(beta, promo, off)
+
+	tests := []struct {
+		name        string
+		add, remove []string
+		wantErr     error
+		wantAdd     []uuid.UUID
+		wantRemove  []uuid.UUID
+	}{
+		{"by name and id", []string{"beta", beta.ID.String()}, []string{promo.ID.String()}, nil, []uuid.UUID{beta.ID}, []uuid.UUID{promo.ID}},
+		{"only remove", nil, []string{"promo"}, nil, nil, []uuid.UUID{promo.ID}},
+		{"unknown name", []string{"beta", "ghost"}, nil, ErrSegmentNotFound, nil, nil},
+		{"unknown id", nil, []string{uuid.NewString()}, ErrSegmentNotFound, nil, nil},
+		{"inactive", []string{"off"}, nil, ErrSegmentInactive, nil, nil},
+		{"add and remove", []string{"beta"}, []string{beta.ID.String()}, ErrConflictingChange, nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &fakeAssignments{}
+			svc := NewUserSegmentService(segs, repo, nil, logging.Discard())
+			err := svc.UpdateUserSegments(context.Background(), uuid.New(), tt.add, tt.remove)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("UpdateUserSegments error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				if repo.batches != 0 {
+					t.Error("batch applied despite the error")
+				}
+				return
+			}
+			var added []uuid.UUID
+			for _, asg := range repo.added {
+				added = append(added, asg.SegmentID)
+			}
+			if repo.batches != 1 || !slices.Equal(added, tt.wantAdd) || !slices.Equal(repo.removed, tt.wantRemove) {
+				t.Errorf("applied %d batches adding %v and removing %v, want one adding %v and removing %v",
+					repo.batches, added, repo.removed, tt.wantAdd, tt.wantRemove)
+			}
+		})
+	}
+}
+
+func TestListUserSegmentsPages(t *testing.T) {
+	userID := uuid.New()
+	segs := newFakeSegments()
+	repo := &fakeAssignments{segs: segs}
+	var want []uuid.UUID
+	types := make(map[uuid.UUID]models.AssignmentType)
+	add := func(seg *models.Segment, member models.AssignmentType) {
+		segs.segs[seg.ID] = seg
+		if member != "" {
+			want = append(want, seg.ID)
+			types[seg.ID] = member
+		}
+	}
+	for range 4 {
+		seg := testSegment("static", models.SegmentTypeStatic, `{}`)
+		add(seg, models.AssignmentManual)
+		repo.added = append(repo.added, &models.UserSegmentAssignment{SegmentID: seg.ID, UserID: userID})
+	}
+	add(testSegment("everyone", models.SegmentTypeDynamic, `{"percent": 100, "salt": "s"}`), models.AssignmentRollout)
+	add(testSegment("nobody", models.SegmentTypeDynamic, `{"percent": 0, "salt": "s"}`), "")
+	add(testSegment("by_rule", models.SegmentTypeDynamicRule, `{"rule": "user_id != null"}`), models.AssignmentRule)
+	add(testSegment("not_by_rule", models.SegmentTypeDynamicRule, `{"rule": "user_id == null"}`), "")
+	// Вычисляемый сегмент, к которому есть и явная привязка, выдаётся один раз —
+	// с данными явной привязки.
+	repo.added = append(repo.added, &models.UserSegmentAssignment{SegmentID: want[4], UserID: userID})
+	types[want[4]] = models.AssignmentManual
+	// Привязка к выключенному сегменту видна только с includeInactive.
+	off := testSegment("off", models.SegmentTypeStatic, `{}`)
+	off.IsActive = false
+	segs.segs[off.ID] = off
+	repo.added = append(repo.added, &models.UserSegmentAssignment{SegmentID: off.ID, UserID: userID})
+	wantInactive := append(slices.Clone(want), off.ID)
+	slices.SortFunc(want, compareIDs)
+	slices.SortFunc(wantInactive, compareIDs)
+
+	svc := NewUserSegmentService(segs, repo, nil, logging.Discard())
+	for _, includeInactive := range []bool{false, true} {
+		want := want
+		if includeInactive {
+			want = wantInactive
+		}
+		for _, limit := range []int{1, 2, 3, 100} {
+			var got []uuid.UUID
+			page := Page{Limit: limit}
+			for range len(want) + 1 {
+				segments, next, err := svc.ListUserSegments(context.Background(), userID, includeInactive, page)
+				if err != nil {
+					t.Fatalf("ListUserSegments: %v", err)
+				}
+				if len(segments) > limit {
+					t.Fatalf("page of %d segments, limit %d", len(segments), limit)
+				}
+				for _, us := range segments {
+					got = append(got, us.Segment.ID)
+					if wantType := types[us.Segment.ID]; us.Segment.ID != off.ID && us.AssignmentType != wantType {
+						t.Errorf("segment %s: assignment type %q, want %q", us.Segment.SegmentName, us.AssignmentType, wantType)
+					}
+				}
+				if next == "" {
+					break
+				}
+				page.Cursor = next
+			}
+			if !slices.Equal(got, want) {
+				t.Errorf("includeInactive %v, limit %d: pages = %v, want %v", includeInactive, limit, got, want)
+			}
+		}
+	}
+}
+
+func TestSetRolloutPercentSaltsLegacySegments(t *testing.T) {
+	ctx := context.Background()
+	users := make([]uuid.UUID, 1000)
+	for i := range users {
+		users[i] = uuid.New()
+	}
+	legacy := testSegment("legacy", models.SegmentTypeDynamic, `{"percent": 10}`)
+	salted := testSegment("salted", models.SegmentTypeDynamic, `{"percent": 10, "salt": "mine"}`)
+	segs := newFakeSegments(legacy, salted)
+	svc := NewUserSegmentService(segs, &fakeAssignments{}, nil, logging.Discard()).(*userSegmentService)
+
+	saltOf := func(seg *models.Segment) string {
+		cfg, err := rollout.ParseConfig(segs.segs[seg.ID].Config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cfg.Salt
+	}
+
+	// Результат считается относительно прежнего разбиения с пустой солью.
+	prev := &rollout.Config{Percent: 10}
+	res, err := svc.setRolloutPercent(ctx, legacy, users, 20)
+	if err != nil {
+		t.Fatalf("setRolloutPercent: %v", err)
+	}
+	salt := saltOf(legacy)
+	if salt == "" {
+		t.Fatal("legacy segment was saved without a salt")
+	}
+	next := &rollout.Config{Percent: 20, Salt: salt}
+	var assigned, skipped int
+	for _, id := range users {
+		if next.Contains(id) {
+			if prev.Contains(id) {
+				skipped++
+			} else {
+				assigned++
+			}
+		}
+	}
+	if res.Assigned != assigned || res.Skipped != skipped {
+		t.Errorf("result = %+v, want %d assigned and %d skipped", res, assigned, skipped)
+	}
+
+	// Сгенерированная соль дальше не меняется, заданная — не трогается.
+	if _, err := svc.setRolloutPercent(ctx, legacy, users, 30); err != nil {
+		t.Fatal(err)
+	}
+	if got := saltOf(legacy); got != salt {
+		t.Errorf("salt changed from %q to %q", salt, got)
+	}
+	if _, err := svc.setRolloutPercent(ctx, salted, users, 20); err != nil {
+		t.Fatal(err)
+	}
+	if got := saltOf(salted); got != "mine" {
+		t.Errorf("explicit salt = %q, want mine", got)
+	}
+}
@@ -0,0 +1,137 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/RaikyD/UserSegmentationService/internal/models"
+	"github.com/RaikyD/UserSegmentationService/internal/storage"
+	"github.com/google/uuid"
+)
+
+// UserService описывает работу с пользователями и их атрибутами.
+type UserService interface {
+	CreateUser(ctx context.Context, user *models.User) (*models.User, error)
+	GetUser(ctx context.Context, id uuid.UUID) (*models.User, error)
+	ListUsers(ctx context.Context, limit, offset int) ([]*models.User, error)
+	UpdateUser(ctx context.Context, user *models.User) (*models.User, error)
+	DeleteUser(ctx context.Context, id uuid.UUID) error
+	AttributeProvider
+}
+
+type userService struct {
+	repo storage.UserProfileRepository
+}
+
+func NewUserService(repo storage.UserProfileRepository) UserService {
+	return &userService{repo: repo}
+}
+
+func (s *userService) CreateUser(ctx context.Context, user *models.User) (*models.User, error) {
+	if user.ID == uuid.Nil {
+		user.ID = uuid.New()
+	}
+	if len(user.Attributes) == 0 {
+		user.Attributes = json.RawMessage("{}")
+	}
+	if err := validateAttributes(user.Attributes); err != nil {
+		return nil, err
+	}
+	if err := s.repo.Create(ctx, user); err != nil {
+		if errors.Is(err, storage.ErrAlreadyExists) {
+			return nil, ErrUserExists
+		}
+		return nil, err
+	}
+	return user, nil
+}
+
+func (s *userService) GetUser(ctx context.Context, id uuid.UUID) (*models.User, error) {
+	user, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+	return user, nil
+}
+
+func (s *userService) ListUsers(ctx context.Context, limit, offset int) ([]*models.User, error) {
+	return s.repo.List(ctx, limit, offset)
+}
+
+func (s *userService) UpdateUser(ctx context.Context, user *models.User) (*models.User, error) {
+	if err := validateAttributes(user.Attributes); err != nil {
+		return nil, err
+	}
+	existing, err := s.GetUser(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	user.CreatedAt = existing.CreatedAt
+	if err := s.repo.Update(ctx, user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (s *userService) DeleteUser(ctx context.Context, id uuid.UUID) error {
+	if _, err := s.GetUser(ctx, id); err != nil {
+		return err
+	}
+	return s.repo.Delete(ctx, id)
+}
+
+// GetAttributes отдаёт атрибуты пользователя для вычисления правил.
+// Помимо пользовательских атрибутов доступен created_at.
+// Для неизвестного пользователя возвращается пустой набор.
+func (s *userService) GetAttributes(ctx context.Context, id uuid.UUID) (map[string]any, error) {
+	user, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return map[string]any{}, nil
+	}
+	return ruleAttributes(user)
+}
+
+// GetManyAttributes загружает атрибуты пользователей ids одним запросом. В ответе
+// есть все ids; у неизвестных пользователей набор пустой, как в GetAttributes.
+func (s *userService) GetManyAttributes(ctx context.Context, ids []uuid.UUID) (map[uuid.UUID]map[string]any, error) {
+	users, err := s.repo.GetMany(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[uuid.UUID]map[string]any, len(ids))
+	for _, id := range ids {
+		out[id] = map[string]any{}
+	}
+	for _, user := range users {
+		if out[user.ID], err = ruleAttributes(user); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// ruleAttributes разбирает атрибуты пользователя и добавляет к ним created_at.
+func ruleAttributes(user *models.User) (map[string]any, error) {
+	attrs := map[string]any{}
+	if err := json.Unmarshal(user.Attributes, &attrs); err != nil {
+		return nil, fmt.Errorf("user %s: decode attributes: %w", user.ID, err)
+	}
+	attrs["created_at"] = user.CreatedAt
+	return attrs, nil
+}
+
+func validateAttributes(raw json.RawMessage) error {
+	var obj map[string]any
+	if err := json.Unmarshal(raw, &obj); err != nil || obj == nil {
+		return ErrInvalidUserAttributes
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/RaikyD/UserSegmentationService/internal/models"
+	"github.com/RaikyD/UserSegmentationService/internal/storage"
+)
+
+// fakeUsers — таблица users в памяти.
+type fakeUsers struct {
+	storage.UserProfileRepository
+	users map[uuid.UUID]*models.User
+}
+
+func newFakeUsers(users ...*models.User) *fakeUsers {
+	f := &fakeUsers{users: make(map[uuid.UUID]*models.User)}
+	for _, u := range users {
+		f.users[u.ID] = u
+	}
+	return f
+}
+
+func (f *fakeUsers) Create(_ context.Context, user *models.User) error {
+	if _, dup := f.users[user.ID]; dup {
+		return storage.ErrAlreadyExists
+	}
+	user.CreatedAt = time.Now()
+	user.UpdatedAt = user.CreatedAt
+	f.users[user.ID] = user
+	return nil
+}
+
+func (f *fakeUsers) GetByID(_ context.Context, id uuid.UUID) (*models.User, error) {
+	return f.users[id], nil
+}
+
+func (f *fakeUsers) GetMany(_ context.Context, ids []uuid.UUID) ([]*models.User, error) {
+	var out []*models.User
+	for _, id := range ids {
+		if user := f.users[id]; user != nil {
+			out = append(out, user)
+		}
+	}
+	return out, nil
+}
+
+func TestCreateUser(t *testing.T) {
+	svc := NewUserService(newFakeUsers())
+	ctx := context.Background()
+
+	created, err := svc.CreateUser(ctx, &models.User{})
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	if created.ID == uuid.Nil || string(created.Attributes) != "{}" {
+		t.Errorf("CreateUser defaults = %s %s, want a new id and {}", created.ID, created.Attributes)
+	}
+
+	if _, err := svc.CreateUser(ctx, &models.User{ID: created.ID}); !errors.Is(err, ErrUserExists) {
+		t.Errorf("CreateUser(duplicate) error = %v, want ErrUserExists", err)
+	}
+	if _, err := svc.GetUser(ctx, uuid.New()); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("GetUser(unknown) error = %v, want ErrUserNotFound", err)
+	}
+
+	for _, raw := range []string{`[]`, `"x"`, `null`, `{`} {
+		_, err := svc.CreateUser(ctx, &models.User{Attributes: json.RawMessage(raw)})
+		if !errors.Is(err, ErrInvalidUserAttributes) {
+			t.Errorf("CreateUser(%s) error = %v, want ErrInvalidUserAttributes", raw, err)
+		}
+	}
+}
+
+func TestGetAttributes(t *testing.T) {
+	created := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	user := &models.User{ID: uuid.New(), Attributes: json.RawMessage(`{"country": "RU", "created_at": "spoofed"}`), CreatedAt: created}
+	svc := NewUserService(newFakeUsers(user))
+
+	attrs, err := svc.GetAttributes(context.Background(), user.ID)
+	if err != nil {
+		t.Fatalf("GetAttributes: %v", err)
+	}
+	if attrs["country"] != "RU" || attrs["created_at"] != created {
+		t.Errorf("GetAttributes = %v, want country and the stored created_at", attrs)
+	}
+
+	attrs, err = svc.GetAttributes(context.Background(), uuid.New())
+	if err != nil || len(attrs) != 0 {
+		t.Errorf("GetAttributes(unknown) = %v, %v, want an empty set", attrs, err)
+	}
+
+	unknown := uuid.New()
+	many, err := svc.GetManyAttributes(context.Background(), []uuid.UUID{user.ID, unknown})
+	if err != nil {
+		t.Fatalf("GetManyAttributes: %v", err)
+	}
+	if len(many) != 2 || many[user.ID]["country"] != "RU" || many[user.ID]["created_at"] != created || len(many[unknown]) != 0 {
+		t.Errorf("GetManyAttributes = %v, want the user's attributes and an empty set for the unknown user", many)
+	}
+}
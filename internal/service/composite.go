@@ -0,0 +1,328 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/RaikyD/UserSegmentationService/internal/composite"
+	"github.com/RaikyD/UserSegmentationService/internal/models"
+	"github.com/RaikyD/UserSegmentationService/internal/rollout"
+	"github.com/RaikyD/UserSegmentationService/internal/storage"
+	"github.com/google/uuid"
+)
+
+// checkCompositeRefs проверяет, что все сегменты выражения существуют, что среди
+// них нет dynamic_rule и что выражение ни прямо, ни через другие composite-сегменты
+// не ссылается на seg. Правила вычисляются только в памяти, а участников composite
+// считает запрос к БД, поэтому правило внутри выражения дало бы разные ответы
+// у проверки членства и у списка участников.
+func checkCompositeRefs(ctx context.Context, repo storage.SegmentRepository, seg *models.Segment) error {
+	cfg, err := composite.ParseConfig(seg.Config)
+	if err != nil {
+		return ErrInvalidSegmentConfig.Withf("%v", err)
+	}
+	checked := make(map[uuid.UUID]bool)
+	var walk func(refs []uuid.UUID) error
+	walk = func(refs []uuid.UUID) error {
+		for _, id := range refs {
+			if seg.ID != uuid.Nil && id == seg.ID {
+				return ErrCompositeCycle.Withf("%s references itself", seg.SegmentName)
+			}
+			if checked[id] {
+				continue
+			}
+			checked[id] = true
+			ref, err := repo.GetByID(ctx, id)
+			if err != nil {
+				return err
+			}
+			if ref == nil {
+				return ErrInvalidSegmentConfig.Withf("segment %s does not exist", id)
+			}
+			if ref.Type == models.SegmentTypeDynamicRule {
+				return ErrCompositeRuleRef.Withf("%s", ref.SegmentName)
+			}
+			if ref.Type != models.SegmentTypeComposite {
+				continue
+			}
+			refCfg, err := composite.ParseConfig(ref.Config)
+			if err != nil {
+				return ErrInvalidSegmentConfig.Withf("segment %s: %v", ref.SegmentName, err)
+			}
+			if err := walk(refCfg.Refs()); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return walk(cfg.Refs())
+}
+
+// memberExpr описывает участников сегмента для запроса к БД. Для dynamic-сегмента
+// добавляются корзины раскатки, composite-сегмент разворачивается в выражение.
+func (u *userSegmentService) memberExpr(ctx context.Context, seg *models.Segment, now time.Time, visiting map[uuid.UUID]bool) (*storage.MemberExpr, error) {
+	switch seg.Type {
+	case models.SegmentTypeComposite:
+		if !seg.ActiveAt(now) {
+			return &storage.MemberExpr{Empty: true}, nil
+		}
+		// Циклы отсекаются при сохранении, но обход не должен зависнуть и на испорченных данных.
+		if visiting[seg.ID] {
+			return nil, ErrCompositeCycle.Withf("%s", seg.SegmentName)
+		}
+		visiting[seg.ID] = true
+		defer delete(visiting, seg.ID)
+
+		cfg, err := composite.ParseConfig(seg.Config)
+		if err != nil {
+			return nil, err
+		}
+		return u.nodeExpr(ctx, cfg.Expr, now, visiting)
+	case models.SegmentTypeDynamic:
+		if !seg.ActiveAt(now) {
+			return storage.SegmentMembers(seg.ID, nil), nil
+		}
+		cfg, err := rollout.ParseConfig(seg.Config)
+		if err != nil {
+			return nil, err
+		}
+		return storage.SegmentMembers(seg.ID, cfg), nil
+	default:
+		// dynamic_rule в выражение не допускается (checkCompositeRefs); если он
+		// остался в старых данных, учитываются только явные привязки.
+		return storage.SegmentMembers(seg.ID, nil), nil
+	}
+}
+
+// nodeExpr переводит узел выражения composite-сегмента. Удалённые и неактивные
+// сегменты внутри выражения участников не дают.
+func (u *userSegmentService) nodeExpr(ctx context.Context, n *composite.Node, now time.Time, visiting map[uuid.UUID]bool) (*storage.MemberExpr, error) {
+	if n.Segment != nil {
+		seg, err := u.segRepo.GetByID(ctx, *n.Segment)
+		if err != nil {
+			return nil, err
+		}
+		if seg == nil || !seg.ActiveAt(now) {
+			return &storage.MemberExpr{Empty: true}, nil
+		}
+		return u.memberExpr(ctx, seg, now, visiting)
+	}
+	expr := &storage.MemberExpr{Op: n.Op, Args: make([]*storage.MemberExpr, 0, len(n.Args))}
+	for _, arg := range n.Args {
+		argExpr, err := u.nodeExpr(ctx, arg, now, visiting)
+		if err != nil {
+			return nil, err
+		}
+		expr.Args = append(expr.Args, argExpr)
+	}
+	return expr, nil
+}
+
+// matchComposites возвращает активные composite-сегменты, в которые входит пользователь.
+// Сегменты выражений загружаются одним запросом, привязки к их листам — ещё одним.
+func (u *userSegmentService) matchComposites(ctx context.Context, userID uuid.UUID) ([]*models.Segment, error) {
+	composites, err := u.segRepo.ListActiveByType(ctx, models.SegmentTypeComposite)
+	if err != nil || len(composites) == 0 {
+		return nil, err
+	}
+	g, err := u.loadCompositeGraph(ctx, composites)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	var assigned []uuid.UUID
+	if leaves := g.leaves(segmentIDs(composites), now); len(leaves) > 0 {
+		if assigned, err = u.usRepo.AssignedSegmentIDs(ctx, userID, leaves); err != nil {
+			return nil, err
+		}
+	}
+
+	eval := g.newEval(userID, assigned, now)
+	var matched []*models.Segment
+	for _, seg := range composites {
+		if eval.isMember(seg.ID) {
+			matched = append(matched, seg)
+		}
+	}
+	return matched, nil
+}
+
+// checkComposites вычисляет членство в composite-сегментах для пар results[i], i из idx,
+// всех сразу: один запрос загружает сегменты выражений, второй проверяет привязки
+// каждого пользователя к листам его выражений.
+func (u *userSegmentService) checkComposites(ctx context.Context, results []*models.Membership, idx []int, now time.Time) error {
+	roots := make([]*models.Segment, 0, len(idx))
+	byUser := make(map[uuid.UUID][]uuid.UUID)
+	seen := make(map[uuid.UUID]bool)
+	for _, i := range idx {
+		seg := results[i].Segment
+		if !seen[seg.ID] {
+			seen[seg.ID] = true
+			roots = append(roots, seg)
+		}
+		byUser[results[i].UserID] = append(byUser[results[i].UserID], seg.ID)
+	}
+	g, err := u.loadCompositeGraph(ctx, roots)
+	if err != nil {
+		return err
+	}
+
+	var pairUsers, pairSegments []uuid.UUID
+	for userID, ids := range byUser {
+		for _, leaf := range g.leaves(ids, now) {
+			pairUsers = append(pairUsers, userID)
+			pairSegments = append(pairSegments, leaf)
+		}
+	}
+	var assigned map[uuid.UUID][]uuid.UUID
+	if len(pairUsers) > 0 {
+		if assigned, err = u.usRepo.AssignedPairs(ctx, pairUsers, pairSegments); err != nil {
+			return err
+		}
+	}
+
+	evals := make(map[uuid.UUID]*compositeEval, len(byUser))
+	for _, i := range idx {
+		res := results[i]
+		eval, ok := evals[res.UserID]
+		if !ok {
+			eval = g.newEval(res.UserID, assigned[res.UserID], now)
+			evals[res.UserID] = eval
+		}
+		if eval.isMember(res.Segment.ID) {
+			res.Member, res.AssignmentType = true, models.AssignmentComposite
+		}
+	}
+	return nil
+}
+
+func segmentIDs(segs []*models.Segment) []uuid.UUID {
+	ids := make([]uuid.UUID, len(segs))
+	for i, seg := range segs {
+		ids[i] = seg.ID
+	}
+	return ids
+}
+
+// compositeGraph — composite-сегменты и все сегменты их выражений.
+type compositeGraph struct {
+	segs    map[uuid.UUID]*models.Segment // nil — сегмент удалён
+	configs map[uuid.UUID]*composite.Config
+}
+
+// loadCompositeGraph загружает выражения roots вместе со всем, на что они
+// ссылаются, одним запросом к хранилищу.
+func (u *userSegmentService) loadCompositeGraph(ctx context.Context, roots []*models.Segment) (*compositeGraph, error) {
+	g := &compositeGraph{
+		segs:    make(map[uuid.UUID]*models.Segment),
+		configs: make(map[uuid.UUID]*composite.Config),
+	}
+	refs, err := u.segRepo.ListReferenced(ctx, segmentIDs(roots))
+	if err != nil {
+		return nil, err
+	}
+	for _, seg := range append(refs, roots...) {
+		g.segs[seg.ID] = seg
+		if seg.Type != models.SegmentTypeComposite {
+			continue
+		}
+		cfg, err := composite.ParseConfig(seg.Config)
+		if err != nil {
+			u.log.WarnContext(ctx, "skip segment with invalid composite config", "segment_id", seg.ID, "error", err)
+			continue
+		}
+		g.configs[seg.ID] = cfg
+	}
+	for _, cfg := range g.configs {
+		for _, id := range cfg.Refs() {
+			if _, ok := g.segs[id]; !ok {
+				g.segs[id] = nil
+			}
+		}
+	}
+	return g, nil
+}
+
+// leaves возвращает активные некомпозитные сегменты, до которых дотягиваются
+// выражения roots.
+func (g *compositeGraph) leaves(roots []uuid.UUID, now time.Time) []uuid.UUID {
+	var out []uuid.UUID
+	visited := make(map[uuid.UUID]bool)
+	var walk func(id uuid.UUID)
+	walk = func(id uuid.UUID) {
+		if visited[id] {
+			return
+		}
+		visited[id] = true
+		seg := g.segs[id]
+		if seg == nil || !seg.ActiveAt(now) {
+			return
+		}
+		if seg.Type != models.SegmentTypeComposite {
+			out = append(out, id)
+			return
+		}
+		if cfg, ok := g.configs[id]; ok {
+			for _, ref := range cfg.Refs() {
+				walk(ref)
+			}
+		}
+	}
+	for _, id := range roots {
+		walk(id)
+	}
+	return out
+}
+
+// newEval готовит вычисление членства пользователя. assigned — листья, к которым
+// у него есть явная привязка; корзины dynamic-листов считаются по их конфигу.
+// dynamic_rule-лист, оставшийся в выражении с тех пор, как это разрешалось, даёт
+// только явные привязки — как и в memberExpr.
+func (g *compositeGraph) newEval(userID uuid.UUID, assigned []uuid.UUID, now time.Time) *compositeEval {
+	e := &compositeEval{
+		graph:  g,
+		now:    now,
+		member: make(map[uuid.UUID]bool, len(assigned)),
+		done:   make(map[uuid.UUID]bool),
+	}
+	for _, id := range assigned {
+		e.member[id] = true
+	}
+	for id, seg := range g.segs {
+		if seg == nil || seg.Type != models.SegmentTypeDynamic || e.member[id] {
+			continue
+		}
+		// Некорректный конфиг раскатки ни под кого не подходит.
+		if cfg, err := rollout.ParseConfig(seg.Config); err == nil && cfg.Contains(userID) {
+			e.member[id] = true
+		}
+	}
+	return e
+}
+
+// compositeEval вычисляет членство одного пользователя в composite-сегментах графа.
+type compositeEval struct {
+	graph  *compositeGraph
+	now    time.Time
+	member map[uuid.UUID]bool
+	done   map[uuid.UUID]bool
+}
+
+// isMember сообщает, входит ли пользователь в сегмент id.
+func (e *compositeEval) isMember(id uuid.UUID) bool {
+	seg := e.graph.segs[id]
+	if seg == nil || !seg.ActiveAt(e.now) {
+		return false
+	}
+	if seg.Type != models.SegmentTypeComposite || e.done[id] {
+		return e.member[id]
+	}
+	// До вычисления считаем сегмент пустым — так испорченный цикл не зациклит обход.
+	e.done[id] = true
+	cfg, ok := e.graph.configs[id]
+	if !ok {
+		return false
+	}
+	e.member[id] = cfg.Expr.Eval(e.isMember)
+	return e.member[id]
+}
@@ -0,0 +1,238 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/RaikyD/UserSegmentationService/internal/composite"
+	"github.com/RaikyD/UserSegmentationService/internal/logging"
+	"github.com/RaikyD/UserSegmentationService/internal/models"
+	"github.com/RaikyD/UserSegmentationService/internal/storage"
+)
+
+// AssignedSegmentIDs отбирает сегменты из явных привязок, сохранённых через Add.
+func (f *fakeAssignments) AssignedSegmentIDs(_ context.Context, userID uuid.UUID, segmentIDs []uuid.UUID) ([]uuid.UUID, error) {
+	var ids []uuid.UUID
+	for _, asg := range f.added {
+		if asg.UserID == userID && slices.Contains(segmentIDs, asg.SegmentID) {
+			ids = append(ids, asg.SegmentID)
+		}
+	}
+	return ids, nil
+}
+
+// ListReferencing отбирает composite-сегменты, в выражении которых встречается ID.
+func (f *fakeSegments) ListReferencing(_ context.Context, segmentID uuid.UUID) ([]*models.Segment, error) {
+	var out []*models.Segment
+	for _, seg := range f.segs {
+		if seg.Type == models.SegmentTypeComposite && strings.Contains(string(seg.Config), segmentID.String()) {
+			out = append(out, seg)
+		}
+	}
+	return out, nil
+}
+
+// ListReferenced обходит выражения сегментов ids так же, как рекурсивный запрос SegmentDB.
+func (f *fakeSegments) ListReferenced(_ context.Context, ids []uuid.UUID) ([]*models.Segment, error) {
+	f.referencedCalls++
+	seen := make(map[uuid.UUID]bool)
+	var out []*models.Segment
+	var walk func(id uuid.UUID)
+	walk = func(id uuid.UUID) {
+		seg := f.segs[id]
+		if seg == nil || seg.Type != models.SegmentTypeComposite {
+			return
+		}
+		cfg, err := composite.ParseConfig(seg.Config)
+		if err != nil {
+			return
+		}
+		for _, ref := range cfg.Refs() {
+			if seen[ref] || f.segs[ref] == nil {
+				continue
+			}
+			seen[ref] = true
+			out = append(out, f.segs[ref])
+			walk(ref)
+		}
+	}
+	for _, id := range ids {
+		walk(id)
+	}
+	return out, nil
+}
+
+// AssignedPairs отбирает явные привязки для пар (userIDs[i], segmentIDs[i]).
+func (f *fakeAssignments) AssignedPairs(_ context.Context, userIDs, segmentIDs []uuid.UUID) (map[uuid.UUID][]uuid.UUID, error) {
+	f.pairsCalls++
+	out := make(map[uuid.UUID][]uuid.UUID)
+	for i := range userIDs {
+		for _, asg := range f.added {
+			if asg.UserID == userIDs[i] && asg.SegmentID == segmentIDs[i] {
+				out[asg.UserID] = append(out[asg.UserID], asg.SegmentID)
+			}
+		}
+	}
+	return out, nil
+}
+
+func (f *fakeSegments) Update(_ context.Context, seg *models.Segment) error {
+	f.segs[seg.ID] = seg
+	return nil
+}
+
+func compositeOf(name, op string, refs ...*models.Segment) *models.Segment {
+	args := make([]string, len(refs))
+	for i, ref := range refs {
+		args[i] = fmt.Sprintf(`{"segment": %q}`, ref.ID)
+	}
+	return testSegment(name, models.SegmentTypeComposite,
+		fmt.Sprintf(`{"expr": {"op": %q, "args": [%s]}}`, op, strings.Join(args, ", ")))
+}
+
+func TestCheckCompositeRefs(t *testing.T) {
+	static := testSegment("static", models.SegmentTypeStatic, `{}`)
+	dynamic := testSegment("dynamic", models.SegmentTypeDynamic, `{"percent": 10, "salt": "s"}`)
+	inner := compositeOf("inner", "union", static, dynamic)
+	rule := testSegment("rule", models.SegmentTypeDynamicRule, `{"rule": "age >= 18"}`)
+	// withRule остался от времени, когда правила в выражениях допускались.
+	withRule := compositeOf("with_rule", "union", static, rule)
+	repo := newFakeSegments(static, dynamic, inner, rule, withRule)
+
+	tests := []struct {
+		name    string
+		seg     *models.Segment
+		wantErr error
+	}{
+		{"static and dynamic", compositeOf("ok", "intersect", static, dynamic), nil},
+		{"nested composite", compositeOf("nested", "difference", inner, static), nil},
+		{"missing segment", compositeOf("missing", "union", static, testSegment("gone", models.SegmentTypeStatic, `{}`)), ErrInvalidSegmentConfig},
+		{"dynamic_rule", compositeOf("rule_ref", "union", static, rule), ErrCompositeRuleRef},
+		{"dynamic_rule through composite", compositeOf("rule_nested", "intersect", withRule, static), ErrCompositeRuleRef},
+		{"invalid expression", testSegment("bad", models.SegmentTypeComposite, `{"expr": {"op": "xor"}}`), ErrInvalidSegmentConfig},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkCompositeRefs(context.Background(), repo, tt.seg)
+			if tt.wantErr == nil {
+				if err != nil {
+					t.Fatalf("checkCompositeRefs: %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, tt.wantErr) || !errors.Is(err, ErrValidation) {
+				t.Errorf("checkCompositeRefs error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	// Сохраняемый сегмент не может попасть в собственное выражение, в том числе
+	// через другой composite.
+	self := testSegment("self", models.SegmentTypeComposite, `{}`)
+	outer := compositeOf("outer", "union", self, static)
+	repo.segs[outer.ID] = outer
+	self.Config = compositeOf("self", "union", outer, dynamic).Config
+	if err := checkCompositeRefs(context.Background(), repo, self); !errors.Is(err, ErrCompositeCycle) {
+		t.Errorf("cycle: checkCompositeRefs error = %v, want ErrCompositeCycle", err)
+	}
+}
+
+func TestUpdateSegmentToRuleInComposite(t *testing.T) {
+	static := testSegment("static", models.SegmentTypeStatic, `{}`)
+	free := testSegment("free", models.SegmentTypeStatic, `{}`)
+	segs := newFakeSegments(static, free, compositeOf("uses_static", "union", static))
+	svc := NewSegmentService(segs)
+
+	toRule := func(seg *models.Segment) *models.Segment {
+		cp := *seg
+		cp.Type = models.SegmentTypeDynamicRule
+		cp.Config = []byte(`{"rule": "age >= 18"}`)
+		return &cp
+	}
+	if _, err := svc.UpdateSegment(context.Background(), toRule(static)); !errors.Is(err, ErrCompositeRuleRef) {
+		t.Errorf("referenced segment: UpdateSegment error = %v, want ErrCompositeRuleRef", err)
+	}
+	if segs.segs[static.ID].Type != models.SegmentTypeStatic {
+		t.Error("rejected update was saved")
+	}
+	if _, err := svc.UpdateSegment(context.Background(), toRule(free)); err != nil {
+		t.Errorf("unreferenced segment: UpdateSegment: %v", err)
+	}
+}
+
+// racingSegments отвечает на запись ошибкой err, как репозиторий, в котором
+// ссылки изменили параллельно с проверкой сервиса.
+type racingSegments struct {
+	*fakeSegments
+	err error
+}
+
+func (r *racingSegments) Create(context.Context, *models.Segment) error { return r.err }
+func (r *racingSegments) Update(context.Context, *models.Segment) error { return r.err }
+func (r *racingSegments) Delete(context.Context, uuid.UUID) error       { return r.err }
+
+func TestSegmentRefRaces(t *testing.T) {
+	static := testSegment("static", models.SegmentTypeStatic, `{}`)
+	other := testSegment("other", models.SegmentTypeStatic, `{}`)
+	union := compositeOf("union", "union", static, other)
+	ctx := context.Background()
+	newService := func(err error) SegmentService {
+		return NewSegmentService(&racingSegments{newFakeSegments(static, other, union), err})
+	}
+
+	if err := newService(storage.ErrReferenced).DeleteSegment(ctx, static.ID); !errors.Is(err, ErrSegmentReferenced) {
+		t.Errorf("DeleteSegment error = %v, want ErrSegmentReferenced", err)
+	}
+	if _, err := newService(storage.ErrMissingReference).CreateSegment(ctx, compositeOf("fresh", "union", static, other)); !errors.Is(err, ErrInvalidSegmentConfig) || !strings.Contains(err.Error(), "was deleted") {
+		t.Errorf("CreateSegment error = %v, want ErrInvalidSegmentConfig about a deleted segment", err)
+	}
+	if _, err := newService(storage.ErrReferenceCycle).UpdateSegment(ctx, union); !errors.Is(err, ErrCompositeCycle) {
+		t.Errorf("UpdateSegment error = %v, want ErrCompositeCycle", err)
+	}
+	toRule := *static
+	toRule.Type = models.SegmentTypeDynamicRule
+	toRule.Config = []byte(`{"rule": "age >= 18"}`)
+	// Composite, ссылающийся на static, появился после проверки сервиса.
+	if _, err := NewSegmentService(&racingSegments{newFakeSegments(static), storage.ErrRuleReference}).UpdateSegment(ctx, &toRule); !errors.Is(err, ErrCompositeRuleRef) {
+		t.Errorf("UpdateSegment to dynamic_rule error = %v, want ErrCompositeRuleRef", err)
+	}
+}
+
+func TestMatchComposites(t *testing.T) {
+	userID := uuid.New()
+	a := testSegment("a", models.SegmentTypeStatic, `{}`)
+	b := testSegment("b", models.SegmentTypeStatic, `{}`)
+	off := testSegment("off", models.SegmentTypeStatic, `{}`)
+	off.IsActive = false
+	dynamic := testSegment("dynamic", models.SegmentTypeDynamic, `{"percent": 100, "salt": "s"}`)
+
+	both := compositeOf("both", "intersect", a, b)
+	either := compositeOf("either", "union", a, b)
+	onlyA := compositeOf("only_a", "difference", a, b)
+	withOff := compositeOf("with_off", "union", off)
+	nested := compositeOf("nested", "intersect", onlyA, dynamic)
+	segs := newFakeSegments(a, b, off, dynamic, both, either, onlyA, withOff, nested)
+
+	repo := &fakeAssignments{added: []*models.UserSegmentAssignment{
+		{UserID: userID, SegmentID: a.ID},
+		{UserID: userID, SegmentID: off.ID},
+		{UserID: uuid.New(), SegmentID: b.ID},
+	}}
+	svc := NewUserSegmentService(segs, repo, nil, logging.Discard()).(*userSegmentService)
+
+	matched, err := svc.matchComposites(context.Background(), userID)
+	if err != nil {
+		t.Fatalf("matchComposites: %v", err)
+	}
+	got := namesOf(matched)
+	slices.Sort(got)
+	if want := []string{"either", "nested", "only_a"}; !slices.Equal(got, want) {
+		t.Errorf("matched = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,72 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Категории ошибок сервиса. Каждая конкретная ошибка относится к одной из них,
+// поэтому транспортный слой проверяет категорию через errors.Is и не зависит
+// ни от конкретных ошибок, ни от драйвера БД.
+var (
+	ErrNotFound      = errors.New("not found")
+	ErrAlreadyExists = errors.New("already exists")
+	ErrValidation    = errors.New("validation failed")
+	ErrConflict      = errors.New("conflict")
+	ErrInactive      = errors.New("inactive")
+)
+
+// Error — ошибка сервиса с текстом для клиента и категорией.
+type Error struct {
+	kind   error
+	msg    string
+	parent *Error
+}
+
+// NewError создаёт ошибку категории kind.
+func NewError(kind error, msg string) *Error {
+	return &Error{kind: kind, msg: msg}
+}
+
+func (e *Error) Error() string { return e.msg }
+
+// Unwrap позволяет проверять и категорию (errors.Is(err, ErrNotFound)),
+// и конкретную ошибку, от которой получена уточнённая через Withf.
+func (e *Error) Unwrap() []error {
+	if e.parent != nil {
+		return []error{e.kind, e.parent}
+	}
+	return []error{e.kind}
+}
+
+// Withf возвращает ту же ошибку с уточнением, например с именем сегмента.
+func (e *Error) Withf(format string, args ...any) *Error {
+	return &Error{kind: e.kind, msg: e.msg + ": " + fmt.Sprintf(format, args...), parent: e}
+}
+
+var (
+	ErrSegmentNotFound   = NewError(ErrNotFound, "segment not found")
+	ErrSegmentExists     = NewError(ErrAlreadyExists, "segment with this name already exists")
+	ErrSegmentInactive   = NewError(ErrInactive, "segment is inactive")
+	ErrUserNotFound      = NewError(ErrNotFound, "user not found")
+	ErrUserExists        = NewError(ErrAlreadyExists, "user already exists")
+	ErrReportNotFound    = NewError(ErrNotFound, "report not found")
+	ErrReportNotReady    = NewError(ErrConflict, "report is not ready")
+	ErrReportFileMissing = NewError(ErrNotFound, "report file is no longer available")
+	ErrImportNotFound    = NewError(ErrNotFound, "import not found")
+	ErrSegmentReferenced = NewError(ErrConflict, "segment is referenced by composite segments")
+
+	ErrInvalidSegmentConfig  = NewError(ErrValidation, "invalid segment config")
+	ErrInvalidSegmentName    = NewError(ErrValidation, "segment name must start with a letter, contain only letters, digits and underscores (max 128) and not be a UUID")
+	ErrInvalidValidityWindow = NewError(ErrValidation, "valid_from must be before valid_to")
+	ErrInvalidUserAttributes = NewError(ErrValidation, "user attributes must be a JSON object")
+	ErrInvalidExpiry         = NewError(ErrValidation, "expires_at must be in the future")
+	ErrConflictingChange     = NewError(ErrValidation, "segment is both added and removed")
+	ErrInvalidCursor         = NewError(ErrValidation, "invalid cursor")
+	ErrInvalidImportMode     = NewError(ErrValidation, "mode must be append or replace")
+	ErrInvalidImportFormat   = NewError(ErrValidation, "format must be csv or ndjson")
+	ErrImportSegmentType     = NewError(ErrValidation, "only static segments can be imported")
+	ErrCompositeCycle        = NewError(ErrValidation, "composite segment expression contains a cycle")
+	ErrCompositeAssignment   = NewError(ErrValidation, "composite segment membership is computed and cannot be assigned")
+	ErrCompositeRuleRef      = NewError(ErrValidation, "composite segments cannot reference dynamic_rule segments")
+)
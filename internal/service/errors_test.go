@@ -0,0 +1,45 @@
+package service
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestErrorCategories(t *testing.T) {
+	tests := []struct {
+		err  error
+		kind error
+	}{
+		{ErrSegmentNotFound, ErrNotFound},
+		{ErrSegmentExists, ErrAlreadyExists},
+		{ErrSegmentInactive, ErrInactive},
+		{ErrReportNotReady, ErrConflict},
+		{ErrInvalidSegmentConfig, ErrValidation},
+		{ErrConflictingChange, ErrValidation},
+	}
+	for _, tt := range tests {
+		t.Run(tt.err.Error(), func(t *testing.T) {
+			if !errors.Is(tt.err, tt.kind) {
+				t.Errorf("%v is not %v", tt.err, tt.kind)
+			}
+			for _, other := range []error{ErrNotFound, ErrAlreadyExists, ErrValidation, ErrConflict, ErrInactive} {
+				if other != tt.kind && errors.Is(tt.err, other) {
+					t.Errorf("%v is also %v", tt.err, other)
+				}
+			}
+		})
+	}
+}
+
+func TestErrorWithf(t *testing.T) {
+	err := ErrSegmentNotFound.Withf("%s", "beta").Withf("while resolving")
+	if got, want := err.Error(), "segment not found: beta: while resolving"; got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+	if !errors.Is(err, ErrSegmentNotFound) || !errors.Is(err, ErrNotFound) {
+		t.Errorf("%v lost its identity or category", err)
+	}
+	if errors.Is(err, ErrUserNotFound) {
+		t.Errorf("%v matches an unrelated error of the same category", err)
+	}
+}
@@ -0,0 +1,99 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/RaikyD/UserSegmentationService/internal/models"
+	"github.com/RaikyD/UserSegmentationService/internal/rollout"
+	"github.com/google/uuid"
+)
+
+func (u *userSegmentService) CheckUserSegments(ctx context.Context, userID uuid.UUID, refs []string) ([]*models.Membership, error) {
+	checks := make([]models.MembershipCheck, len(refs))
+	for i, ref := range refs {
+		checks[i] = models.MembershipCheck{UserID: userID, Segment: ref}
+	}
+	return u.CheckMembership(ctx, checks)
+}
+
+// CheckMembership проверяет пары одним запросом к БД: он находит сегменты и явные
+// привязки. Корзины dynamic-сегментов считаются в памяти. Для dynamic_rule атрибуты
+// всех нужных пользователей загружаются одним запросом (checkRules), а
+// composite-сегменты всех пар вычисляются вместе ещё двумя (checkComposites),
+// сколько бы пар и пользователей ни было.
+func (u *userSegmentService) CheckMembership(ctx context.Context, checks []models.MembershipCheck) ([]*models.Membership, error) {
+	rows, err := u.usRepo.CheckMembership(ctx, checks)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	out := make([]*models.Membership, len(checks))
+	var ruleChecks, composites []int
+	for i, row := range rows {
+		check := checks[i]
+		if row.Segment == nil {
+			return nil, ErrSegmentNotFound.Withf("%s", check.Segment)
+		}
+		res := &models.Membership{UserID: check.UserID, Segment: row.Segment}
+		out[i] = res
+		if !row.Segment.ActiveAt(now) {
+			continue
+		}
+		if row.AssignmentType != "" {
+			res.Member, res.AssignmentType = true, row.AssignmentType
+			continue
+		}
+		switch row.Segment.Type {
+		case models.SegmentTypeDynamic:
+			cfg, err := rollout.ParseConfig(row.Segment.Config)
+			if err != nil {
+				u.log.WarnContext(ctx, "skip segment with invalid rollout config", "segment_id", row.Segment.ID, "error", err)
+				continue
+			}
+			if cfg.Contains(check.UserID) {
+				res.Member, res.AssignmentType = true, models.AssignmentRollout
+			}
+		case models.SegmentTypeDynamicRule:
+			ruleChecks = append(ruleChecks, i)
+		case models.SegmentTypeComposite:
+			composites = append(composites, i)
+		}
+	}
+	if len(ruleChecks) > 0 {
+		if err := u.checkRules(ctx, out, ruleChecks); err != nil {
+			return nil, err
+		}
+	}
+	if len(composites) > 0 {
+		if err := u.checkComposites(ctx, out, composites, now); err != nil {
+			return nil, err
+		}
+	}
+	u.hotLog.DebugContext(ctx, "membership checked", "pairs", len(checks), "rule_pairs", len(ruleChecks))
+	return out, nil
+}
+
+// checkRules проверяет правила dynamic_rule для пар out[idx]. Атрибуты каждого
+// пользователя загружаются один раз, все вместе.
+func (u *userSegmentService) checkRules(ctx context.Context, out []*models.Membership, idx []int) error {
+	var userIDs []uuid.UUID
+	seen := make(map[uuid.UUID]bool)
+	for _, i := range idx {
+		if id := out[i].UserID; !seen[id] {
+			seen[id] = true
+			userIDs = append(userIDs, id)
+		}
+	}
+	attrs, err := u.usersAttributes(ctx, userIDs)
+	if err != nil {
+		return err
+	}
+	for _, i := range idx {
+		res := out[i]
+		if u.matchRule(ctx, res.Segment, attrs[res.UserID]) {
+			res.Member, res.AssignmentType = true, models.AssignmentRule
+		}
+	}
+	return nil
+}
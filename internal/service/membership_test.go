@@ -0,0 +1,142 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/RaikyD/UserSegmentationService/internal/logging"
+	"github.com/RaikyD/UserSegmentationService/internal/models"
+)
+
+// fakeMembershipRepo отвечает на CheckMembership так же, как запрос в БД:
+// находит сегмент по ID или имени и действующую явную привязку.
+type fakeMembershipRepo struct {
+	*fakeAssignments
+	segs *fakeSegments
+}
+
+func (f *fakeMembershipRepo) CheckMembership(ctx context.Context, checks []models.MembershipCheck) ([]*models.MembershipRow, error) {
+	rows := make([]*models.MembershipRow, len(checks))
+	for i, check := range checks {
+		row := &models.MembershipRow{}
+		if id, err := uuid.Parse(check.Segment); err == nil {
+			row.Segment, _ = f.segs.GetByID(ctx, id)
+		} else {
+			row.Segment, _ = f.segs.GetByName(ctx, check.Segment)
+		}
+		if row.Segment != nil {
+			for _, asg := range f.added {
+				if asg.UserID == check.UserID && asg.SegmentID == row.Segment.ID {
+					row.AssignmentType = models.AssignmentManual
+				}
+			}
+		}
+		rows[i] = row
+	}
+	return rows, nil
+}
+
+// countingAttrs отдаёт атрибуты из attrs, считает обращения по пользователям
+// и пакетные загрузки.
+type countingAttrs struct {
+	attrs   map[uuid.UUID]map[string]any
+	calls   map[uuid.UUID]int
+	batches int
+}
+
+func (c *countingAttrs) GetAttributes(_ context.Context, userID uuid.UUID) (map[string]any, error) {
+	c.calls[userID]++
+	attrs := map[string]any{}
+	for k, v := range c.attrs[userID] {
+		attrs[k] = v
+	}
+	return attrs, nil
+}
+
+func (c *countingAttrs) GetManyAttributes(ctx context.Context, userIDs []uuid.UUID) (map[uuid.UUID]map[string]any, error) {
+	c.batches++
+	out := make(map[uuid.UUID]map[string]any, len(userIDs))
+	for _, id := range userIDs {
+		out[id], _ = c.GetAttributes(ctx, id)
+	}
+	return out, nil
+}
+
+func TestCheckMembership(t *testing.T) {
+	ru, us := uuid.New(), uuid.New()
+	static := testSegment("static", models.SegmentTypeStatic, `{}`)
+	off := testSegment("off", models.SegmentTypeStatic, `{}`)
+	off.IsActive = false
+	all := testSegment("all", models.SegmentTypeDynamic, `{"percent": 100, "salt": "s"}`)
+	none := testSegment("none", models.SegmentTypeDynamic, `{"percent": 0, "salt": "s"}`)
+	russia := testSegment("russia", models.SegmentTypeDynamicRule, `{"rule": "country == \"RU\""}`)
+	adult := testSegment("adult", models.SegmentTypeDynamicRule, `{"rule": "age >= 18"}`)
+	both := compositeOf("both", "intersect", static, all)
+	notStatic := compositeOf("not_static", "difference", all, static)
+	nested := compositeOf("nested", "union", both, none)
+	segs := newFakeSegments(static, off, all, none, russia, adult, both, notStatic, nested)
+
+	repo := &fakeMembershipRepo{segs: segs, fakeAssignments: &fakeAssignments{added: []*models.UserSegmentAssignment{
+		{UserID: ru, SegmentID: static.ID},
+		{UserID: ru, SegmentID: off.ID},
+	}}}
+	attrs := &countingAttrs{
+		attrs: map[uuid.UUID]map[string]any{
+			ru: {"country": "RU", "age": float64(30)},
+			us: {"country": "US", "age": float64(16)},
+		},
+		calls: map[uuid.UUID]int{},
+	}
+	svc := NewUserSegmentService(segs, repo, attrs, logging.Discard())
+
+	checks := []struct {
+		user    uuid.UUID
+		segment string
+		want    models.AssignmentType
+	}{
+		{ru, "static", models.AssignmentManual},
+		{us, static.ID.String(), ""},
+		{ru, "off", ""},
+		{us, "all", models.AssignmentRollout},
+		{us, "none", ""},
+		{ru, "russia", models.AssignmentRule},
+		{ru, "adult", models.AssignmentRule},
+		{us, "russia", ""},
+		{us, "adult", ""},
+		{ru, "both", models.AssignmentComposite},
+		{us, "both", ""},
+		{ru, "not_static", ""},
+		{us, "not_static", models.AssignmentComposite},
+		{ru, "nested", models.AssignmentComposite},
+		{us, "nested", ""},
+	}
+	req := make([]models.MembershipCheck, len(checks))
+	for i, c := range checks {
+		req[i] = models.MembershipCheck{UserID: c.user, Segment: c.segment}
+	}
+	got, err := svc.CheckMembership(context.Background(), req)
+	if err != nil {
+		t.Fatalf("CheckMembership: %v", err)
+	}
+	for i, c := range checks {
+		if got[i].AssignmentType != c.want || got[i].Member != (c.want != "") || got[i].UserID != c.user {
+			t.Errorf("check %d (%s): got %+v, want %q", i, c.segment, got[i], c.want)
+		}
+	}
+	// Атрибуты всех пользователей загружаются одним запросом, сколько бы правил ни проверялось.
+	if attrs.batches != 1 || attrs.calls[ru] != 1 || attrs.calls[us] != 1 {
+		t.Errorf("GetManyAttributes calls = %d, users loaded = %v, want one batch with each user once", attrs.batches, attrs.calls)
+	}
+	// Все composite-пары вычисляются вместе: один обход выражений и один запрос привязок.
+	if segs.referencedCalls != 1 || repo.pairsCalls != 1 {
+		t.Errorf("ListReferenced calls = %d, AssignedPairs calls = %d, want 1 and 1", segs.referencedCalls, repo.pairsCalls)
+	}
+
+	_, err = svc.CheckUserSegments(context.Background(), ru, []string{"static", "missing"})
+	if !errors.Is(err, ErrSegmentNotFound) {
+		t.Errorf("unknown segment: error = %v, want ErrSegmentNotFound", err)
+	}
+}
@@ -0,0 +1,31 @@
+package service
+
+import (
+	"encoding/base64"
+	"encoding/json"
+)
+
+// Page — запрос страницы: не больше Limit элементов, начиная после курсора.
+// Пустой Cursor означает первую страницу.
+type Page struct {
+	Limit  int
+	Cursor string
+}
+
+// encodeCursor упаковывает ключ последнего элемента страницы в непрозрачную строку.
+func encodeCursor(key any) string {
+	raw, _ := json.Marshal(key)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// decodeCursor распаковывает курсор, полученный от клиента.
+func decodeCursor(cursor string, key any) error {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return ErrInvalidCursor
+	}
+	if err := json.Unmarshal(raw, key); err != nil {
+		return ErrInvalidCursor
+	}
+	return nil
+}
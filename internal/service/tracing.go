@@ -0,0 +1,152 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/RaikyD/UserSegmentationService/internal/models"
+	"github.com/RaikyD/UserSegmentationService/internal/tracing"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Обёртки ниже открывают спан на каждый вызов метода сервиса. ID пользователей
+// в атрибуты не пишутся, как и в логи.
+
+func segmentAttr(id uuid.UUID) attribute.KeyValue {
+	return attribute.String("segment.id", id.String())
+}
+
+type tracedSegmentService struct {
+	next SegmentService
+}
+
+// NewTracedSegmentService оборачивает svc спанами трассировки.
+func NewTracedSegmentService(svc SegmentService) SegmentService {
+	return &tracedSegmentService{next: svc}
+}
+
+func (t *tracedSegmentService) CreateSegment(ctx context.Context, seg *models.Segment) (_ *models.Segment, err error) {
+	ctx, span := tracing.Start(ctx, "SegmentService.CreateSegment", attribute.String("segment.type", string(seg.Type)))
+	defer func() { tracing.End(span, err) }()
+	return t.next.CreateSegment(ctx, seg)
+}
+
+func (t *tracedSegmentService) GetSegmentByID(ctx context.Context, id uuid.UUID) (_ *models.Segment, err error) {
+	ctx, span := tracing.Start(ctx, "SegmentService.GetSegmentByID", segmentAttr(id))
+	defer func() { tracing.End(span, err) }()
+	return t.next.GetSegmentByID(ctx, id)
+}
+
+func (t *tracedSegmentService) ListSegments(ctx context.Context, filter models.SegmentFilter, sort models.SegmentSort, page Page) (_ []*models.Segment, _ string, err error) {
+	ctx, span := tracing.Start(ctx, "SegmentService.ListSegments", attribute.Int("page.limit", page.Limit))
+	defer func() { tracing.End(span, err) }()
+	return t.next.ListSegments(ctx, filter, sort, page)
+}
+
+func (t *tracedSegmentService) UpdateSegment(ctx context.Context, seg *models.Segment) (_ *models.Segment, err error) {
+	ctx, span := tracing.Start(ctx, "SegmentService.UpdateSegment", segmentAttr(seg.ID))
+	defer func() { tracing.End(span, err) }()
+	return t.next.UpdateSegment(ctx, seg)
+}
+
+func (t *tracedSegmentService) DeleteSegment(ctx context.Context, id uuid.UUID) (err error) {
+	ctx, span := tracing.Start(ctx, "SegmentService.DeleteSegment", segmentAttr(id))
+	defer func() { tracing.End(span, err) }()
+	return t.next.DeleteSegment(ctx, id)
+}
+
+func (t *tracedSegmentService) ResolveSegmentID(ctx context.Context, ref string) (_ uuid.UUID, err error) {
+	ctx, span := tracing.Start(ctx, "SegmentService.ResolveSegmentID")
+	defer func() { tracing.End(span, err) }()
+	return t.next.ResolveSegmentID(ctx, ref)
+}
+
+type tracedUserSegmentService struct {
+	next UserSegmentService
+}
+
+// NewTracedUserSegmentService оборачивает svc спанами трассировки.
+func NewTracedUserSegmentService(svc UserSegmentService) UserSegmentService {
+	return &tracedUserSegmentService{next: svc}
+}
+
+func (t *tracedUserSegmentService) AssignUser(ctx context.Context, segmentID, userID uuid.UUID, expiresAt *time.Time) (err error) {
+	ctx, span := tracing.Start(ctx, "UserSegmentService.AssignUser", segmentAttr(segmentID))
+	defer func() { tracing.End(span, err) }()
+	return t.next.AssignUser(ctx, segmentID, userID, expiresAt)
+}
+
+func (t *tracedUserSegmentService) UnassignUser(ctx context.Context, segmentID, userID uuid.UUID) (err error) {
+	ctx, span := tracing.Start(ctx, "UserSegmentService.UnassignUser", segmentAttr(segmentID))
+	defer func() { tracing.End(span, err) }()
+	return t.next.UnassignUser(ctx, segmentID, userID)
+}
+
+func (t *tracedUserSegmentService) ListUserSegments(ctx context.Context, userID uuid.UUID, includeInactive bool, page Page) (_ []*models.UserSegment, _ string, err error) {
+	ctx, span := tracing.Start(ctx, "UserSegmentService.ListUserSegments",
+		attribute.Bool("include_inactive", includeInactive), attribute.Int("page.limit", page.Limit))
+	defer func() { tracing.End(span, err) }()
+	return t.next.ListUserSegments(ctx, userID, includeInactive, page)
+}
+
+func (t *tracedUserSegmentService) ListSegmentUsers(ctx context.Context, segmentID uuid.UUID, page Page) (_ []uuid.UUID, _ string, err error) {
+	ctx, span := tracing.Start(ctx, "UserSegmentService.ListSegmentUsers", segmentAttr(segmentID), attribute.Int("page.limit", page.Limit))
+	defer func() { tracing.End(span, err) }()
+	return t.next.ListSegmentUsers(ctx, segmentID, page)
+}
+
+func (t *tracedUserSegmentService) ExportSegmentUsers(ctx context.Context, segmentID uuid.UUID, fn func(*models.UserSegmentAssignment) error) (err error) {
+	ctx, span := tracing.Start(ctx, "UserSegmentService.ExportSegmentUsers", segmentAttr(segmentID))
+	defer func() { tracing.End(span, err) }()
+	return t.next.ExportSegmentUsers(ctx, segmentID, fn)
+}
+
+func (t *tracedUserSegmentService) CountSegmentMembers(ctx context.Context, seg *models.Segment) (_ int64, err error) {
+	ctx, span := tracing.Start(ctx, "UserSegmentService.CountSegmentMembers", segmentAttr(seg.ID))
+	defer func() { tracing.End(span, err) }()
+	return t.next.CountSegmentMembers(ctx, seg)
+}
+
+func (t *tracedUserSegmentService) ListUserSegmentsAt(ctx context.Context, userID uuid.UUID, at time.Time) (_ []*models.UserSegment, err error) {
+	ctx, span := tracing.Start(ctx, "UserSegmentService.ListUserSegmentsAt")
+	defer func() { tracing.End(span, err) }()
+	return t.next.ListUserSegmentsAt(ctx, userID, at)
+}
+
+func (t *tracedUserSegmentService) ListUserHistory(ctx context.Context, userID uuid.UUID) (_ []*models.AssignmentEvent, err error) {
+	ctx, span := tracing.Start(ctx, "UserSegmentService.ListUserHistory")
+	defer func() { tracing.End(span, err) }()
+	return t.next.ListUserHistory(ctx, userID)
+}
+
+func (t *tracedUserSegmentService) MassAssignSegment(ctx context.Context, segmentID uuid.UUID, percent int) (_ *models.MassAssignResult, err error) {
+	ctx, span := tracing.Start(ctx, "UserSegmentService.MassAssignSegment", segmentAttr(segmentID), attribute.Int("percent", percent))
+	defer func() { tracing.End(span, err) }()
+	return t.next.MassAssignSegment(ctx, segmentID, percent)
+}
+
+func (t *tracedUserSegmentService) ResolveSegmentID(ctx context.Context, ref string) (_ uuid.UUID, err error) {
+	ctx, span := tracing.Start(ctx, "UserSegmentService.ResolveSegmentID")
+	defer func() { tracing.End(span, err) }()
+	return t.next.ResolveSegmentID(ctx, ref)
+}
+
+func (t *tracedUserSegmentService) UpdateUserSegments(ctx context.Context, userID uuid.UUID, add, remove []string) (err error) {
+	ctx, span := tracing.Start(ctx, "UserSegmentService.UpdateUserSegments",
+		attribute.Int("segments.add", len(add)), attribute.Int("segments.remove", len(remove)))
+	defer func() { tracing.End(span, err) }()
+	return t.next.UpdateUserSegments(ctx, userID, add, remove)
+}
+
+func (t *tracedUserSegmentService) CheckUserSegments(ctx context.Context, userID uuid.UUID, refs []string) (_ []*models.Membership, err error) {
+	ctx, span := tracing.Start(ctx, "UserSegmentService.CheckUserSegments", attribute.Int("segments", len(refs)))
+	defer func() { tracing.End(span, err) }()
+	return t.next.CheckUserSegments(ctx, userID, refs)
+}
+
+func (t *tracedUserSegmentService) CheckMembership(ctx context.Context, checks []models.MembershipCheck) (_ []*models.Membership, err error) {
+	ctx, span := tracing.Start(ctx, "UserSegmentService.CheckMembership", attribute.Int("pairs", len(checks)))
+	defer func() { tracing.End(span, err) }()
+	return t.next.CheckMembership(ctx, checks)
+}
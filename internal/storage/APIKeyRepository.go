@@ -0,0 +1,43 @@
+package storage
+
+import (
+	"context"
+	"errors"
+
+	"github.com/RaikyD/UserSegmentationService/internal/models"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type APIKeyDB struct {
+	pool *pgxpool.Pool
+}
+
+// NewAPIKeyDB конструирует репозиторий ключей API на основе пула соединений.
+func NewAPIKeyDB(pool *pgxpool.Pool) *APIKeyDB {
+	return &APIKeyDB{pool: pool}
+}
+
+func (db *APIKeyDB) GetByHash(ctx context.Context, hash []byte) (*models.APIKey, error) {
+	const sql = `
+SELECT id, name, roles, tenant, created_at, revoked_at
+  FROM api_keys
+ WHERE key_hash = $1
+   AND revoked_at IS NULL;
+`
+	var key models.APIKey
+	if err := db.pool.QueryRow(ctx, sql, hash).Scan(
+		&key.ID,
+		&key.Name,
+		&key.Roles,
+		&key.Tenant,
+		&key.CreatedAt,
+		&key.RevokedAt,
+	); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &key, nil
+}
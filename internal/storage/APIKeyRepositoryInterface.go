@@ -0,0 +1,13 @@
+package storage
+
+import (
+	"context"
+
+	"github.com/RaikyD/UserSegmentationService/internal/models"
+)
+
+// APIKeyRepository ищет ключи доступа к API.
+type APIKeyRepository interface {
+	// GetByHash возвращает неотозванный ключ по sha256 его значения; nil, nil — если такого нет
+	GetByHash(ctx context.Context, hash []byte) (*models.APIKey, error)
+}
@@ -0,0 +1,87 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/RaikyD/UserSegmentationService/internal/jobs"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// JobDB хранит состояние фоновых задач (jobs.Store) в таблице jobs, общей для
+// всех реплик.
+type JobDB struct {
+	pool *pgxpool.Pool
+}
+
+// NewJobDB конструирует хранилище задач на основе пула соединений.
+func NewJobDB(pool *pgxpool.Pool) *JobDB {
+	return &JobDB{pool: pool}
+}
+
+var _ jobs.Store = (*JobDB)(nil)
+
+func (db *JobDB) Save(ctx context.Context, job *jobs.Job) error {
+	const sql = `
+INSERT INTO jobs (id, kind, tenant, status, processed, total, error, result, created_at, updated_at, finished_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+ON CONFLICT (id) DO UPDATE
+   SET status      = EXCLUDED.status,
+       processed   = EXCLUDED.processed,
+       total       = EXCLUDED.total,
+       error       = EXCLUDED.error,
+       result      = EXCLUDED.result,
+       updated_at  = EXCLUDED.updated_at,
+       finished_at = EXCLUDED.finished_at;
+`
+	_, err := db.pool.Exec(ctx, sql,
+		job.ID,
+		job.Kind,
+		job.Tenant,
+		job.Status,
+		job.Processed,
+		job.Total,
+		job.Error,
+		job.Result,
+		job.CreatedAt,
+		job.UpdatedAt,
+		job.FinishedAt,
+	)
+	return err
+}
+
+func (db *JobDB) Get(ctx context.Context, id uuid.UUID) (*jobs.Job, error) {
+	const sql = `
+SELECT id, kind, tenant, status, processed, total, error, result, created_at, updated_at, finished_at
+  FROM jobs
+ WHERE id = $1;
+`
+	var job jobs.Job
+	if err := db.pool.QueryRow(ctx, sql, id).Scan(
+		&job.ID,
+		&job.Kind,
+		&job.Tenant,
+		&job.Status,
+		&job.Processed,
+		&job.Total,
+		&job.Error,
+		&job.Result,
+		&job.CreatedAt,
+		&job.UpdatedAt,
+		&job.FinishedAt,
+	); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &job, nil
+}
+
+func (db *JobDB) DeleteUpdatedBefore(ctx context.Context, cutoff time.Time) error {
+	_, err := db.pool.Exec(ctx, `DELETE FROM jobs WHERE updated_at < $1`, cutoff)
+	return err
+}
@@ -0,0 +1,166 @@
+package storage
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/RaikyD/UserSegmentationService/internal/composite"
+	"github.com/RaikyD/UserSegmentationService/internal/rollout"
+	"github.com/google/uuid"
+)
+
+// MemberExpr описывает множество участников, которое вычисляется в SQL.
+// Лист — участники одного сегмента: явные привязки и, если задан Bucket,
+// пользователи из корзин раскатки. Узел объединяет, пересекает или вычитает
+// множества своих аргументов.
+type MemberExpr struct {
+	Op   composite.Op
+	Args []*MemberExpr
+
+	SegmentID uuid.UUID
+	Bucket    *rollout.Config
+	// Empty — лист без участников, например неактивный сегмент.
+	Empty bool
+}
+
+// SegmentMembers возвращает лист для участников одного сегмента.
+func SegmentMembers(segmentID uuid.UUID, bucket *rollout.Config) *MemberExpr {
+	return &MemberExpr{SegmentID: segmentID, Bucket: bucket}
+}
+
+// sql строит запрос, возвращающий колонку user_id, как UNION ALL непересекающихся
+// ветвей. Каждая ветвь читает одну таблицу в порядке её ключа, начиная строго
+// после after. Если задан limit, он ставится в каждую ветвь вместе с ORDER BY:
+// первые limit элементов объединения непересекающихся множеств лежат среди
+// первых limit элементов ветвей, и страница не читает участников дальше себя.
+func (e *MemberExpr) sql(arg func(any) string, after, limit string) string {
+	bs := e.branches(arg)
+	if len(bs) == 0 {
+		return "SELECT NULL::uuid AS user_id WHERE false"
+	}
+	parts := make([]string, len(bs))
+	for i, b := range bs {
+		parts[i] = b.sql(after, limit)
+	}
+	return strings.Join(parts, "\nUNION ALL\n")
+}
+
+// branch — выборка участников из одной таблицы (псевдоним m) с условиями.
+type branch struct {
+	from  string
+	col   string
+	where []string
+}
+
+func (b branch) sql(after, limit string) string {
+	q := fmt.Sprintf("SELECT %s AS user_id\n  FROM %s\n WHERE %s > %s", b.col, b.from, b.col, after)
+	for _, w := range b.where {
+		q += "\n   AND " + w
+	}
+	if limit == "" {
+		return q
+	}
+	return "(" + q + "\n ORDER BY " + b.col + "\n LIMIT " + limit + ")"
+}
+
+// with возвращает копию ветвей с дополнительным условием, построенным по колонке ветви.
+func with(bs []branch, cond func(col string) string) []branch {
+	out := make([]branch, len(bs))
+	for i, b := range bs {
+		out[i] = branch{from: b.from, col: b.col, where: append(slices.Clip(b.where), cond(b.col))}
+	}
+	return out
+}
+
+// branches раскладывает множество на непересекающиеся ветви. Лист — явные
+// привязки и пользователи из корзин раскатки без привязки. Объединение берёт
+// ветви каждого аргумента без участников предыдущих, пересечение и разность —
+// ветви первого аргумента с проверкой членства в остальных.
+func (e *MemberExpr) branches(arg func(any) string) []branch {
+	if e.Op == "" {
+		if e.Empty {
+			return nil
+		}
+		bs := []branch{{
+			from: "user_segment_assignment m",
+			col:  "m.user_id",
+			where: []string{
+				"m.segment_id = " + arg(e.SegmentID),
+				"(m.expires_at IS NULL OR m.expires_at > now())",
+			},
+		}}
+		if e.Bucket != nil {
+			bs = append(bs, branch{
+				from: "users m",
+				col:  "m.id",
+				where: []string{
+					fmt.Sprintf("rollout_bucket(%s, m.id) < %s", arg(e.Bucket.Salt), arg(e.Bucket.Threshold())),
+					"NOT " + assigned(arg, e.SegmentID, "m.id"),
+				},
+			})
+		}
+		return bs
+	}
+
+	switch e.Op {
+	case composite.OpIntersect, composite.OpDifference:
+		bs := e.Args[0].branches(arg)
+		for _, a := range e.Args[1:] {
+			bs = with(bs, func(col string) string {
+				if e.Op == composite.OpIntersect {
+					return a.member(arg, col)
+				}
+				return "NOT " + a.member(arg, col)
+			})
+		}
+		return bs
+	default:
+		var bs []branch
+		for i, a := range e.Args {
+			own := a.branches(arg)
+			for _, prev := range e.Args[:i] {
+				own = with(own, func(col string) string { return "NOT " + prev.member(arg, col) })
+			}
+			bs = append(bs, own...)
+		}
+		return bs
+	}
+}
+
+// member строит условие «пользователь col входит в множество». Оно проверяет
+// одну строку по первичным ключам и не перебирает участников.
+func (e *MemberExpr) member(arg func(any) string, col string) string {
+	if e.Op == "" {
+		if e.Empty {
+			return "false"
+		}
+		cond := assigned(arg, e.SegmentID, col)
+		if e.Bucket != nil {
+			cond = fmt.Sprintf("(%s OR rollout_bucket(%s, %s) < %s)", cond, arg(e.Bucket.Salt), col, arg(e.Bucket.Threshold()))
+		}
+		return cond
+	}
+
+	parts := make([]string, len(e.Args))
+	for i, a := range e.Args {
+		parts[i] = a.member(arg, col)
+	}
+	switch e.Op {
+	case composite.OpIntersect:
+		return "(" + strings.Join(parts, " AND ") + ")"
+	case composite.OpDifference:
+		return "(" + parts[0] + " AND NOT (" + strings.Join(parts[1:], " OR ") + "))"
+	default:
+		return "(" + strings.Join(parts, " OR ") + ")"
+	}
+}
+
+// assigned строит условие «у пользователя col есть действующая привязка к сегменту».
+func assigned(arg func(any) string, segmentID uuid.UUID, col string) string {
+	return fmt.Sprintf(`EXISTS (SELECT 1
+                 FROM user_segment_assignment a
+                WHERE a.segment_id = %s
+                  AND a.user_id = %s
+                  AND (a.expires_at IS NULL OR a.expires_at > now()))`, arg(segmentID), col)
+}
@@ -0,0 +1,253 @@
+package storage
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/RaikyD/UserSegmentationService/internal/composite"
+	"github.com/RaikyD/UserSegmentationService/internal/rollout"
+)
+
+var (
+	exprSegA = uuid.MustParse("aaaaaaaa-aaaa-aaaa-aaaa-aaaaaaaaaaaa")
+	exprSegB = uuid.MustParse("bbbbbbbb-bbbb-bbbb-bbbb-bbbbbbbbbbbb")
+	exprSegC = uuid.MustParse("cccccccc-cccc-cccc-cccc-cccccccccccc")
+)
+
+// renderExpr строит SQL так же, как ListMemberIDs: $1 — курсор after, $2 —
+// размер страницы. Пустой limit строит запрос без ограничения, как CountMembers.
+func renderExpr(e *MemberExpr, limit string) (string, []any) {
+	args := []any{uuid.Nil, 100}
+	arg := func(v any) string {
+		args = append(args, v)
+		return "$" + strconv.Itoa(len(args))
+	}
+	return e.sql(arg, "$1", limit), args
+}
+
+func TestMemberExprSQL(t *testing.T) {
+	bucket := &rollout.Config{Percent: 50, Salt: "s"}
+	threshold := bucket.Threshold()
+	tests := []struct {
+		name     string
+		expr     *MemberExpr
+		limit    string
+		wantSQL  string
+		wantArgs []any
+	}{
+		{
+			name:     "empty",
+			expr:     &MemberExpr{Empty: true},
+			wantSQL:  `SELECT NULL::uuid AS user_id WHERE false`,
+			wantArgs: []any{uuid.Nil, 100},
+		},
+		{
+			name: "static leaf",
+			expr: SegmentMembers(exprSegA, nil),
+			wantSQL: `SELECT m.user_id AS user_id
+  FROM user_segment_assignment m
+ WHERE m.user_id > $1
+   AND m.segment_id = $3
+   AND (m.expires_at IS NULL OR m.expires_at > now())`,
+			wantArgs: []any{uuid.Nil, 100, exprSegA},
+		},
+		{
+			// Пользователь с привязкой не попадает в ветвь корзин, поэтому ветви
+			// не пересекаются и каждой хватает своих первых $2 строк.
+			name:  "bucketed leaf page",
+			expr:  SegmentMembers(exprSegA, bucket),
+			limit: "$2",
+			wantSQL: `(SELECT m.user_id AS user_id
+  FROM user_segment_assignment m
+ WHERE m.user_id > $1
+   AND m.segment_id = $3
+   AND (m.expires_at IS NULL OR m.expires_at > now())
+ ORDER BY m.user_id
+ LIMIT $2)
+UNION ALL
+(SELECT m.id AS user_id
+  FROM users m
+ WHERE m.id > $1
+   AND rollout_bucket($4, m.id) < $5
+   AND NOT EXISTS (SELECT 1
+                 FROM user_segment_assignment a
+                WHERE a.segment_id = $6
+                  AND a.user_id = m.id
+                  AND (a.expires_at IS NULL OR a.expires_at > now()))
+ ORDER BY m.id
+ LIMIT $2)`,
+			wantArgs: []any{uuid.Nil, 100, exprSegA, "s", threshold, exprSegA},
+		},
+		{
+			// Ветви второго аргумента исключают участников первого целиком,
+			// вместе с его корзинами.
+			name: "union over bucketed leaf",
+			expr: &MemberExpr{Op: composite.OpUnion, Args: []*MemberExpr{
+				SegmentMembers(exprSegA, bucket), SegmentMembers(exprSegB, nil),
+			}},
+			limit: "$2",
+			wantSQL: `(SELECT m.user_id AS user_id
+  FROM user_segment_assignment m
+ WHERE m.user_id > $1
+   AND m.segment_id = $3
+   AND (m.expires_at IS NULL OR m.expires_at > now())
+ ORDER BY m.user_id
+ LIMIT $2)
+UNION ALL
+(SELECT m.id AS user_id
+  FROM users m
+ WHERE m.id > $1
+   AND rollout_bucket($4, m.id) < $5
+   AND NOT EXISTS (SELECT 1
+                 FROM user_segment_assignment a
+                WHERE a.segment_id = $6
+                  AND a.user_id = m.id
+                  AND (a.expires_at IS NULL OR a.expires_at > now()))
+ ORDER BY m.id
+ LIMIT $2)
+UNION ALL
+(SELECT m.user_id AS user_id
+  FROM user_segment_assignment m
+ WHERE m.user_id > $1
+   AND m.segment_id = $7
+   AND (m.expires_at IS NULL OR m.expires_at > now())
+   AND NOT (EXISTS (SELECT 1
+                 FROM user_segment_assignment a
+                WHERE a.segment_id = $8
+                  AND a.user_id = m.user_id
+                  AND (a.expires_at IS NULL OR a.expires_at > now())) OR rollout_bucket($9, m.user_id) < $10)
+ ORDER BY m.user_id
+ LIMIT $2)`,
+			wantArgs: []any{uuid.Nil, 100, exprSegA, "s", threshold, exprSegA, exprSegB, exprSegA, "s", threshold},
+		},
+		{
+			// Пересечение фильтрует ветви первого аргумента проверкой членства во
+			// втором; ветви остаются непересекающимися.
+			name: "intersect of bucketed leaves",
+			expr: &MemberExpr{Op: composite.OpIntersect, Args: []*MemberExpr{
+				SegmentMembers(exprSegA, bucket), SegmentMembers(exprSegB, bucket),
+			}},
+			limit: "$2",
+			wantSQL: `(SELECT m.user_id AS user_id
+  FROM user_segment_assignment m
+ WHERE m.user_id > $1
+   AND m.segment_id = $3
+   AND (m.expires_at IS NULL OR m.expires_at > now())
+   AND (EXISTS (SELECT 1
+                 FROM user_segment_assignment a
+                WHERE a.segment_id = $7
+                  AND a.user_id = m.user_id
+                  AND (a.expires_at IS NULL OR a.expires_at > now())) OR rollout_bucket($8, m.user_id) < $9)
+ ORDER BY m.user_id
+ LIMIT $2)
+UNION ALL
+(SELECT m.id AS user_id
+  FROM users m
+ WHERE m.id > $1
+   AND rollout_bucket($4, m.id) < $5
+   AND NOT EXISTS (SELECT 1
+                 FROM user_segment_assignment a
+                WHERE a.segment_id = $6
+                  AND a.user_id = m.id
+                  AND (a.expires_at IS NULL OR a.expires_at > now()))
+   AND (EXISTS (SELECT 1
+                 FROM user_segment_assignment a
+                WHERE a.segment_id = $10
+                  AND a.user_id = m.id
+                  AND (a.expires_at IS NULL OR a.expires_at > now())) OR rollout_bucket($11, m.id) < $12)
+ ORDER BY m.id
+ LIMIT $2)`,
+			wantArgs: []any{uuid.Nil, 100, exprSegA, "s", threshold, exprSegA, exprSegB, "s", threshold, exprSegB, "s", threshold},
+		},
+		{
+			name: "difference with bucketed and empty leaves",
+			expr: &MemberExpr{Op: composite.OpDifference, Args: []*MemberExpr{
+				SegmentMembers(exprSegA, nil), SegmentMembers(exprSegB, bucket), {Empty: true},
+			}},
+			wantSQL: `SELECT m.user_id AS user_id
+  FROM user_segment_assignment m
+ WHERE m.user_id > $1
+   AND m.segment_id = $3
+   AND (m.expires_at IS NULL OR m.expires_at > now())
+   AND NOT (EXISTS (SELECT 1
+                 FROM user_segment_assignment a
+                WHERE a.segment_id = $4
+                  AND a.user_id = m.user_id
+                  AND (a.expires_at IS NULL OR a.expires_at > now())) OR rollout_bucket($5, m.user_id) < $6)
+   AND NOT false`,
+			wantArgs: []any{uuid.Nil, 100, exprSegA, exprSegB, "s", threshold},
+		},
+		{
+			name: "intersect of union",
+			expr: &MemberExpr{Op: composite.OpIntersect, Args: []*MemberExpr{
+				{Op: composite.OpUnion, Args: []*MemberExpr{SegmentMembers(exprSegA, nil), SegmentMembers(exprSegB, nil)}},
+				SegmentMembers(exprSegC, nil),
+			}},
+			wantSQL: `SELECT m.user_id AS user_id
+  FROM user_segment_assignment m
+ WHERE m.user_id > $1
+   AND m.segment_id = $3
+   AND (m.expires_at IS NULL OR m.expires_at > now())
+   AND EXISTS (SELECT 1
+                 FROM user_segment_assignment a
+                WHERE a.segment_id = $6
+                  AND a.user_id = m.user_id
+                  AND (a.expires_at IS NULL OR a.expires_at > now()))
+UNION ALL
+SELECT m.user_id AS user_id
+  FROM user_segment_assignment m
+ WHERE m.user_id > $1
+   AND m.segment_id = $4
+   AND (m.expires_at IS NULL OR m.expires_at > now())
+   AND NOT EXISTS (SELECT 1
+                 FROM user_segment_assignment a
+                WHERE a.segment_id = $5
+                  AND a.user_id = m.user_id
+                  AND (a.expires_at IS NULL OR a.expires_at > now()))
+   AND EXISTS (SELECT 1
+                 FROM user_segment_assignment a
+                WHERE a.segment_id = $7
+                  AND a.user_id = m.user_id
+                  AND (a.expires_at IS NULL OR a.expires_at > now()))`,
+			wantArgs: []any{uuid.Nil, 100, exprSegA, exprSegB, exprSegA, exprSegC, exprSegC},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sql, args := renderExpr(tt.expr, tt.limit)
+			if sql != tt.wantSQL {
+				t.Errorf("sql:\n%s\nwant:\n%s", sql, tt.wantSQL)
+			}
+			if !slices.Equal(args, tt.wantArgs) {
+				t.Errorf("args = %v, want %v", args, tt.wantArgs)
+			}
+		})
+	}
+}
+
+// TestMemberExprPageLimit проверяет, что страница ограничивает каждую ветвь:
+// ни одна ветвь не читает участников дальше размера страницы.
+func TestMemberExprPageLimit(t *testing.T) {
+	bucket := &rollout.Config{Percent: 10, Salt: "s"}
+	expr := &MemberExpr{Op: composite.OpDifference, Args: []*MemberExpr{
+		{Op: composite.OpUnion, Args: []*MemberExpr{SegmentMembers(exprSegA, bucket), SegmentMembers(exprSegB, bucket)}},
+		SegmentMembers(exprSegC, nil),
+	}}
+	sql, _ := renderExpr(expr, "$2")
+	branches := strings.Split(sql, "\nUNION ALL\n")
+	if len(branches) != 4 {
+		t.Fatalf("got %d branches, want 4:\n%s", len(branches), sql)
+	}
+	for i, b := range branches {
+		if !strings.HasPrefix(b, "(") || !strings.HasSuffix(b, "\n LIMIT $2)") || !strings.Contains(b, "\n ORDER BY m.") {
+			t.Errorf("branch %d is not ordered and limited:\n%s", i, b)
+		}
+	}
+	if strings.Contains(sql, "\nUNION\n") || strings.Contains(sql, "INTERSECT") || strings.Contains(sql, "EXCEPT") {
+		t.Errorf("page query de-duplicates sets:\n%s", sql)
+	}
+}
@@ -0,0 +1,305 @@
+package storage
+
+import (
+	"container/list"
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/RaikyD/UserSegmentationService/internal/models"
+	"github.com/RaikyD/UserSegmentationService/internal/tenant"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"golang.org/x/sync/singleflight"
+)
+
+// SegmentChangesChannel — канал LISTEN/NOTIFY, в который триггер на segments
+// пишет ID изменённого или удалённого сегмента.
+const SegmentChangesChannel = "segments_changed"
+
+// loadTimeout ограничивает общий для нескольких запросов поход в БД за сегментом.
+const loadTimeout = 10 * time.Second
+
+// CacheStats — счётчики кэша сегментов.
+type CacheStats struct {
+	Size          int   `json:"size"`
+	Capacity      int   `json:"capacity"`
+	Hits          int64 `json:"hits"`
+	Misses        int64 `json:"misses"`
+	Evictions     int64 `json:"evictions"`
+	Invalidations int64 `json:"invalidations"`
+}
+
+// SegmentCache кэширует GetByID и GetByName поверх другого SegmentRepository.
+// Записи живут не дольше ttl, их не больше capacity (вытесняются давно не
+// читавшиеся), одновременные промахи по одному ключу идут в БД одним запросом.
+// Отсутствующие сегменты не кэшируются. Остальные методы проходят насквозь.
+// Сегменты по ID кэшируются без учёта арендатора, а при чтении сегмент чужого
+// арендатора считается отсутствующим; имена кэшируются в пределах арендатора.
+type SegmentCache struct {
+	SegmentRepository
+
+	ttl      time.Duration
+	capacity int
+	group    singleflight.Group
+	log      *slog.Logger
+
+	mu     sync.Mutex
+	lru    *list.List // *cacheEntry, в начале — недавно прочитанные
+	byID   map[uuid.UUID]*list.Element
+	byName map[nameKey]uuid.UUID
+	// gen растёт при каждом сбросе: загрузка, начатая до сброса, не кладёт в кэш устаревший сегмент.
+	gen   uint64
+	stats CacheStats
+}
+
+// nameKey — имя сегмента уникально только в пределах арендатора.
+type nameKey struct {
+	tenant string
+	name   string
+}
+
+type cacheEntry struct {
+	seg       *models.Segment
+	expiresAt time.Time
+}
+
+// NewSegmentCache оборачивает repo кэшем.
+func NewSegmentCache(repo SegmentRepository, ttl time.Duration, capacity int, logger *slog.Logger) *SegmentCache {
+	return &SegmentCache{
+		SegmentRepository: repo,
+		ttl:               ttl,
+		capacity:          capacity,
+		log:               logger,
+		lru:               list.New(),
+		byID:              make(map[uuid.UUID]*list.Element),
+		byName:            make(map[nameKey]uuid.UUID),
+		stats:             CacheStats{Capacity: capacity},
+	}
+}
+
+func (c *SegmentCache) GetByID(ctx context.Context, id uuid.UUID) (*models.Segment, error) {
+	c.mu.Lock()
+	seg := c.lookup(id)
+	c.mu.Unlock()
+	if seg == nil {
+		var err error
+		seg, err = c.load(ctx, "id:"+id.String(), func(ctx context.Context) (*models.Segment, error) {
+			return c.SegmentRepository.GetByID(tenant.WithAll(ctx), id)
+		})
+		if err != nil || seg == nil {
+			return nil, err
+		}
+	}
+	if !tenant.All(ctx) && seg.Tenant != tenant.FromContext(ctx) {
+		return nil, nil
+	}
+	return seg, nil
+}
+
+func (c *SegmentCache) GetByName(ctx context.Context, name string) (*models.Segment, error) {
+	key := nameKey{tenant: tenant.FromContext(ctx), name: name}
+	c.mu.Lock()
+	var seg *models.Segment
+	if id, ok := c.byName[key]; ok {
+		seg = c.lookup(id)
+	} else {
+		c.stats.Misses++
+	}
+	c.mu.Unlock()
+	if seg != nil {
+		return seg, nil
+	}
+	return c.load(ctx, "name:"+key.tenant+":"+name, func(ctx context.Context) (*models.Segment, error) {
+		return c.SegmentRepository.GetByName(ctx, name)
+	})
+}
+
+func (c *SegmentCache) Update(ctx context.Context, seg *models.Segment) error {
+	err := c.SegmentRepository.Update(ctx, seg)
+	c.Invalidate(seg.ID)
+	return err
+}
+
+func (c *SegmentCache) Delete(ctx context.Context, id uuid.UUID) error {
+	err := c.SegmentRepository.Delete(ctx, id)
+	c.Invalidate(id)
+	return err
+}
+
+func (c *SegmentCache) ApplySchedule(ctx context.Context) (activated, deactivated []uuid.UUID, err error) {
+	activated, deactivated, err = c.SegmentRepository.ApplySchedule(ctx)
+	for _, id := range activated {
+		c.Invalidate(id)
+	}
+	for _, id := range deactivated {
+		c.Invalidate(id)
+	}
+	return activated, deactivated, err
+}
+
+// Invalidate убирает сегмент из кэша.
+func (c *SegmentCache) Invalidate(id uuid.UUID) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.gen++
+	c.stats.Invalidations++
+	if el, ok := c.byID[id]; ok {
+		c.remove(el)
+	}
+}
+
+// Purge очищает кэш целиком.
+func (c *SegmentCache) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.gen++
+	c.stats.Invalidations++
+	c.lru.Init()
+	c.byID = make(map[uuid.UUID]*list.Element)
+	c.byName = make(map[nameKey]uuid.UUID)
+}
+
+// Stats возвращает снимок счётчиков кэша.
+func (c *SegmentCache) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := c.stats
+	stats.Size = c.lru.Len()
+	return stats
+}
+
+// Listen подписывается на SegmentChangesChannel и сбрасывает из кэша изменённые
+// на других репликах сегменты, пока не отменён ctx. Пока соединения нет,
+// уведомления теряются, поэтому после переподключения кэш очищается целиком.
+func (c *SegmentCache) Listen(ctx context.Context, pool *pgxpool.Pool) {
+	backoff := time.Second
+	for ctx.Err() == nil {
+		err := c.listen(ctx, pool)
+		if ctx.Err() != nil {
+			return
+		}
+		c.log.Warn("segment cache listener failed", "retry_in", backoff, "error", err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, time.Minute)
+	}
+}
+
+func (c *SegmentCache) listen(ctx context.Context, pool *pgxpool.Pool) error {
+	pooled, err := pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	// Соединение после LISTEN нельзя возвращать в пул другим запросам.
+	conn := pooled.Hijack()
+	defer conn.Close(context.Background())
+
+	if _, err := conn.Exec(ctx, "LISTEN "+SegmentChangesChannel); err != nil {
+		return err
+	}
+	c.Purge()
+	for {
+		n, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+		id, err := uuid.Parse(n.Payload)
+		if err != nil {
+			c.log.Warn("segment cache got unexpected notification", "payload", n.Payload)
+			continue
+		}
+		c.Invalidate(id)
+	}
+}
+
+// lookup возвращает копию сегмента из кэша или nil. Вызывается под c.mu.
+func (c *SegmentCache) lookup(id uuid.UUID) *models.Segment {
+	el, ok := c.byID[id]
+	if !ok {
+		c.stats.Misses++
+		return nil
+	}
+	e := el.Value.(*cacheEntry)
+	if time.Now().After(e.expiresAt) {
+		c.remove(el)
+		c.stats.Misses++
+		return nil
+	}
+	c.lru.MoveToFront(el)
+	c.stats.Hits++
+	return copySegment(e.seg)
+}
+
+// load загружает сегмент через inner, объединяя одновременные загрузки по key.
+func (c *SegmentCache) load(ctx context.Context, key string, inner func(context.Context) (*models.Segment, error)) (*models.Segment, error) {
+	c.mu.Lock()
+	gen := c.gen
+	c.mu.Unlock()
+
+	v, err, _ := c.group.Do(key, func() (any, error) {
+		// Общий запрос не должен падать из-за отмены запроса, который его начал.
+		loadCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), loadTimeout)
+		defer cancel()
+		seg, err := inner(loadCtx)
+		if err != nil || seg == nil {
+			return seg, err
+		}
+		c.store(seg, gen)
+		return seg, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	seg := v.(*models.Segment)
+	if seg == nil {
+		return nil, nil
+	}
+	return copySegment(seg), nil
+}
+
+func (c *SegmentCache) store(seg *models.Segment, gen uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if gen != c.gen {
+		return
+	}
+	if el, ok := c.byID[seg.ID]; ok {
+		c.remove(el)
+	}
+	c.byID[seg.ID] = c.lru.PushFront(&cacheEntry{seg: copySegment(seg), expiresAt: time.Now().Add(c.ttl)})
+	c.byName[nameKey{tenant: seg.Tenant, name: seg.SegmentName}] = seg.ID
+	for c.lru.Len() > c.capacity {
+		c.remove(c.lru.Back())
+		c.stats.Evictions++
+	}
+}
+
+// remove убирает запись из всех индексов. Вызывается под c.mu.
+func (c *SegmentCache) remove(el *list.Element) {
+	e := c.lru.Remove(el).(*cacheEntry)
+	delete(c.byID, e.seg.ID)
+	key := nameKey{tenant: e.seg.Tenant, name: e.seg.SegmentName}
+	if c.byName[key] == e.seg.ID {
+		delete(c.byName, key)
+	}
+}
+
+// copySegment отдаёт независимую копию: вызывающие меняют сегменты перед Update.
+func copySegment(seg *models.Segment) *models.Segment {
+	cp := *seg
+	cp.Config = append([]byte(nil), seg.Config...)
+	if seg.ValidFrom != nil {
+		t := *seg.ValidFrom
+		cp.ValidFrom = &t
+	}
+	if seg.ValidTo != nil {
+		t := *seg.ValidTo
+		cp.ValidTo = &t
+	}
+	return &cp
+}
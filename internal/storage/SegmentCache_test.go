@@ -0,0 +1,265 @@
+package storage
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/RaikyD/UserSegmentationService/internal/logging"
+	"github.com/RaikyD/UserSegmentationService/internal/models"
+	"github.com/RaikyD/UserSegmentationService/internal/tenant"
+)
+
+// fakeSegmentRepo — хранилище сегментов в памяти со счётчиком обращений.
+// GetByID, как и SegmentCache при загрузке, не смотрит на арендатора.
+// Если задан block, загрузка ждёт, пока из него не прочитают.
+type fakeSegmentRepo struct {
+	SegmentRepository
+
+	mu      sync.Mutex
+	segs    map[uuid.UUID]*models.Segment
+	calls   atomic.Int64
+	started chan struct{}
+	block   chan struct{}
+}
+
+func newFakeSegmentRepo(segs ...*models.Segment) *fakeSegmentRepo {
+	f := &fakeSegmentRepo{segs: make(map[uuid.UUID]*models.Segment)}
+	for _, seg := range segs {
+		f.segs[seg.ID] = seg
+	}
+	return f
+}
+
+func (f *fakeSegmentRepo) wait() {
+	f.calls.Add(1)
+	if f.started != nil {
+		f.started <- struct{}{}
+	}
+	if f.block != nil {
+		<-f.block
+	}
+}
+
+func (f *fakeSegmentRepo) GetByID(_ context.Context, id uuid.UUID) (*models.Segment, error) {
+	f.wait()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if seg, ok := f.segs[id]; ok {
+		return copySegment(seg), nil
+	}
+	return nil, nil
+}
+
+func (f *fakeSegmentRepo) GetByName(ctx context.Context, name string) (*models.Segment, error) {
+	f.wait()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, seg := range f.segs {
+		if seg.SegmentName == name && seg.Tenant == tenant.FromContext(ctx) {
+			return copySegment(seg), nil
+		}
+	}
+	return nil, nil
+}
+
+func (f *fakeSegmentRepo) Update(_ context.Context, seg *models.Segment) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.segs[seg.ID] = copySegment(seg)
+	return nil
+}
+
+func cacheSegment(name string) *models.Segment {
+	return &models.Segment{ID: uuid.New(), Tenant: tenant.Default, SegmentName: name, Type: models.SegmentTypeStatic, IsActive: true, Config: []byte(`{}`)}
+}
+
+func mustGet(t *testing.T, c *SegmentCache, id uuid.UUID) *models.Segment {
+	t.Helper()
+	seg, err := c.GetByID(context.Background(), id)
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	return seg
+}
+
+func TestSegmentCacheHitsAndCopies(t *testing.T) {
+	seg := cacheSegment("beta")
+	repo := newFakeSegmentRepo(seg)
+	c := NewSegmentCache(repo, time.Hour, 10, logging.Discard())
+
+	got := mustGet(t, c, seg.ID)
+	got.SegmentName = "changed"
+	if again := mustGet(t, c, seg.ID); again.SegmentName != "beta" {
+		t.Errorf("cached segment was changed through a returned copy: %q", again.SegmentName)
+	}
+	byName, err := c.GetByName(context.Background(), "beta")
+	if err != nil || byName == nil || byName.ID != seg.ID {
+		t.Fatalf("GetByName = %v, %v", byName, err)
+	}
+	if n := repo.calls.Load(); n != 1 {
+		t.Errorf("repository calls = %d, want 1", n)
+	}
+
+	// Отсутствующие сегменты не кэшируются.
+	missing := uuid.New()
+	for range 2 {
+		if seg := mustGet(t, c, missing); seg != nil {
+			t.Fatalf("GetByID(missing) = %+v", seg)
+		}
+	}
+	if n := repo.calls.Load(); n != 3 {
+		t.Errorf("repository calls = %d, want 3", n)
+	}
+
+	// Update сбрасывает запись, следующее чтение видит новое значение.
+	upd := copySegment(seg)
+	upd.SegmentName = "gamma"
+	if err := c.Update(context.Background(), upd); err != nil {
+		t.Fatal(err)
+	}
+	if got := mustGet(t, c, seg.ID); got.SegmentName != "gamma" {
+		t.Errorf("after Update name = %q, want gamma", got.SegmentName)
+	}
+	if stats := c.Stats(); stats.Hits != 2 || stats.Invalidations != 1 || stats.Size != 1 {
+		t.Errorf("stats = %+v", stats)
+	}
+}
+
+func TestSegmentCacheTTL(t *testing.T) {
+	seg := cacheSegment("beta")
+	repo := newFakeSegmentRepo(seg)
+	c := NewSegmentCache(repo, time.Millisecond, 10, logging.Discard())
+
+	mustGet(t, c, seg.ID)
+	time.Sleep(5 * time.Millisecond)
+	mustGet(t, c, seg.ID)
+	if n := repo.calls.Load(); n != 2 {
+		t.Errorf("repository calls = %d, want 2 after the entry expired", n)
+	}
+}
+
+func TestSegmentCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	a, b, d := cacheSegment("a"), cacheSegment("b"), cacheSegment("d")
+	repo := newFakeSegmentRepo(a, b, d)
+	c := NewSegmentCache(repo, time.Hour, 2, logging.Discard())
+
+	mustGet(t, c, a.ID)
+	mustGet(t, c, b.ID)
+	mustGet(t, c, a.ID) // a читали позже b
+	mustGet(t, c, d.ID) // вытесняет b
+
+	calls := repo.calls.Load()
+	mustGet(t, c, a.ID)
+	mustGet(t, c, d.ID)
+	if n := repo.calls.Load(); n != calls {
+		t.Errorf("a and d should stay cached, got %d extra loads", n-calls)
+	}
+	if _, err := c.GetByName(context.Background(), "b"); err != nil {
+		t.Fatal(err)
+	}
+	if n := repo.calls.Load(); n != calls+1 {
+		t.Errorf("b should have been evicted")
+	}
+	if stats := c.Stats(); stats.Evictions != 2 || stats.Size != 2 {
+		t.Errorf("stats = %+v, want 2 evictions and size 2", stats)
+	}
+}
+
+func TestSegmentCacheDropsLoadStartedBeforeInvalidation(t *testing.T) {
+	seg := cacheSegment("beta")
+	repo := newFakeSegmentRepo(seg)
+	repo.started = make(chan struct{})
+	repo.block = make(chan struct{})
+	c := NewSegmentCache(repo, time.Hour, 10, logging.Discard())
+
+	done := make(chan *models.Segment)
+	go func() {
+		got, _ := c.GetByID(context.Background(), seg.ID)
+		done <- got
+	}()
+	<-repo.started
+	// Сегмент меняется, пока загрузка старой версии ещё идёт.
+	c.Invalidate(seg.ID)
+	repo.block <- struct{}{}
+	if got := <-done; got == nil || got.ID != seg.ID {
+		t.Fatalf("GetByID = %+v", got)
+	}
+
+	repo.started, repo.block = nil, nil
+	mustGet(t, c, seg.ID)
+	if n := repo.calls.Load(); n != 2 {
+		t.Errorf("repository calls = %d, want 2: a load started before invalidation must not be cached", n)
+	}
+}
+
+func TestSegmentCacheCollapsesConcurrentMisses(t *testing.T) {
+	const readers = 8
+	seg := cacheSegment("beta")
+	repo := newFakeSegmentRepo(seg)
+	repo.block = make(chan struct{})
+	c := NewSegmentCache(repo, time.Hour, 10, logging.Discard())
+
+	var wg sync.WaitGroup
+	for range readers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if got, err := c.GetByID(context.Background(), seg.ID); err != nil || got == nil {
+				t.Errorf("GetByID = %v, %v", got, err)
+			}
+		}()
+	}
+	// Ждём, пока все читатели промахнутся и встанут в очередь за одной загрузкой.
+	for c.Stats().Misses < readers {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(repo.block)
+	wg.Wait()
+
+	if n := repo.calls.Load(); n != 1 {
+		t.Errorf("repository calls = %d, want 1", n)
+	}
+}
+
+func TestSegmentCacheTenants(t *testing.T) {
+	own := cacheSegment("beta")
+	other := cacheSegment("beta")
+	other.Tenant = "acme"
+	repo := newFakeSegmentRepo(own, other)
+	c := NewSegmentCache(repo, time.Hour, 10, logging.Discard())
+	ctx := context.Background()
+	acme := tenant.With(ctx, "acme")
+
+	// Сегмент другого арендатора не виден ни при промахе, ни при попадании в кэш.
+	for range 2 {
+		if seg, err := c.GetByID(ctx, other.ID); err != nil || seg != nil {
+			t.Fatalf("GetByID(other tenant) = %v, %v, want nil", seg, err)
+		}
+	}
+	if seg, err := c.GetByID(acme, other.ID); err != nil || seg == nil || seg.ID != other.ID {
+		t.Fatalf("GetByID(acme) = %v, %v", seg, err)
+	}
+	if seg, err := c.GetByID(tenant.WithAll(ctx), other.ID); err != nil || seg == nil {
+		t.Fatalf("GetByID(all tenants) = %v, %v", seg, err)
+	}
+	if n := repo.calls.Load(); n != 1 {
+		t.Errorf("repository calls = %d, want 1: entries by ID are shared between tenants", n)
+	}
+
+	// Одинаковые имена у разных арендаторов не путаются.
+	for _, tt := range []struct {
+		ctx  context.Context
+		want uuid.UUID
+	}{{ctx, own.ID}, {acme, other.ID}, {ctx, own.ID}, {acme, other.ID}} {
+		seg, err := c.GetByName(tt.ctx, "beta")
+		if err != nil || seg == nil || seg.ID != tt.want {
+			t.Errorf("GetByName(%s) = %v, %v, want %s", tenant.FromContext(tt.ctx), seg, err, tt.want)
+		}
+	}
+}
@@ -2,10 +2,16 @@ package storage
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/RaikyD/UserSegmentationService/internal/models"
+	"github.com/RaikyD/UserSegmentationService/internal/tenant"
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
@@ -20,55 +26,299 @@ func NewSegmentDB(pool *pgxpool.Pool) *SegmentDB {
 
 func (db *SegmentDB) Create(ctx context.Context, seg *models.Segment) error {
 	seg.ID = uuid.New()
+	seg.Tenant = tenant.FromContext(ctx)
 	seg.CreatedOn = time.Now()
 
 	const sql = `
 INSERT INTO segments
-  (id, segment_name, type, config, description, is_active, created_on)
+  (id, tenant, segment_name, type, config, description, is_active, created_on, valid_from, valid_to)
 VALUES
-  ($1, $2, $3, $4, $5, $6, $7);
+  ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10);
 `
-	_, err := db.pool.Exec(ctx, sql,
-		seg.ID,
-		seg.SegmentName,
-		seg.Type,
-		seg.Config,
-		seg.Description,
-		seg.IsActive,
-		seg.CreatedOn,
-	)
-	return err
+	err := pgx.BeginFunc(ctx, db.pool, func(tx pgx.Tx) error {
+		if err := setActor(ctx, tx); err != nil {
+			return err
+		}
+		_, err := tx.Exec(ctx, sql,
+			seg.ID,
+			seg.Tenant,
+			seg.SegmentName,
+			seg.Type,
+			seg.Config,
+			seg.Description,
+			seg.IsActive,
+			seg.CreatedOn,
+			seg.ValidFrom,
+			seg.ValidTo,
+		)
+		if err != nil {
+			return err
+		}
+		return writeRefs(ctx, tx, seg)
+	})
+	return translateError(err)
 }
 
 func (db *SegmentDB) GetByID(ctx context.Context, id uuid.UUID) (*models.Segment, error) {
 	const sql = `
-SELECT id, segment_name, type, config, description, is_active, created_on
+SELECT id, tenant, segment_name, type, config, description, is_active, created_on, valid_from, valid_to
   FROM segments
- WHERE id = $1;
+ WHERE id = $1
+   AND ($2::text IS NULL OR tenant = $2);
 `
-	row := db.pool.QueryRow(ctx, sql, id)
+	row := db.pool.QueryRow(ctx, sql, id, tenantFilter(ctx))
 	var seg models.Segment
 	if err := row.Scan(
 		&seg.ID,
+		&seg.Tenant,
 		&seg.SegmentName,
 		&seg.Type,
 		&seg.Config,
 		&seg.Description,
 		&seg.IsActive,
 		&seg.CreatedOn,
+		&seg.ValidFrom,
+		&seg.ValidTo,
 	); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
 		return nil, err
 	}
 	return &seg, nil
 }
 
-func (db *SegmentDB) List(ctx context.Context) ([]*models.Segment, error) {
+func (db *SegmentDB) GetByName(ctx context.Context, name string) (*models.Segment, error) {
+	const sql = `
+SELECT id, tenant, segment_name, type, config, description, is_active, created_on, valid_from, valid_to
+  FROM segments
+ WHERE tenant = $1
+   AND segment_name = $2;
+`
+	row := db.pool.QueryRow(ctx, sql, tenant.FromContext(ctx), name)
+	var seg models.Segment
+	if err := row.Scan(
+		&seg.ID,
+		&seg.Tenant,
+		&seg.SegmentName,
+		&seg.Type,
+		&seg.Config,
+		&seg.Description,
+		&seg.IsActive,
+		&seg.CreatedOn,
+		&seg.ValidFrom,
+		&seg.ValidTo,
+	); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &seg, nil
+}
+
+func (db *SegmentDB) List(ctx context.Context, q models.SegmentQuery) ([]*models.Segment, error) {
+	var (
+		where []string
+		args  []any
+	)
+	arg := func(v any) string {
+		args = append(args, v)
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	if t := tenantFilter(ctx); t != nil {
+		where = append(where, "tenant = "+arg(*t))
+	}
+	f := q.Filter
+	if f.Type != nil {
+		where = append(where, "type = "+arg(*f.Type))
+	}
+	if f.IsActive != nil {
+		cond := "(is_active AND (valid_from IS NULL OR valid_from <= now()) AND (valid_to IS NULL OR valid_to > now()))"
+		if !*f.IsActive {
+			cond = "NOT " + cond
+		}
+		where = append(where, cond)
+	}
+	if f.NamePrefix != "" {
+		where = append(where, "segment_name LIKE "+arg(likePrefix(f.NamePrefix)))
+	}
+	if f.CreatedFrom != nil {
+		where = append(where, "created_on >= "+arg(*f.CreatedFrom))
+	}
+	if f.CreatedTo != nil {
+		where = append(where, "created_on < "+arg(*f.CreatedTo))
+	}
+
+	column, desc := "created_on", true
+	switch q.Sort {
+	case models.SortCreatedOnAsc:
+		desc = false
+	case models.SortNameAsc:
+		column, desc = "segment_name", false
+	case models.SortNameDesc:
+		column = "segment_name"
+	}
+	cmp, dir := ">", "ASC"
+	if desc {
+		cmp, dir = "<", "DESC"
+	}
+	if q.After != nil {
+		var key any = q.After.CreatedOn
+		if column == "segment_name" {
+			key = q.After.Name
+		}
+		where = append(where, fmt.Sprintf("(%s, id) %s (%s, %s)", column, cmp, arg(key), arg(q.After.ID)))
+	}
+
+	var sb strings.Builder
+	sb.WriteString(`
+SELECT id, tenant, segment_name, type, config, description, is_active, created_on, valid_from, valid_to
+  FROM segments`)
+	if len(where) > 0 {
+		sb.WriteString("\n WHERE " + strings.Join(where, "\n   AND "))
+	}
+	fmt.Fprintf(&sb, "\n ORDER BY %s %s, id %s", column, dir, dir)
+	if q.Limit > 0 {
+		sb.WriteString("\n LIMIT " + arg(q.Limit))
+	}
+
+	rows, err := db.pool.Query(ctx, sb.String(), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []*models.Segment
+	for rows.Next() {
+		var seg models.Segment
+		if err := rows.Scan(
+			&seg.ID,
+			&seg.Tenant,
+			&seg.SegmentName,
+			&seg.Type,
+			&seg.Config,
+			&seg.Description,
+			&seg.IsActive,
+			&seg.CreatedOn,
+			&seg.ValidFrom,
+			&seg.ValidTo,
+		); err != nil {
+			return nil, err
+		}
+		out = append(out, &seg)
+	}
+	return out, rows.Err()
+}
+
+// ListReferencing возвращает composite-сегменты, в выражении которых упоминается segmentID.
+func (db *SegmentDB) ListReferencing(ctx context.Context, segmentID uuid.UUID) ([]*models.Segment, error) {
+	const sql = `
+SELECT s.id, s.tenant, s.segment_name, s.type, s.config, s.description, s.is_active, s.created_on, s.valid_from, s.valid_to
+  FROM segment_refs r
+  JOIN segments s ON s.id = r.parent_id
+ WHERE r.child_id = $1
+   AND ($2::text IS NULL OR r.tenant = $2)
+ ORDER BY s.segment_name;
+`
+	rows, err := db.pool.Query(ctx, sql, segmentID, tenantFilter(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []*models.Segment
+	for rows.Next() {
+		var seg models.Segment
+		if err := rows.Scan(
+			&seg.ID,
+			&seg.Tenant,
+			&seg.SegmentName,
+			&seg.Type,
+			&seg.Config,
+			&seg.Description,
+			&seg.IsActive,
+			&seg.CreatedOn,
+			&seg.ValidFrom,
+			&seg.ValidTo,
+		); err != nil {
+			return nil, err
+		}
+		out = append(out, &seg)
+	}
+	return out, rows.Err()
+}
+
+// ListReferenced одним запросом обходит выражения composite-сегментов ids вглубь.
+// UNION в рекурсии отбрасывает уже найденные ID, поэтому обход конечен и на циклах.
+func (db *SegmentDB) ListReferenced(ctx context.Context, ids []uuid.UUID) ([]*models.Segment, error) {
 	const sql = `
-SELECT id, segment_name, type, config, description, is_active, created_on
+WITH RECURSIVE refs(id) AS (
+    SELECT (ref #>> '{}')::uuid
+      FROM segments s
+     CROSS JOIN LATERAL jsonb_path_query(s.config, 'strict $.**.segment') AS ref
+     WHERE s.id = ANY($1)
+       AND s.type = 'composite'
+       AND ($2::text IS NULL OR s.tenant = $2)
+    UNION
+    SELECT (ref #>> '{}')::uuid
+      FROM refs r
+      JOIN segments s ON s.id = r.id
+     CROSS JOIN LATERAL jsonb_path_query(s.config, 'strict $.**.segment') AS ref
+     WHERE s.type = 'composite'
+       AND ($2::text IS NULL OR s.tenant = $2)
+)
+SELECT id, tenant, segment_name, type, config, description, is_active, created_on, valid_from, valid_to
   FROM segments
+ WHERE id IN (SELECT id FROM refs)
+   AND ($2::text IS NULL OR tenant = $2);
+`
+	rows, err := db.pool.Query(ctx, sql, ids, tenantFilter(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []*models.Segment
+	for rows.Next() {
+		var seg models.Segment
+		if err := rows.Scan(
+			&seg.ID,
+			&seg.Tenant,
+			&seg.SegmentName,
+			&seg.Type,
+			&seg.Config,
+			&seg.Description,
+			&seg.IsActive,
+			&seg.CreatedOn,
+			&seg.ValidFrom,
+			&seg.ValidTo,
+		); err != nil {
+			return nil, err
+		}
+		out = append(out, &seg)
+	}
+	return out, rows.Err()
+}
+
+// likePrefix превращает префикс в шаблон LIKE, экранируя спецсимволы.
+func likePrefix(prefix string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(prefix) + "%"
+}
+
+func (db *SegmentDB) ListActiveByType(ctx context.Context, segType models.SegmentType) ([]*models.Segment, error) {
+	const sql = `
+SELECT id, tenant, segment_name, type, config, description, is_active, created_on, valid_from, valid_to
+  FROM segments
+ WHERE type = $1
+   AND ($2::text IS NULL OR tenant = $2)
+   AND is_active
+   AND (valid_from IS NULL OR valid_from <= now())
+   AND (valid_to IS NULL OR valid_to > now())
  ORDER BY created_on DESC;
 `
-	rows, err := db.pool.Query(ctx, sql)
+	rows, err := db.pool.Query(ctx, sql, segType, tenantFilter(ctx))
 	if err != nil {
 		return nil, err
 	}
@@ -79,12 +329,15 @@ SELECT id, segment_name, type, config, description, is_active, created_on
 		var seg models.Segment
 		if err := rows.Scan(
 			&seg.ID,
+			&seg.Tenant,
 			&seg.SegmentName,
 			&seg.Type,
 			&seg.Config,
 			&seg.Description,
 			&seg.IsActive,
 			&seg.CreatedOn,
+			&seg.ValidFrom,
+			&seg.ValidTo,
 		); err != nil {
 			return nil, err
 		}
@@ -100,25 +353,202 @@ UPDATE segments
        type         = $3,
        config       = $4,
        description  = $5,
-       is_active    = $6
- WHERE id = $1;
+       is_active    = $6,
+       valid_from   = $7,
+       valid_to     = $8
+ WHERE id = $1
+   AND ($9::text IS NULL OR tenant = $9);
 `
-	_, err := db.pool.Exec(ctx, sql,
-		seg.ID,
-		seg.SegmentName,
-		seg.Type,
-		seg.Config,
-		seg.Description,
-		seg.IsActive,
-	)
-	return err
+	err := pgx.BeginFunc(ctx, db.pool, func(tx pgx.Tx) error {
+		if err := setActor(ctx, tx); err != nil {
+			return err
+		}
+		_, err := tx.Exec(ctx, sql,
+			seg.ID,
+			seg.SegmentName,
+			seg.Type,
+			seg.Config,
+			seg.Description,
+			seg.IsActive,
+			seg.ValidFrom,
+			seg.ValidTo,
+			tenantFilter(ctx),
+		)
+		if err != nil {
+			return err
+		}
+		// UPDATE уже заблокировал строку сегмента, поэтому composite, который
+		// параллельно на него ссылается, либо виден здесь, либо увидит новый тип
+		// (см. writeRefs).
+		if seg.Type == models.SegmentTypeDynamicRule {
+			var referenced bool
+			if err := tx.QueryRow(ctx, referencedSQL, seg.ID).Scan(&referenced); err != nil {
+				return err
+			}
+			if referenced {
+				return ErrRuleReference
+			}
+		}
+		return writeRefs(ctx, tx, seg)
+	})
+	return translateError(err)
+}
+
+const referencedSQL = `SELECT EXISTS (SELECT 1 FROM segment_refs WHERE child_id = $1);`
+
+// writeRefs заменяет ссылки выражения seg в segment_refs и проверяет их в той же
+// транзакции. Внешний ключ не даёт сослаться на удалённый сегмент. FOR SHARE ждёт
+// параллельного изменения сегментов выражения, так что их тип читается уже
+// сохранённым. Выражения одного арендатора меняются по очереди под
+// advisory-блокировкой, поэтому два параллельных изменения не замкнут цикл.
+func writeRefs(ctx context.Context, tx pgx.Tx, seg *models.Segment) error {
+	const deleteSQL = `DELETE FROM segment_refs WHERE parent_id = $1;`
+	const lockSQL = `SELECT pg_advisory_xact_lock(hashtextextended('segment_refs:' || $1::text, 0));`
+	const insertSQL = `
+INSERT INTO segment_refs (tenant, parent_id, child_id)
+SELECT DISTINCT $2, $1, (ref #>> '{}')::uuid
+  FROM jsonb_path_query($3::jsonb, 'strict $.**.segment') AS ref;
+`
+	const typesSQL = `
+SELECT s.type
+  FROM segments s
+  JOIN segment_refs r ON r.child_id = s.id
+ WHERE r.parent_id = $1
+   FOR SHARE OF s;
+`
+	const cycleSQL = `
+WITH RECURSIVE reach(id) AS (
+    SELECT child_id FROM segment_refs WHERE parent_id = $1
+    UNION
+    SELECT r.child_id
+      FROM segment_refs r
+      JOIN reach ON r.parent_id = reach.id
+)
+SELECT EXISTS (SELECT 1 FROM reach WHERE id = $1);
+`
+	if _, err := tx.Exec(ctx, deleteSQL, seg.ID); err != nil {
+		return err
+	}
+	if seg.Type != models.SegmentTypeComposite {
+		return nil
+	}
+	if _, err := tx.Exec(ctx, lockSQL, seg.Tenant); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, insertSQL, seg.ID, seg.Tenant, seg.Config); err != nil {
+		if isForeignKeyViolation(err) {
+			return ErrMissingReference
+		}
+		return err
+	}
+
+	rows, err := tx.Query(ctx, typesSQL, seg.ID)
+	if err != nil {
+		return err
+	}
+	var hasRule bool
+	for rows.Next() {
+		var typ models.SegmentType
+		if err := rows.Scan(&typ); err != nil {
+			rows.Close()
+			return err
+		}
+		hasRule = hasRule || typ == models.SegmentTypeDynamicRule
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if hasRule {
+		return ErrRuleReference
+	}
+
+	var cycle bool
+	if err := tx.QueryRow(ctx, cycleSQL, seg.ID).Scan(&cycle); err != nil {
+		return err
+	}
+	if cycle {
+		return ErrReferenceCycle
+	}
+	return nil
 }
 
 func (db *SegmentDB) Delete(ctx context.Context, id uuid.UUID) error {
 	const sql = `
 DELETE FROM segments
- WHERE id = $1;
+ WHERE id = $1
+   AND ($2::text IS NULL OR tenant = $2);
 `
-	_, err := db.pool.Exec(ctx, sql, id)
-	return err
+	return pgx.BeginFunc(ctx, db.pool, func(tx pgx.Tx) error {
+		if err := setActor(ctx, tx); err != nil {
+			return err
+		}
+		_, err := tx.Exec(ctx, sql, id, tenantFilter(ctx))
+		if isForeignKeyViolation(err) {
+			return ErrReferenced
+		}
+		return err
+	})
+}
+
+// ApplySchedule приводит флаг is_active в соответствие с окнами valid_from/valid_to
+// и записывает каждое переключение в segment_schedule_events. Действует на всех арендаторов.
+// Выключаются сегменты вне окна; включаются только те, что ранее выключил сам планировщик,
+// чтобы не перекрывать ручное выключение.
+func (db *SegmentDB) ApplySchedule(ctx context.Context) (activated, deactivated []uuid.UUID, err error) {
+	const deactivateSQL = `
+WITH flipped AS (
+    UPDATE segments
+       SET is_active = false
+     WHERE is_active
+       AND ((valid_to IS NOT NULL AND valid_to <= now())
+         OR (valid_from IS NOT NULL AND valid_from > now()))
+ RETURNING id
+)
+INSERT INTO segment_schedule_events (segment_id, is_active)
+SELECT id, false FROM flipped
+RETURNING segment_id;
+`
+	const activateSQL = `
+WITH flipped AS (
+    UPDATE segments s
+       SET is_active = true
+     WHERE NOT s.is_active
+       AND (s.valid_from IS NULL OR s.valid_from <= now())
+       AND (s.valid_to IS NULL OR s.valid_to > now())
+       AND (SELECT e.is_active
+              FROM segment_schedule_events e
+             WHERE e.segment_id = s.id
+             ORDER BY e.changed_at DESC, e.id DESC
+             LIMIT 1) = false
+ RETURNING s.id
+)
+INSERT INTO segment_schedule_events (segment_id, is_active)
+SELECT id, true FROM flipped
+RETURNING segment_id;
+`
+	if deactivated, err = db.collectIDs(ctx, deactivateSQL); err != nil {
+		return nil, nil, err
+	}
+	if activated, err = db.collectIDs(ctx, activateSQL); err != nil {
+		return nil, deactivated, err
+	}
+	return activated, deactivated, nil
+}
+
+func (db *SegmentDB) collectIDs(ctx context.Context, sql string, args ...any) ([]uuid.UUID, error) {
+	rows, err := db.pool.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
 }
@@ -7,16 +7,33 @@ import (
 	"github.com/google/uuid"
 )
 
-// SegmentRepository описывает CRUD-операции над сегментами.
+// SegmentRepository описывает CRUD-операции над сегментами. Все методы, кроме
+// ApplySchedule, видят только сегменты арендатора из контекста (см. пакет tenant).
 type SegmentRepository interface {
-	// Create вставляет новый сегмент, заполняя у него ID и CreatedOn
+	// Create вставляет новый сегмент, заполняя у него ID, Tenant и CreatedOn.
+	// Если имя у арендатора занято, возвращает ErrAlreadyExists; ссылки
+	// composite-выражения проверяются в той же транзакции (ErrMissingReference,
+	// ErrRuleReference, ErrReferenceCycle)
 	Create(ctx context.Context, seg *models.Segment) error
-	// GetByID возвращает сегмент по его UUID или ошибку
+	// GetByID возвращает сегмент по его UUID; nil, nil — если сегмента нет
 	GetByID(ctx context.Context, id uuid.UUID) (*models.Segment, error)
-	// List возвращает все сегменты, отсортированные по CreatedOn
-	List(ctx context.Context) ([]*models.Segment, error)
-	// Update перезаписывает все изменяемые поля у существующего сегмента
+	// GetByName возвращает сегмент по имени, уникальному у арендатора; nil, nil — если сегмента нет
+	GetByName(ctx context.Context, name string) (*models.Segment, error)
+	// List возвращает страницу сегментов, отобранных и отсортированных по q
+	List(ctx context.Context, q models.SegmentQuery) ([]*models.Segment, error)
+	// ListActiveByType возвращает активные сегменты заданного типа
+	ListActiveByType(ctx context.Context, segType models.SegmentType) ([]*models.Segment, error)
+	// ListReferencing возвращает composite-сегменты, ссылающиеся на сегмент
+	ListReferencing(ctx context.Context, segmentID uuid.UUID) ([]*models.Segment, error)
+	// ListReferenced возвращает все сегменты, на которые прямо или через другие
+	// composite-сегменты ссылаются выражения сегментов ids. Удалённых среди них нет
+	ListReferenced(ctx context.Context, ids []uuid.UUID) ([]*models.Segment, error)
+	// Update перезаписывает все изменяемые поля у существующего сегмента.
+	// Если новое имя занято, возвращает ErrAlreadyExists; ссылки проверяются, как
+	// в Create, а сегмент из выражения composite не может стать dynamic_rule (ErrRuleReference)
 	Update(ctx context.Context, seg *models.Segment) error
-	// Delete удаляет сегмент по ID
+	// Delete удаляет сегмент по ID. Если на сегмент ссылается composite, возвращает ErrReferenced
 	Delete(ctx context.Context, id uuid.UUID) error
+	// ApplySchedule переключает is_active на границах окон valid_from/valid_to
+	ApplySchedule(ctx context.Context) (activated, deactivated []uuid.UUID, err error)
 }
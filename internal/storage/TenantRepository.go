@@ -0,0 +1,65 @@
+package storage
+
+import (
+	"context"
+
+	"github.com/RaikyD/UserSegmentationService/internal/models"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type TenantDB struct {
+	pool *pgxpool.Pool
+}
+
+// NewTenantDB конструирует репозиторий сводок по арендаторам на основе пула соединений.
+func NewTenantDB(pool *pgxpool.Pool) *TenantDB {
+	return &TenantDB{pool: pool}
+}
+
+// ListUsage считает сегменты и привязки каждого арендатора. Привязка не может
+// ссылаться на сегмент другого арендатора, поэтому арендаторов берём из segments.
+func (db *TenantDB) ListUsage(ctx context.Context) ([]*models.TenantUsage, error) {
+	const sql = `
+SELECT s.tenant, s.segments, s.active_segments,
+       COALESCE(a.assignments, 0), COALESCE(a.users, 0)
+  FROM (
+        SELECT tenant,
+               count(*) AS segments,
+               count(*) FILTER (WHERE is_active
+                                  AND (valid_from IS NULL OR valid_from <= now())
+                                  AND (valid_to IS NULL OR valid_to > now())) AS active_segments
+          FROM segments
+         GROUP BY tenant
+       ) s
+  LEFT JOIN (
+        SELECT tenant,
+               count(*) AS assignments,
+               count(DISTINCT user_id) AS users
+          FROM user_segment_assignment
+         WHERE expires_at IS NULL OR expires_at > now()
+         GROUP BY tenant
+       ) a ON a.tenant = s.tenant
+ ORDER BY s.tenant;
+`
+	rows, err := db.pool.Query(ctx, sql)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []*models.TenantUsage
+	for rows.Next() {
+		var u models.TenantUsage
+		if err := rows.Scan(
+			&u.Tenant,
+			&u.Segments,
+			&u.ActiveSegments,
+			&u.Assignments,
+			&u.Users,
+		); err != nil {
+			return nil, err
+		}
+		out = append(out, &u)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,13 @@
+package storage
+
+import (
+	"context"
+
+	"github.com/RaikyD/UserSegmentationService/internal/models"
+)
+
+// TenantRepository описывает сводки по арендаторам.
+type TenantRepository interface {
+	// ListUsage возвращает всех арендаторов, у которых есть сегменты, в порядке имени
+	ListUsage(ctx context.Context) ([]*models.TenantUsage, error)
+}
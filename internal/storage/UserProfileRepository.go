@@ -0,0 +1,150 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/RaikyD/UserSegmentationService/internal/models"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type UserProfileDB struct {
+	pool *pgxpool.Pool
+}
+
+// NewUserProfileDB конструирует репозиторий пользователей на основе пула соединений.
+func NewUserProfileDB(pool *pgxpool.Pool) *UserProfileDB {
+	return &UserProfileDB{pool: pool}
+}
+
+func (db *UserProfileDB) Create(ctx context.Context, user *models.User) error {
+	now := time.Now()
+	user.CreatedAt = now
+	user.UpdatedAt = now
+
+	const sql = `
+INSERT INTO users
+  (id, attributes, created_at, updated_at)
+VALUES
+  ($1, $2, $3, $4);
+`
+	_, err := db.pool.Exec(ctx, sql,
+		user.ID,
+		user.Attributes,
+		user.CreatedAt,
+		user.UpdatedAt,
+	)
+	return translateError(err)
+}
+
+func (db *UserProfileDB) GetByID(ctx context.Context, id uuid.UUID) (*models.User, error) {
+	const sql = `
+SELECT id, attributes, created_at, updated_at
+  FROM users
+ WHERE id = $1;
+`
+	var user models.User
+	if err := db.pool.QueryRow(ctx, sql, id).Scan(
+		&user.ID,
+		&user.Attributes,
+		&user.CreatedAt,
+		&user.UpdatedAt,
+	); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (db *UserProfileDB) GetMany(ctx context.Context, ids []uuid.UUID) ([]*models.User, error) {
+	const sql = `
+SELECT id, attributes, created_at, updated_at
+  FROM users
+ WHERE id = ANY($1);
+`
+	rows, err := db.pool.Query(ctx, sql, ids)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []*models.User
+	for rows.Next() {
+		var user models.User
+		if err := rows.Scan(
+			&user.ID,
+			&user.Attributes,
+			&user.CreatedAt,
+			&user.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		out = append(out, &user)
+	}
+	return out, rows.Err()
+}
+
+func (db *UserProfileDB) List(ctx context.Context, limit, offset int) ([]*models.User, error) {
+	const sql = `
+SELECT id, attributes, created_at, updated_at
+  FROM users
+ ORDER BY created_at, id
+ LIMIT $1 OFFSET $2;
+`
+	rows, err := db.pool.Query(ctx, sql, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []*models.User
+	for rows.Next() {
+		var user models.User
+		if err := rows.Scan(
+			&user.ID,
+			&user.Attributes,
+			&user.CreatedAt,
+			&user.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		out = append(out, &user)
+	}
+	return out, rows.Err()
+}
+
+func (db *UserProfileDB) Update(ctx context.Context, user *models.User) error {
+	user.UpdatedAt = time.Now()
+
+	const sql = `
+UPDATE users
+   SET attributes = $2,
+       updated_at = $3
+ WHERE id = $1;
+`
+	_, err := db.pool.Exec(ctx, sql,
+		user.ID,
+		user.Attributes,
+		user.UpdatedAt,
+	)
+	return err
+}
+
+func (db *UserProfileDB) Delete(ctx context.Context, id uuid.UUID) error {
+	const sql = `
+DELETE FROM users
+ WHERE id = $1;
+`
+	return pgx.BeginFunc(ctx, db.pool, func(tx pgx.Tx) error {
+		if err := setActor(ctx, tx); err != nil {
+			return err
+		}
+		_, err := tx.Exec(ctx, sql, id)
+		return err
+	})
+}
@@ -0,0 +1,25 @@
+package storage
+
+import (
+	"context"
+
+	"github.com/RaikyD/UserSegmentationService/internal/models"
+	"github.com/google/uuid"
+)
+
+// UserProfileRepository описывает CRUD-операции над таблицей users.
+type UserProfileRepository interface {
+	// Create вставляет пользователя, заполняя CreatedAt/UpdatedAt.
+	// Если пользователь уже есть, возвращает ErrAlreadyExists
+	Create(ctx context.Context, user *models.User) error
+	// GetByID возвращает пользователя по UUID; nil, nil — если пользователя нет
+	GetByID(ctx context.Context, id uuid.UUID) (*models.User, error)
+	// GetMany одним запросом возвращает пользователей ids; отсутствующих в ответе нет
+	GetMany(ctx context.Context, ids []uuid.UUID) ([]*models.User, error)
+	// List возвращает пользователей, отсортированных по CreatedAt
+	List(ctx context.Context, limit, offset int) ([]*models.User, error)
+	// Update перезаписывает атрибуты пользователя
+	Update(ctx context.Context, user *models.User) error
+	// Delete удаляет пользователя вместе со всеми его привязками
+	Delete(ctx context.Context, id uuid.UUID) error
+}
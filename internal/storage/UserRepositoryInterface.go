@@ -2,14 +2,29 @@ package storage
 
 import (
 	"context"
+	"time"
+
 	"github.com/RaikyD/UserSegmentationService/internal/models"
+	"github.com/RaikyD/UserSegmentationService/internal/rollout"
 	"github.com/google/uuid"
 )
 
 type UserRepository interface {
-	Add(ctx context.Context, asg *models.UserSegmentAssignment) error
-	Delete(ctx context.Context, segmentID, userID uuid.UUID) error
-	ListByUser(ctx context.Context, userID uuid.UUID) ([]*models.UserSegmentAssignment, error)
-	ListBySegment(ctx context.Context, segmentID uuid.UUID) ([]*models.UserSegmentAssignment, error)
+	Add(ctx context.Context, asg *models.UserSegmentAssignment, meta models.ChangeMeta) error
+	Delete(ctx context.Context, segmentID, userID uuid.UUID, meta models.ChangeMeta) error
+	ApplyBatch(ctx context.Context, userID uuid.UUID, add []*models.UserSegmentAssignment, remove []uuid.UUID, meta models.ChangeMeta) error
+	ListSegmentsByUser(ctx context.Context, userID, after uuid.UUID, limit int, includeInactive bool) ([]*models.UserSegment, error)
+	ListMemberIDs(ctx context.Context, expr *MemberExpr, after uuid.UUID, limit int) ([]uuid.UUID, error)
+	StreamMemberIDs(ctx context.Context, expr *MemberExpr, fn func(uuid.UUID) error) error
+	CountMembers(ctx context.Context, expr *MemberExpr) (int64, error)
+	AssignedSegmentIDs(ctx context.Context, userID uuid.UUID, segmentIDs []uuid.UUID) ([]uuid.UUID, error)
+	AssignedPairs(ctx context.Context, userIDs, segmentIDs []uuid.UUID) (map[uuid.UUID][]uuid.UUID, error)
+	CheckMembership(ctx context.Context, checks []models.MembershipCheck) ([]*models.MembershipRow, error)
+	StreamBySegment(ctx context.Context, segmentID uuid.UUID, bucket *rollout.Config, fn func(*models.UserSegmentAssignment) error) error
+	ImportSegmentUsers(ctx context.Context, segmentID uuid.UUID, mode models.ImportMode, next func() (uuid.UUID, bool, error), meta models.ChangeMeta) (*models.ImportResult, error)
 	GetAllUserIDs(ctx context.Context) ([]uuid.UUID, error)
+	DeleteExpired(ctx context.Context, limit int) (int64, error)
+	ListByUserAt(ctx context.Context, userID uuid.UUID, at time.Time) ([]*models.UserSegmentAssignment, error)
+	ListHistoryByUser(ctx context.Context, userID uuid.UUID) ([]*models.AssignmentEvent, error)
+	StreamHistory(ctx context.Context, from, to time.Time, fn func(*models.AssignmentEvent) error) error
 }
@@ -2,10 +2,15 @@ package storage
 
 import (
 	"context"
-	"log"
+	"strconv"
+	"time"
 
+	"github.com/RaikyD/UserSegmentationService/internal/audit"
 	"github.com/RaikyD/UserSegmentationService/internal/models"
+	"github.com/RaikyD/UserSegmentationService/internal/rollout"
+	"github.com/RaikyD/UserSegmentationService/internal/tenant"
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
@@ -13,97 +18,541 @@ type UserDB struct {
 	pool *pgxpool.Pool
 }
 
-func (db *UserDB) Add(ctx context.Context, asg *models.UserSegmentAssignment) error {
-	log.Printf("Repo.Add: asg.UserID = %s", asg.UserID)
+func (db *UserDB) Add(ctx context.Context, asg *models.UserSegmentAssignment, meta models.ChangeMeta) error {
+	return pgx.BeginFunc(ctx, db.pool, func(tx pgx.Tx) error {
+		if err := setChangeMeta(ctx, tx, meta); err != nil {
+			return err
+		}
 
-	const sql = `
-		INSERT INTO user_segment_assignment
-		    (segment_id, user_id, assignment_type, assigned_at)
-		VALUES ($1, $2, $3, $4)
-		ON CONFLICT (segment_id, user_id) DO UPDATE 
-		SET assignment_type = EXCLUDED.assignment_type,
-      	assigned_at     = EXCLUDED.assigned_at;
-	`
-	_, err := db.pool.Exec(ctx, sql,
-		asg.SegmentID,
-		asg.UserID,
-		asg.AssignmentType,
-		asg.AssignedAt)
-	return err
+		// Пользователь мог ещё не быть заведён через /users — создаём его с пустыми атрибутами.
+		const ensureUser = `
+			INSERT INTO users (id)
+			VALUES ($1)
+			ON CONFLICT (id) DO NOTHING;
+		`
+		if _, err := tx.Exec(ctx, ensureUser, asg.UserID); err != nil {
+			return err
+		}
+
+		const sql = `
+			INSERT INTO user_segment_assignment
+			    (segment_id, user_id, assignment_type, assigned_at, expires_at, tenant)
+			VALUES ($1, $2, $3, $4, $5, $6)
+			ON CONFLICT (segment_id, user_id) DO UPDATE 
+			SET assignment_type = EXCLUDED.assignment_type,
+	      	assigned_at     = EXCLUDED.assigned_at,
+	      	expires_at      = EXCLUDED.expires_at;
+		`
+		_, err := tx.Exec(ctx, sql,
+			asg.SegmentID,
+			asg.UserID,
+			asg.AssignmentType,
+			asg.AssignedAt,
+			asg.ExpiresAt,
+			tenant.FromContext(ctx))
+		return err
+	})
 }
 
-func (db *UserDB) Delete(ctx context.Context, segmentID, userID uuid.UUID) error {
-	const sql = `
+func (db *UserDB) Delete(ctx context.Context, segmentID, userID uuid.UUID, meta models.ChangeMeta) error {
+	return pgx.BeginFunc(ctx, db.pool, func(tx pgx.Tx) error {
+		if err := setChangeMeta(ctx, tx, meta); err != nil {
+			return err
+		}
+		const sql = `
 DELETE FROM user_segment_assignment
  WHERE segment_id = $1
-   AND user_id    = $2;
+   AND user_id    = $2
+   AND ($3::text IS NULL OR tenant = $3);
+`
+		_, err := tx.Exec(ctx, sql, segmentID, userID, tenantFilter(ctx))
+		return err
+	})
+}
+
+// ApplyBatch в одной транзакции добавляет пользователю привязки add и снимает
+// привязки к сегментам remove. При любой ошибке не применяется ничего.
+func (db *UserDB) ApplyBatch(ctx context.Context, userID uuid.UUID, add []*models.UserSegmentAssignment, remove []uuid.UUID, meta models.ChangeMeta) error {
+	return pgx.BeginFunc(ctx, db.pool, func(tx pgx.Tx) error {
+		if err := setChangeMeta(ctx, tx, meta); err != nil {
+			return err
+		}
+
+		const ensureUser = `
+INSERT INTO users (id)
+VALUES ($1)
+ON CONFLICT (id) DO NOTHING;
 `
-	_, err := db.pool.Exec(ctx, sql, segmentID, userID)
+		if _, err := tx.Exec(ctx, ensureUser, userID); err != nil {
+			return err
+		}
+
+		const addSQL = `
+INSERT INTO user_segment_assignment
+    (segment_id, user_id, assignment_type, assigned_at, expires_at, tenant)
+VALUES ($1, $2, $3, $4, $5, $6)
+ON CONFLICT (segment_id, user_id) DO UPDATE
+SET assignment_type = EXCLUDED.assignment_type,
+    assigned_at     = EXCLUDED.assigned_at,
+    expires_at      = EXCLUDED.expires_at;
+`
+		t := tenant.FromContext(ctx)
+		batch := &pgx.Batch{}
+		for _, asg := range add {
+			batch.Queue(addSQL, asg.SegmentID, userID, asg.AssignmentType, asg.AssignedAt, asg.ExpiresAt, t)
+		}
+		if len(remove) > 0 {
+			const removeSQL = `
+DELETE FROM user_segment_assignment
+ WHERE user_id    = $1
+   AND segment_id = ANY($2)
+   AND ($3::text IS NULL OR tenant = $3);
+`
+			batch.Queue(removeSQL, userID, remove, tenantFilter(ctx))
+		}
+		if batch.Len() == 0 {
+			return nil
+		}
+		return tx.SendBatch(ctx, batch).Close()
+	})
+}
+
+// setChangeMeta передаёт актора и источник изменения триггеру, который ведёт
+// user_segment_history. Настройки действуют до конца транзакции.
+func setChangeMeta(ctx context.Context, tx pgx.Tx, meta models.ChangeMeta) error {
+	const sql = `SELECT set_config('app.actor', $1, true), set_config('app.source', $2, true);`
+	_, err := tx.Exec(ctx, sql, meta.Actor, string(meta.Source))
+	return err
+}
+
+// setActor передаёт актора из контекста запроса триггерам журналов
+// (segment_history, user_segment_history при каскадном удалении).
+func setActor(ctx context.Context, tx pgx.Tx) error {
+	const sql = `SELECT set_config('app.actor', $1, true);`
+	_, err := tx.Exec(ctx, sql, audit.ActorFromContext(ctx))
 	return err
 }
 
-func (db *UserDB) ListByUser(ctx context.Context, userID uuid.UUID) ([]*models.UserSegmentAssignment, error) {
+// ListSegmentsByUser одним запросом возвращает сегменты пользователя вместе с
+// его действующими привязками к ним, в порядке segment_id, начиная строго после after.
+// Без includeInactive сегменты, которые сейчас не действуют, пропускаются.
+func (db *UserDB) ListSegmentsByUser(ctx context.Context, userID, after uuid.UUID, limit int, includeInactive bool) ([]*models.UserSegment, error) {
 	const sql = `
-SELECT segment_id, user_id, assignment_type, assigned_at
-  FROM user_segment_assignment
- WHERE user_id = $1;
+SELECT s.id, s.tenant, s.segment_name, s.type, s.config, s.description, s.is_active, s.created_on, s.valid_from, s.valid_to,
+       a.assignment_type, a.assigned_at, a.expires_at
+  FROM user_segment_assignment a
+  JOIN segments s ON s.id = a.segment_id
+ WHERE a.user_id = $1
+   AND a.segment_id > $2
+   AND ($5::text IS NULL OR a.tenant = $5)
+   AND (a.expires_at IS NULL OR a.expires_at > now())
+   AND ($4 OR (s.is_active
+               AND (s.valid_from IS NULL OR s.valid_from <= now())
+               AND (s.valid_to IS NULL OR s.valid_to > now())))
+ ORDER BY a.segment_id
+ LIMIT $3;
 `
-	rows, err := db.pool.Query(ctx, sql, userID)
+	rows, err := db.pool.Query(ctx, sql, userID, after, limit, includeInactive, tenantFilter(ctx))
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var list []*models.UserSegmentAssignment
+	var list []*models.UserSegment
 	for rows.Next() {
-		var asg models.UserSegmentAssignment
+		var (
+			seg        models.Segment
+			assignedAt time.Time
+			us         = &models.UserSegment{Segment: &seg}
+		)
 		if err := rows.Scan(
-			&asg.SegmentID,
-			&asg.UserID,
-			&asg.AssignmentType,
-			&asg.AssignedAt,
+			&seg.ID,
+			&seg.Tenant,
+			&seg.SegmentName,
+			&seg.Type,
+			&seg.Config,
+			&seg.Description,
+			&seg.IsActive,
+			&seg.CreatedOn,
+			&seg.ValidFrom,
+			&seg.ValidTo,
+			&us.AssignmentType,
+			&assignedAt,
+			&us.ExpiresAt,
 		); err != nil {
 			return nil, err
 		}
-		list = append(list, &asg)
+		us.AssignedAt = &assignedAt
+		list = append(list, us)
 	}
 	return list, rows.Err()
 }
 
-func (db *UserDB) ListBySegment(ctx context.Context, segmentID uuid.UUID) ([]*models.UserSegmentAssignment, error) {
+// ListMemberIDs возвращает участников множества expr в порядке user_id, начиная строго после after.
+func (db *UserDB) ListMemberIDs(ctx context.Context, expr *MemberExpr, after uuid.UUID, limit int) ([]uuid.UUID, error) {
+	var args []any
+	arg := func(v any) string {
+		args = append(args, v)
+		return "$" + strconv.Itoa(len(args))
+	}
+	afterArg, limitArg := arg(after), arg(limit)
+	sql := "SELECT user_id FROM (\n" + expr.sql(arg, afterArg, limitArg) + "\n) members\n ORDER BY user_id\n LIMIT " + limitArg
+
+	rows, err := db.pool.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// StreamMemberIDs построчно передаёт в fn всех участников множества expr. Порядок не определён.
+func (db *UserDB) StreamMemberIDs(ctx context.Context, expr *MemberExpr, fn func(uuid.UUID) error) error {
+	var args []any
+	arg := func(v any) string {
+		args = append(args, v)
+		return "$" + strconv.Itoa(len(args))
+	}
+	sql := expr.sql(arg, arg(uuid.Nil), "")
+
+	rows, err := db.pool.Query(ctx, sql, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var id uuid.UUID
+	for rows.Next() {
+		if err := rows.Scan(&id); err != nil {
+			return err
+		}
+		if err := fn(id); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// CountMembers возвращает число участников множества expr.
+func (db *UserDB) CountMembers(ctx context.Context, expr *MemberExpr) (int64, error) {
+	var args []any
+	arg := func(v any) string {
+		args = append(args, v)
+		return "$" + strconv.Itoa(len(args))
+	}
+	// Ветви не пересекаются, поэтому count(*) не нужно устранять дубли.
+	sql := "SELECT count(*) FROM (\n" + expr.sql(arg, arg(uuid.Nil), "") + "\n) members"
+
+	var n int64
+	err := db.pool.QueryRow(ctx, sql, args...).Scan(&n)
+	return n, err
+}
+
+// AssignedSegmentIDs возвращает те из segmentIDs, к которым у пользователя есть действующая привязка.
+func (db *UserDB) AssignedSegmentIDs(ctx context.Context, userID uuid.UUID, segmentIDs []uuid.UUID) ([]uuid.UUID, error) {
 	const sql = `
-SELECT segment_id, user_id, assignment_type, assigned_at
+SELECT segment_id
   FROM user_segment_assignment
- WHERE segment_id = $1;
+ WHERE user_id = $1
+   AND segment_id = ANY($2)
+   AND ($3::text IS NULL OR tenant = $3)
+   AND (expires_at IS NULL OR expires_at > now());
 `
-	rows, err := db.pool.Query(ctx, sql, segmentID)
+	rows, err := db.pool.Query(ctx, sql, userID, segmentIDs, tenantFilter(ctx))
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var list []*models.UserSegmentAssignment
+	var ids []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// AssignedPairs проверяет пары (userIDs[i], segmentIDs[i]) одним запросом и
+// возвращает для каждого пользователя сегменты из пар, к которым у него есть
+// действующая привязка.
+func (db *UserDB) AssignedPairs(ctx context.Context, userIDs, segmentIDs []uuid.UUID) (map[uuid.UUID][]uuid.UUID, error) {
+	const sql = `
+SELECT a.user_id, a.segment_id
+  FROM unnest($1::uuid[], $2::uuid[]) AS req(user_id, segment_id)
+  JOIN user_segment_assignment a
+    ON a.segment_id = req.segment_id
+   AND a.user_id = req.user_id
+ WHERE ($3::text IS NULL OR a.tenant = $3)
+   AND (a.expires_at IS NULL OR a.expires_at > now());
+`
+	rows, err := db.pool.Query(ctx, sql, userIDs, segmentIDs, tenantFilter(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make(map[uuid.UUID][]uuid.UUID)
+	for rows.Next() {
+		var userID, segmentID uuid.UUID
+		if err := rows.Scan(&userID, &segmentID); err != nil {
+			return nil, err
+		}
+		out[userID] = append(out[userID], segmentID)
+	}
+	return out, rows.Err()
+}
+
+// CheckMembership одним запросом находит для каждой пары сегмент (по ID или имени)
+// и действующую привязку пользователя к нему. Результат идёт в порядке checks.
+func (db *UserDB) CheckMembership(ctx context.Context, checks []models.MembershipCheck) ([]*models.MembershipRow, error) {
+	const sql = `
+SELECT s.id, s.tenant, s.segment_name, s.type, s.config, s.description, s.is_active, s.created_on, s.valid_from, s.valid_to,
+       a.assignment_type
+  FROM unnest($1::uuid[], $2::uuid[], $3::text[]) WITH ORDINALITY AS req(user_id, segment_id, segment_name, ord)
+  LEFT JOIN segments s
+         ON s.tenant = $4
+        AND (s.id = req.segment_id
+             OR s.segment_name = NULLIF(req.segment_name, ''))
+  LEFT JOIN user_segment_assignment a
+         ON a.segment_id = s.id
+        AND a.user_id = req.user_id
+        AND (a.expires_at IS NULL OR a.expires_at > now())
+ ORDER BY req.ord;
+`
+	userIDs := make([]uuid.UUID, len(checks))
+	segmentIDs := make([]uuid.UUID, len(checks))
+	names := make([]string, len(checks))
+	for i, c := range checks {
+		userIDs[i] = c.UserID
+		// Ссылка — либо UUID, либо имя; второе поле остаётся пустым и ничего не находит.
+		if id, err := uuid.Parse(c.Segment); err == nil {
+			segmentIDs[i] = id
+		} else {
+			names[i] = c.Segment
+		}
+	}
+
+	rows, err := db.pool.Query(ctx, sql, userIDs, segmentIDs, names, tenant.FromContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]*models.MembershipRow, 0, len(checks))
+	for rows.Next() {
+		var (
+			id          *uuid.UUID
+			segTenant   *string
+			name        *string
+			segType     *models.SegmentType
+			description *string
+			isActive    *bool
+			createdOn   *time.Time
+			asgType     *models.AssignmentType
+			seg         models.Segment
+		)
+		if err := rows.Scan(
+			&id,
+			&segTenant,
+			&name,
+			&segType,
+			&seg.Config,
+			&description,
+			&isActive,
+			&createdOn,
+			&seg.ValidFrom,
+			&seg.ValidTo,
+			&asgType,
+		); err != nil {
+			return nil, err
+		}
+		row := &models.MembershipRow{}
+		if id != nil {
+			seg.ID = *id
+			seg.Tenant = *segTenant
+			seg.SegmentName = *name
+			seg.Type = *segType
+			seg.IsActive = *isActive
+			seg.CreatedOn = *createdOn
+			if description != nil {
+				seg.Description = *description
+			}
+			row.Segment = &seg
+		}
+		if asgType != nil {
+			row.AssignmentType = *asgType
+		}
+		out = append(out, row)
+	}
+	return out, rows.Err()
+}
+
+// StreamBySegment построчно передаёт в fn всех участников сегмента, не накапливая их в памяти.
+// Если задан bucket, после явных привязок идут пользователи из корзин раскатки
+// с типом AssignmentRollout. Порядок строк не определён.
+func (db *UserDB) StreamBySegment(ctx context.Context, segmentID uuid.UUID, bucket *rollout.Config, fn func(*models.UserSegmentAssignment) error) error {
+	const assignedSQL = `
+SELECT segment_id, user_id, assignment_type, assigned_at, expires_at
+  FROM user_segment_assignment
+ WHERE segment_id = $1
+   AND (expires_at IS NULL OR expires_at > now());
+`
+	const withRolloutSQL = `
+SELECT segment_id, user_id, assignment_type, assigned_at, expires_at
+  FROM user_segment_assignment
+ WHERE segment_id = $1
+   AND (expires_at IS NULL OR expires_at > now())
+UNION ALL
+SELECT $1, u.id, 'rollout', NULL::timestamptz, NULL::timestamptz
+  FROM users u
+ WHERE rollout_bucket($2, u.id) < $3
+   AND NOT EXISTS (
+       SELECT 1
+         FROM user_segment_assignment a
+        WHERE a.segment_id = $1
+          AND a.user_id = u.id
+          AND (a.expires_at IS NULL OR a.expires_at > now())
+   );
+`
+	var (
+		rows pgx.Rows
+		err  error
+	)
+	if bucket != nil {
+		rows, err = db.pool.Query(ctx, withRolloutSQL, segmentID, bucket.Salt, bucket.Threshold())
+	} else {
+		rows, err = db.pool.Query(ctx, assignedSQL, segmentID)
+	}
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var asg models.UserSegmentAssignment
+	var assignedAt *time.Time
 	for rows.Next() {
-		var asg models.UserSegmentAssignment
 		if err := rows.Scan(
 			&asg.SegmentID,
 			&asg.UserID,
 			&asg.AssignmentType,
-			&asg.AssignedAt,
+			&assignedAt,
+			&asg.ExpiresAt,
 		); err != nil {
-			return nil, err
+			return err
+		}
+		asg.AssignedAt = time.Time{}
+		if assignedAt != nil {
+			asg.AssignedAt = *assignedAt
+		}
+		if err := fn(&asg); err != nil {
+			return err
 		}
-		list = append(list, &asg)
 	}
-	return list, rows.Err()
+	return rows.Err()
 }
 
-// GetAllUserIDs получает все уникальные user_id из таблицы user_segment
+// ImportSegmentUsers загружает пользователей, которых отдаёт next, во временную таблицу
+// через COPY и одной транзакцией сливает их в привязки сегмента. next возвращает ok=false,
+// когда пользователи закончились. Действующие привязки не меняются, истёкшие возобновляются.
+func (db *UserDB) ImportSegmentUsers(ctx context.Context, segmentID uuid.UUID, mode models.ImportMode, next func() (uuid.UUID, bool, error), meta models.ChangeMeta) (*models.ImportResult, error) {
+	var res models.ImportResult
+	err := pgx.BeginFunc(ctx, db.pool, func(tx pgx.Tx) error {
+		if err := setChangeMeta(ctx, tx, meta); err != nil {
+			return err
+		}
+
+		const createStaging = `
+CREATE TEMP TABLE import_staging (user_id UUID NOT NULL) ON COMMIT DROP;
+`
+		if _, err := tx.Exec(ctx, createStaging); err != nil {
+			return err
+		}
+		_, err := tx.CopyFrom(ctx, pgx.Identifier{"import_staging"}, []string{"user_id"},
+			pgx.CopyFromFunc(func() ([]any, error) {
+				id, ok, err := next()
+				if err != nil || !ok {
+					return nil, err
+				}
+				return []any{id}, nil
+			}))
+		if err != nil {
+			return err
+		}
+
+		const dedupe = `
+CREATE TEMP TABLE import_users ON COMMIT DROP AS
+SELECT DISTINCT user_id FROM import_staging;
+`
+		tag, err := tx.Exec(ctx, dedupe)
+		if err != nil {
+			return err
+		}
+		res.Staged = tag.RowsAffected()
+
+		if mode == models.ImportReplace {
+			const removeMissing = `
+DELETE FROM user_segment_assignment a
+ WHERE a.segment_id = $1
+   AND NOT EXISTS (SELECT 1 FROM import_users i WHERE i.user_id = a.user_id);
+`
+			tag, err := tx.Exec(ctx, removeMissing, segmentID)
+			if err != nil {
+				return err
+			}
+			res.Removed = tag.RowsAffected()
+		}
+
+		// Пользователи могли ещё не быть заведены через /users — создаём их с пустыми атрибутами.
+		const ensureUsers = `
+INSERT INTO users (id)
+SELECT user_id FROM import_users
+ON CONFLICT (id) DO NOTHING;
+`
+		if _, err := tx.Exec(ctx, ensureUsers); err != nil {
+			return err
+		}
+
+		const insertAssignments = `
+INSERT INTO user_segment_assignment (segment_id, user_id, assignment_type, assigned_at, tenant)
+SELECT $1, user_id, $2, now(), $3
+  FROM import_users
+ON CONFLICT (segment_id, user_id) DO UPDATE
+SET assignment_type = EXCLUDED.assignment_type,
+    assigned_at     = EXCLUDED.assigned_at,
+    expires_at      = NULL
+WHERE user_segment_assignment.expires_at <= now();
+`
+		tag, err = tx.Exec(ctx, insertAssignments, segmentID, models.AssignmentManual, tenant.FromContext(ctx))
+		if err != nil {
+			return err
+		}
+		res.Added = tag.RowsAffected()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// GetAllUserIDs получает идентификаторы всех пользователей из таблицы users
 func (db *UserDB) GetAllUserIDs(ctx context.Context) ([]uuid.UUID, error) {
 	const sql = `
-		SELECT DISTINCT user_id 
-		FROM user_segment_assignment
-		ORDER BY user_id;
+		SELECT id
+		FROM users
+		ORDER BY id;
 	`
 	rows, err := db.pool.Query(ctx, sql)
 	if err != nil {
@@ -122,6 +571,144 @@ func (db *UserDB) GetAllUserIDs(ctx context.Context) ([]uuid.UUID, error) {
 	return userIDs, rows.Err()
 }
 
+// ListByUserAt восстанавливает по журналу привязки пользователя на момент at.
+func (db *UserDB) ListByUserAt(ctx context.Context, userID uuid.UUID, at time.Time) ([]*models.UserSegmentAssignment, error) {
+	const sql = `
+SELECT segment_id, user_id, source, occurred_at, expires_at
+  FROM (
+        SELECT DISTINCT ON (segment_id)
+               segment_id, user_id, operation, source, occurred_at, expires_at
+          FROM user_segment_history
+         WHERE user_id = $1
+           AND occurred_at <= $2
+           AND ($3::text IS NULL OR tenant = $3)
+         ORDER BY segment_id, occurred_at DESC, id DESC
+       ) last
+ WHERE operation = 'assign'
+   AND (expires_at IS NULL OR expires_at > $2);
+`
+	rows, err := db.pool.Query(ctx, sql, userID, at, tenantFilter(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []*models.UserSegmentAssignment
+	for rows.Next() {
+		var asg models.UserSegmentAssignment
+		var source models.ChangeSource
+		if err := rows.Scan(
+			&asg.SegmentID,
+			&asg.UserID,
+			&source,
+			&asg.AssignedAt,
+			&asg.ExpiresAt,
+		); err != nil {
+			return nil, err
+		}
+		asg.AssignmentType = models.AssignmentAuto
+		if source == models.SourceManual {
+			asg.AssignmentType = models.AssignmentManual
+		}
+		list = append(list, &asg)
+	}
+	return list, rows.Err()
+}
+
+// ListHistoryByUser возвращает журнал изменений привязок пользователя в хронологическом порядке.
+func (db *UserDB) ListHistoryByUser(ctx context.Context, userID uuid.UUID) ([]*models.AssignmentEvent, error) {
+	const sql = `
+SELECT id, segment_id, user_id, operation, source, actor, expires_at, occurred_at
+  FROM user_segment_history
+ WHERE user_id = $1
+   AND ($2::text IS NULL OR tenant = $2)
+ ORDER BY occurred_at, id;
+`
+	rows, err := db.pool.Query(ctx, sql, userID, tenantFilter(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []*models.AssignmentEvent
+	for rows.Next() {
+		var ev models.AssignmentEvent
+		if err := rows.Scan(
+			&ev.ID,
+			&ev.SegmentID,
+			&ev.UserID,
+			&ev.Operation,
+			&ev.Source,
+			&ev.Actor,
+			&ev.ExpiresAt,
+			&ev.OccurredAt,
+		); err != nil {
+			return nil, err
+		}
+		list = append(list, &ev)
+	}
+	return list, rows.Err()
+}
+
+// StreamHistory построчно передаёт в fn события журнала за период [from, to),
+// не накапливая их в памяти. Порядок — по пользователю, затем по времени.
+func (db *UserDB) StreamHistory(ctx context.Context, from, to time.Time, fn func(*models.AssignmentEvent) error) error {
+	const sql = `
+SELECT h.id, h.segment_id, COALESCE(s.segment_name, ''), h.user_id,
+       h.operation, h.source, h.actor, h.expires_at, h.occurred_at
+  FROM user_segment_history h
+  LEFT JOIN segments s ON s.id = h.segment_id
+ WHERE h.occurred_at >= $1
+   AND h.occurred_at <  $2
+   AND ($3::text IS NULL OR h.tenant = $3)
+ ORDER BY h.user_id, h.occurred_at, h.id;
+`
+	rows, err := db.pool.Query(ctx, sql, from, to, tenantFilter(ctx))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var ev models.AssignmentEvent
+	for rows.Next() {
+		if err := rows.Scan(
+			&ev.ID,
+			&ev.SegmentID,
+			&ev.SegmentName,
+			&ev.UserID,
+			&ev.Operation,
+			&ev.Source,
+			&ev.Actor,
+			&ev.ExpiresAt,
+			&ev.OccurredAt,
+		); err != nil {
+			return err
+		}
+		if err := fn(&ev); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// DeleteExpired удаляет не более limit истёкших привязок и возвращает число удалённых строк.
+func (db *UserDB) DeleteExpired(ctx context.Context, limit int) (int64, error) {
+	const sql = `
+DELETE FROM user_segment_assignment
+ WHERE ctid IN (
+       SELECT ctid
+         FROM user_segment_assignment
+        WHERE expires_at <= now()
+        LIMIT $1
+ );
+`
+	tag, err := db.pool.Exec(ctx, sql, limit)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
 func NewUserDB(pool *pgxpool.Pool) *UserDB {
 	return &UserDB{pool: pool}
 }
@@ -0,0 +1,45 @@
+package storage
+
+import (
+	"errors"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// ErrAlreadyExists возвращается при нарушении ограничения уникальности.
+var ErrAlreadyExists = errors.New("already exists")
+
+// Ошибки ссылок composite-сегментов. Репозиторий проверяет ссылки в транзакции
+// записи, поэтому они ловят и изменения, параллельные проверкам сервиса.
+var (
+	// ErrReferenced — удаляемый сегмент упоминается в выражении composite-сегмента.
+	ErrReferenced = errors.New("segment is referenced by composite segments")
+	// ErrMissingReference — выражение ссылается на сегмент, которого нет.
+	ErrMissingReference = errors.New("referenced segment does not exist")
+	// ErrReferenceCycle — выражение прямо или через другие composite ссылается на свой сегмент.
+	ErrReferenceCycle = errors.New("composite segment expression contains a cycle")
+	// ErrRuleReference — выражение ссылается на dynamic_rule-сегмент.
+	ErrRuleReference = errors.New("composite segment references a dynamic_rule segment")
+)
+
+// SQLSTATE ошибок Postgres, которые важны вызывающему коду.
+const (
+	uniqueViolation     = "23505"
+	foreignKeyViolation = "23503"
+)
+
+// translateError заменяет ошибки драйвера, которые важны вызывающему коду,
+// на ошибки пакета storage.
+func translateError(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+		return ErrAlreadyExists
+	}
+	return err
+}
+
+// isForeignKeyViolation сообщает, нарушен ли внешний ключ.
+func isForeignKeyViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == foreignKeyViolation
+}
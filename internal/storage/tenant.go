@@ -0,0 +1,18 @@
+package storage
+
+import (
+	"context"
+
+	"github.com/RaikyD/UserSegmentationService/internal/tenant"
+)
+
+// tenantFilter возвращает арендатора, которым ограничиваются запросы, или nil,
+// если в контексте ограничение снято через tenant.WithAll. В SQL передаётся
+// как ($N::text IS NULL OR tenant = $N).
+func tenantFilter(ctx context.Context) *string {
+	if tenant.All(ctx) {
+		return nil
+	}
+	t := tenant.FromContext(ctx)
+	return &t
+}
@@ -0,0 +1,48 @@
+// Package tenant переносит через context арендатора (пространство имён сегментов),
+// в пределах которого выполняется запрос.
+package tenant
+
+import (
+	"context"
+	"regexp"
+)
+
+// Default — арендатор запросов, которые его не указали, и всех данных,
+// созданных до появления арендаторов.
+const Default = "default"
+
+var namePattern = regexp.MustCompile(`^[a-z][a-z0-9_-]{0,62}$`)
+
+// Valid сообщает, годится ли name в имена арендаторов.
+func Valid(name string) bool {
+	return namePattern.MatchString(name)
+}
+
+type tenantKey struct{}
+
+type allKey struct{}
+
+// With возвращает контекст с заданным арендатором.
+func With(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, name)
+}
+
+// FromContext возвращает арендатора из контекста или Default.
+func FromContext(ctx context.Context) string {
+	if name, ok := ctx.Value(tenantKey{}).(string); ok && name != "" {
+		return name
+	}
+	return Default
+}
+
+// WithAll возвращает контекст, в котором хранилище не ограничивает запросы
+// арендатором. Нужен фоновым задачам, обходящим данные всех арендаторов.
+func WithAll(ctx context.Context) context.Context {
+	return context.WithValue(ctx, allKey{}, true)
+}
+
+// All сообщает, снято ли в контексте ограничение по арендатору.
+func All(ctx context.Context) bool {
+	all, _ := ctx.Value(allKey{}).(bool)
+	return all
+}
@@ -0,0 +1,44 @@
+package tenant
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestValid(t *testing.T) {
+	tests := map[string]bool{
+		"default":                     true,
+		"acme-eu_2":                   true,
+		"a":                           true,
+		"":                            false,
+		"Acme":                        false,
+		"2acme":                       false,
+		"acme corp":                   false,
+		"a" + strings.Repeat("b", 62): true,
+		"a" + strings.Repeat("b", 63): false,
+	}
+	for name, want := range tests {
+		if got := Valid(name); got != want {
+			t.Errorf("Valid(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestContext(t *testing.T) {
+	ctx := context.Background()
+	if got := FromContext(ctx); got != Default {
+		t.Errorf("FromContext(empty) = %q, want %q", got, Default)
+	}
+	if got := FromContext(With(ctx, "")); got != Default {
+		t.Errorf("FromContext(With(\"\")) = %q, want %q", got, Default)
+	}
+	acme := With(ctx, "acme")
+	if got := FromContext(acme); got != "acme" || All(acme) {
+		t.Errorf("FromContext = %q, All = %v", got, All(acme))
+	}
+	all := WithAll(acme)
+	if !All(all) || FromContext(all) != "acme" || All(ctx) {
+		t.Error("WithAll must lift the filter without dropping the tenant")
+	}
+}
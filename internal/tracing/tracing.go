@@ -0,0 +1,119 @@
+// Package tracing настраивает трассировку OpenTelemetry: провайдер спанов,
+// пропагацию W3C traceparent, спаны HTTP-запросов и запросов к БД.
+//
+// Пока Setup не вызван, глобальный провайдер ничего не записывает, поэтому
+// спаны в коде ничего не стоят, если трассировка выключена.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/RaikyD/UserSegmentationService/internal/buildinfo"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	instrumentationName = "github.com/RaikyD/UserSegmentationService"
+	defaultServiceName  = "user-segmentation-service"
+)
+
+// Экспортёры, которые можно выбрать через OTEL_TRACES_EXPORTER.
+const (
+	ExporterNone   = "none"
+	ExporterOTLP   = "otlp"
+	ExporterStdout = "stdout"
+)
+
+// Setup включает трассировку с экспортёром из OTEL_TRACES_EXPORTER (по умолчанию
+// none — трассировка выключена). Адрес коллектора, заголовки, сэмплер и имя
+// сервиса берутся из стандартных переменных OTEL_EXPORTER_OTLP_*, OTEL_TRACES_SAMPLER*,
+// OTEL_SERVICE_NAME и OTEL_RESOURCE_ATTRIBUTES. Возвращает функцию, которая
+// дописывает накопленные спаны при остановке.
+func Setup(ctx context.Context) (func(context.Context) error, error) {
+	name := strings.ToLower(os.Getenv("OTEL_TRACES_EXPORTER"))
+	var exp sdktrace.SpanExporter
+	switch name {
+	case "", ExporterNone:
+		otel.SetTextMapPropagator(propagator())
+		return func(context.Context) error { return nil }, nil
+	case ExporterOTLP:
+		e, err := otlptracehttp.New(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("otlp exporter: %w", err)
+		}
+		exp = e
+	case ExporterStdout, "console":
+		e, err := stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+		if err != nil {
+			return nil, fmt.Errorf("stdout exporter: %w", err)
+		}
+		exp = e
+	default:
+		return nil, fmt.Errorf("unknown OTEL_TRACES_EXPORTER %q, expected otlp, stdout or none", name)
+	}
+
+	res, err := resource.New(ctx,
+		resource.WithSchemaURL(semconv.SchemaURL),
+		resource.WithAttributes(
+			semconv.ServiceName(defaultServiceName),
+			semconv.ServiceVersion(buildinfo.Version),
+		),
+		resource.WithFromEnv(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("trace resource: %w", err)
+	}
+	tp := Install(exp, sdktrace.WithBatcher(exp), sdktrace.WithResource(res))
+	return tp.Shutdown, nil
+}
+
+// Install делает провайдер с экспортёром exp глобальным и включает пропагацию
+// W3C. Без опций спаны отдаются экспортёру синхронно, что удобно в тестах:
+//
+//	exp := tracetest.NewInMemoryExporter()
+//	tp := tracing.Install(exp)
+//	defer tp.Shutdown(ctx)
+func Install(exp sdktrace.SpanExporter, opts ...sdktrace.TracerProviderOption) *sdktrace.TracerProvider {
+	if len(opts) == 0 {
+		opts = []sdktrace.TracerProviderOption{sdktrace.WithSyncer(exp)}
+	}
+	tp := sdktrace.NewTracerProvider(opts...)
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagator())
+	return tp
+}
+
+func propagator() propagation.TextMapPropagator {
+	return propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+}
+
+// Tracer возвращает трассировщик сервиса из глобального провайдера.
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName)
+}
+
+// Start открывает внутренний спан с именем name.
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return Tracer().Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// End закрывает спан и помечает его ошибкой, если err не nil.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
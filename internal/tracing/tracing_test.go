@@ -0,0 +1,116 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// install ставит провайдер с экспортёром в память и снимает его после теста.
+func install(t *testing.T) *tracetest.InMemoryExporter {
+	t.Helper()
+	exp := tracetest.NewInMemoryExporter()
+	tp := Install(exp)
+	t.Cleanup(func() { _ = tp.Shutdown(context.Background()) })
+	return exp
+}
+
+func attrValue(attrs []attribute.KeyValue, key attribute.Key) attribute.Value {
+	for _, a := range attrs {
+		if a.Key == key {
+			return a.Value
+		}
+	}
+	return attribute.Value{}
+}
+
+func TestMiddleware(t *testing.T) {
+	exp := install(t)
+	r := chi.NewRouter()
+	r.Use(Middleware)
+	r.Get("/segments/{segmentID}", func(w http.ResponseWriter, r *http.Request) {
+		if chi.URLParam(r, "segmentID") == "broken" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	})
+
+	const parent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	req := httptest.NewRequest(http.MethodGet, "/segments/a", nil)
+	req.Header.Set("traceparent", parent)
+	r.ServeHTTP(httptest.NewRecorder(), req)
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/segments/broken", nil))
+
+	spans := exp.GetSpans()
+	if len(spans) != 2 {
+		t.Fatalf("got %d spans, want 2", len(spans))
+	}
+	ok, broken := spans[0], spans[1]
+	if ok.Name != "GET /segments/{segmentID}" || attrValue(ok.Attributes, "http.route").AsString() != "/segments/{segmentID}" {
+		t.Errorf("span = %s %v", ok.Name, ok.Attributes)
+	}
+	if ok.Parent.TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" || ok.SpanContext.TraceID() != ok.Parent.TraceID() {
+		t.Errorf("span did not continue the traceparent trace: parent %v", ok.Parent)
+	}
+	if ok.Status.Code != codes.Unset || attrValue(ok.Attributes, "http.response.status_code").AsInt64() != 200 {
+		t.Errorf("ok span status = %v", ok.Status)
+	}
+	if broken.Status.Code != codes.Error || broken.Parent.IsValid() {
+		t.Errorf("broken span: status %v, parent %v", broken.Status, broken.Parent)
+	}
+}
+
+func TestQueryTracer(t *testing.T) {
+	exp := install(t)
+	var qt QueryTracer
+
+	// Без родительского спана запросы не трассируются.
+	ctx := qt.TraceQueryStart(context.Background(), nil, pgx.TraceQueryStartData{SQL: "SELECT 1"})
+	qt.TraceQueryEnd(ctx, nil, pgx.TraceQueryEndData{})
+	if n := len(exp.GetSpans()); n != 0 {
+		t.Fatalf("got %d spans without a parent, want 0", n)
+	}
+
+	parent, span := Start(context.Background(), "parent")
+	ctx = qt.TraceQueryStart(parent, nil, pgx.TraceQueryStartData{SQL: "\n  update segments SET x = $1"})
+	qt.TraceQueryEnd(ctx, nil, pgx.TraceQueryEndData{CommandTag: pgconn.NewCommandTag("UPDATE 3")})
+	ctx = qt.TraceQueryStart(parent, nil, pgx.TraceQueryStartData{SQL: "SELECT 1"})
+	qt.TraceQueryEnd(ctx, nil, pgx.TraceQueryEndData{Err: errors.New("boom")})
+	End(span, nil)
+
+	spans := exp.GetSpans()
+	if len(spans) != 3 {
+		t.Fatalf("got %d spans, want 3", len(spans))
+	}
+	upd, failed := spans[0], spans[1]
+	if upd.Name != "db UPDATE" || upd.Parent.SpanID() != spans[2].SpanContext.SpanID() {
+		t.Errorf("update span = %s, parent %v", upd.Name, upd.Parent)
+	}
+	if got := attrValue(upd.Attributes, "db.rows_affected").AsInt64(); got != 3 {
+		t.Errorf("db.rows_affected = %d, want 3", got)
+	}
+	if failed.Status.Code != codes.Error || failed.Status.Description != "boom" || len(failed.Events) != 1 {
+		t.Errorf("failed span status = %v, events %v", failed.Status, failed.Events)
+	}
+}
+
+func TestSQLOperation(t *testing.T) {
+	tests := map[string]string{
+		"SELECT 1":                     "SELECT",
+		"\n  with x AS (SELECT 1) ...": "WITH",
+		"":                             "query",
+	}
+	for sql, want := range tests {
+		if got := sqlOperation(sql); got != want {
+			t.Errorf("sqlOperation(%q) = %q, want %q", sql, got, want)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package worker
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/RaikyD/UserSegmentationService/internal/storage"
+)
+
+// SweepStats — состояние чистильщика истёкших привязок.
+type SweepStats struct {
+	Interval     time.Duration `json:"interval"`
+	StartedAt    time.Time     `json:"started_at"`
+	Runs         int64         `json:"runs"`
+	LastRunAt    time.Time     `json:"last_run_at"`
+	LastDeleted  int64         `json:"last_deleted"`
+	TotalDeleted int64         `json:"total_deleted"`
+	LastError    string        `json:"last_error,omitempty"`
+}
+
+// ExpirySweeper периодически удаляет истёкшие привязки пачками по batchSize строк.
+type ExpirySweeper struct {
+	repo      storage.UserRepository
+	interval  time.Duration
+	batchSize int
+	log       *slog.Logger
+
+	mu    sync.Mutex
+	stats SweepStats
+}
+
+// NewExpirySweeper создаёт чистильщик. Запускается через Run.
+func NewExpirySweeper(repo storage.UserRepository, interval time.Duration, batchSize int, logger *slog.Logger) *ExpirySweeper {
+	return &ExpirySweeper{
+		repo:      repo,
+		interval:  interval,
+		batchSize: batchSize,
+		log:       logger,
+		stats:     SweepStats{Interval: interval},
+	}
+}
+
+// Run выполняет проходы раз в interval, пока не отменён ctx.
+func (s *ExpirySweeper) Run(ctx context.Context) {
+	s.mu.Lock()
+	s.stats.StartedAt = time.Now()
+	s.mu.Unlock()
+	s.log.Info("expiry sweeper started", "interval", s.interval, "batch", s.batchSize)
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		s.Sweep(ctx)
+		select {
+		case <-ctx.Done():
+			s.log.Info("expiry sweeper stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sweep удаляет все истёкшие привязки, повторяя пачки, пока очередная пачка заполнена.
+func (s *ExpirySweeper) Sweep(ctx context.Context) {
+	start := time.Now()
+	var deleted int64
+	var sweepErr error
+	for ctx.Err() == nil {
+		n, err := s.repo.DeleteExpired(ctx, s.batchSize)
+		if err != nil {
+			sweepErr = err
+			break
+		}
+		deleted += n
+		if n < int64(s.batchSize) {
+			break
+		}
+	}
+
+	s.mu.Lock()
+	s.stats.Runs++
+	s.stats.LastRunAt = start
+	s.stats.LastDeleted = deleted
+	s.stats.TotalDeleted += deleted
+	s.stats.LastError = ""
+	if sweepErr != nil {
+		s.stats.LastError = sweepErr.Error()
+	}
+	s.mu.Unlock()
+
+	if sweepErr != nil {
+		s.log.Error("expiry sweep failed", "deleted", deleted, "error", sweepErr)
+		return
+	}
+	if deleted > 0 {
+		s.log.Info("expiry sweep done", "deleted", deleted, "duration", time.Since(start))
+	}
+}
+
+// Stats возвращает снимок статистики чистильщика.
+func (s *ExpirySweeper) Stats() SweepStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stats
+}
+
+// Heartbeat возвращает данные для проверки готовности: не завис ли проход.
+func (s *ExpirySweeper) Heartbeat() Heartbeat {
+	st := s.Stats()
+	return Heartbeat{Interval: st.Interval, StartedAt: st.StartedAt, LastRunAt: st.LastRunAt}
+}
@@ -0,0 +1,64 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/RaikyD/UserSegmentationService/internal/logging"
+	"github.com/RaikyD/UserSegmentationService/internal/storage"
+)
+
+// fakeExpired отдаёт заранее заданные размеры пачек DeleteExpired.
+type fakeExpired struct {
+	storage.UserRepository
+	batches []int64
+	err     error
+	calls   int
+}
+
+func (f *fakeExpired) DeleteExpired(_ context.Context, limit int) (int64, error) {
+	f.calls++
+	if len(f.batches) == 0 {
+		return 0, f.err
+	}
+	n := f.batches[0]
+	f.batches = f.batches[1:]
+	return n, nil
+}
+
+func TestSweep(t *testing.T) {
+	tests := []struct {
+		name      string
+		batches   []int64
+		err       error
+		wantCalls int
+		wantRows  int64
+		wantError bool
+	}{
+		{"nothing expired", nil, nil, 1, 0, false},
+		{"short batch stops", []int64{3}, nil, 1, 3, false},
+		{"full batches repeat", []int64{10, 10, 4}, nil, 3, 24, false},
+		{"exact multiple needs an empty batch", []int64{10, 10}, nil, 3, 20, false},
+		{"error keeps deleted rows", []int64{10}, errors.New("boom"), 2, 10, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &fakeExpired{batches: tt.batches, err: tt.err}
+			s := NewExpirySweeper(repo, time.Minute, 10, logging.Discard())
+			s.Sweep(context.Background())
+
+			st := s.Stats()
+			if repo.calls != tt.wantCalls {
+				t.Errorf("DeleteExpired called %d times, want %d", repo.calls, tt.wantCalls)
+			}
+			if st.Runs != 1 || st.LastDeleted != tt.wantRows || st.TotalDeleted != tt.wantRows {
+				t.Errorf("stats = %+v, want 1 run and %d rows", st, tt.wantRows)
+			}
+			if (st.LastError != "") != tt.wantError {
+				t.Errorf("LastError = %q, want error %v", st.LastError, tt.wantError)
+			}
+		})
+	}
+}
@@ -0,0 +1,24 @@
+package worker
+
+import "time"
+
+// Heartbeat — когда воркер запущен, с каким интервалом работает и когда
+// завершил последний проход.
+type Heartbeat struct {
+	Interval  time.Duration
+	StartedAt time.Time
+	LastRunAt time.Time
+}
+
+// Stale сообщает, что воркер запущен, но не завершал проходов дольше
+// maxMissed интервалов. Обычно это значит, что проход завис на БД.
+func (h Heartbeat) Stale(now time.Time, maxMissed int) bool {
+	if h.StartedAt.IsZero() {
+		return false
+	}
+	last := h.LastRunAt
+	if last.Before(h.StartedAt) {
+		last = h.StartedAt
+	}
+	return now.Sub(last) > time.Duration(maxMissed)*h.Interval
+}
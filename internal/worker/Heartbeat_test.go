@@ -0,0 +1,27 @@
+package worker
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHeartbeatStale(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name string
+		hb   Heartbeat
+		want bool
+	}{
+		{"not started", Heartbeat{Interval: time.Minute}, false},
+		{"recent run", Heartbeat{Interval: time.Minute, StartedAt: now.Add(-time.Hour), LastRunAt: now.Add(-2 * time.Minute)}, false},
+		{"missed runs", Heartbeat{Interval: time.Minute, StartedAt: now.Add(-time.Hour), LastRunAt: now.Add(-4 * time.Minute)}, true},
+		{"just started, no runs yet", Heartbeat{Interval: time.Minute, StartedAt: now.Add(-time.Minute)}, false},
+		{"started long ago, never finished", Heartbeat{Interval: time.Minute, StartedAt: now.Add(-time.Hour)}, true},
+		{"run before a restart", Heartbeat{Interval: time.Minute, StartedAt: now.Add(-time.Minute), LastRunAt: now.Add(-time.Hour)}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.hb.Stale(now, 3); got != tt.want {
+			t.Errorf("%s: Stale = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
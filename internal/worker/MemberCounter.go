@@ -0,0 +1,134 @@
+package worker
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/RaikyD/UserSegmentationService/internal/metrics"
+	"github.com/RaikyD/UserSegmentationService/internal/models"
+	"github.com/RaikyD/UserSegmentationService/internal/service"
+	"github.com/RaikyD/UserSegmentationService/internal/storage"
+	"github.com/RaikyD/UserSegmentationService/internal/tenant"
+)
+
+// CountStats — состояние обновления метрики числа участников сегментов.
+type CountStats struct {
+	Interval  time.Duration `json:"interval"`
+	StartedAt time.Time     `json:"started_at"`
+	Runs      int64         `json:"runs"`
+	LastRunAt time.Time     `json:"last_run_at"`
+	Segments  int           `json:"segments"`
+	LastError string        `json:"last_error,omitempty"`
+}
+
+// MemberCounter периодически пересчитывает участников действующих сегментов
+// и выставляет их в метрику metrics.SegmentMembers.
+type MemberCounter struct {
+	segRepo  storage.SegmentRepository
+	svc      service.UserSegmentService
+	interval time.Duration
+	log      *slog.Logger
+
+	mu    sync.Mutex
+	stats CountStats
+}
+
+// NewMemberCounter создаёт счётчик. Запускается через Run.
+func NewMemberCounter(segRepo storage.SegmentRepository, svc service.UserSegmentService, interval time.Duration, logger *slog.Logger) *MemberCounter {
+	return &MemberCounter{
+		segRepo:  segRepo,
+		svc:      svc,
+		interval: interval,
+		log:      logger,
+		stats:    CountStats{Interval: interval},
+	}
+}
+
+// Run выполняет проходы раз в interval, пока не отменён ctx.
+func (c *MemberCounter) Run(ctx context.Context) {
+	c.mu.Lock()
+	c.stats.StartedAt = time.Now()
+	c.mu.Unlock()
+	c.log.Info("member counter started", "interval", c.interval)
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+	for {
+		c.Refresh(ctx)
+		select {
+		case <-ctx.Done():
+			c.log.Info("member counter stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+var countedTypes = []models.SegmentType{
+	models.SegmentTypeStatic,
+	models.SegmentTypeDynamic,
+	models.SegmentTypeDynamicRule,
+	models.SegmentTypeComposite,
+}
+
+// Refresh пересчитывает участников действующих сегментов всех арендаторов. Ряды удалённых
+// и выключенных сегментов пропадают из метрики. У dynamic_rule в БД только
+// явные привязки, поэтому для них считаются только они.
+func (c *MemberCounter) Refresh(ctx context.Context) {
+	start := time.Now()
+	counts := make(map[*models.Segment]int64)
+	var err error
+	for _, t := range countedTypes {
+		var segs []*models.Segment
+		if segs, err = c.segRepo.ListActiveByType(tenant.WithAll(ctx), t); err != nil {
+			break
+		}
+		for _, seg := range segs {
+			var n int64
+			if n, err = c.svc.CountSegmentMembers(tenant.With(ctx, seg.Tenant), seg); err != nil {
+				break
+			}
+			counts[seg] = n
+		}
+		if err != nil {
+			break
+		}
+	}
+
+	// При ошибке прежние значения остаются: неполный проход хуже устаревшего.
+	if err == nil {
+		metrics.SegmentMembers.Reset()
+		for seg, n := range counts {
+			metrics.SegmentMembers.WithLabelValues(seg.Tenant, seg.SegmentName, string(seg.Type)).Set(float64(n))
+		}
+	}
+
+	c.mu.Lock()
+	c.stats.Runs++
+	c.stats.LastRunAt = start
+	c.stats.LastError = ""
+	if err != nil {
+		c.stats.LastError = err.Error()
+	} else {
+		c.stats.Segments = len(counts)
+	}
+	c.mu.Unlock()
+
+	if err != nil {
+		c.log.Error("member count refresh failed", "error", err)
+	}
+}
+
+// Stats возвращает снимок статистики счётчика.
+func (c *MemberCounter) Stats() CountStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stats
+}
+
+// Heartbeat возвращает данные для проверки готовности: не завис ли проход.
+func (c *MemberCounter) Heartbeat() Heartbeat {
+	st := c.Stats()
+	return Heartbeat{Interval: st.Interval, StartedAt: st.StartedAt, LastRunAt: st.LastRunAt}
+}
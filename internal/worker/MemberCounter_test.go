@@ -0,0 +1,77 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/RaikyD/UserSegmentationService/internal/logging"
+	"github.com/RaikyD/UserSegmentationService/internal/metrics"
+	"github.com/RaikyD/UserSegmentationService/internal/models"
+	"github.com/RaikyD/UserSegmentationService/internal/service"
+	"github.com/RaikyD/UserSegmentationService/internal/storage"
+	"github.com/RaikyD/UserSegmentationService/internal/tenant"
+)
+
+// fakeActiveSegments отдаёт действующие сегменты по типу.
+type fakeActiveSegments struct {
+	storage.SegmentRepository
+	byType map[models.SegmentType][]*models.Segment
+}
+
+func (f *fakeActiveSegments) ListActiveByType(_ context.Context, t models.SegmentType) ([]*models.Segment, error) {
+	return f.byType[t], nil
+}
+
+// fakeCounts отдаёт число участников по арендатору и имени сегмента.
+type fakeCounts struct {
+	service.UserSegmentService
+	counts map[string]int64
+	err    error
+}
+
+func (f *fakeCounts) CountSegmentMembers(ctx context.Context, seg *models.Segment) (int64, error) {
+	return f.counts[tenant.FromContext(ctx)+"/"+seg.SegmentName], f.err
+}
+
+func TestMemberCounterRefresh(t *testing.T) {
+	segs := &fakeActiveSegments{byType: map[models.SegmentType][]*models.Segment{
+		models.SegmentTypeStatic: {
+			{Tenant: "default", SegmentName: "beta", Type: models.SegmentTypeStatic},
+			{Tenant: "acme", SegmentName: "beta", Type: models.SegmentTypeStatic},
+		},
+		models.SegmentTypeDynamic:   {{Tenant: "default", SegmentName: "rollout", Type: models.SegmentTypeDynamic}},
+		models.SegmentTypeComposite: {{Tenant: "default", SegmentName: "both", Type: models.SegmentTypeComposite}},
+	}}
+	svc := &fakeCounts{counts: map[string]int64{"default/beta": 3, "acme/beta": 9, "default/rollout": 70, "default/both": 2}}
+	c := NewMemberCounter(segs, svc, 0, logging.Discard())
+
+	metrics.SegmentMembers.WithLabelValues("default", "deleted", "static").Set(5)
+	c.Refresh(context.Background())
+	// Сегменты считаются от имени своих арендаторов.
+	if got := testutil.ToFloat64(metrics.SegmentMembers.WithLabelValues("acme", "beta", "static")); got != 9 {
+		t.Errorf("segment_members{acme/beta} = %v, want 9", got)
+	}
+	if got := testutil.ToFloat64(metrics.SegmentMembers.WithLabelValues("default", "rollout", "dynamic")); got != 70 {
+		t.Errorf("segment_members{rollout} = %v, want 70", got)
+	}
+	// Ряд удалённого сегмента пропадает.
+	if n := testutil.CollectAndCount(metrics.SegmentMembers); n != 4 {
+		t.Errorf("segment_members series = %d, want 4", n)
+	}
+	if stats := c.Stats(); stats.Runs != 1 || stats.Segments != 4 || stats.LastError != "" {
+		t.Errorf("stats = %+v", stats)
+	}
+
+	// Неудачный проход оставляет прежние значения.
+	svc.counts["default/beta"], svc.err = 100, errors.New("db down")
+	c.Refresh(context.Background())
+	if got := testutil.ToFloat64(metrics.SegmentMembers.WithLabelValues("default", "beta", "static")); got != 3 {
+		t.Errorf("segment_members{beta} after failed refresh = %v, want 3", got)
+	}
+	if stats := c.Stats(); stats.Runs != 2 || stats.LastError != "db down" {
+		t.Errorf("stats = %+v", stats)
+	}
+}
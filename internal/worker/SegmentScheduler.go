@@ -0,0 +1,101 @@
+package worker
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/RaikyD/UserSegmentationService/internal/storage"
+)
+
+// ScheduleStats — состояние планировщика окон действия сегментов.
+type ScheduleStats struct {
+	Interval         time.Duration `json:"interval"`
+	StartedAt        time.Time     `json:"started_at"`
+	Runs             int64         `json:"runs"`
+	LastRunAt        time.Time     `json:"last_run_at"`
+	TotalActivated   int64         `json:"total_activated"`
+	TotalDeactivated int64         `json:"total_deactivated"`
+	LastError        string        `json:"last_error,omitempty"`
+}
+
+// SegmentScheduler периодически переключает is_active сегментов на границах
+// valid_from/valid_to. Сами переключения журналируются в segment_schedule_events.
+type SegmentScheduler struct {
+	repo     storage.SegmentRepository
+	interval time.Duration
+	log      *slog.Logger
+
+	mu    sync.Mutex
+	stats ScheduleStats
+}
+
+// NewSegmentScheduler создаёт планировщик. Запускается через Run.
+func NewSegmentScheduler(repo storage.SegmentRepository, interval time.Duration, logger *slog.Logger) *SegmentScheduler {
+	return &SegmentScheduler{
+		repo:     repo,
+		interval: interval,
+		log:      logger,
+		stats:    ScheduleStats{Interval: interval},
+	}
+}
+
+// Run выполняет проходы раз в interval, пока не отменён ctx.
+func (s *SegmentScheduler) Run(ctx context.Context) {
+	s.mu.Lock()
+	s.stats.StartedAt = time.Now()
+	s.mu.Unlock()
+	s.log.Info("segment scheduler started", "interval", s.interval)
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		s.Tick(ctx)
+		select {
+		case <-ctx.Done():
+			s.log.Info("segment scheduler stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Tick выполняет один проход планировщика.
+func (s *SegmentScheduler) Tick(ctx context.Context) {
+	start := time.Now()
+	activated, deactivated, err := s.repo.ApplySchedule(ctx)
+
+	s.mu.Lock()
+	s.stats.Runs++
+	s.stats.LastRunAt = start
+	s.stats.TotalActivated += int64(len(activated))
+	s.stats.TotalDeactivated += int64(len(deactivated))
+	s.stats.LastError = ""
+	if err != nil {
+		s.stats.LastError = err.Error()
+	}
+	s.mu.Unlock()
+
+	for _, id := range activated {
+		s.log.Info("segment activated by schedule", "segment_id", id)
+	}
+	for _, id := range deactivated {
+		s.log.Info("segment deactivated by schedule", "segment_id", id)
+	}
+	if err != nil {
+		s.log.Error("segment scheduler tick failed", "error", err)
+	}
+}
+
+// Stats возвращает снимок статистики планировщика.
+func (s *SegmentScheduler) Stats() ScheduleStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stats
+}
+
+// Heartbeat возвращает данные для проверки готовности: не завис ли проход.
+func (s *SegmentScheduler) Heartbeat() Heartbeat {
+	st := s.Stats()
+	return Heartbeat{Interval: st.Interval, StartedAt: st.StartedAt, LastRunAt: st.LastRunAt}
+}
@@ -0,0 +1,25 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE users (
+  id          UUID        PRIMARY KEY,
+  attributes  JSONB       NOT NULL DEFAULT '{}'::jsonb,
+  created_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+  updated_at  TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+INSERT INTO users (id)
+SELECT DISTINCT user_id
+  FROM user_segment_assignment
+ON CONFLICT DO NOTHING;
+
+ALTER TABLE user_segment_assignment
+  ADD CONSTRAINT user_segment_assignment_user_fk
+      FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE user_segment_assignment
+  DROP CONSTRAINT IF EXISTS user_segment_assignment_user_fk;
+DROP TABLE IF EXISTS users;
+-- +goose StatementEnd
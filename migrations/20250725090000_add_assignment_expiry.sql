@@ -0,0 +1,16 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE user_segment_assignment
+  ADD COLUMN expires_at TIMESTAMPTZ;
+
+CREATE INDEX user_segment_assignment_expires_at_idx
+    ON user_segment_assignment (expires_at)
+ WHERE expires_at IS NOT NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS user_segment_assignment_expires_at_idx;
+ALTER TABLE user_segment_assignment
+  DROP COLUMN IF EXISTS expires_at;
+-- +goose StatementEnd
@@ -0,0 +1,29 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE segments
+  ADD COLUMN valid_from TIMESTAMPTZ,
+  ADD COLUMN valid_to   TIMESTAMPTZ,
+  ADD CONSTRAINT segments_validity_check
+      CHECK (valid_from IS NULL OR valid_to IS NULL OR valid_from < valid_to);
+
+CREATE TABLE segment_schedule_events (
+  id          BIGSERIAL   PRIMARY KEY,
+  segment_id  UUID        NOT NULL
+      REFERENCES segments(id)
+          ON DELETE CASCADE,
+  is_active   BOOLEAN     NOT NULL,
+  changed_at  TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX segment_schedule_events_segment_idx
+    ON segment_schedule_events (segment_id, changed_at DESC);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS segment_schedule_events;
+ALTER TABLE segments
+  DROP CONSTRAINT IF EXISTS segments_validity_check,
+  DROP COLUMN IF EXISTS valid_to,
+  DROP COLUMN IF EXISTS valid_from;
+-- +goose StatementEnd
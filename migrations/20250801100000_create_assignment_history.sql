@@ -0,0 +1,86 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE user_segment_history (
+    id          BIGSERIAL    PRIMARY KEY,
+    segment_id  UUID         NOT NULL,
+    user_id     UUID         NOT NULL,
+    operation   TEXT         NOT NULL
+     CHECK (operation IN ('assign','unassign')),
+    source      TEXT         NOT NULL
+     CHECK (source IN ('manual','auto','rule','import')),
+    actor       TEXT         NOT NULL DEFAULT 'system',
+    expires_at  TIMESTAMPTZ,
+    occurred_at TIMESTAMPTZ  NOT NULL DEFAULT now()
+);
+
+CREATE INDEX user_segment_history_user_idx
+    ON user_segment_history (user_id, occurred_at);
+CREATE INDEX user_segment_history_occurred_idx
+    ON user_segment_history (occurred_at);
+
+-- Текущие привязки становятся стартовыми событиями истории.
+INSERT INTO user_segment_history
+    (segment_id, user_id, operation, source, actor, expires_at, occurred_at)
+SELECT segment_id, user_id, 'assign', assignment_type, 'system', expires_at, assigned_at
+  FROM user_segment_assignment;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+-- Журнал пишется триггером, поэтому в него попадают и каскадные удаления
+-- (удаление сегмента или пользователя), и чистка истёкших привязок.
+-- Актор и источник изменения передаются через локальные настройки транзакции
+-- app.actor / app.source; без них изменение считается системным.
+CREATE FUNCTION record_user_segment_history() RETURNS trigger AS $$
+DECLARE
+    v_actor  TEXT := COALESCE(NULLIF(current_setting('app.actor', true), ''), 'system');
+    v_source TEXT := NULLIF(current_setting('app.source', true), '');
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        IF OLD.expires_at IS NOT NULL AND OLD.expires_at <= now() THEN
+            INSERT INTO user_segment_history
+                (segment_id, user_id, operation, source, actor, occurred_at)
+            VALUES (OLD.segment_id, OLD.user_id, 'unassign', 'auto', v_actor, OLD.expires_at);
+        ELSE
+            INSERT INTO user_segment_history
+                (segment_id, user_id, operation, source, actor)
+            VALUES (OLD.segment_id, OLD.user_id, 'unassign', COALESCE(v_source, 'auto'), v_actor);
+        END IF;
+        RETURN OLD;
+    END IF;
+
+    INSERT INTO user_segment_history
+        (segment_id, user_id, operation, source, actor, expires_at, occurred_at)
+    VALUES (NEW.segment_id, NEW.user_id, 'assign', COALESCE(v_source, NEW.assignment_type),
+            v_actor, NEW.expires_at, NEW.assigned_at);
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TRIGGER user_segment_assignment_history
+AFTER INSERT OR UPDATE OR DELETE ON user_segment_assignment
+FOR EACH ROW EXECUTE FUNCTION record_user_segment_history();
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE FUNCTION forbid_history_modification() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'user_segment_history is append-only';
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TRIGGER user_segment_history_append_only
+BEFORE UPDATE OR DELETE ON user_segment_history
+FOR EACH ROW EXECUTE FUNCTION forbid_history_modification();
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TRIGGER IF EXISTS user_segment_assignment_history ON user_segment_assignment;
+DROP TABLE IF EXISTS user_segment_history;
+DROP FUNCTION IF EXISTS record_user_segment_history();
+DROP FUNCTION IF EXISTS forbid_history_modification();
+-- +goose StatementEnd
@@ -0,0 +1,31 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Постраничные выборки идут по ключу, поэтому нужны индексы в порядке сортировки.
+CREATE INDEX segments_created_on_id_idx
+    ON segments (created_on, id);
+
+CREATE INDEX segments_segment_name_pattern_idx
+    ON segments (segment_name text_pattern_ops);
+
+CREATE INDEX user_segment_assignment_user_segment_idx
+    ON user_segment_assignment (user_id, segment_id);
+
+-- rollout_bucket повторяет rollout.Bucket: первые 8 байт sha256(salt ":" uuid)
+-- как беззнаковое число по модулю 10000. Позволяет отбирать участников
+-- dynamic-сегмента прямо в SQL.
+CREATE FUNCTION rollout_bucket(salt TEXT, user_id UUID) RETURNS INTEGER
+LANGUAGE sql IMMUTABLE STRICT PARALLEL SAFE AS $$
+  SELECT mod(CASE WHEN h < 0 THEN h::numeric + 18446744073709551616 ELSE h::numeric END, 10000)::integer
+    FROM (
+      SELECT ('x' || encode(substring(sha256(convert_to(salt || ':', 'UTF8') || uuid_send(user_id)) FROM 1 FOR 8), 'hex'))::bit(64)::bigint AS h
+    ) AS hashed
+$$;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP FUNCTION IF EXISTS rollout_bucket(TEXT, UUID);
+DROP INDEX IF EXISTS user_segment_assignment_user_segment_idx;
+DROP INDEX IF EXISTS segments_segment_name_pattern_idx;
+DROP INDEX IF EXISTS segments_created_on_id_idx;
+-- +goose StatementEnd
@@ -0,0 +1,16 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE segments
+  DROP CONSTRAINT segments_type_check,
+  ADD CONSTRAINT segments_type_check
+      CHECK (type IN ('static','dynamic','dynamic_rule','composite'));
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM segments WHERE type = 'composite';
+ALTER TABLE segments
+  DROP CONSTRAINT segments_type_check,
+  ADD CONSTRAINT segments_type_check
+      CHECK (type IN ('static','dynamic','dynamic_rule'));
+-- +goose StatementEnd
@@ -0,0 +1,23 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Каждое изменение и удаление сегмента рассылается в канал segments_changed,
+-- чтобы реплики сбрасывали его из кэша. Триггер ловит и изменения в обход
+-- репозитория, например переключения планировщика.
+CREATE FUNCTION notify_segment_changed() RETURNS trigger
+LANGUAGE plpgsql AS $$
+BEGIN
+  PERFORM pg_notify('segments_changed', OLD.id::text);
+  RETURN NULL;
+END;
+$$;
+
+CREATE TRIGGER segments_notify_changed
+AFTER UPDATE OR DELETE ON segments
+FOR EACH ROW EXECUTE FUNCTION notify_segment_changed();
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TRIGGER IF EXISTS segments_notify_changed ON segments;
+DROP FUNCTION IF EXISTS notify_segment_changed();
+-- +goose StatementEnd
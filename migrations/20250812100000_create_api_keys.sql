@@ -0,0 +1,18 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Ключи хранятся только в виде sha256, сам ключ показывается один раз при выпуске.
+CREATE TABLE api_keys (
+    id          UUID         PRIMARY KEY DEFAULT gen_random_uuid(),
+    name        TEXT         NOT NULL UNIQUE,
+    key_hash    BYTEA        NOT NULL UNIQUE,
+    roles       TEXT[]       NOT NULL
+     CHECK (roles <@ ARRAY['reader','assigner','segment-admin']::TEXT[]),
+    created_at  TIMESTAMPTZ  NOT NULL DEFAULT now(),
+    revoked_at  TIMESTAMPTZ
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS api_keys;
+-- +goose StatementEnd
@@ -0,0 +1,48 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE segment_history (
+    id           BIGSERIAL    PRIMARY KEY,
+    segment_id   UUID         NOT NULL,
+    segment_name TEXT         NOT NULL,
+    operation    TEXT         NOT NULL
+      CHECK (operation IN ('create','update','delete')),
+    actor        TEXT         NOT NULL DEFAULT 'system',
+    occurred_at  TIMESTAMPTZ  NOT NULL DEFAULT now()
+);
+
+CREATE INDEX segment_history_segment_idx
+    ON segment_history (segment_id, occurred_at);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+-- Актор передаётся так же, как для user_segment_history: через app.actor.
+-- Переключения планировщика попадают в журнал как изменения актора system.
+CREATE FUNCTION record_segment_history() RETURNS trigger AS $$
+DECLARE
+    v_actor TEXT := COALESCE(NULLIF(current_setting('app.actor', true), ''), 'system');
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        INSERT INTO segment_history (segment_id, segment_name, operation, actor)
+        VALUES (OLD.id, OLD.segment_name, 'delete', v_actor);
+        RETURN OLD;
+    END IF;
+    INSERT INTO segment_history (segment_id, segment_name, operation, actor)
+    VALUES (NEW.id, NEW.segment_name,
+            CASE TG_OP WHEN 'INSERT' THEN 'create' ELSE 'update' END, v_actor);
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TRIGGER segments_history
+AFTER INSERT OR UPDATE OR DELETE ON segments
+FOR EACH ROW EXECUTE FUNCTION record_segment_history();
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TRIGGER IF EXISTS segments_history ON segments;
+DROP FUNCTION IF EXISTS record_segment_history();
+DROP TABLE IF EXISTS segment_history;
+-- +goose StatementEnd
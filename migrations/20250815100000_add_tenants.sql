@@ -0,0 +1,179 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Все существующие данные принадлежат арендатору default.
+ALTER TABLE segments
+  ADD COLUMN tenant TEXT NOT NULL DEFAULT 'default';
+ALTER TABLE segments
+  ALTER COLUMN tenant DROP DEFAULT;
+
+-- Имена уникальны в пределах арендатора. Пара (id, tenant) нужна внешнему ключу
+-- привязок: привязка не может ссылаться на сегмент чужого арендатора.
+ALTER TABLE segments
+  DROP CONSTRAINT segments_segment_name_key;
+ALTER TABLE segments
+  ADD CONSTRAINT segments_tenant_segment_name_key UNIQUE (tenant, segment_name);
+ALTER TABLE segments
+  ADD CONSTRAINT segments_id_tenant_key UNIQUE (id, tenant);
+
+DROP INDEX IF EXISTS segments_segment_name_pattern_idx;
+CREATE INDEX segments_tenant_segment_name_pattern_idx
+    ON segments (tenant, segment_name text_pattern_ops);
+DROP INDEX IF EXISTS segments_created_on_id_idx;
+CREATE INDEX segments_tenant_created_on_id_idx
+    ON segments (tenant, created_on, id);
+
+ALTER TABLE user_segment_assignment
+  ADD COLUMN tenant TEXT;
+UPDATE user_segment_assignment a
+   SET tenant = s.tenant
+  FROM segments s
+ WHERE s.id = a.segment_id;
+ALTER TABLE user_segment_assignment
+  ALTER COLUMN tenant SET NOT NULL;
+ALTER TABLE user_segment_assignment
+  DROP CONSTRAINT user_segment_assignment_segment_id_fkey;
+ALTER TABLE user_segment_assignment
+  ADD CONSTRAINT user_segment_assignment_segment_tenant_fkey
+      FOREIGN KEY (segment_id, tenant) REFERENCES segments (id, tenant) ON DELETE CASCADE;
+
+CREATE INDEX user_segment_assignment_tenant_user_idx
+    ON user_segment_assignment (tenant, user_id);
+
+-- Журналы пишутся триггерами; старые события относятся к default.
+ALTER TABLE user_segment_history
+  ADD COLUMN tenant TEXT NOT NULL DEFAULT 'default';
+ALTER TABLE segment_history
+  ADD COLUMN tenant TEXT NOT NULL DEFAULT 'default';
+
+-- Ключ без арендатора действует для всех арендаторов.
+ALTER TABLE api_keys
+  ADD COLUMN tenant TEXT;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION record_user_segment_history() RETURNS trigger AS $$
+DECLARE
+    v_actor  TEXT := COALESCE(NULLIF(current_setting('app.actor', true), ''), 'system');
+    v_source TEXT := NULLIF(current_setting('app.source', true), '');
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        IF OLD.expires_at IS NOT NULL AND OLD.expires_at <= now() THEN
+            INSERT INTO user_segment_history
+                (tenant, segment_id, user_id, operation, source, actor, occurred_at)
+            VALUES (OLD.tenant, OLD.segment_id, OLD.user_id, 'unassign', 'auto', v_actor, OLD.expires_at);
+        ELSE
+            INSERT INTO user_segment_history
+                (tenant, segment_id, user_id, operation, source, actor)
+            VALUES (OLD.tenant, OLD.segment_id, OLD.user_id, 'unassign', COALESCE(v_source, 'auto'), v_actor);
+        END IF;
+        RETURN OLD;
+    END IF;
+
+    INSERT INTO user_segment_history
+        (tenant, segment_id, user_id, operation, source, actor, expires_at, occurred_at)
+    VALUES (NEW.tenant, NEW.segment_id, NEW.user_id, 'assign', COALESCE(v_source, NEW.assignment_type),
+            v_actor, NEW.expires_at, NEW.assigned_at);
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION record_segment_history() RETURNS trigger AS $$
+DECLARE
+    v_actor TEXT := COALESCE(NULLIF(current_setting('app.actor', true), ''), 'system');
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        INSERT INTO segment_history (tenant, segment_id, segment_name, operation, actor)
+        VALUES (OLD.tenant, OLD.id, OLD.segment_name, 'delete', v_actor);
+        RETURN OLD;
+    END IF;
+    INSERT INTO segment_history (tenant, segment_id, segment_name, operation, actor)
+    VALUES (NEW.tenant, NEW.id, NEW.segment_name,
+            CASE TG_OP WHEN 'INSERT' THEN 'create' ELSE 'update' END, v_actor);
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION record_segment_history() RETURNS trigger AS $$
+DECLARE
+    v_actor TEXT := COALESCE(NULLIF(current_setting('app.actor', true), ''), 'system');
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        INSERT INTO segment_history (segment_id, segment_name, operation, actor)
+        VALUES (OLD.id, OLD.segment_name, 'delete', v_actor);
+        RETURN OLD;
+    END IF;
+    INSERT INTO segment_history (segment_id, segment_name, operation, actor)
+    VALUES (NEW.id, NEW.segment_name,
+            CASE TG_OP WHEN 'INSERT' THEN 'create' ELSE 'update' END, v_actor);
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION record_user_segment_history() RETURNS trigger AS $$
+DECLARE
+    v_actor  TEXT := COALESCE(NULLIF(current_setting('app.actor', true), ''), 'system');
+    v_source TEXT := NULLIF(current_setting('app.source', true), '');
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        IF OLD.expires_at IS NOT NULL AND OLD.expires_at <= now() THEN
+            INSERT INTO user_segment_history
+                (segment_id, user_id, operation, source, actor, occurred_at)
+            VALUES (OLD.segment_id, OLD.user_id, 'unassign', 'auto', v_actor, OLD.expires_at);
+        ELSE
+            INSERT INTO user_segment_history
+                (segment_id, user_id, operation, source, actor)
+            VALUES (OLD.segment_id, OLD.user_id, 'unassign', COALESCE(v_source, 'auto'), v_actor);
+        END IF;
+        RETURN OLD;
+    END IF;
+
+    INSERT INTO user_segment_history
+        (segment_id, user_id, operation, source, actor, expires_at, occurred_at)
+    VALUES (NEW.segment_id, NEW.user_id, 'assign', COALESCE(v_source, NEW.assignment_type),
+            v_actor, NEW.expires_at, NEW.assigned_at);
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE api_keys
+  DROP COLUMN IF EXISTS tenant;
+ALTER TABLE segment_history
+  DROP COLUMN IF EXISTS tenant;
+ALTER TABLE user_segment_history
+  DROP COLUMN IF EXISTS tenant;
+
+DROP INDEX IF EXISTS user_segment_assignment_tenant_user_idx;
+ALTER TABLE user_segment_assignment
+  DROP CONSTRAINT IF EXISTS user_segment_assignment_segment_tenant_fkey;
+ALTER TABLE user_segment_assignment
+  ADD CONSTRAINT user_segment_assignment_segment_id_fkey
+      FOREIGN KEY (segment_id) REFERENCES segments (id) ON DELETE CASCADE;
+ALTER TABLE user_segment_assignment
+  DROP COLUMN IF EXISTS tenant;
+
+DROP INDEX IF EXISTS segments_tenant_created_on_id_idx;
+CREATE INDEX segments_created_on_id_idx
+    ON segments (created_on, id);
+DROP INDEX IF EXISTS segments_tenant_segment_name_pattern_idx;
+CREATE INDEX segments_segment_name_pattern_idx
+    ON segments (segment_name text_pattern_ops);
+
+-- Откат не удастся, если у разных арендаторов есть сегменты с одинаковыми именами.
+ALTER TABLE segments
+  DROP CONSTRAINT IF EXISTS segments_id_tenant_key;
+ALTER TABLE segments
+  DROP CONSTRAINT IF EXISTS segments_tenant_segment_name_key;
+ALTER TABLE segments
+  ADD CONSTRAINT segments_segment_name_key UNIQUE (segment_name);
+ALTER TABLE segments
+  DROP COLUMN IF EXISTS tenant;
+-- +goose StatementEnd
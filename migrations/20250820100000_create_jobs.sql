@@ -0,0 +1,26 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Состояние фоновых задач (отчёты, импорты). Задачу выполняет запустившая её
+-- реплика и периодически обновляет updated_at; читать состояние может любая.
+CREATE TABLE jobs (
+    id           UUID         PRIMARY KEY,
+    kind         TEXT         NOT NULL,
+    tenant       TEXT         NOT NULL,
+    status       TEXT         NOT NULL
+     CHECK (status IN ('pending', 'running', 'done', 'failed')),
+    processed    BIGINT       NOT NULL DEFAULT 0,
+    total        BIGINT       NOT NULL DEFAULT 0,
+    error        TEXT         NOT NULL DEFAULT '',
+    result       JSONB,
+    created_at   TIMESTAMPTZ  NOT NULL,
+    updated_at   TIMESTAMPTZ  NOT NULL,
+    finished_at  TIMESTAMPTZ
+);
+
+CREATE INDEX jobs_updated_at_idx ON jobs (updated_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS jobs;
+-- +goose StatementEnd
@@ -0,0 +1,31 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Ссылки выражений composite-сегментов на другие сегменты. Внешние ключи не дают
+-- удалить сегмент, на который ссылается composite, и сослаться на удалённый,
+-- даже если удаление и сохранение выражения идут параллельно.
+CREATE TABLE segment_refs (
+    tenant    TEXT NOT NULL,
+    parent_id UUID NOT NULL,
+    child_id  UUID NOT NULL,
+    PRIMARY KEY (parent_id, child_id),
+    CONSTRAINT segment_refs_parent_fkey
+        FOREIGN KEY (parent_id, tenant) REFERENCES segments (id, tenant) ON DELETE CASCADE,
+    CONSTRAINT segment_refs_child_fkey
+        FOREIGN KEY (child_id, tenant) REFERENCES segments (id, tenant) ON DELETE RESTRICT
+);
+
+CREATE INDEX segment_refs_child_idx
+    ON segment_refs (child_id);
+
+INSERT INTO segment_refs (tenant, parent_id, child_id)
+SELECT DISTINCT s.tenant, s.id, c.id
+  FROM segments s
+ CROSS JOIN LATERAL jsonb_path_query(s.config, 'strict $.**.segment') AS ref
+  JOIN segments c ON c.id = (ref #>> '{}')::uuid AND c.tenant = s.tenant
+ WHERE s.type = 'composite';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS segment_refs;
+-- +goose StatementEnd
@@ -0,0 +1,10 @@
+// Package migrations встраивает SQL-миграции схемы в бинарник, чтобы сервису
+// не нужен был каталог migrations рядом с исполняемым файлом.
+package migrations
+
+import "embed"
+
+// FS содержит файлы миграций goose.
+//
+//go:embed *.sql
+var FS embed.FS